@@ -1,6 +1,6 @@
 module main
 
-go 1.19
+go 1.21
 
 replace github.com/srmadden/godb => ./godb
 
@@ -1,7 +1,10 @@
 package godb
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
 )
 
 type Aggregator struct {
@@ -14,6 +17,10 @@ type Aggregator struct {
 	newAggState []AggState
 
 	child Operator // the child operator for the inputs to aggregate
+
+	// Maximum number of groups kept in memory, after which tuples of new
+	// groups are partitioned to temporary files
+	maxBufferSize int
 }
 
 type AggType int
@@ -27,12 +34,12 @@ const DefaultGroup int = 0 // for handling the case of no group-by
 
 // Constructor for an aggregator with a group-by
 func NewGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
-	return &Aggregator{groupByFields, emptyAggState, child}
+	return &Aggregator{groupByFields, emptyAggState, child, HashBufferSize}
 }
 
 // Constructor for an aggregator with no group-by
 func NewAggregator(emptyAggState []AggState, child Operator) *Aggregator {
-	return &Aggregator{nil, emptyAggState, child}
+	return &Aggregator{nil, emptyAggState, child, HashBufferSize}
 }
 
 // Return a TupleDescriptor for this aggregation. If the aggregator has no group-by, the
@@ -60,14 +67,33 @@ func (a *Aggregator) Descriptor() *TupleDesc {
 	return td
 }
 
+// Describe the aggregates and group by expressions of the aggregator
+func (a *Aggregator) DescribePlan() (*PlanDescription, []Operator) {
+	aggs := make([]string, len(a.newAggState))
+	for i, agg := range a.newAggState {
+		aggs[i] = fmt.Sprintf("%s(%s)", reflect.TypeOf(agg).Elem().Name(), agg.GetTupleDesc().HeaderString(false))
+	}
+	return newPlanDescription("Aggregate", "aggregates", strings.Join(aggs, ", "), "group by", describeExprs(a.groupByFields)), []Operator{a.child}
+}
+
 // Aggregate operator implementation: This function should iterate over the results of
 // the aggregate. The aggregate should be the result of aggregating each group's tuples
 // and the iterator should iterate through each group's result. In the case where there
 // is no group-by, the iterator simply iterates through only one tuple, representing the
 // aggregation of all child tuples.
-func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+//
+// Groups are kept in a hash table keyed by the encoding of their group by
+// values (see [appendTupleKey]), so distinct groups are never merged.  If
+// there are more than maxBufferSize groups, or the groups would exceed the
+// query's memory limit (see [MemoryTracker]), the tuples of groups that are
+// not in the table are instead written to temporary files partitioned by the
+// hash of their group key, so that all of a group's tuples go to the same
+// partition.  Each partition is then aggregated separately (recursively
+// partitioning it if it is too large) once the groups in memory have been
+// output.
+func (a *Aggregator) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	// the child iterator
-	childIter, err := a.child.Iterator(tid)
+	childIter, err := a.child.Iterator(ctx, tid)
 	if err != nil {
 		return nil, err
 	}
@@ -75,71 +101,181 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 		return nil, GoDBError{MalformedDataError, "child iter unexpectedly nil"}
 
 	}
-	// the map that stores the aggregation state of each group
-	aggState := make(map[any]*[]AggState)
 	if a.groupByFields == nil {
-		var newAggState []AggState
-		for _, as := range a.newAggState {
-			copy := as.Copy()
-			if copy == nil {
-				return nil, GoDBError{MalformedDataError, "aggState Copy unexpectedly returned nil"}
-			}
-			newAggState = append(newAggState, copy)
-		}
+		return a.ungroupedIterator(childIter)
+	}
 
-		aggState[DefaultGroup] = &newAggState
+	var pending []*hashPartition
+	closePending := func() {
+		for _, p := range pending {
+			p.file.close()
+		}
+		pending = nil
 	}
-	// the list of group key tuples
-	var groupByList []*Tuple
+	var part *hashPartition
+	input, level := childIter, 0
+	mem := newMemoryAccount(ctx, "Aggregate")
 	// the iterator for iterating thru the finalized aggregation results for each group
 	var finalizedIter func() (*Tuple, error)
+	return closeOnCancel(ctx, func() (*Tuple, error) {
+		for {
+			if finalizedIter == nil {
+				groupByList, err := a.aggregateGroups(input, level, &pending, mem)
+				if err != nil {
+					mem.release()
+					if part != nil {
+						part.file.close()
+					}
+					closePending()
+					return nil, err
+				}
+				finalizedIter = getFinalizedTuplesIterator(a, groupByList)
+			}
+			if t, err := finalizedIter(); t != nil || err != nil {
+				return t, err
+			}
+			mem.release()
+			if part != nil {
+				part.file.close()
+				part = nil
+			}
+			if len(pending) == 0 {
+				return nil, nil
+			}
+			part, pending = pending[0], pending[1:]
+			input, err = part.file.Iterator()
+			if err != nil {
+				part.file.close()
+				closePending()
+				return nil, err
+			}
+			level = part.level
+			finalizedIter = nil
+		}
+	}, func() {
+		mem.release()
+		if part != nil {
+			part.file.close()
+			part = nil
+		}
+		closePending()
+	}), nil
+}
+
+// Iterator for an aggregator with no group-by, which returns one tuple
+// aggregating all of the child tuples.
+func (a *Aggregator) ungroupedIterator(childIter func() (*Tuple, error)) (func() (*Tuple, error), error) {
+	var aggState []AggState
+	for _, as := range a.newAggState {
+		copy := as.Copy()
+		if copy == nil {
+			return nil, GoDBError{MalformedDataError, "aggState Copy unexpectedly returned nil"}
+		}
+		aggState = append(aggState, copy)
+	}
+	done := false
 	return func() (*Tuple, error) {
+		if done {
+			return nil, nil
+		}
 		// iterates thru all child tuples
-		for t, err := childIter(); t != nil || err != nil; t, err = childIter() {
+		for {
+			t, err := childIter()
 			if err != nil {
 				return nil, err
 			}
 			if t == nil {
-				return nil, nil
+				break
+			}
+			for _, as := range aggState {
+				as.AddTuple(t)
 			}
+		}
+		done = true
+		var tup *Tuple
+		for _, as := range aggState {
+			tup = joinTuples(tup, as.Finalize())
+		}
+		return tup, nil
+	}, nil
+}
 
-			if a.groupByFields == nil { // adds tuple to the aggregation in the case of no group-by
-				for i := 0; i < len(a.newAggState); i++ {
-					(*aggState[DefaultGroup])[i].AddTuple(t)
+// aggGroup holds the group key tuple and aggregation states of one group
+type aggGroup struct {
+	key    *Tuple
+	states []AggState
+}
 
-				}
-			} else { // adds tuple to the aggregation with grouping
-				keygenTup, err := extractGroupByKeyTuple(a, t)
+// Aggregate the tuples of iter, which are at the given level of partitioning,
+// returning the groups in the order they were first seen.  Tuples of groups
+// that don't fit in memory are written to new partitions, which are added to
+// pending.  The memory of the groups is charged to mem.
+func (a *Aggregator) aggregateGroups(iter func() (*Tuple, error), level int, pending *[]*hashPartition, mem *memoryAccount) ([]*aggGroup, error) {
+	table := make(map[string]*aggGroup)
+	var groupByList []*aggGroup
+	var key []byte
+	var parts []*hashPartition
+	closeParts := func() {
+		for _, p := range parts {
+			p.file.close()
+		}
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			closeParts()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		keygenTup, err := extractGroupByKeyTuple(a, t)
+		if err != nil {
+			closeParts()
+			return nil, err
+		}
+		key = appendTupleKey(key[:0], keygenTup.Fields)
+		group := table[string(key)]
+		if group == nil && level >= maxPartitionDepth {
+			if err := mem.reserve(groupMemorySize(keygenTup, key, len(a.newAggState))); err != nil {
+				closeParts()
+				return nil, err
+			}
+		} else if group == nil && (len(groupByList) >= a.maxBufferSize || !mem.tryReserve(groupMemorySize(keygenTup, key, len(a.newAggState)))) {
+			if parts == nil {
+				parts, err = newHashPartitions(a.child.Descriptor(), level+1)
 				if err != nil {
 					return nil, err
 				}
-
-				key := keygenTup.tupleKey()
-				if aggState[key] == nil {
-					asNew := make([]AggState, len(a.newAggState))
-					aggState[key] = &asNew
-					groupByList = append(groupByList, keygenTup)
-				}
-
-				addTupleToGrpAggState(a, t, aggState[key])
 			}
-		}
-
-		if finalizedIter == nil { // builds the iterator for iterating thru the finalized aggregation results for each group
-			if a.groupByFields == nil {
-				var tup *Tuple
-				for i := 0; i < len(a.newAggState); i++ {
-					newTup := (*aggState[DefaultGroup])[i].Finalize()
-					tup = joinTuples(tup, newTup)
-				}
-				finalizedIter = func() (*Tuple, error) { return nil, nil }
-				return tup, nil
-			} else {
-				finalizedIter = getFinalizedTuplesIterator(a, groupByList, aggState)
+			p := parts[hashKey(key, uint64(level+1))%hashPartitions]
+			if err := p.file.append(t); err != nil {
+				closeParts()
+				return nil, err
 			}
+			continue
 		}
-		return finalizedIter()
-	}, nil
+		if group == nil {
+			group = &aggGroup{keygenTup, make([]AggState, len(a.newAggState))}
+			table[string(key)] = group
+			groupByList = append(groupByList, group)
+		}
+		addTupleToGrpAggState(a, t, &group.states)
+	}
+	for _, p := range parts {
+		if p.file.numTuples == 0 {
+			p.file.close()
+		} else {
+			*pending = append(*pending, p)
+		}
+	}
+	return groupByList, nil
+}
+
+// Estimate of the memory used by a group with the given key tuple and key
+// encoding, including its hash table entry and its n aggregate states
+func groupMemorySize(keyTup *Tuple, key []byte, n int) int64 {
+	return tupleMemorySize(keyTup) + keyMemorySize(len(key)) + int64(64*n)
 }
 
 // Given a tuple t from a child iterator, return a tuple that identifies t's group.
@@ -187,33 +323,22 @@ func addTupleToGrpAggState(a *Aggregator, t *Tuple, grpAggState *[]AggState) {
 // HINT: you can call [aggState.Finalize()] to get the field for each AggState.
 // Then, you should get the groupByTuple and merge it with each of the AggState tuples using the
 // joinTuples function in tuple.go you wrote in lab 1.
-func getFinalizedTuplesIterator(a *Aggregator, groupByList []*Tuple, aggState map[any]*[]AggState) func() (*Tuple, error) {
+func getFinalizedTuplesIterator(a *Aggregator, groupByList []*aggGroup) func() (*Tuple, error) {
 	curGbyTuple := 0 // "captured" counter to track the current tuple we are iterating over
 	td := a.Descriptor()
 	return func() (*Tuple, error) {
-		for {
-			if curGbyTuple < len(groupByList) {
-				gbyTuple := groupByList[curGbyTuple]
-				key := gbyTuple.tupleKey()
-				curGbyTuple += 1
-
-				aggStates := aggState[key]
-				if aggStates == nil {
-					continue
-				}
-				for _, aggState := range *aggStates {
-					tuple := aggState.Finalize()
-					// tuple = tuple{Desc: td} // add descriptor?
-					joinedTup := joinTuples(gbyTuple, tuple)
-					joinedTup.Desc = *td
-					return joinedTup, nil
-				}
-			} else {
-				break
-			}
+		if curGbyTuple == len(groupByList) {
+			return nil, nil
 		}
-		// curGbyTuple = 0
-		return nil, errors.New("end")
-
+		group := groupByList[curGbyTuple]
+		curGbyTuple += 1
+		// copy the group by fields so that joining the aggregate
+		// results never appends into the group key tuple itself
+		joinedTup := &Tuple{Fields: append([]DBValue{}, group.key.Fields...)}
+		for _, aggState := range group.states {
+			joinedTup = joinTuples(joinedTup, aggState.Finalize())
+		}
+		joinedTup.Desc = *td
+		return joinedTup, nil
 	}
 }
@@ -1,19 +1,20 @@
 package godb
 
 import (
+	"context"
 	"testing"
 )
 
 func TestSimpleSumAgg(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
 
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	sa := SumAggState[int64]{}
 	expr := FieldExpr{t1.Desc.Fields[1]}
 	sa.Init("sum", &expr, intAggGetter)
 	agg := NewAggregator([]AggState{&sa}, hf)
-	iter, err := agg.Iterator(tid)
+	iter, err := agg.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -33,15 +34,35 @@ func TestSimpleSumAgg(t *testing.T) {
 	}
 }
 
+// AVG divides the sum of the values by their count, rather than rounding a
+// running average down as each value is added
+func TestAvgAgg(t *testing.T) {
+	td, _, _, _, _, _ := makeTestVars()
+	age := FieldExpr{td.Fields[1]}
+	avg := &AvgAggState[int64]{}
+	if err := avg.Init("avg", &age, intAggGetter); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if v := avg.Finalize().Fields[0].(IntField).Value; v != 0 {
+		t.Errorf("expected average of no values to be 0, got %d", v)
+	}
+	for _, v := range []int64{0, 3, 3} {
+		avg.AddTuple(&Tuple{td, []DBValue{StringField{"sam"}, IntField{v}}, nil})
+	}
+	if v := avg.Finalize().Fields[0].(IntField).Value; v != 2 {
+		t.Errorf("expected average of 0, 3 and 3 to be 2, got %d", v)
+	}
+}
+
 func TestMinStringAgg(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	sa := MinAggState[string]{}
 	expr := FieldExpr{t1.Desc.Fields[0]}
 	sa.Init("min", &expr, stringAggGetter)
 	agg := NewAggregator([]AggState{&sa}, hf)
-	iter, err := agg.Iterator(tid)
+	iter, err := agg.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -63,13 +84,13 @@ func TestMinStringAgg(t *testing.T) {
 
 func TestSimpleCountAgg(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	sa := CountAggState{}
 	expr := FieldExpr{t1.Desc.Fields[0]}
 	sa.Init("count", &expr, nil)
 	agg := NewAggregator([]AggState{&sa}, hf)
-	iter, err := agg.Iterator(tid)
+	iter, err := agg.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -91,8 +112,8 @@ func TestSimpleCountAgg(t *testing.T) {
 
 func TestMultiAgg(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	ca := CountAggState{}
 	expr := FieldExpr{t1.Desc.Fields[0]}
 	ca.Init("count", &expr, nil)
@@ -101,7 +122,7 @@ func TestMultiAgg(t *testing.T) {
 	sa.Init("sum", &expr, intAggGetter)
 
 	agg := NewAggregator([]AggState{&ca, &sa}, hf)
-	iter, err := agg.Iterator(tid)
+	iter, err := agg.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -128,10 +149,10 @@ func TestMultiAgg(t *testing.T) {
 
 func TestGbyCountAgg(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
-	hf.insertTuple(&t2, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 
 	gbyFields := []Expr{&FieldExpr{hf.Descriptor().Fields[0]}}
 	sa := CountAggState{}
@@ -139,7 +160,7 @@ func TestGbyCountAgg(t *testing.T) {
 	sa.Init("count", &expr, nil)
 
 	agg := NewGroupedAggregator([]AggState{&sa}, gbyFields, hf)
-	iter, _ := agg.Iterator(tid)
+	iter, _ := agg.Iterator(context.Background(), tid)
 	fields := []FieldType{
 		{"name", "", StringType},
 		{"count", "", IntType},
@@ -168,10 +189,10 @@ func TestGbyCountAgg(t *testing.T) {
 
 func TestGbySumAgg(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	//gbyFields := hf.td.Fields[0:1]
 	gbyFields := []Expr{&FieldExpr{hf.Descriptor().Fields[0]}}
 
@@ -180,7 +201,7 @@ func TestGbySumAgg(t *testing.T) {
 	sa.Init("sum", &expr, intAggGetter)
 
 	agg := NewGroupedAggregator([]AggState{&sa}, gbyFields, hf)
-	iter, _ := agg.Iterator(tid)
+	iter, _ := agg.Iterator(context.Background(), tid)
 
 	fields := []FieldType{
 		{"name", "", StringType},
@@ -208,8 +229,8 @@ func TestGbySumAgg(t *testing.T) {
 
 func TestFilterCountAgg(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 
 	var f FieldType = FieldType{"age", "", IntType}
 	filt, err := NewIntFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
@@ -224,7 +245,7 @@ func TestFilterCountAgg(t *testing.T) {
 	expr := FieldExpr{t1.Desc.Fields[0]}
 	sa.Init("count", &expr, nil)
 	agg := NewAggregator([]AggState{&sa}, filt)
-	iter, err := agg.Iterator(tid)
+	iter, err := agg.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -246,13 +267,13 @@ func TestFilterCountAgg(t *testing.T) {
 
 func TestRepeatedIteration(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	sa := CountAggState{}
 	expr := FieldExpr{t1.Desc.Fields[0]}
 	sa.Init("count", &expr, nil)
 	agg := NewAggregator([]AggState{&sa}, hf)
-	iter, err := agg.Iterator(tid)
+	iter, err := agg.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -270,7 +291,7 @@ func TestRepeatedIteration(t *testing.T) {
 	if cnt != 2 {
 		t.Errorf("unexpected count")
 	}
-	iter, err = agg.Iterator(tid)
+	iter, err = agg.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -290,3 +311,187 @@ func TestRepeatedIteration(t *testing.T) {
 	}
 
 }
+
+func TestGbyMultipleAggs(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	gbyFields := []Expr{&FieldExpr{hf.Descriptor().Fields[0]}}
+
+	ca := CountAggState{}
+	expr := FieldExpr{t1.Desc.Fields[0]}
+	ca.Init("count", &expr, nil)
+	sa := SumAggState[int64]{}
+	expr2 := FieldExpr{t1.Desc.Fields[1]}
+	sa.Init("sum", &expr2, intAggGetter)
+
+	agg := NewGroupedAggregator([]AggState{&ca, &sa}, gbyFields, hf)
+	iter, _ := agg.Iterator(context.Background(), tid)
+
+	fields := []FieldType{
+		{"name", "", StringType},
+		{"count", "", IntType},
+		{"sum", "", IntType},
+	}
+	outt1 := Tuple{TupleDesc{fields},
+		[]DBValue{
+			StringField{"sam"},
+			IntField{2},
+			IntField{50},
+		}, nil,
+	}
+	outt2 := Tuple{
+		TupleDesc{fields},
+		[]DBValue{
+			StringField{"george jones"},
+			IntField{2},
+			IntField{1998},
+		}, nil,
+	}
+	ts := []*Tuple{&outt1, &outt2}
+	match := CheckIfOutputMatches(iter, ts)
+	if !match {
+		t.Fail()
+	}
+}
+
+// Run an aggregator computing aggs over a heap file holding t1 twice and t2
+// once, returning its single output tuple
+func runAggTest(t *testing.T, aggs ...AggState) *Tuple {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	agg := NewAggregator(aggs, hf)
+	iter, err := agg.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup == nil {
+		t.Fatalf("Expected non-null tuple")
+	}
+	return tup
+}
+
+func TestDistinctAgg(t *testing.T) {
+	td, _, _, _, _, _ := makeTestVars()
+	name := FieldExpr{td.Fields[0]}
+	age := FieldExpr{td.Fields[1]}
+	ca := NewDistinctAggState(&CountAggState{})
+	ca.Init("count", &name, stringAggGetter)
+	sa := NewDistinctAggState(&SumAggState[int64]{})
+	sa.Init("sum", &age, intAggGetter)
+	ma := NewDistinctAggState(&MaxAggState[string]{})
+	ma.Init("max", &name, stringAggGetter)
+	tup := runAggTest(t, ca, sa, ma.Copy())
+	if cnt := tup.Fields[0].(IntField).Value; cnt != 2 {
+		t.Errorf("unexpected count distinct %d", cnt)
+	}
+	if sum := tup.Fields[1].(IntField).Value; sum != 1024 {
+		t.Errorf("unexpected sum distinct %d", sum)
+	}
+	if max := tup.Fields[2].(StringField).Value; max != "sam" {
+		t.Errorf("unexpected max distinct %s", max)
+	}
+}
+
+func TestStatisticalAggs(t *testing.T) {
+	td, _, _, _, _, _ := makeTestVars()
+	age := FieldExpr{td.Fields[1]}
+	aggs := []AggState{
+		&VarianceAggState{},
+		&VarianceAggState{stddev: true},
+		&PercentileAggState{fraction: 0.5},
+		&PercentileAggState{fraction: 0.9},
+		&PercentileAggState{fraction: 1},
+	}
+	for _, a := range aggs {
+		if err := a.Init("stat", &age, intAggGetter); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	tup := runAggTest(t, aggs...)
+	//ages are 25, 25 and 999
+	for i, expected := range []int64{316225, 562, 25, 804, 999} {
+		if v := tup.Fields[i].(IntField).Value; v != expected {
+			t.Errorf("unexpected value %d for aggregate %d, expected %d", v, i, expected)
+		}
+	}
+	if err := (&PercentileAggState{fraction: 1.5}).Init("pct", &age, intAggGetter); err == nil {
+		t.Errorf("expected error for percentile greater than 1")
+	}
+}
+
+func TestStringAndBoolAggs(t *testing.T) {
+	td, _, _, _, _, _ := makeTestVars()
+	name := FieldExpr{td.Fields[0]}
+	age := FieldExpr{td.Fields[1]}
+	sa := StringAggState{sep: ";"}
+	sa.Init("names", &name, stringAggGetter)
+	ia := StringAggState{sep: ","}
+	ia.Init("ages", &age, intAggGetter)
+	ba := BoolAggState{}
+	ba.Init("and", &age, intAggGetter)
+	bo := BoolAggState{or: true}
+	bo.Init("or", &age, intAggGetter)
+	tup := runAggTest(t, &sa, &ia, &ba, &bo)
+	if v := tup.Fields[0].(StringField).Value; v != "sam;sam;george jones" {
+		t.Errorf("unexpected string_agg result %s", v)
+	}
+	if v := tup.Fields[1].(StringField).Value; v != "25,25,999" {
+		t.Errorf("unexpected string_agg result %s", v)
+	}
+	if tup.Fields[2].(IntField).Value != 1 || tup.Fields[3].(IntField).Value != 1 {
+		t.Errorf("unexpected bool_and/bool_or results %v", tup.Fields[2:])
+	}
+}
+
+// Group by name when there are more groups than fit in memory, so that the
+// tuples of some groups are partitioned to temporary files
+func TestGbySpill(t *testing.T) {
+	n, groups := 300, 120
+	td, hf, tid := makeDistinctTestVars(t, n, groups)
+	//the tuples of group v have age v / 3
+	expected := make(map[string][2]int64)
+	for i := 0; i < n; i++ {
+		v := i % groups
+		name := "n" + string(rune('a'+v%26)) + string(rune('a'+v/26))
+		e := expected[name]
+		expected[name] = [2]int64{e[0] + 1, e[1] + int64(v/3)}
+	}
+
+	for _, bufSize := range []int{10, 1} {
+		ca := CountAggState{}
+		ca.Init("count", &FieldExpr{td.Fields[0]}, nil)
+		sa := SumAggState[int64]{}
+		sa.Init("sum", &FieldExpr{td.Fields[1]}, intAggGetter)
+		agg := NewGroupedAggregator([]AggState{&ca, &sa}, []Expr{&FieldExpr{td.Fields[0]}}, hf)
+		agg.maxBufferSize = bufSize
+
+		tempFiles := countTempFiles(t)
+		seen := make(map[string]bool)
+		for _, tup := range collectTuples(t, agg, tid) {
+			name := tup.Fields[0].(StringField).Value
+			if seen[name] {
+				t.Fatalf("group %s output more than once", name)
+			}
+			seen[name] = true
+			e := expected[name]
+			if tup.Fields[1].(IntField).Value != e[0] || tup.Fields[2].(IntField).Value != e[1] {
+				t.Errorf("group %s: expected count %d and sum %d, got %v", name, e[0], e[1], tup.Fields)
+			}
+		}
+		if len(seen) != groups {
+			t.Errorf("expected %d groups, got %d", groups, len(seen))
+		}
+		if n := countTempFiles(t); n != tempFiles {
+			t.Errorf("expected temporary files to be removed, found %d more", n-tempFiles)
+		}
+	}
+}
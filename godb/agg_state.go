@@ -1,6 +1,11 @@
 package godb
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
 	"golang.org/x/exp/constraints"
 )
 
@@ -128,32 +133,31 @@ func (a *SumAggState[T]) Finalize() *Tuple {
 type AvgAggState[T Number] struct {
 	alias  string
 	expr   Expr
-	avg    int
-	total  int
+	sum    int64
+	total  int64
 	getter func(DBValue) any
 }
 
 func (a *AvgAggState[T]) Copy() AggState {
-	return &AvgAggState[T]{a.alias, a.expr, a.avg, a.total, a.getter}
+	return &AvgAggState[T]{a.alias, a.expr, a.sum, a.total, a.getter}
 }
 
 func (a *AvgAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any) error {
 	a.alias = alias
 	a.expr = expr
 	a.getter = getter
-	a.avg = 0
+	a.sum = 0
 	a.total = 0
 	return nil
 }
 
 func (a *AvgAggState[T]) AddTuple(t *Tuple) {
-	a.total += 1
 	v, err := a.expr.EvalExpr(t)
 	if err != nil {
 		return
 	}
-	val := a.getter(v).(int64)
-	a.avg = (a.avg*(a.total-1) + int(val)) / a.total
+	a.sum += a.getter(v).(int64)
+	a.total += 1
 }
 
 func (a *AvgAggState[T]) GetTupleDesc() *TupleDesc {
@@ -166,7 +170,11 @@ func (a *AvgAggState[T]) GetTupleDesc() *TupleDesc {
 
 func (a *AvgAggState[T]) Finalize() *Tuple {
 	td := a.GetTupleDesc()
-	var f = IntField{any(a.avg).(int64)}
+	var avg int64
+	if a.total > 0 {
+		avg = a.sum / a.total
+	}
+	var f = IntField{avg}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
@@ -299,3 +307,246 @@ func (a *MinAggState[T]) Finalize() *Tuple {
 	t := Tuple{*td, fs, nil}
 	return &t
 }
+
+// Implements DISTINCT for another aggregation state, e.g., COUNT(DISTINCT age),
+// by only adding the first tuple with each value of the expression to it
+type DistinctAggState struct {
+	agg  AggState
+	expr Expr
+	seen map[any]bool
+}
+
+// Construct a DISTINCT aggregation state wrapping agg.  The wrapped state is
+// initialized along with this one.
+func NewDistinctAggState(agg AggState) *DistinctAggState {
+	return &DistinctAggState{agg: agg}
+}
+
+func (a *DistinctAggState) Copy() AggState {
+	seen := make(map[any]bool, len(a.seen))
+	for k := range a.seen {
+		seen[k] = true
+	}
+	return &DistinctAggState{a.agg.Copy(), a.expr, seen}
+}
+
+func (a *DistinctAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.expr = expr
+	a.seen = make(map[any]bool)
+	return a.agg.Init(alias, expr, getter)
+}
+
+func (a *DistinctAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || a.seen[v] {
+		return
+	}
+	a.seen[v] = true
+	a.agg.AddTuple(t)
+}
+
+func (a *DistinctAggState) GetTupleDesc() *TupleDesc {
+	return a.agg.GetTupleDesc()
+}
+
+func (a *DistinctAggState) Finalize() *Tuple {
+	return a.agg.Finalize()
+}
+
+// Implements the aggregation state for VARIANCE and STDDEV, the sample variance
+// and standard deviation, computed with Welford's algorithm.  Like AVG, the
+// result is truncated to an integer, and is 0 for fewer than two tuples.
+type VarianceAggState struct {
+	alias  string
+	expr   Expr
+	getter func(DBValue) any
+	stddev bool // whether to output the standard deviation rather than the variance
+	count  int64
+	mean   float64
+	m2     float64 // sum of squared differences from the mean
+}
+
+func (a *VarianceAggState) Copy() AggState {
+	return &VarianceAggState{a.alias, a.expr, a.getter, a.stddev, a.count, a.mean, a.m2}
+}
+
+func (a *VarianceAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.alias = alias
+	a.expr = expr
+	a.getter = getter
+	a.count = 0
+	a.mean = 0
+	a.m2 = 0
+	return nil
+}
+
+func (a *VarianceAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+	x := float64(a.getter(v).(int64))
+	a.count++
+	delta := x - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (x - a.mean)
+}
+
+func (a *VarianceAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{[]FieldType{{a.alias, "", IntType}}}
+}
+
+func (a *VarianceAggState) Finalize() *Tuple {
+	var result float64
+	if a.count > 1 {
+		result = a.m2 / float64(a.count-1)
+	}
+	if a.stddev {
+		result = math.Sqrt(result)
+	}
+	return &Tuple{*a.GetTupleDesc(), []DBValue{IntField{int64(result)}}, nil}
+}
+
+// Implements the aggregation state for PERCENTILE_CONT and MEDIAN (the 0.5
+// percentile), which interpolate linearly between the two values closest to
+// the requested fraction of the way through the sorted input.  The result is
+// truncated to an integer, and is 0 if there are no tuples.
+type PercentileAggState struct {
+	alias    string
+	expr     Expr
+	getter   func(DBValue) any
+	fraction float64
+	vals     []int64
+}
+
+func (a *PercentileAggState) Copy() AggState {
+	vals := make([]int64, len(a.vals))
+	copy(vals, a.vals)
+	return &PercentileAggState{a.alias, a.expr, a.getter, a.fraction, vals}
+}
+
+func (a *PercentileAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	if a.fraction < 0 || a.fraction > 1 {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("percentile %v is not between 0 and 1", a.fraction)}
+	}
+	a.alias = alias
+	a.expr = expr
+	a.getter = getter
+	a.vals = nil
+	return nil
+}
+
+func (a *PercentileAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+	a.vals = append(a.vals, a.getter(v).(int64))
+}
+
+func (a *PercentileAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{[]FieldType{{a.alias, "", IntType}}}
+}
+
+func (a *PercentileAggState) Finalize() *Tuple {
+	var result int64
+	if len(a.vals) > 0 {
+		vals := make([]int64, len(a.vals))
+		copy(vals, a.vals)
+		sort.Slice(vals, func(i, j int) bool { return vals[i] < vals[j] })
+		pos := a.fraction * float64(len(vals)-1)
+		lo := int(math.Floor(pos))
+		hi := int(math.Ceil(pos))
+		result = int64(float64(vals[lo]) + float64(vals[hi]-vals[lo])*(pos-float64(lo)))
+	}
+	return &Tuple{*a.GetTupleDesc(), []DBValue{IntField{result}}, nil}
+}
+
+// Implements the aggregation state for STRING_AGG and GROUP_CONCAT, which
+// concatenate the values of the input (in the order they are added),
+// separated by sep
+type StringAggState struct {
+	alias  string
+	expr   Expr
+	getter func(DBValue) any
+	sep    string
+	vals   []string
+}
+
+func (a *StringAggState) Copy() AggState {
+	vals := make([]string, len(a.vals))
+	copy(vals, a.vals)
+	return &StringAggState{a.alias, a.expr, a.getter, a.sep, vals}
+}
+
+func (a *StringAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.alias = alias
+	a.expr = expr
+	a.getter = getter
+	a.vals = nil
+	return nil
+}
+
+func (a *StringAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+	a.vals = append(a.vals, fmt.Sprint(a.getter(v)))
+}
+
+func (a *StringAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{[]FieldType{{a.alias, "", StringType}}}
+}
+
+func (a *StringAggState) Finalize() *Tuple {
+	return &Tuple{*a.GetTupleDesc(), []DBValue{StringField{strings.Join(a.vals, a.sep)}}, nil}
+}
+
+// Implements the aggregation state for BOOL_AND and BOOL_OR.  GoDB has no
+// boolean type, so inputs are integers that are true if they are non-zero, and
+// the result is 1 or 0.  With no tuples, BOOL_AND is 1 and BOOL_OR is 0.
+type BoolAggState struct {
+	alias  string
+	expr   Expr
+	getter func(DBValue) any
+	or     bool // whether to compute BOOL_OR rather than BOOL_AND
+	result bool
+}
+
+func (a *BoolAggState) Copy() AggState {
+	return &BoolAggState{a.alias, a.expr, a.getter, a.or, a.result}
+}
+
+func (a *BoolAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.alias = alias
+	a.expr = expr
+	a.getter = getter
+	a.result = !a.or
+	return nil
+}
+
+func (a *BoolAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+	val := a.getter(v).(int64) != 0
+	if a.or {
+		a.result = a.result || val
+	} else {
+		a.result = a.result && val
+	}
+}
+
+func (a *BoolAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{[]FieldType{{a.alias, "", IntType}}}
+}
+
+func (a *BoolAggState) Finalize() *Tuple {
+	var result int64
+	if a.result {
+		result = 1
+	}
+	return &Tuple{*a.GetTupleDesc(), []DBValue{IntField{result}}, nil}
+}
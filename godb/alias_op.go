@@ -0,0 +1,50 @@
+package godb
+
+import "context"
+
+// AliasOp relabels the tuples of its child with a table alias, e.g., the alias
+// of a subquery in a FROM clause.  Without it, tuples keep the table qualifiers
+// of the tables they were read from, so in a query such as
+//
+//	SELECT x.name, y.name FROM (SELECT name FROM t) x JOIN (SELECT name FROM t) y ...
+//
+// the fields of x and y could not be told apart.
+type AliasOp struct {
+	child Operator
+	alias string
+}
+
+// Construct an operator that sets the table qualifier of all fields of the
+// tuples of child to alias.
+func NewAliasOp(child Operator, alias string) *AliasOp {
+	return &AliasOp{child, alias}
+}
+
+func (a *AliasOp) Descriptor() *TupleDesc {
+	desc := a.child.Descriptor().copy()
+	desc.setTableAlias(a.alias)
+	return desc
+}
+
+// An alias of a heap file is described as a single scan
+func (a *AliasOp) DescribePlan() (*PlanDescription, []Operator) {
+	if hf, ok := a.child.(*HeapFile); ok {
+		return newPlanDescription("Heap Scan", "file", hf.Filename, "alias", a.alias), nil
+	}
+	return newPlanDescription("Alias", "alias", a.alias), []Operator{a.child}
+}
+
+func (a *AliasOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	desc := a.Descriptor()
+	iter, err := a.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		t, err := iter()
+		if err != nil || t == nil {
+			return nil, err
+		}
+		return &Tuple{*desc, t.Fields, t.Rid}, nil
+	}, nil
+}
@@ -0,0 +1,370 @@
+package godb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// The operators of the rest of GoDB output one [Tuple] at a time, each with
+// its own copy of its descriptor.  Batch operators instead output a [Batch] of
+// up to BatchSize rows at a time, stored column by column, so that filters,
+// projections, aggregates and joins loop over plain slices of values rather
+// than making a call, and usually a tuple, per row.  [ColumnBatchScan] reads
+// the columns of a [ColumnFile] straight into batches, and [RowToBatch] and
+// [BatchToRow] convert between the two kinds of operators, so batch operators
+// can be used within plans of row operators and vice versa.
+
+// The number of rows batch operators try to put in each batch they output.
+// Operators such as joins may output larger batches.
+var BatchSize = 1024
+
+// A Vector holds the values of one column of a [Batch]: in Ints if the column
+// is an IntType column, or in Strings if it is a StringType column.
+type Vector struct {
+	Type    DBType
+	Ints    []int64
+	Strings []string
+}
+
+// Batch is a set of rows, stored as one [Vector] per field of Desc
+type Batch struct {
+	Desc    TupleDesc
+	Columns []*Vector
+	rows    int
+}
+
+// BatchOperator is the batch counterpart of [Operator].  The iterator returns
+// batches of at least one row, and nil when there are no more rows; the
+// batches returned are not modified by the operator afterwards.
+type BatchOperator interface {
+	Descriptor() *TupleDesc
+	BatchIterator(ctx context.Context, tid TransactionID) (func() (*Batch, error), error)
+}
+
+// BatchPlanDescriber is implemented by batch operators to describe themselves
+// below the [BatchToRow] that outputs their rows, like [PlanDescriber].
+type BatchPlanDescriber interface {
+	DescribeBatchPlan() (*PlanDescription, []BatchOperator)
+}
+
+// Return an empty vector of type t with room for capacity values
+func newVector(t DBType, capacity int) *Vector {
+	v := &Vector{Type: t}
+	switch t {
+	case IntType:
+		v.Ints = make([]int64, 0, capacity)
+	case StringType:
+		v.Strings = make([]string, 0, capacity)
+	}
+	return v
+}
+
+// Return the number of values in the vector
+func (v *Vector) Len() int {
+	if v.Type == StringType {
+		return len(v.Strings)
+	}
+	return len(v.Ints)
+}
+
+// Return the i-th value of the vector
+func (v *Vector) value(i int) DBValue {
+	if v.Type == StringType {
+		return StringField{v.Strings[i]}
+	}
+	return IntField{v.Ints[i]}
+}
+
+// Append val to the vector, returning an error if it isn't of the vector's
+// type
+func (v *Vector) appendValue(val DBValue) error {
+	switch val := val.(type) {
+	case IntField:
+		if v.Type == IntType {
+			v.Ints = append(v.Ints, val.Value)
+			return nil
+		}
+	case StringField:
+		if v.Type == StringType {
+			v.Strings = append(v.Strings, val.Value)
+			return nil
+		}
+	}
+	return GoDBError{TypeMismatchError, fmt.Sprintf("can't add %v to a column of type %s", val, typeNames[v.Type])}
+}
+
+// Return a vector of the values of v at the positions in sel, in order
+func (v *Vector) take(sel []int) *Vector {
+	out := newVector(v.Type, len(sel))
+	if v.Type == StringType {
+		for _, i := range sel {
+			out.Strings = append(out.Strings, v.Strings[i])
+		}
+	} else {
+		for _, i := range sel {
+			out.Ints = append(out.Ints, v.Ints[i])
+		}
+	}
+	return out
+}
+
+// Append the key encoding (see [appendTupleKey]) of the i-th value of v to
+// buf, without making a [DBValue] of it
+func (v *Vector) appendKey(buf []byte, i int) []byte {
+	if v.Type == StringType {
+		buf = append(buf, stringKeyTag)
+		buf = binary.AppendUvarint(buf, uint64(len(v.Strings[i])))
+		return append(buf, v.Strings[i]...)
+	}
+	buf = append(buf, intKeyTag)
+	return binary.BigEndian.AppendUint64(buf, uint64(v.Ints[i]))
+}
+
+// Create an empty batch of rows of type desc
+func NewBatch(desc *TupleDesc) *Batch {
+	b := &Batch{Desc: *desc.copy(), Columns: make([]*Vector, len(desc.Fields))}
+	for i, f := range desc.Fields {
+		b.Columns[i] = newVector(f.Ftype, BatchSize)
+	}
+	return b
+}
+
+// Return the number of rows in the batch
+func (b *Batch) Len() int {
+	return b.rows
+}
+
+// Append the fields of t to the batch as a new row.  Returns an error if t
+// doesn't have the fields of the batch's descriptor.
+func (b *Batch) AppendTuple(t *Tuple) error {
+	if len(t.Fields) != len(b.Columns) {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("can't add a tuple of %d fields to a batch of %d columns", len(t.Fields), len(b.Columns))}
+	}
+	for i, v := range b.Columns {
+		if err := v.appendValue(t.Fields[i]); err != nil {
+			return err
+		}
+	}
+	b.rows++
+	return nil
+}
+
+// Return the i-th row of the batch as a tuple
+func (b *Batch) Row(i int) *Tuple {
+	fields := make([]DBValue, len(b.Columns))
+	for j, v := range b.Columns {
+		fields[j] = v.value(i)
+	}
+	return &Tuple{Desc: *b.Desc.copy(), Fields: fields}
+}
+
+// Return a batch of the rows of b at the positions in sel, in order
+func (b *Batch) take(sel []int) *Batch {
+	out := &Batch{Desc: b.Desc, Columns: make([]*Vector, len(b.Columns)), rows: len(sel)}
+	for i, v := range b.Columns {
+		out.Columns[i] = v.take(sel)
+	}
+	return out
+}
+
+// Return the index of the column of desc that f refers to, choosing fields
+// the same way as [FieldExpr.EvalExpr]: a field with the same name and table
+// if there is one, and otherwise the first field with the same name.
+func batchFieldIndex(desc *TupleDesc, f FieldType) (int, error) {
+	best := -1
+	for i, field := range desc.Fields {
+		if field.Fname != f.Fname {
+			continue
+		}
+		if field.TableQualifier == f.TableQualifier {
+			return i, nil
+		}
+		if best == -1 {
+			best = i
+		}
+	}
+	if best == -1 {
+		return -1, GoDBError{IncompatibleTypesError, fmt.Sprintf("field %s.%s not found", f.TableQualifier, f.Fname)}
+	}
+	return best, nil
+}
+
+// Vectorized arithmetic, for the functions of [funcs] that can't fail
+var batchIntFuncs = map[string]func(a, b int64) int64{
+	"+": func(a, b int64) int64 { return a + b },
+	"-": func(a, b int64) int64 { return a - b },
+	"*": func(a, b int64) int64 { return a * b },
+}
+
+// Evaluate e against every row of b, returning a vector of the results.
+// Fields are returned as the column of b, without copying, constants and
+// integer arithmetic are evaluated a column at a time, and other expressions
+// are evaluated by [Expr.EvalExpr] against each row.
+func evalBatchExpr(e Expr, b *Batch) (*Vector, error) {
+	switch e := e.(type) {
+	case *FieldExpr:
+		i, err := batchFieldIndex(&b.Desc, e.selectField)
+		if err != nil {
+			return nil, err
+		}
+		return b.Columns[i], nil
+	case *ConstExpr:
+		v := newVector(e.constType, b.Len())
+		for i := 0; i < b.Len(); i++ {
+			if err := v.appendValue(e.val); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case *FuncExpr:
+		f, ok := batchIntFuncs[e.op]
+		if !ok || len(e.args) != 2 {
+			break
+		}
+		left, err := evalBatchExpr(*e.args[0], b)
+		if err != nil {
+			return nil, err
+		}
+		right, err := evalBatchExpr(*e.args[1], b)
+		if err != nil {
+			return nil, err
+		}
+		if left.Type != IntType || right.Type != IntType {
+			return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected arg of type int", e.op)}
+		}
+		v := newVector(IntType, b.Len())
+		for i := range left.Ints {
+			v.Ints = append(v.Ints, f(left.Ints[i], right.Ints[i]))
+		}
+		return v, nil
+	}
+	v := newVector(e.GetExprType().Ftype, b.Len())
+	for i := 0; i < b.Len(); i++ {
+		val, err := e.EvalExpr(b.Row(i))
+		if err != nil {
+			return nil, err
+		}
+		if err := v.appendValue(val); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// RowToBatch collects the tuples of a row operator into batches
+type RowToBatch struct {
+	child Operator
+}
+
+// Construct an adapter outputting the tuples of child in batches
+func NewRowToBatch(child Operator) *RowToBatch {
+	return &RowToBatch{child}
+}
+
+func (r *RowToBatch) Descriptor() *TupleDesc {
+	return r.child.Descriptor().copy()
+}
+
+// The child is described by [DescribePlan] without statistics, as batch plans
+// are described without a catalog
+func (r *RowToBatch) DescribeBatchPlan() (*PlanDescription, []BatchOperator) {
+	d := newPlanDescription("Row To Batch")
+	d.Children = append(d.Children, DescribePlan(nil, r.child))
+	return d, nil
+}
+
+// RowToBatch implementation.  Each batch holds BatchSize tuples, except for
+// the last one.
+func (r *RowToBatch) BatchIterator(ctx context.Context, tid TransactionID) (func() (*Batch, error), error) {
+	iter, err := r.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := r.Descriptor()
+	done := false
+	return func() (*Batch, error) {
+		if done {
+			return nil, nil
+		}
+		b := NewBatch(desc)
+		for b.Len() < BatchSize {
+			t, err := iter()
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				done = true
+				break
+			}
+			if err := b.AppendTuple(t); err != nil {
+				return nil, err
+			}
+		}
+		if b.Len() == 0 {
+			return nil, nil
+		}
+		return b, nil
+	}, nil
+}
+
+// BatchToRow outputs the rows of the batches of a batch operator as tuples,
+// so that a batch plan can be used as the child of row operators
+type BatchToRow struct {
+	child BatchOperator
+}
+
+// Construct an adapter outputting the rows of the batches of child
+func NewBatchToRow(child BatchOperator) *BatchToRow {
+	return &BatchToRow{child}
+}
+
+func (r *BatchToRow) Descriptor() *TupleDesc {
+	return r.child.Descriptor().copy()
+}
+
+// The batch plan below the adapter is described as its children, as it
+// isn't made of row operators
+func (r *BatchToRow) DescribePlan() (*PlanDescription, []Operator) {
+	d := newPlanDescription("Batch To Row", "batch size", fmt.Sprint(BatchSize))
+	d.Children = append(d.Children, describeBatchPlan(r.child))
+	return d, nil
+}
+
+// Return the description of the batch plan rooted at op
+func describeBatchPlan(op BatchOperator) *PlanDescription {
+	describer, ok := op.(BatchPlanDescriber)
+	if !ok {
+		return &PlanDescription{Name: fmt.Sprintf("%T", op)}
+	}
+	d, children := describer.DescribeBatchPlan()
+	for _, child := range children {
+		d.Children = append(d.Children, describeBatchPlan(child))
+	}
+	return d
+}
+
+// BatchToRow implementation.  The tuples of a batch share their descriptor.
+func (r *BatchToRow) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := r.child.BatchIterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	var b *Batch
+	i := 0
+	return func() (*Tuple, error) {
+		for b == nil || i == b.Len() {
+			next, err := iter()
+			if err != nil || next == nil {
+				return nil, err
+			}
+			b, i = next, 0
+		}
+		fields := make([]DBValue, len(b.Columns))
+		for j, v := range b.Columns {
+			fields[j] = v.value(i)
+		}
+		i++
+		return &Tuple{Desc: b.Desc, Fields: fields}, nil
+	}, nil
+}
@@ -0,0 +1,530 @@
+package godb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// BatchFilter is the batch counterpart of [Filter]: it evaluates both sides of
+// its comparison a column at a time and outputs the rows of each child batch
+// that satisfy it, skipping batches with no such rows.
+type BatchFilter struct {
+	op          BoolOp
+	left, right Expr
+	child       BatchOperator
+}
+
+// Construct a filter comparing left and right with op.  Returns an error if
+// the two expressions are not of the same type.
+func NewBatchFilter(left Expr, op BoolOp, right Expr, child BatchOperator) (*BatchFilter, error) {
+	if left.GetExprType().Ftype != right.GetExprType().Ftype {
+		return nil, GoDBError{IncompatibleTypesError, "cannot compare expressions of different types in filter"}
+	}
+	return &BatchFilter{op, left, right, child}, nil
+}
+
+func (f *BatchFilter) Descriptor() *TupleDesc {
+	return f.child.Descriptor().copy()
+}
+
+func (f *BatchFilter) DescribeBatchPlan() (*PlanDescription, []BatchOperator) {
+	pred := exprToStr(f.left) + " " + strings.TrimSpace(opToStr(f.op)) + " " + exprToStr(f.right)
+	return newPlanDescription("Batch Filter", "predicate", pred), []BatchOperator{f.child}
+}
+
+// Return the positions of the rows of b that satisfy the filter
+func (f *BatchFilter) selectRows(b *Batch) ([]int, error) {
+	left, err := evalBatchExpr(f.left, b)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evalBatchExpr(f.right, b)
+	if err != nil {
+		return nil, err
+	}
+	if left.Type != right.Type {
+		return nil, GoDBError{IncompatibleTypesError, "cannot compare expressions of different types in filter"}
+	}
+	var sel []int
+	switch {
+	case left.Type == IntType:
+		for i := range left.Ints {
+			if evalPred(left.Ints[i], right.Ints[i], f.op) {
+				sel = append(sel, i)
+			}
+		}
+	case f.op == OpLike:
+		//compile each pattern once, rather than once per row like evalPred
+		patterns := make(map[string]*regexp.Regexp)
+		for i, s := range left.Strings {
+			re, ok := patterns[right.Strings[i]]
+			if !ok {
+				re, _ = regexp.Compile("^" + strings.Replace(right.Strings[i], "%", ".*?", -1) + "$")
+				patterns[right.Strings[i]] = re
+			}
+			if re != nil && re.MatchString(s) {
+				sel = append(sel, i)
+			}
+		}
+	default:
+		for i := range left.Strings {
+			if evalPred(left.Strings[i], right.Strings[i], f.op) {
+				sel = append(sel, i)
+			}
+		}
+	}
+	return sel, nil
+}
+
+// BatchFilter implementation.  Batches whose rows all satisfy the filter are
+// output as they are.
+func (f *BatchFilter) BatchIterator(ctx context.Context, tid TransactionID) (func() (*Batch, error), error) {
+	iter, err := f.child.BatchIterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Batch, error) {
+		for {
+			b, err := iter()
+			if err != nil || b == nil {
+				return nil, err
+			}
+			sel, err := f.selectRows(b)
+			if err != nil {
+				return nil, err
+			}
+			if len(sel) == b.Len() {
+				return b, nil
+			}
+			if len(sel) > 0 {
+				return b.take(sel), nil
+			}
+		}
+	}, nil
+}
+
+// BatchProject is the batch counterpart of [Project], without DISTINCT
+type BatchProject struct {
+	selectFields []Expr
+	outputNames  []string
+	child        BatchOperator
+}
+
+// Construct a projection of selectFields, named outputNames.  Returns an
+// error if there isn't one name per expression.
+func NewBatchProject(selectFields []Expr, outputNames []string, child BatchOperator) (*BatchProject, error) {
+	if len(selectFields) != len(outputNames) {
+		return nil, errors.New("mismatched length")
+	}
+	return &BatchProject{selectFields, outputNames, child}, nil
+}
+
+func (p *BatchProject) Descriptor() *TupleDesc {
+	fields := make([]FieldType, len(p.selectFields))
+	for i, expr := range p.selectFields {
+		fields[i] = expr.GetExprType()
+		fields[i].Fname = p.outputNames[i]
+	}
+	return &TupleDesc{Fields: fields}
+}
+
+func (p *BatchProject) DescribeBatchPlan() (*PlanDescription, []BatchOperator) {
+	fields := make([]string, len(p.selectFields))
+	for i, e := range p.selectFields {
+		fields[i] = exprToStr(e) + " as " + p.outputNames[i]
+	}
+	return newPlanDescription("Batch Project", "fields", strings.Join(fields, ", ")), []BatchOperator{p.child}
+}
+
+// BatchProject implementation.  Projected fields share the columns of the
+// child batches.
+func (p *BatchProject) BatchIterator(ctx context.Context, tid TransactionID) (func() (*Batch, error), error) {
+	iter, err := p.child.BatchIterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := p.Descriptor()
+	return func() (*Batch, error) {
+		b, err := iter()
+		if err != nil || b == nil {
+			return nil, err
+		}
+		out := &Batch{Desc: *desc, Columns: make([]*Vector, len(p.selectFields)), rows: b.Len()}
+		for i, expr := range p.selectFields {
+			if out.Columns[i], err = evalBatchExpr(expr, b); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}, nil
+}
+
+// BatchHashAggregate is the batch counterpart of [Aggregator].  Each batch is
+// assigned to groups a row at a time, by the key encoding of the group by
+// columns, and the arguments of the aggregates are evaluated a column at a
+// time.  The states of COUNT, SUM, AVG, MIN and MAX are updated from the
+// columns directly; other aggregates are given each row as a tuple.
+//
+// Unlike [Aggregator], all of the groups are kept in memory.
+type BatchHashAggregate struct {
+	groupByFields []Expr
+	newAggState   []AggState
+	child         BatchOperator
+}
+
+// Construct an aggregate computing aggStates for each group of the values of
+// groupByFields, or for all of the rows of child if groupByFields is empty
+func NewBatchHashAggregate(aggStates []AggState, groupByFields []Expr, child BatchOperator) *BatchHashAggregate {
+	return &BatchHashAggregate{groupByFields, aggStates, child}
+}
+
+// The group by fields followed by the fields of the aggregates, as for
+// [Aggregator.Descriptor]
+func (a *BatchHashAggregate) Descriptor() *TupleDesc {
+	desc := &TupleDesc{}
+	for _, expr := range a.groupByFields {
+		desc.Fields = append(desc.Fields, expr.GetExprType())
+	}
+	for _, as := range a.newAggState {
+		desc.Fields = append(desc.Fields, as.GetTupleDesc().Fields...)
+	}
+	return desc
+}
+
+func (a *BatchHashAggregate) DescribeBatchPlan() (*PlanDescription, []BatchOperator) {
+	aggs := make([]string, len(a.newAggState))
+	for i, agg := range a.newAggState {
+		aggs[i] = fmt.Sprintf("%s(%s)", reflect.TypeOf(agg).Elem().Name(), agg.GetTupleDesc().HeaderString(false))
+	}
+	return newPlanDescription("Batch Hash Aggregate", "aggregates", strings.Join(aggs, ", "), "group by", describeExprs(a.groupByFields)), []BatchOperator{a.child}
+}
+
+// Return the expression whose values the aggregate state as adds up, or nil
+// if as is not updated from columns by [addBatchToAggStates]
+func batchAggExpr(as AggState) Expr {
+	switch as := as.(type) {
+	case *CountAggState:
+		return as.expr
+	case *SumAggState[int64]:
+		return as.expr
+	case *AvgAggState[int64]:
+		return as.expr
+	case *MaxAggState[int64]:
+		return as.expr
+	case *MaxAggState[string]:
+		return as.expr
+	case *MinAggState[int64]:
+		return as.expr
+	case *MinAggState[string]:
+		return as.expr
+	}
+	return nil
+}
+
+// Add row i of b, whose values of the aggregates' expressions are in args, to
+// the aggregate states of a group.  States without an argument column are
+// given the row as a tuple.
+func addBatchRowToAggStates(states []AggState, args []*Vector, b *Batch, i int) {
+	var row *Tuple
+	for j, as := range states {
+		switch as := as.(type) {
+		case *CountAggState:
+			as.count++
+			continue
+		case *SumAggState[int64]:
+			if args[j] != nil {
+				as.sum += int(args[j].Ints[i])
+				continue
+			}
+		case *AvgAggState[int64]:
+			if args[j] != nil {
+				as.sum += args[j].Ints[i]
+				as.total++
+				continue
+			}
+		case *MaxAggState[int64]:
+			if args[j] != nil {
+				if v := args[j].Ints[i]; as.null || v > as.max {
+					as.max, as.null = v, false
+				}
+				continue
+			}
+		case *MaxAggState[string]:
+			if args[j] != nil {
+				if v := args[j].Strings[i]; as.null || v > as.max {
+					as.max, as.null = v, false
+				}
+				continue
+			}
+		case *MinAggState[int64]:
+			if args[j] != nil {
+				if v := args[j].Ints[i]; as.null || v < as.min {
+					as.min, as.null = v, false
+				}
+				continue
+			}
+		case *MinAggState[string]:
+			if args[j] != nil {
+				if v := args[j].Strings[i]; as.null || v < as.min {
+					as.min, as.null = v, false
+				}
+				continue
+			}
+		}
+		if row == nil {
+			row = b.Row(i)
+		}
+		as.AddTuple(row)
+	}
+}
+
+// Return a copy of the template aggregate states of a
+func (a *BatchHashAggregate) newGroupStates() []AggState {
+	states := make([]AggState, len(a.newAggState))
+	for i, as := range a.newAggState {
+		states[i] = as.Copy()
+	}
+	return states
+}
+
+// BatchHashAggregate implementation.  Groups are output in the order they
+// were first seen, BatchSize groups per batch.  Without group by fields, a
+// single row aggregating all of the child rows is output, even if there are
+// none.
+func (a *BatchHashAggregate) BatchIterator(ctx context.Context, tid TransactionID) (func() (*Batch, error), error) {
+	iter, err := a.child.BatchIterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := a.Descriptor()
+	var groups []*aggGroup
+	aggregated := false
+	mem := newMemoryAccount(ctx, "Batch Hash Aggregate")
+	aggregate := func() error {
+		index := make(map[string]int)
+		if len(a.groupByFields) == 0 {
+			groups = append(groups, &aggGroup{&Tuple{}, a.newGroupStates()})
+		}
+		var key []byte
+		for {
+			b, err := iter()
+			if err != nil || b == nil {
+				return err
+			}
+			keys := make([]*Vector, len(a.groupByFields))
+			for i, expr := range a.groupByFields {
+				if keys[i], err = evalBatchExpr(expr, b); err != nil {
+					return err
+				}
+			}
+			args := make([]*Vector, len(a.newAggState))
+			for i, as := range a.newAggState {
+				if expr := batchAggExpr(as); expr != nil {
+					if args[i], err = evalBatchExpr(expr, b); err != nil {
+						return err
+					}
+				}
+			}
+			for i := 0; i < b.Len(); i++ {
+				group := 0
+				if len(keys) > 0 {
+					key = key[:0]
+					for _, v := range keys {
+						key = v.appendKey(key, i)
+					}
+					var ok bool
+					if group, ok = index[string(key)]; !ok {
+						group = len(groups)
+						index[string(key)] = group
+						fields := make([]DBValue, len(keys))
+						for j, v := range keys {
+							fields[j] = v.value(i)
+						}
+						keyTup := &Tuple{Fields: fields}
+						if err := mem.reserve(groupMemorySize(keyTup, key, len(a.newAggState))); err != nil {
+							return err
+						}
+						groups = append(groups, &aggGroup{keyTup, a.newGroupStates()})
+					}
+				}
+				addBatchRowToAggStates(groups[group].states, args, b, i)
+			}
+		}
+	}
+	next := 0
+	return func() (*Batch, error) {
+		if !aggregated {
+			if err := aggregate(); err != nil {
+				mem.release()
+				return nil, err
+			}
+			aggregated = true
+		}
+		if next == len(groups) {
+			mem.release()
+			return nil, nil
+		}
+		out := NewBatch(desc)
+		for ; next < len(groups) && out.Len() < BatchSize; next++ {
+			t := &Tuple{Fields: append([]DBValue{}, groups[next].key.Fields...)}
+			for _, as := range groups[next].states {
+				t = joinTuples(t, as.Finalize())
+			}
+			if err := out.AppendTuple(t); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}, nil
+}
+
+// BatchHashJoin is the batch counterpart of [HashJoin].  It reads the batches
+// of its right input into a hash table of the positions of their rows, keyed
+// by the values of rightFields, and then probes the table with each row of
+// each left batch, outputting a batch of the matching pairs of rows per left
+// batch with matches.
+//
+// Unlike [HashJoin], the right input is always kept in memory.
+type BatchHashJoin struct {
+	leftFields, rightFields []Expr
+	left, right             BatchOperator
+}
+
+// Construct a hash join.  Returns an error if the two lists of expressions
+// differ in length or in the types of their expressions.
+func NewBatchHashJoin(left BatchOperator, leftFields []Expr, right BatchOperator, rightFields []Expr) (*BatchHashJoin, error) {
+	if err := checkJoinKeys(leftFields, rightFields); err != nil {
+		return nil, err
+	}
+	return &BatchHashJoin{leftFields, rightFields, left, right}, nil
+}
+
+// The fields of the left input followed by those of the right input
+func (hj *BatchHashJoin) Descriptor() *TupleDesc {
+	return hj.left.Descriptor().merge(hj.right.Descriptor())
+}
+
+func (hj *BatchHashJoin) DescribeBatchPlan() (*PlanDescription, []BatchOperator) {
+	return newPlanDescription("Batch Hash Join", "keys", describeJoinKeys(hj.leftFields, hj.rightFields)), []BatchOperator{hj.left, hj.right}
+}
+
+// The position of a row of the right input of a [BatchHashJoin]
+type batchRow struct {
+	batch, row int
+}
+
+// Append the key encoding of row i of the values of keys to buf
+func appendBatchKey(buf []byte, keys []*Vector, i int) []byte {
+	for _, v := range keys {
+		buf = v.appendKey(buf, i)
+	}
+	return buf
+}
+
+// Evaluate each of exprs against b
+func evalBatchExprs(exprs []Expr, b *Batch) ([]*Vector, error) {
+	out := make([]*Vector, len(exprs))
+	for i, expr := range exprs {
+		v, err := evalBatchExpr(expr, b)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// BatchHashJoin implementation.  Pairs are output in the order of the left
+// input, and pairs with the same left row in the order of the right input.
+func (hj *BatchHashJoin) BatchIterator(ctx context.Context, tid TransactionID) (func() (*Batch, error), error) {
+	leftIter, err := hj.left.BatchIterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	rightIter, err := hj.right.BatchIterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := hj.Descriptor()
+	rightDesc := hj.right.Descriptor()
+	var rights []*Batch
+	table := make(map[string][]batchRow)
+	var key []byte
+	mem := newMemoryAccount(ctx, "Batch Hash Join")
+	build := func() error {
+		for {
+			b, err := rightIter()
+			if err != nil || b == nil {
+				return err
+			}
+			keys, err := evalBatchExprs(hj.rightFields, b)
+			if err != nil {
+				return err
+			}
+			size := batchMemorySize(b)
+			for i := 0; i < b.Len(); i++ {
+				key = appendBatchKey(key[:0], keys, i)
+				table[string(key)] = append(table[string(key)], batchRow{len(rights), i})
+				size += keyMemorySize(len(key))
+			}
+			if err := mem.reserve(size); err != nil {
+				return err
+			}
+			rights = append(rights, b)
+		}
+	}
+	built := false
+	return func() (*Batch, error) {
+		if !built {
+			if err := build(); err != nil {
+				mem.release()
+				return nil, err
+			}
+			built = true
+		}
+		for {
+			b, err := leftIter()
+			if err != nil || b == nil {
+				mem.release()
+				return nil, err
+			}
+			if len(table) == 0 {
+				continue
+			}
+			keys, err := evalBatchExprs(hj.leftFields, b)
+			if err != nil {
+				return nil, err
+			}
+			var sel []int
+			var matches []batchRow
+			for i := 0; i < b.Len(); i++ {
+				key = appendBatchKey(key[:0], keys, i)
+				for _, m := range table[string(key)] {
+					sel = append(sel, i)
+					matches = append(matches, m)
+				}
+			}
+			if len(sel) == 0 {
+				continue
+			}
+			out := &Batch{Desc: *desc, Columns: b.take(sel).Columns, rows: len(sel)}
+			for j, f := range rightDesc.Fields {
+				v := newVector(f.Ftype, len(matches))
+				for _, m := range matches {
+					col := rights[m.batch].Columns[j]
+					if v.Type == StringType {
+						v.Strings = append(v.Strings, col.Strings[m.row])
+					} else {
+						v.Ints = append(v.Ints, col.Ints[m.row])
+					}
+				}
+				out.Columns = append(out.Columns, v)
+			}
+			return out, nil
+		}
+	}, nil
+}
@@ -0,0 +1,292 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+// Use batches of n rows for the rest of the test
+func setTestBatchSize(t *testing.T, n int) {
+	size := BatchSize
+	BatchSize = n
+	t.Cleanup(func() { BatchSize = size })
+}
+
+// Read all of the batches of op, failing the test on error
+func collectBatches(t *testing.T, op BatchOperator, tid TransactionID) []*Batch {
+	iter, err := op.BatchIterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var batches []*Batch
+	for {
+		b, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if b == nil {
+			return batches
+		}
+		if b.Len() == 0 {
+			t.Fatalf("expected batches to have rows")
+		}
+		batches = append(batches, b)
+	}
+}
+
+// Check that the batch plan op outputs the same tuples as the row plan
+// expected, in the same order if ordered is set
+func checkBatchPlan(t *testing.T, name string, op BatchOperator, expected Operator, tid TransactionID, ordered bool) {
+	want := collectTuples(t, expected, tid)
+	got := collectTuples(t, NewBatchToRow(op), tid)
+	if len(want) == 0 {
+		t.Fatalf("%s: expected the row plan to output tuples", name)
+	}
+	if !op.Descriptor().equals(expected.Descriptor()) {
+		t.Errorf("%s: expected descriptor %v, got %v", name, expected.Descriptor(), op.Descriptor())
+	}
+	if ordered {
+		for i := range want {
+			if i >= len(got) || fmt.Sprint(want[i].Fields) != fmt.Sprint(got[i].Fields) {
+				t.Errorf("%s: expected %v, got %v", name, want, got)
+				return
+			}
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: expected %d tuples, got %d", name, len(want), len(got))
+		}
+		return
+	}
+	if w, g := sortedTupleStrings(want), sortedTupleStrings(got); !slices.Equal(w, g) {
+		t.Errorf("%s: expected %v, got %v", name, w, g)
+	}
+}
+
+func TestBatchAdapters(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	setTestBatchSize(t, 100)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+
+	batches := collectBatches(t, NewRowToBatch(hf), tid)
+	if len(batches) != 30 {
+		t.Errorf("expected 30 batches of 100 rows, got %d", len(batches))
+	}
+	if row := batches[1].Row(0); row.Fields[0].(StringField).Value != "n0" || row.Fields[1].(IntField).Value != 0 {
+		t.Errorf("expected row 100 to be n0, 0, got %v", row.Fields)
+	}
+	checkBatchPlan(t, "round trip", NewRowToBatch(hf), hf, tid, true)
+
+	b := NewBatch(hf.Descriptor())
+	if err := b.AppendTuple(&Tuple{Fields: []DBValue{IntField{1}, IntField{2}}}); err == nil {
+		t.Errorf("expected error adding a tuple of the wrong types to a batch")
+	}
+}
+
+func TestBatchFilterProject(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	setTestBatchSize(t, 100)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+
+	name, age := &FieldExpr{hf.Descriptor().Fields[0]}, &FieldExpr{hf.Descriptor().Fields[1]}
+	filters := []struct {
+		pred        string
+		left, right Expr
+		op          BoolOp
+	}{
+		{"age > 90", age, &ConstExpr{IntField{90}, IntType}, OpGt},
+		{"name = 'n7'", name, &ConstExpr{StringField{"n7"}, StringType}, OpEq},
+		{"name like 'n1%'", name, &ConstExpr{StringField{"n1%"}, StringType}, OpLike},
+		{"age + age < 10", &FuncExpr{"+", []*Expr{asExpr(age), asExpr(age)}}, &ConstExpr{IntField{10}, IntType}, OpLt},
+		{"age >= 0", age, &ConstExpr{IntField{0}, IntType}, OpGe},
+		{"mod(age, 7) = age", &FuncExpr{"mod", []*Expr{asExpr(age), asExpr(&ConstExpr{IntField{7}, IntType})}}, age, OpEq},
+	}
+	for _, f := range filters {
+		bf, err := NewBatchFilter(f.left, f.op, f.right, NewRowToBatch(hf))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		rf, err := NewFilter(f.left, f.op, f.right, hf)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		checkBatchPlan(t, f.pred, bf, rf, tid, true)
+	}
+	if _, err := NewBatchFilter(name, OpEq, age, NewRowToBatch(hf)); err == nil {
+		t.Errorf("expected error comparing fields of different types")
+	}
+
+	fields := []Expr{age, &FuncExpr{"*", []*Expr{asExpr(age), asExpr(&ConstExpr{IntField{3}, IntType})}}, name, &ConstExpr{StringField{"x"}, StringType}}
+	names := []string{"age", "triple", "name", "x"}
+	bp2, err := NewBatchProject(fields, names, NewRowToBatch(hf))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	p, err := NewProjectOp(fields, names, false, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkBatchPlan(t, "project", bp2, p, tid, true)
+	if _, err := NewBatchProject(fields, names[1:], NewRowToBatch(hf)); err == nil {
+		t.Errorf("expected error projecting with a missing name")
+	}
+}
+
+// Return a pointer to e, as the arguments of a [FuncExpr]
+func asExpr(e Expr) *Expr {
+	return &e
+}
+
+// Return the aggregate states count(*), sum(age), avg(age), min(name),
+// max(age), count(distinct age) and stddev(age) over the fields of big
+func makeBatchTestAggStates(desc *TupleDesc) []AggState {
+	name, age := &FieldExpr{desc.Fields[0]}, &FieldExpr{desc.Fields[1]}
+	count, sum, avg := &CountAggState{}, &SumAggState[int64]{}, &AvgAggState[int64]{}
+	min, max := &MinAggState[string]{}, &MaxAggState[int64]{}
+	distinct, stddev := NewDistinctAggState(&CountAggState{}), &VarianceAggState{}
+	count.Init("count", age, nil)
+	sum.Init("sum", age, intAggGetter)
+	avg.Init("avg", age, intAggGetter)
+	min.Init("min", name, stringAggGetter)
+	max.Init("max", age, intAggGetter)
+	distinct.Init("distinct", age, intAggGetter)
+	stddev.Init("stddev", age, intAggGetter)
+	return []AggState{count, sum, avg, min, max, distinct, stddev}
+}
+
+func TestBatchHashAggregate(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	setTestBatchSize(t, 100)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	desc := hf.Descriptor()
+	name, age := &FieldExpr{desc.Fields[0]}, &FieldExpr{desc.Fields[1]}
+
+	groupBys := map[string][]Expr{
+		"none":        nil,
+		"name":        {name},
+		"name, age":   {name, age},
+		"mod(age, 3)": {&FuncExpr{"mod", []*Expr{asExpr(age), asExpr(&ConstExpr{IntField{3}, IntType})}}},
+	}
+	for gby, exprs := range groupBys {
+		ba := NewBatchHashAggregate(makeBatchTestAggStates(desc), exprs, NewRowToBatch(hf))
+		a := NewGroupedAggregator(makeBatchTestAggStates(desc), exprs, hf)
+		if exprs == nil {
+			a = NewAggregator(makeBatchTestAggStates(desc), hf)
+		}
+		checkBatchPlan(t, "group by "+gby, ba, a, tid, false)
+	}
+
+	//groups are output BatchSize at a time
+	batches := collectBatches(t, NewBatchHashAggregate(makeBatchTestAggStates(desc), []Expr{name, age}, NewRowToBatch(hf)), tid)
+	if len(batches) != 1 || batches[0].Len() != 100 {
+		t.Errorf("expected one batch of 100 groups, got %d batches", len(batches))
+	}
+	setTestBatchSize(t, 30)
+	batches = collectBatches(t, NewBatchHashAggregate(makeBatchTestAggStates(desc), []Expr{name, age}, NewRowToBatch(hf)), tid)
+	if len(batches) != 4 {
+		t.Errorf("expected the 100 groups in 4 batches, got %d", len(batches))
+	}
+
+	//without group by, an empty input still has an aggregate
+	none, _ := NewBatchFilter(age, OpGt, &ConstExpr{IntField{1000}, IntType}, NewRowToBatch(hf))
+	batches = collectBatches(t, NewBatchHashAggregate(makeBatchTestAggStates(desc), nil, none), tid)
+	if len(batches) != 1 || batches[0].Row(0).Fields[0].(IntField).Value != 0 {
+		t.Errorf("expected a count of 0 over no rows")
+	}
+	if batches = collectBatches(t, NewBatchHashAggregate(makeBatchTestAggStates(desc), []Expr{name}, none), tid); len(batches) != 0 {
+		t.Errorf("expected no groups over no rows, got %d batches", len(batches))
+	}
+}
+
+func TestBatchHashJoin(t *testing.T) {
+	c, bp, hf := makeParallelTestCatalog(t)
+	setTestBatchSize(t, 100)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	file, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	small := file.(*HeapFile)
+	bigDesc, smallDesc := hf.Descriptor(), small.Descriptor()
+
+	//many big rows match each small row, and the other way around
+	bigAge, smallAge := []Expr{&FieldExpr{bigDesc.Fields[1]}}, []Expr{&FieldExpr{smallDesc.Fields[1]}}
+	bj, err := NewBatchHashJoin(NewRowToBatch(hf), bigAge, NewRowToBatch(small), smallAge)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	j, _ := NewHashJoin(hf, bigAge, small, smallAge)
+	checkBatchPlan(t, "big join t", bj, j, tid, true)
+	bj, _ = NewBatchHashJoin(NewRowToBatch(small), smallAge, NewRowToBatch(hf), bigAge)
+	j, _ = NewHashJoin(small, smallAge, hf, bigAge)
+	checkBatchPlan(t, "t join big", bj, j, tid, true)
+
+	//a self join on two keys, with the right rows spread over many batches
+	self := []Expr{&FieldExpr{bigDesc.Fields[0]}, &FieldExpr{bigDesc.Fields[1]}}
+	bj, _ = NewBatchHashJoin(NewRowToBatch(hf), self, NewRowToBatch(hf), self)
+	j, _ = NewHashJoin(hf, self, hf, self)
+	checkBatchPlan(t, "self join", bj, j, tid, true)
+
+	if _, err := NewBatchHashJoin(NewRowToBatch(hf), self[:1], NewRowToBatch(hf), self[1:]); err == nil {
+		t.Errorf("expected error joining fields of different types")
+	}
+}
+
+func TestColumnBatchScan(t *testing.T) {
+	_, _, _, _, cf, _, tid, _ := makeLargeColumnTestVars()
+	f, err := os.Open("test_column_file.csv")
+	if err != nil {
+		t.Fatalf("couldn't open test_column_file.csv")
+	}
+	defer f.Close()
+	if err := cf.LoadFromCSV(f, true, ",", false); err != nil {
+		t.Fatalf("load failed, %s", err)
+	}
+	setTestBatchSize(t, 3)
+
+	checkBatchPlan(t, "column scan", NewColumnBatchScan(cf, []string{"age", "name"}), NewColumnScan(cf, []string{"age", "name"}), tid, true)
+	rows := 0
+	for _, b := range collectBatches(t, NewColumnBatchScan(cf, []string{"weight", "age", "name"}), tid) {
+		if b.Len() > 3 || len(b.Columns) != 3 || b.Desc.Fields[0].Fname != "name" {
+			t.Fatalf("expected batches of up to 3 rows of name, age and weight, got %v", b.Desc)
+		}
+		rows += b.Len()
+	}
+	if rows != 50 {
+		t.Errorf("expected 50 rows, got %d", rows)
+	}
+
+	//a filter and aggregate read only the columns they use
+	age := &FieldExpr{FieldType{Fname: "age", Ftype: IntType}}
+	filter, _ := NewBatchFilter(age, OpGt, &ConstExpr{IntField{15}, IntType}, NewColumnBatchScan(cf, []string{"age"}))
+	count := &CountAggState{}
+	count.Init("count", age, nil)
+	plan := NewBatchToRow(NewBatchHashAggregate([]AggState{count}, nil, filter))
+	var names []string
+	var visit func(d *PlanDescription)
+	visit = func(d *PlanDescription) {
+		names = append(names, d.Name)
+		for _, child := range d.Children {
+			visit(child)
+		}
+	}
+	visit(DescribePlan(nil, plan))
+	if expected := []string{"Batch To Row", "Batch Hash Aggregate", "Batch Filter", "Column Batch Scan"}; !slices.Equal(names, expected) {
+		t.Errorf("expected plan %v, got %v", expected, names)
+	}
+	tups := collectTuples(t, plan, tid)
+	rowFilter, _ := NewFilter(age, OpGt, &ConstExpr{IntField{15}, IntType}, NewColumnScan(cf, []string{"age"}))
+	if expected := len(collectTuples(t, rowFilter, tid)); len(tups) != 1 || tups[0].Fields[0].(IntField).Value != int64(expected) || expected == 0 {
+		t.Errorf("expected a count of %d, got %v", expected, tups)
+	}
+}
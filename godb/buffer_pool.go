@@ -1,8 +1,10 @@
 package godb
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,6 +39,49 @@ type BufferPool struct {
 	// remove a transaction ID
 	Waitlist map[TransactionID]map[TransactionID]bool
 	mutex    sync.Mutex
+	stats    PageStats // counts of the pages requested through GetPage
+}
+
+// Counts of the pages requested from a buffer pool, see [BufferPool.PageStats]
+type PageStats struct {
+	Hits          int64 `json:"hits"`           // requests for pages that were already cached
+	Reads         int64 `json:"reads"`          // requests for pages that had to be read from disk
+	WriteRequests int64 `json:"write_requests"` // requests for pages with WritePerm, to modify them
+}
+
+// pageCounter counts the pages requested through [BufferPool.GetPage] with a
+// context carrying it (see withPageCounter), e.g., by the plan below an
+// [InstrumentedOp].  The counts are updated atomically, as the workers of a
+// parallel plan request pages at the same time.
+type pageCounter struct {
+	hits, reads, writeRequests atomic.Int64
+}
+
+// The page counters of a context, innermost first
+type pageCounters struct {
+	counter *pageCounter
+	next    *pageCounters
+}
+
+type pageCountersKey struct{}
+
+// Return a copy of ctx in which the pages requested are also counted by
+// counter, as well as by the counters ctx already carries
+func withPageCounter(ctx context.Context, counter *pageCounter) context.Context {
+	next, _ := ctx.Value(pageCountersKey{}).(*pageCounters)
+	return context.WithValue(ctx, pageCountersKey{}, &pageCounters{counter, next})
+}
+
+// Call count with each of the page counters carried by ctx
+func forEachPageCounter(ctx context.Context, count func(c *pageCounter)) {
+	for cs, _ := ctx.Value(pageCountersKey{}).(*pageCounters); cs != nil; cs = cs.next {
+		count(cs.counter)
+	}
+}
+
+// Return the pages counted so far
+func (c *pageCounter) stats() PageStats {
+	return PageStats{c.hits.Load(), c.reads.Load(), c.writeRequests.Load()}
 }
 
 // Create a new BufferPool with the specified number of pages
@@ -112,6 +157,14 @@ func (bp *BufferPool) CommitTransaction(tid TransactionID) {
 	delete(bp.Waitlist, tid)
 }
 
+// Return the number of pages requested from the buffer pool so far, by all
+// transactions
+func (bp *BufferPool) PageStats() PageStats {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+	return bp.stats
+}
+
 func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
 	bp.mutex.Lock()
 	defer bp.mutex.Unlock()
@@ -132,10 +185,21 @@ func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
 // unavailable, should block until the lock is free. If a deadlock occurs, abort
 // one of the transactions in the deadlock]. You will likely want to store a list
 // of pages in the BufferPool in a map keyed by the [DBFile.pageKey].
-func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*Page, error) {
+//
+// If ctx is canceled or its deadline passes, including while waiting for a
+// lock, GetPage returns ctx's error.  The transaction keeps the locks it
+// already holds until it is aborted.
+func (bp *BufferPool) GetPage(ctx context.Context, file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// acquire mutex
 	bp.mutex.Lock()
 	defer bp.mutex.Unlock()
+	if perm == WritePerm {
+		bp.stats.WriteRequests++
+		forEachPageCounter(ctx, func(c *pageCounter) { c.writeRequests.Add(1) })
+	}
 	// Check if page is in bp - if so, retrieve it
 	pageKey := file.pageKey(pageNo).(heapHash)
 	if pg, pgKeyExists := bp.Pages[pageKey]; pgKeyExists {
@@ -150,6 +214,10 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 					bp.mutex.Lock()
 					return nil, errors.New("need to abort")
 				}
+				// a canceled query stops waiting; it's up to the caller to abort
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
 				bp.mutex.Unlock()
 				time.Sleep(10000) // block for 5 milliseconds
 				bp.mutex.Lock()
@@ -166,6 +234,10 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 					bp.mutex.Lock()
 					return nil, errors.New("need to abort")
 				}
+				// a canceled query stops waiting; it's up to the caller to abort
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
 				bp.mutex.Unlock()
 				time.Sleep(10000)
 				bp.mutex.Lock()
@@ -174,6 +246,8 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 		}
 
 		if pg != nil {
+			bp.stats.Hits++
+			forEachPageCounter(ctx, func(c *pageCounter) { c.hits.Add(1) })
 			return &pg, nil
 		}
 	}
@@ -183,6 +257,8 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 	if err != nil {
 		return nil, err
 	}
+	bp.stats.Reads++
+	forEachPageCounter(ctx, func(c *pageCounter) { c.reads.Add(1) })
 
 	// Filename:
 	//currFile := file.(*HeapFile).Filename
@@ -226,6 +302,10 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 				bp.mutex.Lock()
 				return nil, errors.New("need to abort")
 			}
+			// a canceled query stops waiting; it's up to the caller to abort
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
 			bp.mutex.Unlock()
 			time.Sleep(10000) // block for 5 milliseconds
 			bp.mutex.Lock()
@@ -241,6 +321,10 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 				bp.mutex.Lock()
 				return nil, errors.New("need to abort")
 			}
+			// a canceled query stops waiting; it's up to the caller to abort
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
 			bp.mutex.Unlock()
 			time.Sleep(10000)
 			bp.mutex.Lock()
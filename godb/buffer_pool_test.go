@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"testing"
 )
 
@@ -9,11 +10,11 @@ func TestGetPage(t *testing.T) {
 	tid := NewTID()
 	for i := 0; i < 300; i++ {
 		bp.BeginTransaction(tid)
-		err := hf.insertTuple(&t1, tid)
+		err := hf.insertTuple(context.Background(), &t1, tid)
 		if err != nil {
 			t.Fatalf("%v", err)
 		}
-		err = hf.insertTuple(&t2, tid)
+		err = hf.insertTuple(context.Background(), &t2, tid)
 		if err != nil {
 			t.Fatalf("%v", err)
 		}
@@ -21,7 +22,7 @@ func TestGetPage(t *testing.T) {
 		// because CommitTransaction may not be implemented
 		// yet if this is called in lab 1 or 2
 		for i := 0; i < hf.NumPages(); i++ {
-			pg, err := bp.GetPage(hf, i, tid, ReadPerm)
+			pg, err := bp.GetPage(context.Background(), hf, i, tid, ReadPerm)
 			if pg == nil || err != nil {
 				t.Fatal("page nil or error", err)
 			}
@@ -36,12 +37,12 @@ func TestGetPage(t *testing.T) {
 	bp.BeginTransaction(tid)
 	//expect 6 pages
 	for i := 0; i < 6; i++ {
-		pg, err := bp.GetPage(hf, i, tid, ReadPerm)
+		pg, err := bp.GetPage(context.Background(), hf, i, tid, ReadPerm)
 		if pg == nil || err != nil {
 			t.Fatalf("failed to get page %d (err = %v)", i, err)
 		}
 	}
-	_, err := bp.GetPage(hf, 7, tid, ReadPerm)
+	_, err := bp.GetPage(context.Background(), hf, 7, tid, ReadPerm)
 	if err == nil {
 		t.Fatalf("No error when getting page 7 from a file with 6 pages.")
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync/atomic"
 )
 
 type Table struct {
@@ -18,10 +19,34 @@ type Catalog struct {
 	columnMap map[string][]*Table
 	bp        *BufferPool
 	rootPath  string
+
+	// common table expressions defined by the WITH clause of the query being
+	// parsed, which take precedence over tables of the same name
+	ctes map[string]*cteDef
+
+	// statistics of the tables that have been analyzed, by table name
+	stats map[string]*TableStats
+
+	// the placeholders of the prepared statement being parsed, in order
+	params []*ParamExpr
+
+	// incremented whenever tables are added or dropped or their statistics
+	// change, so that plans built against the catalog can be invalidated; see
+	// [PlanCache].  Shared by the copies of the catalog made for parsing, and
+	// read and written atomically, as statements may be parsed while it changes.
+	version *atomic.Int64
+
+	// whether scans are planned serially, rather than in parallel (see
+	// [ParallelWorkers]), e.g., for a query whose output is inserted into a
+	// table it may read
+	serialScans bool
 }
 
+// Write the tables of the catalog to the named file, followed by a section
+// with the statistics of the tables that have been analyzed, which
+// [NewCatalogFromFile] loads back.
 func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
-	catalogString := c.CatalogString()
+	catalogString := c.CatalogString() + c.statisticsString()
 	f, err := os.OpenFile(rootPath+"/"+catalogFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
@@ -36,6 +61,8 @@ func (c *Catalog) dropTable(table string) error {
 		if t.name == table {
 			c.tableMap[table] = nil
 			c.columnMap[table] = nil
+			delete(c.stats, table)
+			c.version.Add(1)
 			c.tables = append(c.tables[:i], c.tables[i+1:]...)
 			os.Remove(c.tableNameToFile(table))
 			return nil
@@ -69,21 +96,31 @@ func ImportCatalogFromCSVs(catalogFile string, bp *BufferPool, rootPath string,
 	return nil
 }
 
-func parseCatalogFile(catalogFile string, rootPath string) ([]TupleDesc, []string, error) {
+// Parse the tables of a catalog file, returning their descriptors and names,
+// and the lines of its statistics section, if it has one
+func parseCatalogFile(catalogFile string, rootPath string) ([]TupleDesc, []string, []string, error) {
 	var tables []TupleDesc
 	var names []string
 	f, err := os.Open(rootPath + "/" + catalogFile)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+	defer f.Close()
 	scanner := bufio.NewScanner(f)
 
 	for scanner.Scan() {
+		if scanner.Text() == statisticsHeader {
+			var stats []string
+			for scanner.Scan() {
+				stats = append(stats, scanner.Text())
+			}
+			return tables, names, stats, nil
+		}
 		// code to read each line
 		line := strings.ToLower(scanner.Text())
 		sep := strings.Split(line, "(")
 		if len(sep) != 2 {
-			return nil, nil, GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
+			return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
 		}
 		tableName := strings.TrimSpace(sep[0])
 		rest := strings.Trim(sep[1], "()")
@@ -93,7 +130,7 @@ func parseCatalogFile(catalogFile string, rootPath string) ([]TupleDesc, []strin
 			f := strings.TrimSpace(f)
 			nameType := strings.Split(f, " ")
 			if len(nameType) != 2 {
-				return nil, nil, GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", nameType, line)}
+				return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", nameType, line)}
 			}
 			switch nameType[1] {
 			case "int":
@@ -107,25 +144,28 @@ func parseCatalogFile(catalogFile string, rootPath string) ([]TupleDesc, []strin
 			case "text":
 				fieldArray = append(fieldArray, FieldType{nameType[0], "", StringType})
 			default:
-				return nil, nil, GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
+				return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
 			}
 		}
 		tables = append(tables, TupleDesc{fieldArray})
 		names = append(names, tableName)
 	}
-	return tables, names, nil
+	return tables, names, nil, nil
 
 }
 
 func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*Catalog, error) {
-	tabs, names, err := parseCatalogFile(catalogFile, rootPath)
+	tabs, names, stats, err := parseCatalogFile(catalogFile, rootPath)
 	if err != nil {
 		return nil, err
 	}
-	c := &Catalog{make([]*Table, 0), make(map[string]*Table), make(map[string][]*Table), bp, rootPath}
+	c := &Catalog{make([]*Table, 0), make(map[string]*Table), make(map[string][]*Table), bp, rootPath, nil, make(map[string]*TableStats), nil, new(atomic.Int64), false}
 	for i, t := range tabs {
 		c.addTable(names[i], t)
 	}
+	if err := c.parseStatistics(stats); err != nil {
+		return nil, err
+	}
 
 	return c, nil
 
@@ -145,12 +185,42 @@ func (c *Catalog) addTable(named string, desc TupleDesc) error {
 			mapList = append(mapList, t)
 			c.columnMap[f.Fname] = mapList
 		}
+		c.version.Add(1)
 		return nil
 	} else {
 		return GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", named)}
 	}
 }
 
+// Return a copy of the catalog in which the supplied common table expression
+// is visible, in addition to those already visible in c.  The copy shares the
+// tables of c, and is only meant to be used for parsing.
+func (c *Catalog) withCTE(def *cteDef) *Catalog {
+	scoped := *c
+	scoped.ctes = make(map[string]*cteDef)
+	for name, d := range c.ctes {
+		scoped.ctes[name] = d
+	}
+	scoped.ctes[def.name] = def
+	return &scoped
+}
+
+// Return a copy of the catalog for parsing a prepared statement whose
+// placeholders are params; see withCTE.
+func (c *Catalog) withParams(params []*ParamExpr) *Catalog {
+	scoped := *c
+	scoped.params = params
+	return &scoped
+}
+
+// Return a copy of the catalog for parsing a query whose scans are planned
+// serially; see withCTE.
+func (c *Catalog) withSerialScans() *Catalog {
+	scoped := *c
+	scoped.serialScans = true
+	return &scoped
+}
+
 func (c *Catalog) tableNameToFile(tableName string) string {
 	return c.rootPath + "/" + tableName + ".dat"
 
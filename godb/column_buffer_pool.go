@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 )
@@ -71,7 +72,10 @@ func (bp *ColumnBufferPool) BeginTransaction(tid TransactionID) error {
 // unavailable, should block until the lock is free. If a deadlock occurs, abort
 // one of the transactions in the deadlock]. You will likely want to store a list
 // of pages in the BufferPool in a map keyed by the [DBFile.pageKey].
-func (bp *ColumnBufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*Page, error) {
+func (bp *ColumnBufferPool) GetPage(ctx context.Context, file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// Check if page is in bp - if so, retrieve it
 	pageKey := file.pageKey(pageNo).(heapHash)
 	if pg, pgKeyExists := bp.Pages[pageKey]; pgKeyExists {
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"testing"
 )
 
@@ -8,11 +9,11 @@ func TestColumnGetPage(t *testing.T) {
 	_, _, t1, t2, cf, bp, _, n := makeLargeColumnTestVars()
 	tid := NewTID()
 	for i := 0; i < n; i++ {
-		err := cf.insertTuple(&t1, tid)
+		err := cf.insertTuple(context.Background(), &t1, tid)
 		if err != nil {
 			t.Fatalf("%v", err)
 		}
-		err = cf.insertTuple(&t2, tid)
+		err = cf.insertTuple(context.Background(), &t2, tid)
 		if err != nil {
 			t.Fatalf("%v", err)
 		}
@@ -20,7 +21,7 @@ func TestColumnGetPage(t *testing.T) {
 		// because CommitTransaction may not be implemented
 		// yet if this is called in lab 1 or 2
 		for i := 0; i < cf.NumPages(); i++ {
-			pg, err := bp.GetPage(cf, i, tid, ReadPerm)
+			pg, err := bp.GetPage(context.Background(), cf, i, tid, ReadPerm)
 			if pg == nil || err != nil {
 				t.Fatal("page nil or error", err)
 			}
@@ -31,12 +32,12 @@ func TestColumnGetPage(t *testing.T) {
 		}
 	}
 
-	pg, err := bp.GetPage(cf, 0, tid, ReadPerm)
+	pg, err := bp.GetPage(context.Background(), cf, 0, tid, ReadPerm)
 	if pg == nil || err != nil {
 		t.Fatalf("failed to get page %d (err = %v)", 0, err)
 	}
 
-	_, err1 := bp.GetPage(cf, 1, tid, ReadPerm)
+	_, err1 := bp.GetPage(context.Background(), cf, 1, tid, ReadPerm)
 	if err1 == nil {
 		t.Fatalf("No error when getting page 7 from a file with 6 pages.")
 	}
@@ -3,6 +3,7 @@ package godb
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -102,7 +103,7 @@ func (f *ColumnFile) readPage(pageNo int) (*Page, error) {
 // rather than directly reading pages itself. For lab 1, you do not need to
 // worry about concurrent transactions modifying the Page or ColumnFile.  We will
 // add support for concurrent modifications in lab 3.
-func (f *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
+func (f *ColumnFile) insertTuple(ctx context.Context, t *Tuple, tid TransactionID) error {
 	for i, field := range t.Desc.Fields {
 		newt := new(Tuple)
 		newt.Desc.Fields = []FieldType{t.Desc.Fields[i]}
@@ -116,7 +117,7 @@ func (f *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
 			// Insert page to file and bufpool
 			f.flushPage(&p)
 
-			TP, err := f.bufPool.GetPage(f, 0, tid, WritePerm)
+			TP, err := f.bufPool.GetPage(ctx, f, 0, tid, WritePerm)
 
 			if err != nil {
 				return err
@@ -157,7 +158,7 @@ func (f *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
 			// check if columnpage is the same field
 			if hh.FileName == f.Filename && f.ColumnPages[hh.PageNo].fieldEquals(field) {
 
-				p, err := f.bufPool.GetPage(f, hh.PageNo, tid, WritePerm)
+				p, err := f.bufPool.GetPage(ctx, f, hh.PageNo, tid, WritePerm)
 
 				if err != nil {
 					fmt.Println("erroring", err)
@@ -208,7 +209,7 @@ func (f *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
 			// Check other pages within currPages that are NOT in buffer pool
 			pgsToCheck := f.Columns[field.Fname]
 			for _, pgNo := range pgsToCheck {
-				TP, err := f.bufPool.GetPage(f, pgNo, tid, WritePerm)
+				TP, err := f.bufPool.GetPage(ctx, f, pgNo, tid, WritePerm)
 				if err != nil {
 					return err
 				}
@@ -241,7 +242,7 @@ func (f *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
 				newCP := *newColumnPage(&field, f.currPages-1, f)
 				var p Page = &newCP
 				f.flushPage(&p)
-				TP, err := f.bufPool.GetPage(f, f.currPages-1, tid, WritePerm)
+				TP, err := f.bufPool.GetPage(ctx, f, f.currPages-1, tid, WritePerm)
 				if err != nil {
 					return err
 				}
@@ -284,7 +285,7 @@ func (f *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
 	return nil
 }
 
-func (f *ColumnFile) deleteTuple(t *Tuple, tid TransactionID) error {
+func (f *ColumnFile) deleteTuple(ctx context.Context, t *Tuple, tid TransactionID) error {
 	// Check if t.Rid is an Rid
 	rid, ok := t.Rid.(rID)
 	if !ok {
@@ -294,7 +295,7 @@ func (f *ColumnFile) deleteTuple(t *Tuple, tid TransactionID) error {
 		}
 		for i, _ := range ridd.Page {
 			pageNum := ridd.Page[i]
-			pg, err := f.bufPool.GetPage(f, pageNum, tid, WritePerm)
+			pg, err := f.bufPool.GetPage(ctx, f, pageNum, tid, WritePerm)
 
 			if err != nil {
 				return err
@@ -313,7 +314,7 @@ func (f *ColumnFile) deleteTuple(t *Tuple, tid TransactionID) error {
 	}
 
 	pageNum := rid.Page
-	pg, err := f.bufPool.GetPage(f, pageNum, tid, WritePerm)
+	pg, err := f.bufPool.GetPage(ctx, f, pageNum, tid, WritePerm)
 
 	if err != nil {
 		return err
@@ -359,6 +360,10 @@ func (f *ColumnFile) Descriptor() *TupleDesc {
 
 }
 
+func (f *ColumnFile) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Column Scan", "file", f.Filename), nil
+}
+
 // Return the number of pages in the column file
 func (f *ColumnFile) NumPages() int {
 	// Stat the file
@@ -383,6 +388,8 @@ func (f *ColumnFile) NumPages() int {
 // - skipLastField: if true, the final field is skipped (some TPC datasets include a trailing separator on each line)
 // Returns an error if the field cannot be opened or if a line is malformed
 func (f *ColumnFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLastField bool) error {
+	//each line is loaded in a transaction of its own, which can't be canceled
+	ctx := context.Background()
 	scanner := bufio.NewScanner(file)
 	cnt := 0
 	for scanner.Scan() {
@@ -426,7 +433,7 @@ func (f *ColumnFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skip
 				var newValue []DBValue
 				newValue = append(newValue, IntField{intValue})
 				newT := Tuple{newDescriptor, newValue, nil}
-				err = f.insertTuple(&newT, tid)
+				err = f.insertTuple(ctx, &newT, tid)
 				if err != nil {
 					return err
 				}
@@ -437,7 +444,7 @@ func (f *ColumnFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skip
 				var newValue []DBValue
 				newValue = append(newValue, StringField{field})
 				newT := Tuple{newDescriptor, newValue, nil}
-				err := f.insertTuple(&newT, tid)
+				err := f.insertTuple(ctx, &newT, tid)
 				if err != nil {
 					return err
 				}
@@ -447,7 +454,7 @@ func (f *ColumnFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skip
 		// hack to force dirty pages to disk
 		// for j := 0; j < f.currPages; j++ {
 		// 	fmt.Println("GET PG:", j )
-		// 	pg, err := bp.GetPage(f, j, tid, ReadPerm)
+		// 	pg, err := bp.GetPage(ctx, f, j, tid, ReadPerm)
 		// 	if pg == nil || err != nil {
 		// 		fmt.Println("page nil or error", err)
 		// 		break
@@ -469,7 +476,7 @@ func (f *ColumnFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skip
 // [Operator] COLUMN-specific iterator method
 // Return a function that iterates through the records in the column file.
 // Accepts a list of columns to read and returns tuples that contain only records from these columns.
-func (f *ColumnFile) ColumnIterator(toRead []FieldType, tid TransactionID) (func() (*Tuple, error), error) {
+func (f *ColumnFile) ColumnIterator(ctx context.Context, toRead []FieldType, tid TransactionID) (func() (*Tuple, error), error) {
 	i := 0
 	slotNum := 0
 	var pageIter func() (*Tuple, error)
@@ -486,7 +493,6 @@ func (f *ColumnFile) ColumnIterator(toRead []FieldType, tid TransactionID) (func
 		for _, pgNo := range f.Columns[ft.Fname] {
 			if !slices.Contains(pagesToCheck, pgNo) {
 				pagesToCheck = append(pagesToCheck, pgNo)
-				fmt.Println("CHECK:", pgNo, "for", ft.Fname)
 			}
 		}
 	}
@@ -504,7 +510,6 @@ func (f *ColumnFile) ColumnIterator(toRead []FieldType, tid TransactionID) (func
 			// Check if there is an existing page iterator
 			if pageIter != nil {
 				next, err := pageIter()
-				fmt.Println(i, slotNum, next)
 				if i >= f.currPages && f.currPages != 0 {
 					return nil, nil
 				}
@@ -521,7 +526,7 @@ func (f *ColumnFile) ColumnIterator(toRead []FieldType, tid TransactionID) (func
 						slotNum = 0
 						continue
 					} else {
-						page, err := f.bufPool.GetPage(f, i, tid, ReadPerm)
+						page, err := f.bufPool.GetPage(ctx, f, i, tid, ReadPerm)
 						if page == nil {
 							// fmt.Println("C2", i, slotNum, tid)
 							return nil, nil
@@ -568,8 +573,15 @@ func (f *ColumnFile) ColumnIterator(toRead []FieldType, tid TransactionID) (func
 					} else {
 						tdCopy := next.Desc.copy()
 						fields := next.Fields[:]
-						currTups[tupNumber] = Tuple{Desc: *tdCopy, Fields: fields}
+						currTup = Tuple{Desc: *tdCopy, Fields: fields}
 						tupCounts[next.Desc.Fields[0].Fname] += 1 // one tuple added
+						// a tuple of a single column is already complete
+						if len(currTup.Desc.Fields) == len(toRead) {
+							totalTups += 1
+							currTup.Rid = totalTups
+							return &currTup, nil
+						}
+						currTups[tupNumber] = currTup
 					}
 					continue
 				}
@@ -590,7 +602,7 @@ func (f *ColumnFile) ColumnIterator(toRead []FieldType, tid TransactionID) (func
 					slotNum = 0
 					continue
 				} else {
-					page, err := f.bufPool.GetPage(f, i, tid, ReadPerm)
+					page, err := f.bufPool.GetPage(ctx, f, i, tid, ReadPerm)
 					if err != nil {
 						return nil, err
 					}
@@ -607,7 +619,7 @@ func (f *ColumnFile) ColumnIterator(toRead []FieldType, tid TransactionID) (func
 // [Operator] Generic iterator method (included so column file still implements DBFile interface)
 // Return a function that iterates through the records in the column file.
 // Accepts a list of columns to read and returns tuples that contain only records from these columns.
-func (f *ColumnFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+func (f *ColumnFile) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	i := 0
 	slotNum := 0
 	var pageIter func() (*Tuple, error)
@@ -628,7 +640,7 @@ func (f *ColumnFile) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 						// fmt.Println("C1", i, slotNum, tid)
 						return nil, nil
 					} else {
-						page, err := f.bufPool.GetPage(f, i, tid, ReadPerm)
+						page, err := f.bufPool.GetPage(ctx, f, i, tid, ReadPerm)
 						if page == nil {
 							// fmt.Println("C2", i, slotNum, tid)
 							return nil, nil
@@ -671,7 +683,7 @@ func (f *ColumnFile) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 					// fmt.Println("C5", i, slotNum, tid)
 					return nil, nil
 				} else {
-					page, err := f.bufPool.GetPage(f, i, tid, ReadPerm)
+					page, err := f.bufPool.GetPage(ctx, f, i, tid, ReadPerm)
 					if err != nil {
 						// fmt.Println("C6", i, slotNum, tid)
 						return nil, err
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -117,9 +118,9 @@ func makeColumnTestVars() (TupleDesc, FieldType, Tuple, Tuple, *ColumnFile, *Col
 
 func TestCreateAndInsertColumnFile(t *testing.T) {
 	_, _, t1, t2, cf, _, tid := makeColumnTestVars()
-	cf.insertTuple(&t1, tid)
-	cf.insertTuple(&t2, tid)
-	iter, _ := cf.Iterator(tid)
+	cf.insertTuple(context.Background(), &t1, tid)
+	cf.insertTuple(context.Background(), &t2, tid)
+	iter, _ := cf.Iterator(context.Background(), tid)
 	i := 0
 	for {
 		t, err := iter()
@@ -139,18 +140,18 @@ func TestCreateAndInsertColumnFile(t *testing.T) {
 
 func TestDeleteColumnFile(t *testing.T) {
 	_, _, t1, t2, cf, _, tid := makeColumnTestVars()
-	cf.insertTuple(&t1, tid)
-	cf.insertTuple(&t2, tid)
+	cf.insertTuple(context.Background(), &t1, tid)
+	cf.insertTuple(context.Background(), &t2, tid)
 	fmt.Println("rid", t1.Rid)
 
-	cf.deleteTuple(&t1, tid)
-	iter, _ := cf.Iterator(tid)
+	cf.deleteTuple(context.Background(), &t1, tid)
+	iter, _ := cf.Iterator(context.Background(), tid)
 	t3, _ := iter()
 	if t3 == nil {
 		t.Errorf("HeapFile iterator expected 1 tuple")
 	}
-	cf.deleteTuple(&t2, tid)
-	iter, _ = cf.Iterator(tid)
+	cf.deleteTuple(context.Background(), &t2, tid)
+	iter, _ = cf.Iterator(context.Background(), tid)
 	t3, _ = iter()
 	if t3 != nil {
 		fmt.Println("t3", t3)
@@ -173,7 +174,7 @@ func TestColumnLoadWideCSV(t *testing.T) {
 	}
 	fmt.Println("LOADED LARGE CSV")
 	//should have 50 tuples, only with name and age
-	iter, _ := largeCf.ColumnIterator(want, tid)
+	iter, _ := largeCf.ColumnIterator(context.Background(), want, tid)
 	i := 0
 	for {
 		t, _ := iter()
@@ -221,7 +222,7 @@ func TestHeapLoadWideCSV(t *testing.T) {
 	}
 	fmt.Println("LOADED LARGE CSV")
 	//should have 50 tuples
-	iter, _ := hf.Iterator(tid)
+	iter, _ := hf.Iterator(context.Background(), tid)
 	i := 0
 	for {
 		t, _ := iter()
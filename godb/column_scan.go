@@ -0,0 +1,152 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ColumnScan reads some of the columns of a column file, using
+// [ColumnFile.ColumnIterator] so that only the pages of those columns are
+// read.
+type ColumnScan struct {
+	file *ColumnFile
+	desc *TupleDesc
+}
+
+// Construct a scan of the named columns of file.  The output tuples have the
+// columns in the order of the file's descriptor; names that aren't in it are
+// ignored.
+func NewColumnScan(file *ColumnFile, columns []string) *ColumnScan {
+	desc := &TupleDesc{}
+	for _, f := range file.Desc.Fields {
+		if slices.Contains(columns, f.Fname) {
+			desc.Fields = append(desc.Fields, f)
+		}
+	}
+	return &ColumnScan{file, desc}
+}
+
+func (s *ColumnScan) Descriptor() *TupleDesc {
+	return s.desc.copy()
+}
+
+func (s *ColumnScan) DescribePlan() (*PlanDescription, []Operator) {
+	names := make([]string, len(s.desc.Fields))
+	for i, f := range s.desc.Fields {
+		names[i] = f.Fname
+	}
+	return newPlanDescription("Column Scan", "file", s.file.Filename, "columns", strings.Join(names, ", ")), nil
+}
+
+// ColumnScan implementation.  The column iterator assembles each tuple from
+// its columns in the order their pages are read, so the fields are put back in
+// the order of the descriptor.
+func (s *ColumnScan) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := s.file.ColumnIterator(ctx, s.desc.Fields, tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		t, err := iter()
+		if err != nil || t == nil {
+			return nil, err
+		}
+		fields := make([]DBValue, len(s.desc.Fields))
+		for i, f := range s.desc.Fields {
+			j := slices.IndexFunc(t.Desc.Fields, func(g FieldType) bool { return g.Fname == f.Fname })
+			if j < 0 || j >= len(t.Fields) {
+				return nil, GoDBError{MalformedDataError, fmt.Sprintf("column %s missing from tuple read from %s", f.Fname, s.file.Filename)}
+			}
+			fields[i] = t.Fields[j]
+		}
+		return &Tuple{*s.desc, fields, t.Rid}, nil
+	}, nil
+}
+
+// ColumnBatchScan reads some of the columns of a column file into batches
+// (see [BatchOperator]).  Each column is read from its own pages, straight
+// into the column's vector, so rows are never assembled into tuples.
+type ColumnBatchScan struct {
+	file *ColumnFile
+	desc *TupleDesc
+}
+
+// Construct a batch scan of the named columns of file, in the order of the
+// file's descriptor, like [NewColumnScan]
+func NewColumnBatchScan(file *ColumnFile, columns []string) *ColumnBatchScan {
+	return &ColumnBatchScan{file, NewColumnScan(file, columns).desc}
+}
+
+func (s *ColumnBatchScan) Descriptor() *TupleDesc {
+	return s.desc.copy()
+}
+
+func (s *ColumnBatchScan) DescribeBatchPlan() (*PlanDescription, []BatchOperator) {
+	names := make([]string, len(s.desc.Fields))
+	for i, f := range s.desc.Fields {
+		names[i] = f.Fname
+	}
+	return newPlanDescription("Column Batch Scan", "file", s.file.Filename, "columns", strings.Join(names, ", ")), nil
+}
+
+// The position of a [ColumnBatchScan] in the pages of one column
+type columnCursor struct {
+	pages []int // of the column, in the order its values were inserted
+	page  int   // index in pages of the page being read
+	slot  int   // next slot of the page to read
+}
+
+// Append up to n values of the column to v, reading its pages from the
+// buffer pool as needed
+func (s *ColumnBatchScan) readColumn(ctx context.Context, c *columnCursor, v *Vector, n int, tid TransactionID) error {
+	for v.Len() < n && c.page < len(c.pages) {
+		pg, err := s.file.bufPool.GetPage(ctx, s.file, c.pages[c.page], tid, ReadPerm)
+		if err != nil {
+			return err
+		}
+		p := (*pg).(*columnPage)
+		for ; c.slot < len(p.Tuples) && v.Len() < n; c.slot++ {
+			if t := p.Tuples[c.slot]; t != nil {
+				if err := v.appendValue(t.Fields[0]); err != nil {
+					return err
+				}
+			}
+		}
+		if c.slot == len(p.Tuples) {
+			c.page, c.slot = c.page+1, 0
+		}
+	}
+	return nil
+}
+
+// ColumnBatchScan implementation.  The rows of the file are the values of
+// its columns in order, so the i-th value of every column read is put in the
+// same row.  Returns an error if the columns have different numbers of values.
+func (s *ColumnBatchScan) BatchIterator(ctx context.Context, tid TransactionID) (func() (*Batch, error), error) {
+	cursors := make([]*columnCursor, len(s.desc.Fields))
+	for i, f := range s.desc.Fields {
+		cursors[i] = &columnCursor{pages: s.file.Columns[f.Fname]}
+	}
+	return func() (*Batch, error) {
+		b := NewBatch(s.desc)
+		for i, c := range cursors {
+			if err := s.readColumn(ctx, c, b.Columns[i], BatchSize, tid); err != nil {
+				return nil, err
+			}
+		}
+		rows := 0
+		for i, v := range b.Columns {
+			if i > 0 && v.Len() != rows {
+				return nil, GoDBError{MalformedDataError, fmt.Sprintf("columns %s and %s of %s have different numbers of values", s.desc.Fields[0].Fname, s.desc.Fields[i].Fname, s.file.Filename)}
+			}
+			rows = v.Len()
+		}
+		if rows == 0 {
+			return nil, nil
+		}
+		b.rows = rows
+		return b, nil
+	}, nil
+}
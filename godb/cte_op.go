@@ -0,0 +1,214 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+)
+
+// Operators for evaluating recursive common table expressions, e.g.,
+//
+//	WITH RECURSIVE reports(name) AS (
+//		SELECT name FROM emp WHERE manager = 'ann'
+//		UNION
+//		SELECT emp.name FROM emp JOIN reports ON emp.manager = reports.name)
+//	SELECT * FROM reports
+//
+// The anchor (the first input of the union) is evaluated once; the recursive
+// term (the second input) is then evaluated repeatedly, each time reading the
+// tuples produced by the previous iteration from a [WorkTable], until an
+// iteration produces no new tuples.
+
+// Maximum number of iterations of the recursive term of a [RecursiveCTE],
+// to guard against queries that never terminate.
+const maxRecursiveIterations = 10000
+
+// WorkTable is the leaf of the recursive term of a [RecursiveCTE] that reads
+// the tuples produced by the previous iteration.
+type WorkTable struct {
+	desc *TupleDesc
+	file *tempFile
+}
+
+// Construct a work table holding tuples with the supplied descriptor.  It is
+// empty until it is filled by the [RecursiveCTE] that it belongs to.
+func NewWorkTable(desc *TupleDesc) *WorkTable {
+	return &WorkTable{desc.copy(), nil}
+}
+
+func (w *WorkTable) Descriptor() *TupleDesc {
+	return w.desc.copy()
+}
+
+func (w *WorkTable) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Work Table Scan"), nil
+}
+
+// Iterate through the tuples of the current iteration.
+func (w *WorkTable) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	if w.file == nil {
+		return func() (*Tuple, error) { return nil, nil }, nil
+	}
+	return w.file.Iterator()
+}
+
+type RecursiveCTE struct {
+	anchor, recursive Operator
+	work              *WorkTable
+	all               bool
+}
+
+// Constructor for a recursive CTE.  work must be the work table read by the
+// recursive term.  The anchor and recursive term must produce tuples with the
+// same number and types of fields, and the output fields are named after those
+// of the anchor.  If all is set (UNION ALL), every tuple produced by each
+// iteration is output; otherwise duplicate tuples are removed, which also
+// ensures that the recursion terminates on cyclic data.
+func NewRecursiveCTE(anchor Operator, recursive Operator, work *WorkTable, all bool) (*RecursiveCTE, error) {
+	ad, rd := anchor.Descriptor(), recursive.Descriptor()
+	if len(ad.Fields) != len(rd.Fields) {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("anchor and recursive term of recursive query have different numbers of columns (%d and %d)", len(ad.Fields), len(rd.Fields))}
+	}
+	for i := range ad.Fields {
+		if ad.Fields[i].Ftype != rd.Fields[i].Ftype {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("column %d of the anchor and recursive term of recursive query have different types", i+1)}
+		}
+	}
+	return &RecursiveCTE{anchor, recursive, work, all}, nil
+}
+
+func (r *RecursiveCTE) Descriptor() *TupleDesc {
+	return r.anchor.Descriptor().copy()
+}
+
+func (r *RecursiveCTE) DescribePlan() (*PlanDescription, []Operator) {
+	union := "UNION"
+	if r.all {
+		union += " ALL"
+	}
+	return newPlanDescription("Recursive CTE", "union", union), []Operator{r.anchor, r.recursive}
+}
+
+// Evaluate the recursive query, materializing its result into a temporary
+// file.  Each iteration's new tuples are written both to the result and to a
+// fresh temporary file that becomes the work table of the next iteration.
+func (r *RecursiveCTE) materialize(ctx context.Context, tid TransactionID) (*tempFile, error) {
+	desc := r.Descriptor()
+	result, err := newTempFile(desc)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var delta *tempFile
+	cleanup := func() {
+		result.close()
+		if delta != nil {
+			delta.close()
+		}
+		r.work.file = nil
+	}
+
+	//add the output of iter to the result and to a new delta file, skipping
+	//tuples that were already seen unless this is a UNION ALL
+	addAll := func(iter func() (*Tuple, error)) (*tempFile, error) {
+		next, err := newTempFile(desc)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			t, err := iter()
+			if err != nil {
+				next.close()
+				return nil, err
+			}
+			if t == nil {
+				return next, nil
+			}
+			if !r.all {
+				key := t.tupleKey()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			if err := result.append(t); err != nil {
+				next.close()
+				return nil, err
+			}
+			if err := next.append(t); err != nil {
+				next.close()
+				return nil, err
+			}
+		}
+	}
+
+	iter, err := r.anchor.Iterator(ctx, tid)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	delta, err = addAll(iter)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	for i := 0; delta.numTuples > 0; i++ {
+		if i == maxRecursiveIterations {
+			cleanup()
+			return nil, GoDBError{IllegalOperationError, fmt.Sprintf("recursive query did not terminate after %d iterations", maxRecursiveIterations)}
+		}
+		r.work.file = delta
+		iter, err := r.recursive.Iterator(ctx, tid)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		next, err := addAll(iter)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		delta.close()
+		delta = next
+	}
+	delta.close()
+	r.work.file = nil
+	return result, nil
+}
+
+// Recursive CTE implementation.  The query is evaluated in full the first time
+// the iterator is invoked, after which the materialized result is streamed;
+// the temporary file holding it is deleted once the iterator is exhausted.
+func (r *RecursiveCTE) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	desc := r.Descriptor()
+	var result *tempFile
+	var resultIter func() (*Tuple, error)
+	done := false
+	return closeOnCancel(ctx, func() (*Tuple, error) {
+		if done {
+			return nil, nil
+		}
+		if result == nil {
+			var err error
+			result, err = r.materialize(ctx, tid)
+			if err != nil {
+				return nil, err
+			}
+			resultIter, err = result.Iterator()
+			if err != nil {
+				result.close()
+				return nil, err
+			}
+		}
+		t, err := resultIter()
+		if err != nil || t == nil {
+			done = true
+			result.close()
+			return nil, err
+		}
+		return &Tuple{*desc, t.Fields, nil}, nil
+	}, func() {
+		if result != nil {
+			result.close()
+		}
+	}), nil
+}
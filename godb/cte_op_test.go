@@ -0,0 +1,108 @@
+package godb
+
+import (
+	"context"
+	"testing"
+)
+
+// Build the recursive query
+//
+//	anchor UNION [ALL] SELECT name, age + 1 FROM work WHERE age < limit
+//
+// over the tuples of hf
+func makeCountingCTE(t *testing.T, hf *HeapFile, limit int64, all bool) *RecursiveCTE {
+	desc := hf.Descriptor()
+	work := NewWorkTable(desc)
+	var age Expr = &FieldExpr{desc.Fields[1]}
+	var one Expr = &ConstExpr{IntField{1}, IntType}
+	filt, err := NewFilter(age, OpLt, &ConstExpr{IntField{limit}, IntType}, work)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	proj, err := NewProjectOp([]Expr{&FieldExpr{desc.Fields[0]}, &FuncExpr{"+", []*Expr{&age, &one}}}, []string{"name", "age"}, false, filt)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cte, err := NewRecursiveCTE(hf, proj, work, all)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return cte
+}
+
+func TestRecursiveCTE(t *testing.T) {
+	_, t1, _, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+
+	// sam is 25, so the query counts from 25 to 30
+	cte := makeCountingCTE(t, hf, 30, true)
+	iter, err := cte.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var ages []int64
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		ages = append(ages, tup.Fields[1].(IntField).Value)
+	}
+	if len(ages) != 6 {
+		t.Fatalf("expected 6 results, got %v", ages)
+	}
+	for i, age := range ages {
+		if age != int64(25+i) {
+			t.Errorf("expected age %d at position %d, got %d", 25+i, i, age)
+		}
+	}
+}
+
+func TestRecursiveCTEDuplicates(t *testing.T) {
+	_, t1, _, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+
+	// both copies of sam are counted up with UNION ALL, but only one with UNION
+	for _, tc := range []struct {
+		all      bool
+		expected int
+	}{{true, 12}, {false, 6}} {
+		cte := makeCountingCTE(t, hf, 30, tc.all)
+		iter, err := cte.Iterator(context.Background(), tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		cnt := 0
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			cnt++
+		}
+		if cnt != tc.expected {
+			t.Errorf("expected %d results with all = %t, got %d", tc.expected, tc.all, cnt)
+		}
+	}
+}
+
+func TestRecursiveCTEIncompatible(t *testing.T) {
+	_, _, _, hf, _, _ := makeTestVars()
+	desc := hf.Descriptor()
+	work := NewWorkTable(desc)
+	proj, err := NewProjectOp([]Expr{&FieldExpr{desc.Fields[0]}}, []string{"name"}, false, work)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = NewRecursiveCTE(hf, proj, work, false)
+	if err == nil {
+		t.Errorf("expected error for recursive term with a different number of fields")
+	}
+}
@@ -1,5 +1,7 @@
 package godb
 
+import "context"
+
 type DeleteOp struct {
 	file DBFile
 	child Operator
@@ -20,14 +22,18 @@ func (i *DeleteOp) Descriptor() *TupleDesc {
 	return &TupleDesc{fields}
 }
 
+func (i *DeleteOp) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Delete", "file", describeFile(i.file)), []Operator{i.child}
+}
+
 // Return an iterator function that deletes all of the tuples from the child
 // iterator from the DBFile passed to the constuctor and then returns a
 // one-field tuple with a "count" field indicating the number of tuples that
 // were deleted.  Tuples should be deleted using the [DBFile.deleteTuple]
 // method.
-func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+func (dop *DeleteOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	ct := 0
-	iter, err := dop.child.Iterator(tid)
+	iter, err := dop.child.Iterator(ctx, tid)
 	if err != nil {
 		return nil, err
 	}
@@ -35,6 +41,9 @@ func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 	return func() (*Tuple, error) {
 		for {
 			t, err := iter()
+			if err != nil {
+				return nil, err
+			}
 			if t == nil {
 				var fields []DBValue
 				ctField := IntField{int64(ct)}
@@ -42,10 +51,7 @@ func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 				out := &Tuple{*dop.Descriptor().copy(), fields, 0}
 				return out, nil
 			}
-			if err != nil {
-				return nil, err
-			}
-			err = dop.file.deleteTuple(t, tid)
+			err = dop.file.deleteTuple(ctx, t, tid)
 			if err != nil {
 				return nil, err
 			}
@@ -1,13 +1,14 @@
 package godb
 
 import (
+	"context"
 	"testing"
 )
 
 func TestDelete(t *testing.T) {
 	_, t1, t2, hf, bp, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	bp.CommitTransaction(tid)
 	var f FieldType = FieldType{"age", "", IntType}
 	filt, err := NewIntFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
@@ -20,7 +21,7 @@ func TestDelete(t *testing.T) {
 	}
 	tid = NewTID()
 	bp.BeginTransaction(tid)
-	iter, _ := dop.Iterator(tid)
+	iter, _ := dop.Iterator(context.Background(), tid)
 	if iter == nil {
 		t.Fatalf("iter was nil")
 	}
@@ -43,7 +44,7 @@ func TestDelete(t *testing.T) {
 	tid = NewTID()
 	bp.BeginTransaction(tid)
 
-	iter, _ = hf.Iterator(tid)
+	iter, _ = hf.Iterator(context.Background(), tid)
 
 	cnt := 0
 	for {
@@ -58,3 +59,10 @@ func TestDelete(t *testing.T) {
 	}
 
 }
+
+func TestDeleteChildError(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	expectChildError(t, NewDeleteOp(hf, &failingOp{hf, 1}), tid, 0)
+}
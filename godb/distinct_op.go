@@ -0,0 +1,233 @@
+package godb
+
+import "context"
+
+// Maximum number of distinct tuples (or groups) that a hash-based operator
+// keeps in memory.  Once it is exceeded, the operator partitions the rest of
+// its input into temporary files by hash, and processes each partition
+// separately.
+var HashBufferSize int = 100000
+
+// Number of partitions that a hash-based operator whose input exceeds its
+// buffer splits the input into.
+const hashPartitions = 16
+
+// Maximum depth of recursive partitioning.  Partitions at this depth are
+// processed in memory regardless of their size.
+const maxPartitionDepth = 8
+
+// Return true if the two lists of field values are equal
+func fieldsEqual(f1 []DBValue, f2 []DBValue) bool {
+	if len(f1) != len(f2) {
+		return false
+	}
+	for i := range f1 {
+		if f1[i] != f2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Distinct removes duplicate tuples from its input, e.g., for SELECT DISTINCT.
+//
+// By default, it is hash based: it remembers the keys (see [appendTupleKey]) of
+// the tuples it has output, and outputs each input tuple whose key it hasn't
+// seen.  Once it has seen [HashBufferSize] keys, or the keys would exceed the
+// query's memory limit (see [MemoryTracker]), input tuples with new keys are
+// instead written to one of several temporary files by hash; as
+// duplicates are always written to the same file, each file can then be
+// deduplicated separately (recursively partitioning it if it is too large).
+//
+// A sorted distinct instead requires that its input be sorted such that
+// duplicates are adjacent, and only compares each tuple with the previous one,
+// using constant memory.
+type Distinct struct {
+	child         Operator
+	sorted        bool
+	maxBufferSize int
+}
+
+// Construct a hash-based distinct operator.
+func NewDistinct(child Operator) *Distinct {
+	return &Distinct{child, false, HashBufferSize}
+}
+
+// Construct a sort-based distinct operator.  child must output duplicate
+// tuples consecutively, e.g., because it is sorted on all of its fields.
+func NewSortedDistinct(child Operator) *Distinct {
+	return &Distinct{child, true, 0}
+}
+
+func (d *Distinct) Descriptor() *TupleDesc {
+	return d.child.Descriptor().copy()
+}
+
+func (d *Distinct) DescribePlan() (*PlanDescription, []Operator) {
+	if d.sorted {
+		return newPlanDescription("Sorted Distinct"), []Operator{d.child}
+	}
+	return newPlanDescription("Hash Distinct"), []Operator{d.child}
+}
+
+// Distinct implementation.  Without partitioning, tuples are output in the
+// order they are first seen in the input; tuples that are partitioned are
+// output after all others.
+func (d *Distinct) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := d.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	if d.sorted {
+		var last *Tuple
+		return func() (*Tuple, error) {
+			for {
+				t, err := childIter()
+				if err != nil || t == nil {
+					return nil, err
+				}
+				if last == nil || !fieldsEqual(t.Fields, last.Fields) {
+					last = t
+					return t, nil
+				}
+			}
+		}, nil
+	}
+
+	desc := d.Descriptor()
+	var pending []*hashPartition
+	closePending := func() {
+		for _, p := range pending {
+			p.file.close()
+		}
+		pending = nil
+	}
+	var part *hashPartition
+	mem := newMemoryAccount(ctx, "Hash Distinct")
+	iter := d.hashIterator(childIter, desc, 0, &pending, mem)
+	return closeOnCancel(ctx, func() (*Tuple, error) {
+		for {
+			t, err := iter()
+			if err != nil {
+				mem.release()
+				if part != nil {
+					part.file.close()
+				}
+				closePending()
+				return nil, err
+			}
+			if t != nil {
+				return t, nil
+			}
+			mem.release()
+			if part != nil {
+				part.file.close()
+				part = nil
+			}
+			if len(pending) == 0 {
+				return nil, nil
+			}
+			part, pending = pending[0], pending[1:]
+			fileIter, err := part.file.Iterator()
+			if err != nil {
+				part.file.close()
+				closePending()
+				return nil, err
+			}
+			iter = d.hashIterator(fileIter, desc, part.level, &pending, mem)
+		}
+	}, func() {
+		mem.release()
+		if part != nil {
+			part.file.close()
+			part = nil
+		}
+		closePending()
+	}), nil
+}
+
+// A temporary file holding tuples of one partition of a hash-based operator's
+// input, at the given level of recursive partitioning
+type hashPartition struct {
+	file  *tempFile
+	level int
+}
+
+// Create hashPartitions empty partitions at the given level
+func newHashPartitions(desc *TupleDesc, level int) ([]*hashPartition, error) {
+	parts := make([]*hashPartition, hashPartitions)
+	for i := range parts {
+		f, err := newTempFile(desc)
+		if err != nil {
+			for _, p := range parts[:i] {
+				p.file.close()
+			}
+			return nil, err
+		}
+		parts[i] = &hashPartition{f, level}
+	}
+	return parts, nil
+}
+
+// Return an iterator through the distinct tuples of iter, which are at the
+// given level of partitioning.  Tuples that don't fit in memory are written to
+// new partitions, which are added to pending once iter is exhausted.  The
+// memory of the keys seen is charged to mem.
+func (d *Distinct) hashIterator(iter func() (*Tuple, error), desc *TupleDesc, level int, pending *[]*hashPartition, mem *memoryAccount) func() (*Tuple, error) {
+	seen := make(map[string]bool)
+	var key []byte
+	var parts []*hashPartition
+	closeParts := func() {
+		for _, p := range parts {
+			p.file.close()
+		}
+		parts = nil
+	}
+	return func() (*Tuple, error) {
+		for {
+			t, err := iter()
+			if err != nil {
+				closeParts()
+				return nil, err
+			}
+			if t == nil {
+				for _, p := range parts {
+					if p.file.numTuples == 0 {
+						p.file.close()
+					} else {
+						*pending = append(*pending, p)
+					}
+				}
+				parts = nil
+				return nil, nil
+			}
+			key = appendTupleKey(key[:0], t.Fields)
+			if seen[string(key)] {
+				continue
+			}
+			if level >= maxPartitionDepth {
+				if err := mem.reserve(keyMemorySize(len(key))); err != nil {
+					closeParts()
+					return nil, err
+				}
+				seen[string(key)] = true
+				return &Tuple{*desc, t.Fields, nil}, nil
+			}
+			if len(seen) < d.maxBufferSize && mem.tryReserve(keyMemorySize(len(key))) {
+				seen[string(key)] = true
+				return &Tuple{*desc, t.Fields, nil}, nil
+			}
+			if parts == nil {
+				parts, err = newHashPartitions(desc, level+1)
+				if err != nil {
+					return nil, err
+				}
+			}
+			p := parts[hashKey(key, uint64(level+1))%hashPartitions]
+			if err := p.file.append(t); err != nil {
+				closeParts()
+				return nil, err
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Insert n tuples into hf, where tuple i has name "n" + (i % distinct) and age
+// (i % distinct) / 3
+func makeDistinctTestVars(t *testing.T, n int, distinct int) (TupleDesc, *HeapFile, TransactionID) {
+	td, _, _, hf, _, tid := makeTestVars()
+	for i := 0; i < n; i++ {
+		v := i % distinct
+		tup := Tuple{td, []DBValue{StringField{"n" + string(rune('a'+v%26)) + string(rune('a'+v/26))}, IntField{int64(v / 3)}}, nil}
+		if err := hf.insertTuple(context.Background(), &tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	return td, hf, tid
+}
+
+// Return the number of temporary files in the temporary directory
+func countTempFiles(t *testing.T) int {
+	files, err := filepath.Glob(filepath.Join(os.TempDir(), "godb-*.dat"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return len(files)
+}
+
+// Check that d outputs each of the distinct tuples of its input exactly once
+func checkDistinct(t *testing.T, d *Distinct, tid TransactionID, distinct int) {
+	tempFiles := countTempFiles(t)
+	seen := make(map[string]bool)
+	for _, tup := range collectTuples(t, d, tid) {
+		key := fmt.Sprint(tup.Fields)
+		if seen[key] {
+			t.Fatalf("duplicate tuple %v", tup.Fields)
+		}
+		seen[key] = true
+	}
+	if len(seen) != distinct {
+		t.Errorf("expected %d distinct tuples, got %d", distinct, len(seen))
+	}
+	if n := countTempFiles(t); n != tempFiles {
+		t.Errorf("expected temporary files to be removed, found %d more", n-tempFiles)
+	}
+}
+
+func TestDistinctInMemory(t *testing.T) {
+	_, hf, tid := makeDistinctTestVars(t, 300, 50)
+	checkDistinct(t, NewDistinct(hf), tid, 50)
+}
+
+func TestDistinctSpill(t *testing.T) {
+	_, hf, tid := makeDistinctTestVars(t, 300, 120)
+	d := NewDistinct(hf)
+	d.maxBufferSize = 20
+	checkDistinct(t, d, tid, 120)
+
+	//partitions that are still too large are partitioned again
+	d.maxBufferSize = 2
+	checkDistinct(t, d, tid, 120)
+}
+
+func TestSortedDistinct(t *testing.T) {
+	td, hf, tid := makeDistinctTestVars(t, 300, 50)
+	exprs := []Expr{&FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}}
+	oby, err := NewOrderBy(exprs, hf, []bool{true, true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkDistinct(t, NewSortedDistinct(oby), tid, 50)
+}
+
+// tuples whose hashes collide are still distinguished
+func TestTupleSetCollisions(t *testing.T) {
+	td, t1, t2, hf, _, tid := makeTestVars()
+	//find a tuple that is spilled to the same partition as t1
+	part := hashKey(appendTupleKey(nil, t1.Fields), 1) % hashPartitions
+	var t3 Tuple
+	for i := 0; ; i++ {
+		t3 = Tuple{td, []DBValue{StringField{fmt.Sprintf("sam%d", i)}, IntField{25}}, nil}
+		if hashKey(appendTupleKey(nil, t3.Fields), 1)%hashPartitions == part {
+			break
+		}
+	}
+	for _, tup := range []*Tuple{&t2, &t1, &t3, &t1, &t3} {
+		if err := hf.insertTuple(context.Background(), tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	d := NewDistinct(hf)
+	d.maxBufferSize = 1
+	checkDistinct(t, d, tid, 3)
+}
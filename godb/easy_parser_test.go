@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -134,7 +135,7 @@ func TestParseEasy(t *testing.T) {
 				return
 			}
 
-			resultIter, err := outfile.Iterator(tid)
+			resultIter, err := outfile.Iterator(context.Background(), tid)
 			if err != nil {
 				t.Errorf("%s", err.Error())
 				return
@@ -156,7 +157,7 @@ func TestParseEasy(t *testing.T) {
 
 		if printOutput || save {
 			fmt.Printf("Doing %s\n", sql)
-			iter, err := plan.Iterator(tid)
+			iter, err := plan.Iterator(context.Background(), tid)
 			if err != nil {
 				t.Errorf("%s", err.Error())
 				return
@@ -180,7 +181,7 @@ func TestParseEasy(t *testing.T) {
 				nresults++
 				if save {
 					fmt.Fprintf(outfile_csv, "%s\n", tup.PrettyPrintString(false))
-					//outfile.insertTuple(tup, tid)
+					//outfile.insertTuple(context.Background(), tup, tid)
 				}
 			}
 			fmt.Printf("(%d results)\n\n", nresults)
@@ -189,7 +190,7 @@ func TestParseEasy(t *testing.T) {
 			//outfile.bufPool.CommitTransaction(tid)
 			outfile_csv.Close()
 		} else {
-			iter, err := plan.Iterator(tid)
+			iter, err := plan.Iterator(context.Background(), tid)
 			if err != nil {
 				t.Errorf("%s", err.Error())
 				return
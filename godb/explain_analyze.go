@@ -0,0 +1,159 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// What an operator did while a plan was run by [ExplainAnalyze].  Time and
+// pages include those of the operator's children: time is measured around
+// calls to its iterator, which call its children's iterators, and pages are
+// counted for all of the requests made by the plan below it, including those
+// of parallel workers.
+type OperatorStats struct {
+	Rows  int           `json:"rows"`    // tuples output
+	Loops int           `json:"loops"`   // number of times the operator was iterated through
+	Time  time.Duration `json:"time_ns"` // time spent in calls to Iterator and its iterators
+	Pages PageStats     `json:"pages"`   // pages requested from the buffer pool by the operator and its children
+}
+
+func (s OperatorStats) String() string {
+	str := fmt.Sprintf("rows=%d", s.Rows)
+	if s.Loops != 1 {
+		str += fmt.Sprintf(" loops=%d", s.Loops)
+	}
+	return str + fmt.Sprintf(" time=%v pages hit=%d read=%d write_requests=%d", s.Time, s.Pages.Hits, s.Pages.Reads, s.Pages.WriteRequests)
+}
+
+// InstrumentedOp passes the tuples of its child through unchanged, recording
+// the child's [OperatorStats].  Pages are counted by [BufferPool.GetPage]
+// through a counter carried by the context the child is iterated with, so
+// they don't include pages requested by other queries running at the same
+// time.
+type InstrumentedOp struct {
+	child Operator
+	pages pageCounter
+	Stats OperatorStats
+}
+
+// Wrap each operator of the plan rooted at op in an [InstrumentedOp], by
+// replacing the children of each operator with their wrappers, and return the
+// wrapper of op.  A heap file read under an alias is treated as part of the
+// alias, as it is printed as a single scan.
+//
+// Only the children of the operators listed below are wrapped.  Others are
+// wrapped themselves, but the plans below them are left as they are, e.g.,
+// the batch plan of a [BatchToRow] or the child of the filter of a
+// [KeysetPager], and are described as not instrumented by [DescribePlan].
+func Instrument(op Operator) *InstrumentedOp {
+	switch op := op.(type) {
+	case *EqualityJoin[int64]:
+		left, right := Operator(Instrument(*op.left)), Operator(Instrument(*op.right))
+		op.left, op.right = &left, &right
+	case *EqualityJoin[string]:
+		left, right := Operator(Instrument(*op.left)), Operator(Instrument(*op.right))
+		op.left, op.right = &left, &right
+	case *HashJoin:
+		op.left, op.right = Instrument(op.left), Instrument(op.right)
+	case *SortMergeJoin:
+		op.left, op.right = Instrument(op.left), Instrument(op.right)
+	case *SemiJoin:
+		op.left, op.right = Instrument(op.left), Instrument(op.right)
+	case *SetOp:
+		op.left, op.right = Instrument(op.left), Instrument(op.right)
+	case *SubqueryFilter:
+		op.child, op.subquery = Instrument(op.child), Instrument(op.subquery)
+	case *RecursiveCTE:
+		op.anchor, op.recursive = Instrument(op.anchor), Instrument(op.recursive)
+	case *AliasOp:
+		if _, ok := op.child.(*HeapFile); !ok {
+			op.child = Instrument(op.child)
+		}
+	case *Project:
+		op.child = Instrument(op.child)
+	case *Filter[int64]:
+		op.child = Instrument(op.child)
+	case *Filter[string]:
+		op.child = Instrument(op.child)
+	case *OrderBy:
+		op.child = Instrument(op.child)
+	case *Distinct:
+		op.child = Instrument(op.child)
+	case *LimitOp:
+		op.child = Instrument(op.child)
+	case *TopN:
+		op.child = Instrument(op.child)
+	case *Window:
+		op.child = Instrument(op.child)
+	case *Aggregator:
+		op.child = Instrument(op.child)
+	case *Gather:
+		for i, child := range op.children {
+			op.children[i] = Instrument(child)
+		}
+	case *ExchangeOutput:
+		//the children are shared by all of the outputs
+		if e := op.exchange; op.index == 0 {
+			for i, child := range e.children {
+				e.children[i] = Instrument(child)
+			}
+		}
+	case *InsertOp:
+		op.child = Instrument(op.child)
+	case *DeleteOp:
+		op.child = Instrument(op.child)
+	}
+	return &InstrumentedOp{child: op}
+}
+
+// Instrument the plan rooted at op (see [Instrument]) and run it to completion
+// in transaction tid, discarding its output.  The stats of each operator are
+// included in the returned plan's [DescribePlan].
+func ExplainAnalyze(ctx context.Context, op Operator, tid TransactionID) (*InstrumentedOp, error) {
+	plan := Instrument(op)
+	iter, err := plan.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return plan, nil
+		}
+	}
+}
+
+func (op *InstrumentedOp) Descriptor() *TupleDesc {
+	return op.child.Descriptor()
+}
+
+// Add the time used since start to the stats, and update the pages requested
+func (op *InstrumentedOp) record(start time.Time) {
+	op.Stats.Time += time.Since(start)
+	op.Stats.Pages = op.pages.stats()
+}
+
+// InstrumentedOp implementation.  Stats accumulate over all of the iterators
+// returned, e.g., for a subquery that is evaluated once per outer tuple.
+func (op *InstrumentedOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	op.Stats.Loops++
+	start := time.Now()
+	iter, err := op.child.Iterator(withPageCounter(ctx, &op.pages), tid)
+	op.record(start)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		start := time.Now()
+		t, err := iter()
+		op.record(start)
+		if t != nil {
+			op.Stats.Rows++
+		}
+		return t, err
+	}, nil
+}
@@ -0,0 +1,137 @@
+package godb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// Parse sql and run it with ExplainAnalyze in its own transaction
+func runExplainAnalyze(t *testing.T, c *Catalog, bp *BufferPool, sql string) *InstrumentedOp {
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", sql, err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	analyzed, err := ExplainAnalyze(context.Background(), plan, tid)
+	if err != nil {
+		t.Fatalf("failed to run, q=%s, %s", sql, err.Error())
+	}
+	return analyzed
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	sql := "select t.name from t, t2 where t.name = t2.name and t.age > 40"
+	analyzed := runExplainAnalyze(t, c, bp, sql)
+	if expected := len(runParserTestQuery(t, c, bp, sql)); analyzed.Stats.Rows != expected {
+		t.Errorf("expected %d rows, got %d", expected, analyzed.Stats.Rows)
+	}
+	if analyzed.Stats.Loops != 1 {
+		t.Errorf("expected one loop, got %d", analyzed.Stats.Loops)
+	}
+	if analyzed.Stats.Pages.Hits+analyzed.Stats.Pages.Reads == 0 {
+		t.Errorf("expected pages to be read")
+	}
+
+	//the scans of t and t2 output all 12 of their tuples, and the filter
+	//the 6 older than 40
+	var buf bytes.Buffer
+	WritePlan(&buf, DescribePlan(c, analyzed), PlanText)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	scans, filters := 0, 0
+	for _, line := range lines {
+		if !strings.Contains(line, "rows=") {
+			t.Errorf("expected stats on every line, got '%s'", line)
+		}
+		if strings.Contains(line, "Heap Scan") && strings.Contains(line, "rows=12 ") {
+			scans++
+		}
+		if strings.Contains(line, "Filter") && strings.Contains(line, "rows=6 ") {
+			filters++
+		}
+	}
+	if scans != 2 || filters != 1 {
+		t.Errorf("expected two scans of 12 rows and a filter of 6 rows, got plan\n%s", buf.String())
+	}
+}
+
+func TestExplainAnalyzeLoops(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	//the correlated subquery is evaluated once per tuple of t
+	analyzed := runExplainAnalyze(t, c, bp, "select name from t where age = (select max(age) from t2 where t2.name = t.name)")
+	filter, ok := analyzed.child.(*Project).child.(*InstrumentedOp).child.(*SubqueryFilter)
+	if !ok {
+		var buf bytes.Buffer
+		WritePlan(&buf, DescribePlan(c, analyzed), PlanText)
+		t.Fatalf("expected subquery filter below project, got plan\n%s", buf.String())
+	}
+	if loops := filter.subquery.(*InstrumentedOp).Stats.Loops; loops != 12 {
+		t.Errorf("expected 12 loops of the subquery, got %d", loops)
+	}
+}
+
+// The plans below operators whose children aren't instrumented, like the
+// batch plan of a BatchToRow, are described as not instrumented
+func TestExplainAnalyzeNotInstrumented(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	analyzed, err := ExplainAnalyze(context.Background(), NewBatchToRow(NewRowToBatch(hf)), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	d := DescribePlan(nil, analyzed)
+	if d.Actual == nil || d.Actual.Rows != 2 || d.NotInstrumented {
+		t.Errorf("expected the batch to row adapter to be instrumented, got %+v", d)
+	}
+	var buf bytes.Buffer
+	WritePlan(&buf, d, PlanText)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected the batch plan to be described, got plan\n%s", buf.String())
+	}
+	for _, line := range lines[1:] {
+		if !strings.Contains(line, "not instrumented") {
+			t.Errorf("expected '%s' to be described as not instrumented", line)
+		}
+	}
+}
+
+// Pages requested by other queries while a plan runs aren't counted for it
+func TestExplainAnalyzePages(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	run := func(other bool) PageStats {
+		plan := Instrument(hf)
+		iter, err := plan.Iterator(context.Background(), tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				return plan.Stats.Pages
+			}
+			if other {
+				if _, err := bp.GetPage(context.Background(), hf, 0, tid, WritePerm); err != nil {
+					t.Fatalf(err.Error())
+				}
+			}
+		}
+	}
+	alone := run(false)
+	if alone.Hits+alone.Reads == 0 {
+		t.Errorf("expected pages to be read")
+	}
+	if pages := run(true); pages != alone {
+		t.Errorf("expected %+v pages, as when the plan ran alone, got %+v", alone, pages)
+	}
+}
@@ -0,0 +1,260 @@
+package godb
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Maximum number of tuples that an external sort (e.g., of an [OrderBy])
+// buffers in memory; once it is exceeded, the buffered tuples are sorted and
+// spilled to a temporary file.
+var SortBufferSize int = 100000
+
+// Maximum number of sorted runs that are merged at once.  If a sort spills
+// more runs than this, groups of runs are first merged into longer runs.
+const sortMergeFanIn = 64
+
+// externalSorter sorts a stream of tuples that may not fit in memory.  Tuples
+// are added to an in-memory buffer; when the buffer holds maxBufferSize tuples
+// it is sorted and written to a temporary file as a sorted run.  Once all
+// tuples have been added, the runs are merged to produce the sorted output.
+// If no run was written, the tuples are simply sorted in memory.  The buffer
+// is also spilled early if the query's memory limit (see [MemoryTracker])
+// would be exceeded.
+//
+// The order is given by less, so the sorter can be used by any operator that
+// needs its input sorted, not just [OrderBy].  Tuples that compare equal are
+// returned in the order they were added.
+type externalSorter struct {
+	desc          *TupleDesc
+	less          func(t1, t2 *Tuple) bool
+	maxBufferSize int
+	fanIn         int
+	buf           []*Tuple
+	runs          []*tempFile
+	mem           *memoryAccount // charged for the buffered tuples
+}
+
+// Create a sorter for tuples with descriptor desc that buffers at most
+// maxBufferSize tuples in memory, charging them to mem.
+func newExternalSorter(desc *TupleDesc, less func(t1, t2 *Tuple) bool, maxBufferSize int, mem *memoryAccount) *externalSorter {
+	if maxBufferSize < 1 {
+		maxBufferSize = 1
+	}
+	return &externalSorter{desc: desc, less: less, maxBufferSize: maxBufferSize, fanIn: sortMergeFanIn, mem: mem}
+}
+
+// Add t to the tuples to be sorted, spilling the buffered tuples to a new run
+// if the buffer is full, or to make room for t under the memory limit.
+func (s *externalSorter) add(t *Tuple) error {
+	size := tupleMemorySize(t)
+	if !s.mem.tryReserve(size) {
+		if len(s.buf) > 0 {
+			if err := s.spill(); err != nil {
+				return err
+			}
+		}
+		if err := s.mem.reserve(size); err != nil {
+			return err
+		}
+	}
+	s.buf = append(s.buf, t)
+	if len(s.buf) >= s.maxBufferSize {
+		return s.spill()
+	}
+	return nil
+}
+
+// Sort the buffered tuples and write them to a new run.
+func (s *externalSorter) spill() error {
+	sort.SliceStable(s.buf, func(i, j int) bool {
+		return s.less(s.buf[i], s.buf[j])
+	})
+	run, err := newTempFile(s.desc)
+	if err != nil {
+		return err
+	}
+	for _, t := range s.buf {
+		if err := run.append(t); err != nil {
+			run.close()
+			return err
+		}
+	}
+	s.runs = append(s.runs, run)
+	s.buf = nil
+	s.mem.release()
+	return nil
+}
+
+// Return an iterator through the sorted tuples.  No tuples may be added once
+// the iterator has been created.  The runs are deleted once the iterator is
+// exhausted or returns an error.
+func (s *externalSorter) Iterator() (func() (*Tuple, error), error) {
+	if len(s.runs) == 0 {
+		tups := s.buf
+		s.buf = nil
+		sort.SliceStable(tups, func(i, j int) bool {
+			return s.less(tups[i], tups[j])
+		})
+		i := 0
+		return func() (*Tuple, error) {
+			if i == len(tups) {
+				s.mem.release()
+				return nil, nil
+			}
+			i++
+			return tups[i-1], nil
+		}, nil
+	}
+
+	if len(s.buf) > 0 {
+		if err := s.spill(); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	//merge the oldest runs first so that equal tuples stay in the order
+	//they were added
+	for len(s.runs) > s.fanIn {
+		run, err := s.mergeRuns(s.runs[:s.fanIn])
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.runs = append([]*tempFile{run}, s.runs[s.fanIn:]...)
+	}
+	iter, err := s.merge(s.runs)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		t, err := iter()
+		if err != nil || t == nil {
+			s.close()
+		}
+		return t, err
+	}, nil
+}
+
+// Merge runs into a single new run, deleting them.
+func (s *externalSorter) mergeRuns(runs []*tempFile) (*tempFile, error) {
+	merged, err := newTempFile(s.desc)
+	if err != nil {
+		return nil, err
+	}
+	iter, err := s.merge(runs)
+	if err != nil {
+		merged.close()
+		return nil, err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			merged.close()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		if err := merged.append(t); err != nil {
+			merged.close()
+			return nil, err
+		}
+	}
+	for _, run := range runs {
+		run.close()
+	}
+	return merged, nil
+}
+
+// Return an iterator that merges the sorted runs, using a heap holding the
+// next tuple of each run.
+func (s *externalSorter) merge(runs []*tempFile) (func() (*Tuple, error), error) {
+	h := &mergeHeap{less: s.less}
+	for i, run := range runs {
+		iter, err := run.Iterator()
+		if err != nil {
+			return nil, err
+		}
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			h.heads = append(h.heads, &mergeHead{t, i, iter})
+		}
+	}
+	heap.Init(h)
+	return func() (*Tuple, error) {
+		if h.Len() == 0 {
+			return nil, nil
+		}
+		head := h.heads[0]
+		t := &Tuple{*s.desc, head.tup.Fields, nil}
+		next, err := head.iter()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			heap.Pop(h)
+		} else {
+			head.tup = next
+			heap.Fix(h, 0)
+		}
+		return t, nil
+	}, nil
+}
+
+// Delete all runs.  The sorter may not be used afterwards.
+func (s *externalSorter) close() {
+	for _, run := range s.runs {
+		run.close()
+	}
+	s.runs = nil
+	s.buf = nil
+	s.mem.release()
+}
+
+// The next tuple of a sorted run being merged
+type mergeHead struct {
+	tup  *Tuple
+	run  int
+	iter func() (*Tuple, error)
+}
+
+// mergeHeap implements [heap.Interface], ordering the next tuples of the runs
+// being merged.  Ties are broken by run, so that merging is stable.
+type mergeHeap struct {
+	heads []*mergeHead
+	less  func(t1, t2 *Tuple) bool
+}
+
+func (h *mergeHeap) Len() int {
+	return len(h.heads)
+}
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.heads[i], h.heads[j]
+	if h.less(a.tup, b.tup) {
+		return true
+	}
+	if h.less(b.tup, a.tup) {
+		return false
+	}
+	return a.run < b.run
+}
+
+func (h *mergeHeap) Swap(i, j int) {
+	h.heads[i], h.heads[j] = h.heads[j], h.heads[i]
+}
+
+func (h *mergeHeap) Push(x any) {
+	h.heads = append(h.heads, x.(*mergeHead))
+}
+
+func (h *mergeHeap) Pop() any {
+	head := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return head
+}
@@ -0,0 +1,111 @@
+package godb
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// Sort n tuples of the form (name, age), where ages cycle through 0..6 and
+// the names record the order the tuples were added, by age with a sorter
+// buffering at most bufSize tuples, and check that the output is sorted and
+// stable.  The sorter charges its memory to mem, if it isn't nil.  Returns the
+// sorter so callers can check how it was run.
+func runExternalSortTest(t *testing.T, n int, bufSize int, fanIn int, mem *MemoryTracker) *externalSorter {
+	td, _, _, _, _, _ := makeTestVars()
+	age := &FieldExpr{td.Fields[1]}
+	less := func(t1, t2 *Tuple) bool {
+		ord, _ := t1.compareField(t2, age)
+		return ord == OrderedLessThan
+	}
+	ctx := context.Background()
+	if mem != nil {
+		ctx = WithMemoryTracker(ctx, mem)
+	}
+	s := newExternalSorter(&td, less, bufSize, newMemoryAccount(ctx, "Order By"))
+	s.fanIn = fanIn
+	for i := 0; i < n; i++ {
+		name := string(rune('a'+i/26%26)) + string(rune('a'+i%26))
+		tup := &Tuple{td, []DBValue{StringField{name}, IntField{int64(i % 7)}}, nil}
+		if err := s.add(tup); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	iter, err := s.Iterator()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var names []string
+	for _, run := range s.runs {
+		names = append(names, run.file.Filename)
+	}
+
+	var last *Tuple
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if !tup.Desc.equals(&td) {
+			t.Fatalf("unexpected descriptor %v", tup.Desc)
+		}
+		if last != nil {
+			ord, _ := last.compareField(tup, age)
+			if ord == OrderedGreaterThan {
+				t.Fatalf("tuple %v sorted after %v", tup.Fields, last.Fields)
+			}
+			if ord == OrderedEqual && last.Fields[0].(StringField).Value > tup.Fields[0].(StringField).Value {
+				t.Fatalf("sort was not stable: %v returned before %v", last.Fields, tup.Fields)
+			}
+		}
+		last = tup
+		cnt++
+	}
+	if cnt != n {
+		t.Errorf("expected %d tuples, got %d", n, cnt)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("expected run %s to be removed", name)
+		}
+	}
+	return s
+}
+
+func TestExternalSortInMemory(t *testing.T) {
+	s := runExternalSortTest(t, 100, 1000, sortMergeFanIn, nil)
+	if len(s.runs) != 0 {
+		t.Errorf("expected no runs to be spilled")
+	}
+}
+
+func TestExternalSortSpill(t *testing.T) {
+	//20 runs, merged in one pass
+	runExternalSortTest(t, 500, 25, sortMergeFanIn, nil)
+	//the last run is only partially full
+	runExternalSortTest(t, 510, 25, sortMergeFanIn, nil)
+}
+
+func TestExternalSortMultiPass(t *testing.T) {
+	//50 runs, merged 4 at a time
+	runExternalSortTest(t, 500, 10, 4, nil)
+}
+
+func TestExternalSortMemoryLimit(t *testing.T) {
+	//the buffer would hold all of the tuples, but the memory limit only
+	//allows about 20 of them at a time
+	td, _, _, _, _, _ := makeTestVars()
+	limit := 20 * tupleMemorySize(&Tuple{td, []DBValue{StringField{"aa"}, IntField{0}}, nil})
+	mem := NewMemoryTracker(limit)
+	runExternalSortTest(t, 500, 1000, sortMergeFanIn, mem)
+	if mem.Peak() > limit {
+		t.Errorf("expected at most %d bytes to be used, got %d", limit, mem.Peak())
+	}
+	if mem.Peak() == 0 || mem.Used() != 0 {
+		t.Errorf("expected the memory of the sort to be charged and then released, peak %d, used %d", mem.Peak(), mem.Used())
+	}
+}
@@ -1,7 +1,9 @@
 package godb
 
 import (
+	"context"
 	"golang.org/x/exp/constraints"
+	"strings"
 )
 
 type Filter[T constraints.Ordered] struct {
@@ -22,12 +24,29 @@ func stringFilterGetter(v DBValue) string {
 	return stringV.Value
 }
 
+// Constructor for a filter operator comparing two arbitrary expressions, e.g.,
+// price > cost * 2.  Both expressions are evaluated against every child tuple,
+// so either side may reference fields, constants, or functions of them.
+// Returns an error if the two expressions are not of the same type.
+func NewFilter(left Expr, op BoolOp, right Expr, child Operator) (Operator, error) {
+	if left.GetExprType().Ftype != right.GetExprType().Ftype {
+		return nil, GoDBError{IncompatibleTypesError, "cannot compare expressions of different types in filter"}
+	}
+	switch left.GetExprType().Ftype {
+	case IntType:
+		return newFilter[int64](left, op, right, child, intFilterGetter)
+	case StringType:
+		return newFilter[string](left, op, right, child, stringFilterGetter)
+	}
+	return nil, GoDBError{TypeMismatchError, "unknown type in filter"}
+}
+
 // Constructor for a filter operator on ints
 func NewIntFilter(constExpr Expr, op BoolOp, field Expr, child Operator) (*Filter[int64], error) {
 	if constExpr.GetExprType().Ftype != IntType || field.GetExprType().Ftype != IntType {
 		return nil, GoDBError{IncompatibleTypesError, "cannot apply int filter to non int-types"}
 	}
-	f, err := newFilter[int64](constExpr, op, field, child, intFilterGetter)
+	f, err := newFilter[int64](field, op, constExpr, child, intFilterGetter)
 	return f, err
 }
 
@@ -36,7 +55,7 @@ func NewStringFilter(constExpr Expr, op BoolOp, field Expr, child Operator) (*Fi
 	if constExpr.GetExprType().Ftype != StringType || field.GetExprType().Ftype != StringType {
 		return nil, GoDBError{IncompatibleTypesError, "cannot apply string filter to non string-types"}
 	}
-	f, err := newFilter[string](constExpr, op, field, child, stringFilterGetter)
+	f, err := newFilter[string](field, op, constExpr, child, stringFilterGetter)
 	return f, err
 }
 
@@ -44,23 +63,27 @@ func NewStringFilter(constExpr Expr, op BoolOp, field Expr, child Operator) (*Fi
 // from a field of a tuple
 // This allows us to have a generic interface for filters that work
 // with any ordered type
-func newFilter[T constraints.Ordered](constExpr Expr, op BoolOp, field Expr, child Operator, getter func(DBValue) T) (*Filter[T], error) {
-	return &Filter[T]{op, field, constExpr, child, getter}, nil
+func newFilter[T constraints.Ordered](left Expr, op BoolOp, right Expr, child Operator, getter func(DBValue) T) (*Filter[T], error) {
+	return &Filter[T]{op, left, right, child, getter}, nil
 }
 
-// Return a TupleDescriptor for this filter op.
+// Return a TupleDescriptor for this filter op.  A filter does not change the
+// shape of its input, so this is just the child's descriptor.
 func (f *Filter[T]) Descriptor() *TupleDesc {
-	desc := make([]FieldType, 2)
-	desc = append(desc, f.left.GetExprType(), f.right.GetExprType())
-	return &TupleDesc{desc}
+	return f.child.Descriptor().copy()
+}
+
+func (f *Filter[T]) DescribePlan() (*PlanDescription, []Operator) {
+	pred := exprToStr(f.left) + " " + strings.TrimSpace(opToStr(f.op)) + " " + exprToStr(f.right)
+	return newPlanDescription("Filter", "predicate", pred), []Operator{f.child}
 }
 
 // Filter operator implementation. This function should iterate over
 // the results of the child iterator and return a tuple if it satisfies
 // the predicate.
 // HINT: you can use the evalPred function defined in types.go to compare two values
-func (f *Filter[T]) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
-	iter, err := f.child.Iterator(tid)
+func (f *Filter[T]) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := f.child.Iterator(ctx, tid)
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +98,14 @@ func (f *Filter[T]) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 				return nil, nil
 			}
 
-			v, _ := f.left.EvalExpr(tuple)
-			vv, _ := f.right.EvalExpr(tuple)
+			v, err := f.left.EvalExpr(tuple)
+			if err != nil {
+				return nil, err
+			}
+			vv, err := f.right.EvalExpr(tuple)
+			if err != nil {
+				return nil, err
+			}
 			leftVal := f.getter(v)
 			rightVal := f.getter(vv)
 
@@ -87,4 +116,4 @@ func (f *Filter[T]) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 	}
 
 	return iterator, nil
-}
\ No newline at end of file
+}
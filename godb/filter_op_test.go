@@ -1,20 +1,21 @@
 package godb
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
 
 func TestIntFilter(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	var f FieldType = FieldType{"age", "", IntType}
 	filt, err := NewIntFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
-	iter, err := filt.Iterator(tid)
+	iter, err := filt.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -38,14 +39,14 @@ func TestIntFilter(t *testing.T) {
 
 func TestStringFilter(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	var f FieldType = FieldType{"name", "", StringType}
 	filt, err := NewStringFilter(&ConstExpr{StringField{"sam"}, StringType}, OpEq, &FieldExpr{f}, hf)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
-	iter, err := filt.Iterator(tid)
+	iter, err := filt.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -66,3 +67,55 @@ func TestStringFilter(t *testing.T) {
 		t.Errorf("unexpected number of results")
 	}
 }
+
+func TestExprFilter(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	var f FieldType = FieldType{"age", "", IntType}
+	var age Expr = &FieldExpr{f}
+	var two Expr = &ConstExpr{IntField{2}, IntType}
+	var hundred Expr = &ConstExpr{IntField{100}, IntType}
+	// age * 2 > age + 100, which only george jones (999) satisfies
+	left := &FuncExpr{"*", []*Expr{&age, &two}}
+	right := &FuncExpr{"+", []*Expr{&age, &hundred}}
+	filt, err := NewFilter(left, OpGt, right, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := filt.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		if !tup.equals(&t2) {
+			t.Errorf("unexpected tuple %v passed filter", tup)
+		}
+		cnt++
+	}
+	if cnt != 1 {
+		t.Errorf("unexpected number of results")
+	}
+	if !filt.Descriptor().equals(hf.Descriptor()) {
+		t.Errorf("filter descriptor should match child descriptor")
+	}
+}
+
+func TestExprFilterTypeMismatch(t *testing.T) {
+	_, _, _, hf, _, _ := makeTestVars()
+	var name FieldType = FieldType{"name", "", StringType}
+	var age FieldType = FieldType{"age", "", IntType}
+	_, err := NewFilter(&FieldExpr{name}, OpEq, &FieldExpr{age}, hf)
+	if err == nil {
+		t.Errorf("expected error comparing string and int expressions")
+	}
+}
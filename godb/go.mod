@@ -1,10 +1,9 @@
 module github.com/srmadden/godb
 
-go 1.19
+go 1.21
 
 require (
 	github.com/bits-and-blooms/bitset v1.8.0
-	github.com/mitchellh/hashstructure/v2 v2.0.2
 	github.com/xwb1989/sqlparser v0.0.0-20180606152119-120387863bf2
 	golang.org/x/exp v0.0.0-20230522175609-2e198f4a06a1
 )
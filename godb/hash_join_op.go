@@ -0,0 +1,285 @@
+package godb
+
+import "context"
+
+// HashJoin is an equality join that reads its right input into a hash table
+// keyed by the values of rightFields, and then probes the table with each
+// tuple of its left input.  A left and a right tuple join if every leftFields
+// expression evaluates to the same value as the corresponding rightFields
+// expression.  Unlike [EqualityJoin], it reads each input only once.
+//
+// If the right input has more than maxBufferSize tuples, or its tuples would
+// exceed the query's memory limit (see [MemoryTracker]), the join instead
+// partitions both inputs into temporary files by the hash of their keys (a
+// grace hash join).  As matching tuples are always written to partitions with
+// the same number, each pair of partitions is then joined separately,
+// recursively partitioning pairs whose right partition is still too large.
+type HashJoin struct {
+	leftFields, rightFields []Expr
+	left, right             Operator
+	maxBufferSize           int
+}
+
+// Check that the join keys of the two sides of a join line up
+func checkJoinKeys(leftFields []Expr, rightFields []Expr) error {
+	if len(leftFields) == 0 || len(leftFields) != len(rightFields) {
+		return GoDBError{IllegalOperationError, "join requires the same, non-zero, number of fields on each side"}
+	}
+	for i := range leftFields {
+		if leftFields[i].GetExprType().Ftype != rightFields[i].GetExprType().Ftype {
+			return GoDBError{TypeMismatchError, "can't join fields of different types"}
+		}
+	}
+	return nil
+}
+
+// Constructor for a hash join.  Returns an error if the two lists of
+// expressions differ in length or in the types of their expressions.
+func NewHashJoin(left Operator, leftFields []Expr, right Operator, rightFields []Expr) (*HashJoin, error) {
+	if err := checkJoinKeys(leftFields, rightFields); err != nil {
+		return nil, err
+	}
+	return &HashJoin{leftFields, rightFields, left, right, HashBufferSize}, nil
+}
+
+// The hash join outputs the fields of the left input followed by those of the
+// right input.
+func (hj *HashJoin) Descriptor() *TupleDesc {
+	return hj.left.Descriptor().merge(hj.right.Descriptor())
+}
+
+func (hj *HashJoin) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Hash Join", "keys", describeJoinKeys(hj.leftFields, hj.rightFields)), []Operator{hj.left, hj.right}
+}
+
+// Append the key encoding (see [appendTupleKey]) of the values of exprs
+// applied to t to buf
+func appendJoinKey(buf []byte, exprs []Expr, t *Tuple) ([]byte, error) {
+	for _, e := range exprs {
+		v, err := e.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		buf = appendTupleKey(buf, []DBValue{v})
+	}
+	return buf, nil
+}
+
+// A pair of temporary files holding the tuples of the left and right inputs
+// of a hash join whose keys hash to the same partition
+type joinPartition struct {
+	left, right *tempFile
+	level       int
+}
+
+func (p *joinPartition) close() {
+	p.left.close()
+	p.right.close()
+}
+
+// Hash join implementation.  Without partitioning, tuples are output in the
+// order of the left input, and tuples with the same left tuple in the order of
+// the right input; pairs of partitions are joined after all other tuples.
+func (hj *HashJoin) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	leftIter, err := hj.left.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	rightIter, err := hj.right.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	var pending []*joinPartition
+	closePending := func() {
+		for _, p := range pending {
+			p.close()
+		}
+		pending = nil
+	}
+	var part *joinPartition
+	mem := newMemoryAccount(ctx, "Hash Join")
+	iter := hj.joinIterator(leftIter, rightIter, 0, &pending, mem)
+	return closeOnCancel(ctx, func() (*Tuple, error) {
+		for {
+			t, err := iter()
+			if err != nil {
+				mem.release()
+				if part != nil {
+					part.close()
+				}
+				closePending()
+				return nil, err
+			}
+			if t != nil {
+				return t, nil
+			}
+			mem.release()
+			if part != nil {
+				part.close()
+				part = nil
+			}
+			if len(pending) == 0 {
+				return nil, nil
+			}
+			part, pending = pending[0], pending[1:]
+			leftIter, err := part.left.Iterator()
+			if err != nil {
+				part.close()
+				closePending()
+				return nil, err
+			}
+			rightIter, err := part.right.Iterator()
+			if err != nil {
+				part.close()
+				closePending()
+				return nil, err
+			}
+			iter = hj.joinIterator(leftIter, rightIter, part.level, &pending, mem)
+		}
+	}, func() {
+		mem.release()
+		if part != nil {
+			part.close()
+			part = nil
+		}
+		closePending()
+	}), nil
+}
+
+// Return an iterator through the join of leftIter and rightIter, which are at
+// the given level of partitioning.  If the right input doesn't fit in memory,
+// both inputs are instead written to new partitions, which are added to
+// pending, and the iterator returns no tuples.  The memory of the hash table
+// is charged to mem.
+func (hj *HashJoin) joinIterator(leftIter func() (*Tuple, error), rightIter func() (*Tuple, error), level int, pending *[]*joinPartition, mem *memoryAccount) func() (*Tuple, error) {
+	var table map[string][]*Tuple
+	built := false
+	var key []byte
+	var left *Tuple
+	var matches []*Tuple
+	return func() (*Tuple, error) {
+		if !built {
+			var err error
+			table, err = hj.build(leftIter, rightIter, level, pending, mem)
+			if err != nil {
+				return nil, err
+			}
+			built = true
+		}
+		if table == nil {
+			return nil, nil
+		}
+		for len(matches) == 0 {
+			t, err := leftIter()
+			if err != nil || t == nil {
+				return nil, err
+			}
+			key, err = appendJoinKey(key[:0], hj.leftFields, t)
+			if err != nil {
+				return nil, err
+			}
+			left, matches = t, table[string(key)]
+		}
+		right := matches[0]
+		matches = matches[1:]
+		return joinTuples(left, right), nil
+	}
+}
+
+// Read the tuples of rightIter into a hash table.  If there are too many of
+// them, instead partition both inputs, returning a nil table.
+func (hj *HashJoin) build(leftIter func() (*Tuple, error), rightIter func() (*Tuple, error), level int, pending *[]*joinPartition, mem *memoryAccount) (map[string][]*Tuple, error) {
+	table := make(map[string][]*Tuple)
+	var key []byte
+	n := 0
+	for {
+		t, err := rightIter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return table, nil
+		}
+		key, err = appendJoinKey(key[:0], hj.rightFields, t)
+		if err != nil {
+			return nil, err
+		}
+		table[string(key)] = append(table[string(key)], t)
+		n++
+		size := tupleMemorySize(t) + keyMemorySize(len(key))
+		if level >= maxPartitionDepth {
+			if err := mem.reserve(size); err != nil {
+				return nil, err
+			}
+		} else if n > hj.maxBufferSize || !mem.tryReserve(size) {
+			break
+		}
+	}
+
+	leftParts, err := newHashPartitions(hj.left.Descriptor(), level+1)
+	if err != nil {
+		return nil, err
+	}
+	rightParts, err := newHashPartitions(hj.right.Descriptor(), level+1)
+	if err != nil {
+		for _, p := range leftParts {
+			p.file.close()
+		}
+		return nil, err
+	}
+	closeParts := func() {
+		for i := range leftParts {
+			leftParts[i].file.close()
+			rightParts[i].file.close()
+		}
+	}
+	for k, tups := range table {
+		p := rightParts[hashKey([]byte(k), uint64(level+1))%hashPartitions]
+		for _, t := range tups {
+			if err := p.file.append(t); err != nil {
+				closeParts()
+				return nil, err
+			}
+		}
+	}
+	for _, input := range []struct {
+		iter   func() (*Tuple, error)
+		fields []Expr
+		parts  []*hashPartition
+	}{
+		{rightIter, hj.rightFields, rightParts},
+		{leftIter, hj.leftFields, leftParts},
+	} {
+		for {
+			t, err := input.iter()
+			if err != nil {
+				closeParts()
+				return nil, err
+			}
+			if t == nil {
+				break
+			}
+			key, err = appendJoinKey(key[:0], input.fields, t)
+			if err != nil {
+				closeParts()
+				return nil, err
+			}
+			p := input.parts[hashKey(key, uint64(level+1))%hashPartitions]
+			if err := p.file.append(t); err != nil {
+				closeParts()
+				return nil, err
+			}
+		}
+	}
+	mem.release()
+	//partitions with no tuples on either side produce no output
+	for i := range leftParts {
+		part := &joinPartition{leftParts[i].file, rightParts[i].file, level + 1}
+		if part.left.numTuples == 0 || part.right.numTuples == 0 {
+			part.close()
+		} else {
+			*pending = append(*pending, part)
+		}
+	}
+	return nil, nil
+}
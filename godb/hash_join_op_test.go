@@ -0,0 +1,93 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Check that join outputs the same tuples as expected, in any order
+func checkJoinOutput(t *testing.T, join Operator, expected Operator, tid TransactionID) {
+	tempFiles := countTempFiles(t)
+	counts := make(map[string]int)
+	want := collectTuples(t, expected, tid)
+	for _, tup := range want {
+		counts[fmt.Sprint(tup.Fields)]++
+	}
+	got := collectTuples(t, join, tid)
+	for _, tup := range got {
+		key := fmt.Sprint(tup.Fields)
+		if counts[key] == 0 {
+			t.Fatalf("unexpected tuple %v", tup.Fields)
+		}
+		counts[key]--
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d tuples, got %d", len(want), len(got))
+	}
+	if n := countTempFiles(t); n != tempFiles {
+		t.Errorf("expected temporary files to be removed, found %d more", n-tempFiles)
+	}
+}
+
+// Return a filter passing the tuples of hf with age < 10, so that the two
+// inputs of the joins under test differ
+func makeJoinTestFilter(t *testing.T, td TupleDesc, hf *HeapFile) Operator {
+	filter, err := NewFilter(&FieldExpr{td.Fields[1]}, OpLt, &ConstExpr{IntField{10}, IntType}, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return filter
+}
+
+func TestHashJoin(t *testing.T) {
+	td, hf, tid := makeDistinctTestVars(t, 300, 60)
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+	right := makeJoinTestFilter(t, td, hf)
+	expected, err := NewStringJoin(hf, name, right, name, JoinBufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hj, err := NewHashJoin(hf, []Expr{name}, right, []Expr{name})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkJoinOutput(t, hj, expected, tid)
+
+	//joins on several fields match them all
+	hj, err = NewHashJoin(hf, []Expr{age, name}, hf, []Expr{age, name})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected, err = NewStringJoin(hf, name, hf, name, JoinBufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkJoinOutput(t, hj, expected, tid)
+
+	if _, err := NewHashJoin(hf, []Expr{name}, hf, []Expr{age}); err == nil {
+		t.Errorf("expected error joining fields of different types")
+	}
+	if _, err := NewHashJoin(hf, []Expr{name, age}, hf, []Expr{name}); err == nil {
+		t.Errorf("expected error joining different numbers of fields")
+	}
+}
+
+func TestHashJoinSpill(t *testing.T) {
+	td, hf, tid := makeDistinctTestVars(t, 300, 60)
+	name := &FieldExpr{td.Fields[0]}
+	expected, err := NewStringJoin(hf, name, hf, name, JoinBufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hj, err := NewHashJoin(hf, []Expr{name}, hf, []Expr{name})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hj.maxBufferSize = 40
+	checkJoinOutput(t, hj, expected, tid)
+
+	//partitions that are still too large are partitioned again, until the
+	//tuples of a partition all have the same key
+	hj.maxBufferSize = 2
+	checkJoinOutput(t, hj, expected, tid)
+}
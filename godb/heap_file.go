@@ -3,6 +3,7 @@ package godb
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -73,6 +74,8 @@ func (f *HeapFile) NumPages() int {
 // We provide the implementation of this method, but it won't work until
 // [HeapFile.insertTuple] is implemented
 func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLastField bool) error {
+	//each line is loaded in a transaction of its own, which can't be canceled
+	ctx := context.Background()
 	scanner := bufio.NewScanner(file)
 	cnt := 0
 	for scanner.Scan() {
@@ -115,13 +118,13 @@ func (f *HeapFile) LoadFromCSV(file *os.File, hasHeader bool, sep string, skipLa
 		tid := NewTID()
 		bp := f.bufPool
 		bp.BeginTransaction(tid)
-		f.insertTuple(&newT, tid)
+		f.insertTuple(ctx, &newT, tid)
 
 		// hack to force dirty pages to disk
 		// because CommitTransaction may not be implemented
 		// yet if this is called in lab 1 or 2
 		for j := 0; j < f.NumPages(); j++ {
-			pg, err := bp.GetPage(f, j, tid, ReadPerm)
+			pg, err := bp.GetPage(ctx, f, j, tid, ReadPerm)
 			if pg == nil || err != nil {
 				//			fmt.Println("page nil or error", err)
 				break
@@ -191,7 +194,7 @@ func (f *HeapFile) readPage(pageNo int) (*Page, error) {
 // rather than directly reading pages itself. For lab 1, you do not need to
 // worry about concurrent transactions modifying the Page or HeapFile.  We will
 // add support for concurrent modifications in lab 3.
-func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
+func (f *HeapFile) insertTuple(ctx context.Context, t *Tuple, tid TransactionID) error {
 	f.m.Lock()
 	defer f.m.Unlock()
 	if f.currPages == 0 {
@@ -205,7 +208,7 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 
 		// Try to get page from buf pool
 		f.m.Unlock()
-		TP, err := f.bufPool.GetPage(f, 0, tid, WritePerm)
+		TP, err := f.bufPool.GetPage(ctx, f, 0, tid, WritePerm)
 		f.m.Lock()
 		if err != nil {
 			return err
@@ -230,7 +233,7 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 		if hh.FileName == f.Filename {
 			//fmt.Println("inserting other tuple")
 			f.m.Unlock()
-			p, err := f.bufPool.GetPage(f, hh.PageNo, tid, WritePerm)
+			p, err := f.bufPool.GetPage(ctx, f, hh.PageNo, tid, WritePerm)
 			f.m.Lock()
 			if err != nil {
 				return err
@@ -264,7 +267,7 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 		f.flushPage(&p)
 		//fmt.Println("inserting other tuple on new pages")
 		f.m.Unlock()
-		TP, err := f.bufPool.GetPage(f, f.currPages-1, tid, WritePerm)
+		TP, err := f.bufPool.GetPage(ctx, f, f.currPages-1, tid, WritePerm)
 		f.m.Lock()
 		if err != nil {
 			return err
@@ -291,7 +294,7 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 // for tuples as they are read via [Iterator].  Note that Rid is an empty interface,
 // so you can supply any object you wish.  You will likely want to identify the
 // heap page and slot within the page that the tuple came from.
-func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
+func (f *HeapFile) deleteTuple(ctx context.Context, t *Tuple, tid TransactionID) error {
 	f.m.Lock()
 	defer f.m.Unlock()
 
@@ -303,7 +306,7 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 
 	pageNum := rid.Page
 	f.m.Unlock()
-	pg, err := f.bufPool.GetPage(f, pageNum, tid, WritePerm)
+	pg, err := f.bufPool.GetPage(ctx, f, pageNum, tid, WritePerm)
 	f.m.Lock()
 	if err != nil {
 		return err
@@ -354,6 +357,10 @@ func (f *HeapFile) Descriptor() *TupleDesc {
 
 }
 
+func (f *HeapFile) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Heap Scan", "file", f.Filename), nil
+}
+
 // [Operator] iterator method
 // Return a function that iterates through the records in the heap file
 // Note that this method should read pages from the HeapFile using the
@@ -362,7 +369,7 @@ func (f *HeapFile) Descriptor() *TupleDesc {
 // transactions
 // You should esnure that Tuples returned by this method have their Rid object
 // set appropriate so that [deleteTuple] will work (see additional comments there).
-func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+func (f *HeapFile) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	i := 0
 	slotNum := 0
 	var pageIter func() (*Tuple, error)
@@ -383,7 +390,7 @@ func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 						fmt.Println("C1", i, slotNum, tid)
 						return nil, nil
 					} else {
-						page, err := f.bufPool.GetPage(f, i, tid, ReadPerm)
+						page, err := f.bufPool.GetPage(ctx, f, i, tid, ReadPerm)
 						if page == nil {
 							fmt.Println("C2", i, slotNum, tid)
 							return nil, nil
@@ -415,7 +422,7 @@ func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 					fmt.Println("C5", i, slotNum, tid)
 					return nil, nil
 				} else {
-					page, err := f.bufPool.GetPage(f, i, tid, ReadPerm)
+					page, err := f.bufPool.GetPage(ctx, f, i, tid, ReadPerm)
 					if err != nil {
 						fmt.Println("C6", i, slotNum, tid)
 						return nil, err
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -46,9 +47,9 @@ func makeTestVars() (TupleDesc, Tuple, Tuple, *HeapFile, *BufferPool, Transactio
 
 func TestCreateAndInsertHeapFile(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
-	iter, _ := hf.Iterator(tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	iter, _ := hf.Iterator(context.Background(), tid)
 	i := 0
 	for {
 		t, err := iter()
@@ -67,17 +68,17 @@ func TestCreateAndInsertHeapFile(t *testing.T) {
 
 func TestDeleteHeapFile(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 
-	hf.deleteTuple(&t1, tid)
-	iter, _ := hf.Iterator(tid)
+	hf.deleteTuple(context.Background(), &t1, tid)
+	iter, _ := hf.Iterator(context.Background(), tid)
 	t3, _ := iter()
 	if t3 == nil {
 		t.Errorf("HeapFile iterator expected 1 tuple")
 	}
-	hf.deleteTuple(&t2, tid)
-	iter, _ = hf.Iterator(tid)
+	hf.deleteTuple(context.Background(), &t2, tid)
+	iter, _ = hf.Iterator(context.Background(), tid)
 	t3, _ = iter()
 	if t3 != nil {
 		t.Errorf("HeapFile iterator expected 0 tuple")
@@ -89,12 +90,12 @@ func testSerializeN(t *testing.T, n int) {
 	for i := 0; i < n; i++ {
 		tid := NewTID()
 		bp.BeginTransaction(tid)
-		err := hf.insertTuple(&t1, tid)
+		err := hf.insertTuple(context.Background(), &t1, tid)
 		if err != nil {
 			t.Errorf(err.Error())
 			return
 		}
-		err = hf.insertTuple(&t2, tid)
+		err = hf.insertTuple(context.Background(), &t2, tid)
 		if err != nil {
 			t.Errorf(err.Error())
 			return
@@ -105,7 +106,7 @@ func testSerializeN(t *testing.T, n int) {
 		// yet if this is called in lab 1 or 2
 		if i%10 == 0 {
 			for j := hf.NumPages() - 1; j > -1; j-- {
-				pg, err := bp.GetPage(hf, j, tid, ReadPerm)
+				pg, err := bp.GetPage(context.Background(), hf, j, tid, ReadPerm)
 				if pg == nil || err != nil {
 					t.Fatal("page nil or error", err)
 				}
@@ -126,7 +127,7 @@ func testSerializeN(t *testing.T, n int) {
 	hf2, _ := NewHeapFile(TestingFile, &td, bp2)
 	tid := NewTID()
 	bp2.BeginTransaction(tid)
-	iter, _ := hf2.Iterator(tid)
+	iter, _ := hf2.Iterator(context.Background(), tid)
 	i := 0
 	for {
 		t, _ := iter()
@@ -164,7 +165,7 @@ func TestLoadCSV(t *testing.T) {
 		t.Fatalf("Load failed, %s", err)
 	}
 	//should have 384 records
-	iter, _ := hf.Iterator(tid)
+	iter, _ := hf.Iterator(context.Background(), tid)
 	i := 0
 	for {
 		t, _ := iter()
@@ -185,8 +186,8 @@ func TestHeapFilePageKey(t *testing.T) {
 	hf2, _ := NewHeapFile(TestingFile2, &td, bp)
 
 	for hf.NumPages() < 2 {
-		hf.insertTuple(&t1, tid)
-		hf2.insertTuple(&t1, tid)
+		hf.insertTuple(context.Background(), &t1, tid)
+		hf2.insertTuple(context.Background(), &t1, tid)
 		if hf.NumPages() == 0 {
 			t.Fatalf("Heap file should have at least one page after insertion.")
 		}
@@ -1,5 +1,7 @@
 package godb
 
+import "context"
+
 type InsertOp struct {
 	file  DBFile
 	child Operator
@@ -20,21 +22,31 @@ func (i *InsertOp) Descriptor() *TupleDesc {
 	return &TupleDesc{fields}
 }
 
+func (i *InsertOp) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Insert", "file", describeFile(i.file)), []Operator{i.child}
+}
+
 // Return an iterator function that inserts all of the tuples from the child
 // iterator into the DBFile passed to the constuctor and then returns a
 // one-field tuple with a "count" field indicating the number of tuples that
 // were inserted.  Tuples should be inserted using the [DBFile.insertTuple]
 // method.
-func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+func (iop *InsertOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	ct := 0
-	iter, err := iop.child.Iterator(tid)
+	iter, err := iop.child.Iterator(ctx, tid)
 	if err != nil {
 		return nil, err
 	}
+	// inserted tuples take on the field names of the file, rather than those
+	// of the child (e.g., the constants of an insert ... values statement)
+	desc := iop.file.Descriptor()
 
 	return func() (*Tuple, error) {
 		for {
 			t, err := iter()
+			if err != nil {
+				return nil, err
+			}
 			if t == nil {
 				var fields []DBValue
 				ctField := IntField{int64(ct)}
@@ -42,10 +54,7 @@ func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 				out := &Tuple{*iop.Descriptor().copy(), fields, 0}
 				return out, nil
 			}
-			if err != nil {
-				return nil, err
-			}
-			err = iop.file.insertTuple(t, tid)
+			err = iop.file.insertTuple(ctx, &Tuple{*desc, t.Fields, nil}, tid)
 			if err != nil {
 				return nil, err
 			}
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"os"
 	"testing"
 )
@@ -9,8 +10,8 @@ const InsertTestFile string = "InsertTestFile.dat"
 
 func TestInsert(t *testing.T) {
 	td, t1, _, hf, bp, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t1, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
 	bp.CommitTransaction(tid)
 	os.Remove(InsertTestFile)
 	hf2, _ := NewHeapFile(InsertTestFile, &td, bp)
@@ -20,7 +21,7 @@ func TestInsert(t *testing.T) {
 	tid = NewTID()
 	bp.BeginTransaction(tid)
 	ins := NewInsertOp(hf2, hf)
-	iter, _ := ins.Iterator(tid)
+	iter, _ := ins.Iterator(context.Background(), tid)
 	if iter == nil {
 		t.Fatalf("iter was nil")
 	}
@@ -43,7 +44,7 @@ func TestInsert(t *testing.T) {
 	bp.BeginTransaction(tid)
 
 	cnt := 0
-	iter, _ = hf2.Iterator(tid)
+	iter, _ = hf2.Iterator(context.Background(), tid)
 	for {
 		tup, err := iter()
 
@@ -59,3 +60,10 @@ func TestInsert(t *testing.T) {
 		t.Errorf("insert failed, expected 2 tuples, got %d", cnt)
 	}
 }
+
+func TestInsertChildError(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	expectChildError(t, NewInsertOp(hf, &failingOp{hf, 1}), tid, 0)
+}
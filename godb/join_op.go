@@ -1,5 +1,7 @@
 package godb
 
+import "context"
+
 type EqualityJoin[T comparable] struct {
 	// Expressions that when applied to tuples from the left or right operators,
 	// respectively, return the value of the left or right side of the join
@@ -54,6 +56,11 @@ func (hj *EqualityJoin[T]) Descriptor() *TupleDesc {
 	return (*hj.left).Descriptor().merge((*hj.right).Descriptor())
 }
 
+func (hj *EqualityJoin[T]) DescribePlan() (*PlanDescription, []Operator) {
+	keys := describeJoinKeys([]Expr{hj.leftField}, []Expr{hj.rightField})
+	return newPlanDescription("Nested Loop Join", "keys", keys), []Operator{*hj.left, *hj.right}
+}
+
 // Join operator implementation.  This function should iterate over the results
 // of the join. The join should be the result of joining joinOp.left and
 // joinOp.right, applying the joinOp.leftField and joinOp.rightField expressions
@@ -68,11 +75,11 @@ func (hj *EqualityJoin[T]) Descriptor() *TupleDesc {
 // maxBufferSize records, and should pass the testBigJoin test without timing
 // out.  To pass this test, you will need to use something other than a nested
 // loops join.
-func (joinOp *EqualityJoin[T]) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+func (joinOp *EqualityJoin[T]) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	lOp := *(joinOp.left)
 	rOp := *(joinOp.right)
 
-	lIter, err := lOp.Iterator(tid)
+	lIter, err := lOp.Iterator(ctx, tid)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +89,7 @@ func (joinOp *EqualityJoin[T]) Iterator(tid TransactionID) (func() (*Tuple, erro
 	}
 
 	// Create rIter outside the outer loop to avoid resetting it repeatedly
-	rIter, err := rOp.Iterator(tid)
+	rIter, err := rOp.Iterator(ctx, tid)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +103,7 @@ func (joinOp *EqualityJoin[T]) Iterator(tid TransactionID) (func() (*Tuple, erro
 				if err != nil {
 					return nil, err
 				}
-				rIter, err = rOp.Iterator(tid)
+				rIter, err = rOp.Iterator(ctx, tid)
 				if err != nil {
 					return nil, err
 				}
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -10,15 +11,15 @@ const JoinTestFile string = "JoinTestFile.dat"
 
 func TestJoin(t *testing.T) {
 	td, t1, t2, hf, bp, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 
 	os.Remove(JoinTestFile)
 	hf2, _ := NewHeapFile(JoinTestFile, &td, bp)
-	hf2.insertTuple(&t1, tid)
-	hf2.insertTuple(&t2, tid)
-	hf2.insertTuple(&t2, tid)
+	hf2.insertTuple(context.Background(), &t1, tid)
+	hf2.insertTuple(context.Background(), &t2, tid)
+	hf2.insertTuple(context.Background(), &t2, tid)
 
 	outT1 := joinTuples(&t1, &t1)
 	outT2 := joinTuples(&t2, &t2)
@@ -29,7 +30,7 @@ func TestJoin(t *testing.T) {
 		t.Errorf("unexpected error initializing join")
 		return
 	}
-	iter, err := join.Iterator(tid)
+	iter, err := join.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -107,7 +108,7 @@ func TestBigJoinOptional(t *testing.T) {
 					// because CommitTransaction may not be implemented
 					// yet if this is called in lab 1 or 2
 					for j := 0; j < hf1.NumPages(); j++ {
-						pg, err := bp.GetPage(hf1, j, tid, ReadPerm)
+						pg, err := bp.GetPage(context.Background(), hf1, j, tid, ReadPerm)
 						if pg == nil || err != nil {
 							t.Fatal("page nil or error", err)
 						}
@@ -118,7 +119,7 @@ func TestBigJoinOptional(t *testing.T) {
 
 					}
 					for j := 0; j < hf2.NumPages(); j++ {
-						pg, err := bp.GetPage(hf2, j, tid, ReadPerm)
+						pg, err := bp.GetPage(context.Background(), hf2, j, tid, ReadPerm)
 						if pg == nil || err != nil {
 							t.Fatal("page nil or error", err)
 						}
@@ -137,13 +138,13 @@ func TestBigJoinOptional(t *testing.T) {
 			}
 
 			tup := Tuple{td, []DBValue{IntField{int64(i)}}, nil}
-			err := hf1.insertTuple(&tup, tid)
+			err := hf1.insertTuple(context.Background(), &tup, tid)
 			if err != nil {
 				t.Errorf(err.Error())
 				return
 			}
 
-			err = hf2.insertTuple(&tup, tid)
+			err = hf2.insertTuple(context.Background(), &tup, tid)
 			if err != nil {
 				t.Errorf(err.Error())
 				return
@@ -159,7 +160,7 @@ func TestBigJoinOptional(t *testing.T) {
 			t.Errorf("unexpected error initializing join")
 			return
 		}
-		iter, err := join.Iterator(tid)
+		iter, err := join.Iterator(context.Background(), tid)
 		if err != nil {
 			t.Errorf(err.Error())
 			return
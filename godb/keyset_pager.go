@@ -0,0 +1,202 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+)
+
+// KeysetPager pages through the results of an ordered query using keyset
+// pagination.  Rather than skipping the tuples of earlier pages with an
+// OFFSET, which must read and sort every skipped tuple again for each page,
+// each page resumes after the ORDER BY key of the last tuple of the previous
+// page.  The key serves as a cursor that can be handed to a client and passed
+// back to request the next page.
+//
+// Pages only partition the results if the order by key is unique, e.g.,
+// because it ends with a primary key column; otherwise, tuples with the same
+// key as the last tuple of a page are skipped.
+type KeysetPager struct {
+	orderBy   []Expr
+	ascending []bool
+	child     Operator
+}
+
+// Construct a pager over the tuples of child ordered by orderByFields, where
+// ascending gives the direction of each field as for [NewOrderBy].
+func NewKeysetPager(orderByFields []Expr, child Operator, ascending []bool) (*KeysetPager, error) {
+	if len(orderByFields) == 0 {
+		return nil, GoDBError{IllegalOperationError, "keyset pagination requires an order by"}
+	}
+	if len(orderByFields) != len(ascending) {
+		return nil, GoDBError{IllegalOperationError, "number of order by expressions and sort directions differ"}
+	}
+	return &KeysetPager{orderByFields, ascending, child}, nil
+}
+
+// Construct a pager over the results of plan, which must be the plan of a
+// query ending in an ORDER BY with no LIMIT, e.g., as returned by [Parse].
+func NewKeysetPagerForPlan(plan Operator) (*KeysetPager, error) {
+	ob, ok := plan.(*OrderBy)
+	if !ok {
+		return nil, GoDBError{IllegalOperationError, "keyset pagination requires a query with an order by and no limit"}
+	}
+	return NewKeysetPager(ob.orderBy, ob.child, ob.ascending)
+}
+
+func (p *KeysetPager) Descriptor() *TupleDesc {
+	return p.child.Descriptor().copy()
+}
+
+// Return the key of t, i.e., the values of the order by expressions, which
+// may be passed to [KeysetPager.IteratorAfter] or [KeysetPager.Page] to
+// resume after t.
+func (p *KeysetPager) Key(t *Tuple) ([]DBValue, error) {
+	key := make([]DBValue, len(p.orderBy))
+	for i, expr := range p.orderBy {
+		v, err := expr.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = v
+	}
+	return key, nil
+}
+
+// Check that key has a value of the right type for each order by expression
+func (p *KeysetPager) checkKey(key []DBValue) error {
+	if len(key) != len(p.orderBy) {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("expected key with %d values, got %d", len(p.orderBy), len(key))}
+	}
+	for i, expr := range p.orderBy {
+		ok := false
+		switch key[i].(type) {
+		case IntField:
+			ok = expr.GetExprType().Ftype == IntType
+		case StringField:
+			ok = expr.GetExprType().Ftype == StringType
+		}
+		if !ok {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("value %v of key does not match type of order by expression %d", key[i], i+1)}
+		}
+	}
+	return nil
+}
+
+// Return true if t sorts strictly after key
+func (p *KeysetPager) after(t *Tuple, key []DBValue) (bool, error) {
+	for i, expr := range p.orderBy {
+		v, err := expr.EvalExpr(t)
+		if err != nil {
+			return false, err
+		}
+		if compareValues(v, key[i], OpLt) {
+			return !p.ascending[i], nil
+		}
+		if compareValues(v, key[i], OpGt) {
+			return p.ascending[i], nil
+		}
+	}
+	return false, nil
+}
+
+// Return an operator producing the tuples of the child that sort after key,
+// or all of them if key is nil
+func (p *KeysetPager) childAfter(key []DBValue) (Operator, error) {
+	if key == nil {
+		return p.child, nil
+	}
+	if err := p.checkKey(key); err != nil {
+		return nil, err
+	}
+	return &keysetFilter{p, key}, nil
+}
+
+// Return an iterator through the tuples that sort strictly after key, in
+// order.  If key is nil, iterates through all tuples.
+func (p *KeysetPager) IteratorAfter(ctx context.Context, key []DBValue, tid TransactionID) (func() (*Tuple, error), error) {
+	child, err := p.childAfter(key)
+	if err != nil {
+		return nil, err
+	}
+	ob, err := NewOrderBy(p.orderBy, child, p.ascending)
+	if err != nil {
+		return nil, err
+	}
+	return ob.Iterator(ctx, tid)
+}
+
+// Return the (up to) pageSize tuples that sort strictly after key, in order,
+// or the first page if key is nil.  Also returns the key to pass to get the
+// next page, which is nil if this is the last page.
+func (p *KeysetPager) Page(ctx context.Context, key []DBValue, pageSize int, tid TransactionID) ([]*Tuple, []DBValue, error) {
+	if pageSize <= 0 {
+		return nil, nil, GoDBError{IllegalOperationError, fmt.Sprintf("page size %d is not positive", pageSize)}
+	}
+	child, err := p.childAfter(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	topN, err := NewTopN(p.orderBy, child, p.ascending, pageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	iter, err := topN.Iterator(ctx, tid)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tups []*Tuple
+	for {
+		t, err := iter()
+		if err != nil {
+			return nil, nil, err
+		}
+		if t == nil {
+			break
+		}
+		tups = append(tups, t)
+	}
+	if len(tups) < pageSize {
+		return tups, nil, nil
+	}
+	next, err := p.Key(tups[len(tups)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return tups, next, nil
+}
+
+// keysetFilter passes the tuples of a pager's child that sort after a key
+type keysetFilter struct {
+	pager *KeysetPager
+	key   []DBValue
+}
+
+func (f *keysetFilter) Descriptor() *TupleDesc {
+	return f.pager.Descriptor()
+}
+
+func (f *keysetFilter) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Keyset Filter", "after", fmt.Sprint(f.key), "order by", describeOrder(f.pager.orderBy, f.pager.ascending)), []Operator{f.pager.child}
+}
+
+func (f *keysetFilter) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := f.pager.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for {
+			t, err := iter()
+			if err != nil || t == nil {
+				return nil, err
+			}
+			ok, err := f.pager.after(t, f.key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return t, nil
+			}
+		}
+	}, nil
+}
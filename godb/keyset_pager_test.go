@@ -0,0 +1,84 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestKeysetPager(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	sql := "select name, age from t order by age desc, name"
+	var expected []string
+	for _, tup := range runParserTestQuery(t, c, bp, sql) {
+		expected = append(expected, fmt.Sprint(tup.Fields))
+	}
+
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pager, err := NewKeysetPagerForPlan(plan)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//page through the results 5 at a time
+	var got []string
+	var key []DBValue
+	pages := 0
+	for {
+		tups, next, err := pager.Page(context.Background(), key, 5, tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, tup := range tups {
+			got = append(got, fmt.Sprint(tup.Fields))
+		}
+		pages++
+		if next == nil {
+			break
+		}
+		key = next
+	}
+	if pages != 3 || fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected 3 pages of %v, got %d pages of %v", expected, pages, got)
+	}
+
+	//resume an iterator after the fourth tuple
+	iter, err := pager.IteratorAfter(context.Background(), []DBValue{IntField{50}, StringField{"mark"}}, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	got = nil
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		got = append(got, fmt.Sprint(tup.Fields))
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected[4:]) {
+		t.Errorf("expected %v, got %v", expected[4:], got)
+	}
+
+	for _, key := range [][]DBValue{{IntField{50}}, {StringField{"mark"}, IntField{50}}} {
+		if _, _, err := pager.Page(context.Background(), key, 5, tid); err == nil {
+			t.Errorf("expected error for key %v", key)
+		}
+	}
+
+	_, plan, err = Parse(c, sql+" limit 3")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := NewKeysetPagerForPlan(plan); err == nil {
+		t.Errorf("expected error for plan with a limit")
+	}
+}
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"errors"
 	"os"
 )
@@ -41,7 +42,7 @@ func computeFieldSum(fileName string, td TupleDesc, sumField string) (int, error
 	}
 	sum := 0
 	tid := NewTID()
-	iter, _ := hf.Iterator(tid)
+	iter, _ := hf.Iterator(context.Background(), tid)
 	i := 0
 	for {
 		t, _ := iter()
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"os"
 	"testing"
 )
@@ -83,7 +84,7 @@ func TestSetDirty(t *testing.T) {
 	tid := NewTID()
 	bp.BeginTransaction(tid)
 	for i := 0; i < 308; i++ {
-		err := hf.insertTuple(&t1, tid)
+		err := hf.insertTuple(context.Background(), &t1, tid)
 		if err != nil && (i == 306 || i == 307) {
 			return
 		} else if err != nil {
@@ -99,9 +100,9 @@ func TestDirtyBit(t *testing.T) {
 
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t1, tid)
-	page, _ := bp.GetPage(hf, 0, tid, ReadPerm)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	page, _ := bp.GetPage(context.Background(), hf, 0, tid, ReadPerm)
 	if !(*page).isDirty() {
 		t.Fatalf("Expected page to be dirty")
 	}
@@ -113,8 +114,8 @@ func TestJoinFieldOrder(t *testing.T) {
 	tid := NewTID()
 	bp.BeginTransaction(tid)
 
-	hf1.insertTuple(&t1, tid)
-	hf2.insertTuple(&t2, tid)
+	hf1.insertTuple(context.Background(), &t1, tid)
+	hf2.insertTuple(context.Background(), &t2, tid)
 
 	leftField := FieldExpr{t1.Desc.Fields[1]}
 	rightField := FieldExpr{t2.Desc.Fields[1]}
@@ -124,7 +125,7 @@ func TestJoinFieldOrder(t *testing.T) {
 		t.Errorf("unexpected error initializing join")
 		return
 	}
-	iter, err := join.Iterator(tid)
+	iter, err := join.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -154,7 +155,7 @@ func TestOrderByFieldsOrder(t *testing.T) {
 
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	hf.insertTuple(&tup, tid)
+	hf.insertTuple(context.Background(), &tup, tid)
 
 	bs := make([]bool, 2)
 	for i := range bs {
@@ -168,7 +169,7 @@ func TestOrderByFieldsOrder(t *testing.T) {
 		t.Fatalf(err.Error())
 	}
 
-	iter, _ := oby.Iterator(tid)
+	iter, _ := oby.Iterator(context.Background(), tid)
 	if iter == nil {
 		t.Fatalf("iter was nil")
 	}
@@ -194,7 +195,7 @@ func TestProjectOrdering(t *testing.T) {
 
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	hf.insertTuple(&tup, tid)
+	hf.insertTuple(context.Background(), &tup, tid)
 
 	var outNames = []string{"out1", "out2"}
 	exprs := []Expr{&FieldExpr{td.Fields[2]}, &FieldExpr{td.Fields[0]}}
@@ -203,7 +204,7 @@ func TestProjectOrdering(t *testing.T) {
 	if proj == nil {
 		t.Fatalf("project was nil")
 	}
-	iter, _ := proj.Iterator(tid)
+	iter, _ := proj.Iterator(context.Background(), tid)
 	if iter == nil {
 		t.Fatalf("iter was nil")
 	}
@@ -255,8 +256,8 @@ func TestHeapFileSize(t *testing.T) {
 
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	hf.insertTuple(&t1, tid)
-	page, err := bp.GetPage(hf, 0, tid, ReadPerm)
+	hf.insertTuple(context.Background(), &t1, tid)
+	page, err := bp.GetPage(context.Background(), hf, 0, tid, ReadPerm)
 	if err != nil {
 		t.Fatalf("unexpected error, getPage, %s", err.Error())
 	}
@@ -356,13 +357,13 @@ func TestHeapFileIteratorExtra(t *testing.T) {
 	tid := NewTID()
 	bp.BeginTransaction(tid)
 
-	it, err := hf.Iterator(tid)
+	it, err := hf.Iterator(context.Background(), tid)
 	_, err = it()
 	if err != nil {
 		t.Fatalf("Empty heap file iterator should return nil,nil")
 	}
-	hf.insertTuple(&t1, tid)
-	it, err = hf.Iterator(tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	it, err = hf.Iterator(context.Background(), tid)
 	pg, err := it()
 	if err != nil {
 		t.Fatalf("Iterating over heap file with one tuple returned error %s", err.Error())
@@ -388,9 +389,9 @@ func TestBufferPoolHoldsMultipleHeapFiles(t *testing.T) {
 		panic(err)
 	}
 
-	err1 := hf.insertTuple(&t1, tid)
-	err2 := hf.insertTuple(&t1, tid)
-	err3 := hf2.insertTuple(&t2, tid)
+	err1 := hf.insertTuple(context.Background(), &t1, tid)
+	err2 := hf.insertTuple(context.Background(), &t1, tid)
+	err3 := hf2.insertTuple(context.Background(), &t2, tid)
 
 	if err1 != nil || err2 != nil || err3 != nil {
 		t.Errorf("The BufferPool should be able to handle multiple files")
@@ -399,7 +400,7 @@ func TestBufferPoolHoldsMultipleHeapFiles(t *testing.T) {
 
 	hf2TupCntPerPage := 0
 	for hf2.NumPages() <= 1 {
-		if err := hf2.insertTuple(&t2, tid); err != nil {
+		if err := hf2.insertTuple(context.Background(), &t2, tid); err != nil {
 			t.Errorf("%v", err)
 		}
 		hf2TupCntPerPage++
@@ -407,14 +408,14 @@ func TestBufferPoolHoldsMultipleHeapFiles(t *testing.T) {
 	// bp contains 3 dirty pages at this point
 
 	for i := 0; i < hf2TupCntPerPage-1; i++ {
-		if err := hf2.insertTuple(&t2, tid); err != nil {
+		if err := hf2.insertTuple(context.Background(), &t2, tid); err != nil {
 			t.Errorf("%v", err)
 		}
 	}
 
 	// bp contains 3 dirty pages at this point, including 2 full pages of hf2
-	_ = hf2.insertTuple(&t2, tid)
-	if err := hf2.insertTuple(&t2, tid); err == nil {
+	_ = hf2.insertTuple(context.Background(), &t2, tid)
+	if err := hf2.insertTuple(context.Background(), &t2, tid); err == nil {
 		t.Errorf("should cause bufferpool dirty page overflow here")
 	}
 }
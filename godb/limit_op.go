@@ -1,70 +1,116 @@
 package godb
 
-import "errors"
+import (
+	"context"
+)
 
 type LimitOp struct {
 	child     Operator //required fields for parser
 	limitTups Expr
 	limit int
 	//add additional fields here, if needed
+	offset Expr // number of tuples to skip, or nil
 }
 
 // Limit constructor -- should save how many tuples to return and the child op.
 // lim is how many tuples to return and child is the child op.
 func NewLimitOp(lim Expr, child Operator) *LimitOp {
+	return NewLimitOffsetOp(lim, nil, child)
+}
+
+// Constructor for LIMIT lim OFFSET offset, which skips the first offset tuples
+// of child before returning up to lim tuples.  If offset is nil, no tuples are
+// skipped.
+func NewLimitOffsetOp(lim Expr, offset Expr, child Operator) *LimitOp {
 	// limit is a constant, so with any tuple, it'll evaluate to the same number - find that limit and store it
 	empty := make([]DBValue, 0)
 	emptyDesc := TupleDesc{}
 	dummy := Tuple{emptyDesc, empty, 0}
 	limit, _:= lim.EvalExpr(&dummy)
 	limInt, _ := limit.(IntField)
-	return &LimitOp{child, lim, int(limInt.Value)}
+	return &LimitOp{child, lim, int(limInt.Value), offset}
 }
 
-// Return a TupleDescriptor for this limit
+// Return a TupleDescriptor for this limit, which outputs tuples with the
+// same fields as its child
 func (l *LimitOp) Descriptor() *TupleDesc {
-	desc := *l.child.Descriptor()
-	if len(desc.Fields) < l.limit {
-		// m (# fields in child) < limit n, so resulting tuple desc has at most m fields
-		return desc.copy()
+	return l.child.Descriptor().copy()
+}
+
+func (l *LimitOp) DescribePlan() (*PlanDescription, []Operator) {
+	offset := ""
+	if l.offset != nil {
+		offset = exprToStr(l.offset)
 	}
-	// otherwise, get first n fields of desc
-	return &TupleDesc{desc.Fields[:l.limit+1]}
+	return newPlanDescription("Limit", "limit", exprToStr(l.limitTups), "offset", offset), []Operator{l.child}
 }
 
 // Limit operator implementation. This function should iterate over the
 // results of the child iterator, and limit the result set to the first
-// [lim] tuples it sees (where lim is specified in the constructor).
-func (l *LimitOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+// [lim] tuples it sees (where lim is specified in the constructor), after
+// skipping the first [offset] tuples, if an offset was given.
+func (l *LimitOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	ct := 0
-	iter, err := l.child.Iterator(tid)
+	skip := 0
+	if l.offset != nil {
+		// like the limit, the offset is a constant
+		offset, err := l.offset.EvalExpr(&Tuple{TupleDesc{}, nil, nil})
+		if err != nil {
+			return nil, err
+		}
+		offsetInt, ok := offset.(IntField)
+		if !ok || offsetInt.Value < 0 {
+			return nil, GoDBError{IllegalOperationError, "expected non-negative integer offset"}
+		}
+		skip = int(offsetInt.Value)
+	}
+	//the child is canceled once the limit is reached, rather than being
+	//abandoned part way through
+	ctx, cancel := context.WithCancel(ctx)
+	iter, err := l.child.Iterator(ctx, tid)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
+	done := false
 
 	return func() (*Tuple, error) {
-		for {
+		for !done {
 			t, err := iter()
-			if t == nil {
-				return nil, nil
-			}
 			if err != nil {
+				cancel()
 				return nil, err
 			}
+			if t == nil {
+				break
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
 			lim, err := l.limitTups.EvalExpr(t)
 			if err != nil {
+				cancel()
 				return nil, err
 			}
 			limInt, ok := lim.(IntField)
 			if !ok {
-				return nil, errors.New("expected integer limit")
+				cancel()
+				return nil, GoDBError{IllegalOperationError, "expected integer limit"}
 			}
 			if int(limInt.Value) == ct {
-				return nil, err
-			} else {
-				ct++
-				return t, nil
+				//give the child a chance to see that it was canceled, so
+				//that it has released what it holds, e.g., the runs of a
+				//sort, by the time the limit is exhausted
+				cancel()
+				iter()
+				break
 			}
+			ct++
+			return t, nil
 		}
+		done = true
+		cancel()
+		return nil, nil
 	}, nil
 }
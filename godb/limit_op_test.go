@@ -1,6 +1,8 @@
 package godb
 
 import (
+	"context"
+	"fmt"
 	"testing"
 )
 
@@ -10,12 +12,12 @@ func testLimitCount(t *testing.T, n int) {
 	for i := 0; i < n; i++ {
 		tid := NewTID()
 		bp.BeginTransaction(tid)
-		err := hf.insertTuple(&t1, tid)
+		err := hf.insertTuple(context.Background(), &t1, tid)
 		if err != nil {
 			t.Errorf(err.Error())
 			return
 		}
-		err = hf.insertTuple(&t2, tid)
+		err = hf.insertTuple(context.Background(), &t2, tid)
 		if err != nil {
 			t.Errorf(err.Error())
 			return
@@ -26,7 +28,7 @@ func testLimitCount(t *testing.T, n int) {
 		// yet if this is called in lab 2
 		if i%10 == 0 {
 			for j := hf.NumPages() - 1; j > -1; j-- {
-				pg, err := bp.GetPage(hf, j, tid, ReadPerm)
+				pg, err := bp.GetPage(context.Background(), hf, j, tid, ReadPerm)
 				if pg == nil || err != nil {
 					t.Fatal("page nil or error", err)
 				}
@@ -51,7 +53,7 @@ func testLimitCount(t *testing.T, n int) {
 		t.Fatalf("Op was nil")
 		return
 	}
-	iter, err := lim.Iterator(tid)
+	iter, err := lim.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf(err.Error())
 		return
@@ -76,6 +78,55 @@ func testLimitCount(t *testing.T, n int) {
 	bp.CommitTransaction(tid)
 }
 
+// An operator that fails after its child outputs n tuples
+type failingOp struct {
+	child Operator
+	n     int
+}
+
+func (f *failingOp) Descriptor() *TupleDesc {
+	return f.child.Descriptor()
+}
+
+func (f *failingOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := f.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	return func() (*Tuple, error) {
+		if n == f.n {
+			return nil, GoDBError{IllegalOperationError, "failing operator"}
+		}
+		n++
+		return iter()
+	}, nil
+}
+
+// Run op, whose child fails, expecting it to output n tuples and then return
+// the error of its child, rather than stop as if the child was exhausted
+func expectChildError(t *testing.T, op Operator, tid TransactionID, n int) {
+	iter, err := op.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; i < n; i++ {
+		if tup, err := iter(); tup == nil || err != nil {
+			t.Fatalf("%T: expected %d tuples, got %d, %v", op, n, i, err)
+		}
+	}
+	if tup, err := iter(); err == nil {
+		t.Errorf("%T: expected the error of its child, got %v", op, tup)
+	}
+}
+
+func TestLimitChildError(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	expectChildError(t, NewLimitOp(&ConstExpr{IntField{10}, IntType}, &failingOp{hf, 1}), tid, 1)
+}
+
 func TestLimit5(t *testing.T) {
 	testLimitCount(t, 5)
 }
@@ -87,3 +138,89 @@ func TestLimit50(t *testing.T) {
 func TestLimit100(t *testing.T) {
 	testLimitCount(t, 100)
 }
+
+func TestLimitOffset(t *testing.T) {
+	td, _, _, hf, _, tid := makeTestVars()
+	for i := 0; i < 10; i++ {
+		tup := Tuple{td, []DBValue{StringField{"sam"}, IntField{int64(i)}}, nil}
+		if err := hf.insertTuple(context.Background(), &tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	for _, test := range []struct {
+		limit, offset int64
+		expected      []int64
+	}{
+		{3, 0, []int64{0, 1, 2}},
+		{3, 4, []int64{4, 5, 6}},
+		{5, 8, []int64{8, 9}},
+		{5, 10, nil},
+	} {
+		lim := NewLimitOffsetOp(&ConstExpr{IntField{test.limit}, IntType}, &ConstExpr{IntField{test.offset}, IntType}, hf)
+		iter, err := lim.Iterator(context.Background(), tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var ages []int64
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			ages = append(ages, tup.Fields[1].(IntField).Value)
+		}
+		if fmt.Sprint(ages) != fmt.Sprint(test.expected) {
+			t.Errorf("limit %d offset %d: expected %v, got %v", test.limit, test.offset, test.expected, ages)
+		}
+	}
+
+	lim := NewLimitOffsetOp(&ConstExpr{IntField{1}, IntType}, &ConstExpr{IntField{-1}, IntType}, hf)
+	_, err := lim.Iterator(context.Background(), tid)
+	if dbErr, ok := err.(GoDBError); !ok || dbErr.code != IllegalOperationError {
+		t.Errorf("expected illegal operation error for negative offset, got %v", err)
+	}
+}
+
+func TestLimitOverSpillingSort(t *testing.T) {
+	td, _, _, hf, _, tid := makeTestVars()
+	for i := 0; i < 200; i++ {
+		tup := Tuple{td, []DBValue{StringField{"sam"}, IntField{int64((i * 37) % 101)}}, nil}
+		if err := hf.insertTuple(context.Background(), &tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	oby, err := NewOrderBy([]Expr{&FieldExpr{td.Fields[1]}}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	oby.maxBufferSize = 15
+	tempFiles := countTempFiles(t)
+	iter, err := NewLimitOp(&ConstExpr{IntField{5}, IntType}, oby).Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		cnt++
+	}
+	if cnt != 5 {
+		t.Errorf("expected 5 tuples, got %d", cnt)
+	}
+	//the sort is canceled once the limit is reached, deleting its runs
+	if n := countTempFiles(t); n != tempFiles {
+		t.Errorf("expected temporary files to be removed, found %d more", n-tempFiles)
+	}
+	if tup, err := iter(); tup != nil || err != nil {
+		t.Errorf("expected exhausted limit to keep returning nil, got %v, %v", tup, err)
+	}
+}
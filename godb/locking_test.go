@@ -1,6 +1,8 @@
 package godb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -26,7 +28,7 @@ func NewLockGrabber(bp *BufferPool, tid TransactionID, file DBFile, pgNo int, pe
 
 func (lg *LockGrabber) run() {
 	// Try to get the page from the buffer pool.
-	_, err := lg.bp.GetPage(lg.file, lg.pgNo, lg.tid, lg.perm)
+	_, err := lg.bp.GetPage(context.Background(), lg.file, lg.pgNo, lg.tid, lg.perm)
 	if err != nil {
 		fmt.Println("ERROR", err)
 	}
@@ -80,7 +82,7 @@ func metaLockTester(t *testing.T, bp *BufferPool,
 	tid1 TransactionID, file1 DBFile, pgNo1 int, perm1 RWPerm,
 	tid2 TransactionID, file2 DBFile, pgNo2 int, perm2 RWPerm,
 	expected bool) {
-	bp.GetPage(file1, pgNo1, tid1, perm1)
+	bp.GetPage(context.Background(), file1, pgNo1, tid1, perm1)
 	grabLock(t, bp, tid2, file2, pgNo2, perm2, expected)
 }
 
@@ -157,3 +159,24 @@ func TestAcquireWriteAndReadLocks(t *testing.T) {
 		tid1, hf, 0, ReadPerm,
 		true)
 }
+
+func TestGetPageDeadline(t *testing.T) {
+	bp, hf, tid1, tid2 := lockingTestSetUp(t)
+	if _, err := bp.GetPage(context.Background(), hf, 1, tid2, ReadPerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := bp.GetPage(context.Background(), hf, 0, tid1, WritePerm); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//tid2 gives up waiting for tid1's lock once its deadline passes
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := bp.GetPage(ctx, hf, 0, tid2, ReadPerm); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	//aborting tid2 releases the lock it held
+	bp.AbortTransaction(tid2)
+	grabLock(t, bp, tid1, hf, 1, WritePerm, true)
+}
@@ -0,0 +1,186 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Default limit, in bytes, on the memory a query may use to buffer tuples,
+// e.g., for a query run from the shell.  See [MemoryTracker].
+var QueryMemoryLimit int64 = 256 << 20
+
+// MemoryTracker accounts for the memory that the operators of a query use to
+// buffer tuples, e.g., the tuples of a sort or the groups of an aggregate, and
+// enforces a limit on their total.  A tracker is passed to a query through the
+// context of its iterator (see [WithMemoryTracker]).  When an operator would
+// exceed the limit it spills to temporary files if it can, like an [OrderBy]
+// or a [HashJoin]; otherwise the query fails with a [MemoryLimitError].
+//
+// Sizes are estimates of the memory used by the buffered tuples and keys (see
+// [tupleMemorySize]), not exact counts of allocated bytes.  A tracker may be
+// shared by goroutines, e.g., the workers of a [Gather].
+type MemoryTracker struct {
+	mutex sync.Mutex
+	limit int64 // no limit if 0
+	used  int64
+	peak  int64
+}
+
+// Create a tracker enforcing a limit of limit bytes, or no limit if limit is
+// 0.
+func NewMemoryTracker(limit int64) *MemoryTracker {
+	return &MemoryTracker{limit: limit}
+}
+
+// Return the number of bytes currently reserved by operators
+func (m *MemoryTracker) Used() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.used
+}
+
+// Return the largest number of bytes that were reserved at once
+func (m *MemoryTracker) Peak() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.peak
+}
+
+type memoryTrackerKey struct{}
+
+// Return a copy of ctx that carries m, so that the operators of a query run
+// with the returned context charge their memory to m.
+func WithMemoryTracker(ctx context.Context, m *MemoryTracker) context.Context {
+	return context.WithValue(ctx, memoryTrackerKey{}, m)
+}
+
+// Return the tracker carried by ctx, or nil if there is none
+func memoryTrackerOf(ctx context.Context) *MemoryTracker {
+	m, _ := ctx.Value(memoryTrackerKey{}).(*MemoryTracker)
+	return m
+}
+
+// memoryAccount is the memory one operator has reserved from the tracker of
+// its query, which it releases all at once, e.g., when it spills or is done.
+// Without a tracker, reservations always succeed and nothing is counted.
+type memoryAccount struct {
+	tracker *MemoryTracker
+	ctx     context.Context
+	name    string // of the operator, for errors
+
+	// guarded by the tracker's mutex
+	bytes int64
+	stop  func() bool // of the callback that releases the memory when ctx is done, while any is reserved
+}
+
+// Create an account for the operator with the given name (as in its plan
+// description) in the tracker of ctx.  Memory that is reserved is released
+// when ctx is done, in case the operator is abandoned before it is exhausted.
+func newMemoryAccount(ctx context.Context, name string) *memoryAccount {
+	return &memoryAccount{tracker: memoryTrackerOf(ctx), ctx: ctx, name: name}
+}
+
+// Reserve n bytes if the limit allows it, returning whether it did
+func (a *memoryAccount) tryReserve(n int64) bool {
+	m := a.tracker
+	if m == nil {
+		return true
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.limit > 0 && m.used+n > m.limit {
+		return false
+	}
+	m.used += n
+	a.bytes += n
+	if a.stop == nil {
+		a.stop = context.AfterFunc(a.ctx, a.release)
+	}
+	if m.used > m.peak {
+		m.peak = m.used
+	}
+	return true
+}
+
+// Reserve n bytes, returning a [MemoryLimitError] if that would exceed the
+// limit, for operators that can't spill.
+func (a *memoryAccount) reserve(n int64) error {
+	if a.tryReserve(n) {
+		return nil
+	}
+	return GoDBError{MemoryLimitError, fmt.Sprintf("query exceeded its memory limit of %d bytes in %s", a.tracker.limit, a.name)}
+}
+
+// Release n of the reserved bytes, e.g., those of a tuple that was replaced
+func (a *memoryAccount) releaseBytes(n int64) {
+	m := a.tracker
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if n > a.bytes {
+		n = a.bytes
+	}
+	m.used -= n
+	a.bytes -= n
+}
+
+// Release all of the reserved bytes.  The callback releasing them when the
+// context is done is stopped, so that accounts of operators that are iterated
+// many times, e.g., the inner side of a nested loops join, don't each leave
+// one behind.
+func (a *memoryAccount) release() {
+	m := a.tracker
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.used -= a.bytes
+	a.bytes = 0
+	if a.stop != nil {
+		a.stop()
+		a.stop = nil
+	}
+}
+
+// Estimated bytes of memory used by a tuple struct and its slice of fields,
+// apart from the values of the fields
+const tupleOverhead = 64
+
+// Estimate of the memory used by t, not counting its descriptor, which is
+// usually shared with other tuples.  Each field is an interface value holding
+// an int or a string.
+func tupleMemorySize(t *Tuple) int64 {
+	n := int64(tupleOverhead)
+	for _, f := range t.Fields {
+		n += 16
+		switch f := f.(type) {
+		case IntField:
+			n += 8
+		case StringField:
+			n += 16 + int64(len(f.Value))
+		}
+	}
+	return n
+}
+
+// Estimate of the memory used by the columns of b
+func batchMemorySize(b *Batch) int64 {
+	var n int64
+	for _, v := range b.Columns {
+		n += 8 * int64(len(v.Ints))
+		for _, str := range v.Strings {
+			n += 16 + int64(len(str))
+		}
+	}
+	return n
+}
+
+// Estimate of the memory used by an entry with a key of n bytes in a hash
+// table
+func keyMemorySize(n int) int64 {
+	return int64(48 + n)
+}
@@ -0,0 +1,125 @@
+package godb
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Run op in tid charging its memory to mem, returning its tuples or the error
+// it failed with
+func runWithMemory(op Operator, tid TransactionID, mem *MemoryTracker) ([]*Tuple, error) {
+	iter, err := op.Iterator(WithMemoryTracker(context.Background(), mem), tid)
+	if err != nil {
+		return nil, err
+	}
+	var tups []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if tup == nil {
+			return tups, nil
+		}
+		tups = append(tups, tup)
+	}
+}
+
+// Operators that can spill stay within the memory limit and produce the same
+// tuples as without one
+func TestMemoryLimitSpills(t *testing.T) {
+	td, hf, tid := makeDistinctTestVars(t, 300, 120)
+	name := &FieldExpr{td.Fields[0]}
+	ca := CountAggState{}
+	ca.Init("count", name, nil)
+	agg := NewGroupedAggregator([]AggState{&ca}, []Expr{name}, hf)
+	hj, err := NewHashJoin(hf, []Expr{name}, hf, []Expr{name})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	oby, err := NewOrderBy([]Expr{name}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	const limit = 2000
+	for _, op := range []Operator{agg, NewDistinct(hf), hj, oby} {
+		expected := sortedTupleStrings(collectTuples(t, op, tid))
+		tempFiles := countTempFiles(t)
+		mem := NewMemoryTracker(limit)
+		tups, err := runWithMemory(op, tid, mem)
+		if err != nil {
+			t.Fatalf("%T failed under the memory limit, %s", op, err.Error())
+		}
+		if out := sortedTupleStrings(tups); !slices.Equal(out, expected) {
+			t.Errorf("%T: expected %d tuples, got %d", op, len(expected), len(out))
+		}
+		if mem.Peak() == 0 || mem.Peak() > limit {
+			t.Errorf("%T: expected between 1 and %d bytes to be used, got %d", op, limit, mem.Peak())
+		}
+		if mem.Used() != 0 {
+			t.Errorf("%T: expected memory to be released, %d bytes still used", op, mem.Used())
+		}
+		if n := countTempFiles(t); n != tempFiles {
+			t.Errorf("%T: expected temporary files to be removed, found %d more", op, n-tempFiles)
+		}
+	}
+}
+
+// Operators that can't spill fail once the memory limit is exceeded
+func TestMemoryLimitError(t *testing.T) {
+	td, hf, tid := makeDistinctTestVars(t, 300, 120)
+	name := &FieldExpr{td.Fields[0]}
+	topN, err := NewTopN([]Expr{name}, hf, []bool{true}, 200)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	setOp, err := NewSetOp(hf, hf, ExceptOp, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	for _, op := range []Operator{topN, setOp} {
+		if _, err := runWithMemory(op, tid, NewMemoryTracker(0)); err != nil {
+			t.Fatalf("%T failed without a memory limit, %s", op, err.Error())
+		}
+		mem := NewMemoryTracker(2000)
+		_, err := runWithMemory(op, tid, mem)
+		var dbErr GoDBError
+		if !errors.As(err, &dbErr) || dbErr.code != MemoryLimitError {
+			t.Errorf("%T: expected a memory limit error, got %v", op, err)
+		}
+		if mem.Used() != 0 {
+			t.Errorf("%T: expected memory to be released, %d bytes still used", op, mem.Used())
+		}
+	}
+}
+
+// Memory that is reserved is released when the context is done, and releasing
+// it stops the callback that would have released it
+func TestMemoryAccountRelease(t *testing.T) {
+	mem := NewMemoryTracker(0)
+	ctx, cancel := context.WithCancel(WithMemoryTracker(context.Background(), mem))
+	a := newMemoryAccount(ctx, "Test")
+	for i := 0; i < 3; i++ {
+		a.tryReserve(100)
+		a.release()
+		if a.stop != nil {
+			t.Fatalf("expected releasing the account to stop its callback")
+		}
+	}
+	if mem.Used() != 0 {
+		t.Errorf("expected memory to be released, %d bytes still used", mem.Used())
+	}
+
+	a.tryReserve(100)
+	cancel()
+	for start := time.Now(); mem.Used() != 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("expected memory to be released when the context is done, %d bytes still used", mem.Used())
+		}
+	}
+}
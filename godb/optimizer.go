@@ -0,0 +1,769 @@
+package godb
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// The optimizer chooses the order in which the tables and subqueries of a
+// query's from clause are joined, and the algorithm used for each join, by
+// estimating the cost of candidate plans.  Following Selinger et al., it finds
+// the cheapest plan joining each set of relations from the cheapest plans of
+// its subsets, by dynamic programming.  Plans are left deep, except that
+// either input of each join may be the single relation added to the set (so
+// that, e.g., a hash join can be built on the smaller side), and only join
+// relations connected by a join predicate, as cross products aren't supported.
+//
+// As well as the cheapest plan for each set, it keeps the cheapest plan for
+// each "interesting order", i.e., each join column that the plan's output is
+// sorted on: such a plan may be more expensive, but save a sort in a later
+// sort merge join on that column.
+//
+// Estimates are deliberately simple.  Tables are as large as their heap
+// files, filters have a fixed selectivity depending on their operator, and
+// join columns are assumed to be keys of their relations.  GoDB has no
+// indexes, so index nested loop joins are never considered.
+
+const (
+	// The cost of reading or writing a page, relative to the cost of
+	// processing a tuple in memory
+	pageIOCost float64 = 100
+
+	// The cost of comparing two tuples while sorting, relative to the cost
+	// of processing a tuple
+	compareCost float64 = 0.1
+
+	// The estimated number of tuples output by operators that the optimizer
+	// can't estimate, e.g., aggregates
+	defaultCardinality float64 = 1000
+
+	// The largest number of relations whose join order is chosen by dynamic
+	// programming; larger joins are ordered greedily
+	maxJoinOrderRelations = 12
+)
+
+// The number of tuples with descriptor desc that fit in a heap page
+func tuplesPerPage(desc *TupleDesc) float64 {
+	bytesPerTuple := 0
+	for _, f := range desc.Fields {
+		switch f.Ftype {
+		case IntType:
+			bytesPerTuple += 8
+		case StringType:
+			bytesPerTuple += StringLength
+		}
+	}
+	if bytesPerTuple == 0 || bytesPerTuple > PageSize-8 {
+		return 1
+	}
+	return float64((PageSize - 8) / bytesPerTuple)
+}
+
+// The fraction of tuples expected to pass a filter comparing with op, when
+// nothing is known about the values compared
+func defaultSelectivity(op BoolOp) float64 {
+	switch op {
+	case OpEq:
+		return 0.1
+	case OpNeq:
+		return 0.9
+	case OpLike:
+		return 0.25
+	}
+	return 1.0 / 3
+}
+
+// The estimated number of tuples a plan outputs, and the estimated cost of
+// producing all of them
+type planEstimate struct {
+	rows float64
+	cost float64
+	// the statistics of the fields of the output that are (unmodified)
+	// fields of analyzed tables, keyed by [colKey]
+	cols map[string]*ColumnStats
+}
+
+// Return the key of a field in the cols of a plan estimate, which is also its
+// name in the join optimizer
+func colKey(f FieldType) string {
+	return f.TableQualifier + "." + f.Fname
+}
+
+// Return the statistics of the field that expr reads, if it is a field with
+// statistics
+func (e *planEstimate) colStats(expr Expr) *ColumnStats {
+	if f, ok := expr.(*FieldExpr); ok {
+		return e.cols[colKey(f.selectField)]
+	}
+	return nil
+}
+
+// Return the estimated number of distinct values of the named output field.
+// Without statistics, the field is assumed to be a key.
+func (e *planEstimate) distinctValues(col string) float64 {
+	rows := math.Max(e.rows, 1)
+	if cs := e.cols[col]; cs != nil {
+		return math.Max(math.Min(float64(cs.Distinct), rows), 1)
+	}
+	return rows
+}
+
+// Return the statistics of the fields of desc, where the statistics of
+// field i of desc are those of the field read by exprs[i] in e
+func renameCols(e planEstimate, exprs []Expr, desc *TupleDesc) map[string]*ColumnStats {
+	cols := make(map[string]*ColumnStats)
+	for i, expr := range exprs {
+		if cs := e.colStats(expr); cs != nil {
+			cols[colKey(desc.Fields[i])] = cs
+		}
+	}
+	return cols
+}
+
+// Estimate the size and cost of the plan rooted at op.  Tables analyzed in
+// catalog c (which may be nil) are estimated from their statistics.
+func estimatePlan(c *Catalog, op Operator) planEstimate {
+	switch op := op.(type) {
+	case *HeapFile:
+		desc := op.Descriptor()
+		pages := float64(op.NumPages())
+		rows := pages * tuplesPerPage(desc)
+		var stats *TableStats
+		if c != nil {
+			stats = c.statisticsForFile(op.Filename)
+		}
+		if stats == nil {
+			return planEstimate{rows, pages*pageIOCost + rows, nil}
+		}
+		//scale the number of rows analyzed by the growth of the table since
+		if stats.Pages > 0 {
+			rows = float64(stats.Rows) * pages / float64(stats.Pages)
+		} else {
+			rows = float64(stats.Rows)
+		}
+		cols := make(map[string]*ColumnStats)
+		for i, cs := range stats.Columns {
+			cols[colKey(desc.Fields[i])] = cs
+		}
+		return planEstimate{rows, pages*pageIOCost + rows, cols}
+	case *PartitionScan:
+		e := estimatePlan(c, op.file)
+		n := float64(op.partitions)
+		return planEstimate{e.rows / n, e.cost / n, e.cols}
+	case *Gather:
+		//the workers run at the same time
+		e := estimatePlan(c, op.children[0])
+		rows := e.rows * float64(len(op.children))
+		return planEstimate{rows, e.cost + rows, e.cols}
+	case *ExchangeOutput:
+		ex := op.exchange
+		e := estimatePlan(c, ex.children[0])
+		n := float64(len(ex.children))
+		return planEstimate{e.rows * n / float64(len(ex.outputs)), e.cost + e.rows, e.cols}
+	case *AliasOp:
+		e := estimatePlan(c, op.child)
+		childDesc := op.child.Descriptor()
+		exprs := make([]Expr, len(childDesc.Fields))
+		for i, f := range childDesc.Fields {
+			exprs[i] = &FieldExpr{f}
+		}
+		e.cols = renameCols(e, exprs, op.Descriptor())
+		return e
+	case *Filter[int64]:
+		return estimateFilter(estimatePlan(c, op.child), op.left, op.op, op.right)
+	case *Filter[string]:
+		return estimateFilter(estimatePlan(c, op.child), op.left, op.op, op.right)
+	case *Project:
+		e := estimatePlan(c, op.child)
+		return planEstimate{e.rows, e.cost + e.rows, renameCols(e, op.selectFields, op.Descriptor())}
+	case *SemiJoin:
+		left, right := estimatePlan(c, op.left), estimatePlan(c, op.right)
+		return planEstimate{left.rows / 2, left.cost + right.cost + left.rows + right.rows, left.cols}
+	case *SubqueryFilter:
+		child, sub := estimatePlan(c, op.child), estimatePlan(c, op.subquery)
+		return planEstimate{child.rows / 2, child.cost + child.rows*sub.cost, child.cols}
+	case *EqualityJoin[int64]:
+		return estimateJoin(c, nestedLoopJoin, *op.left, []Expr{op.leftField}, *op.right, []Expr{op.rightField}, false, false)
+	case *EqualityJoin[string]:
+		return estimateJoin(c, nestedLoopJoin, *op.left, []Expr{op.leftField}, *op.right, []Expr{op.rightField}, false, false)
+	case *HashJoin:
+		return estimateJoin(c, hashJoin, op.left, op.leftFields, op.right, op.rightFields, false, false)
+	case *SortMergeJoin:
+		return estimateJoin(c, sortMergeJoin, op.left, op.leftFields, op.right, op.rightFields, op.leftSorted, op.rightSorted)
+	case *InstrumentedOp:
+		return estimatePlan(c, op.child)
+	case *OrderBy:
+		e := estimatePlan(c, op.child)
+		return planEstimate{e.rows, e.cost + e.rows*math.Log2(math.Max(e.rows, 2))*compareCost, e.cols}
+	case *Window:
+		e := estimatePlan(c, op.child)
+		return planEstimate{e.rows, e.cost + e.rows*math.Log2(math.Max(e.rows, 2))*compareCost, e.cols}
+	case *TopN:
+		e := estimatePlan(c, op.child)
+		return planEstimate{math.Min(e.rows, float64(op.limit)), e.cost + e.rows, e.cols}
+	case *Distinct:
+		e := estimatePlan(c, op.child)
+		return planEstimate{e.rows, e.cost + e.rows, e.cols}
+	case *Aggregator:
+		//one group per combination of values of the group by fields
+		e := estimatePlan(c, op.child)
+		groups := 1.0
+		for _, expr := range op.groupByFields {
+			groups *= e.distinctValues(exprCol(expr))
+		}
+		return planEstimate{math.Max(math.Min(groups, e.rows), 1), e.cost + e.rows, nil}
+	case *LimitOp:
+		e := estimatePlan(c, op.child)
+		if c, ok := op.limitTups.(*ConstExpr); ok {
+			if v, ok := c.val.(IntField); ok {
+				e.rows = math.Min(e.rows, float64(v.Value))
+			}
+		}
+		return e
+	}
+	return planEstimate{defaultCardinality, defaultCardinality, nil}
+}
+
+// Estimate a filter comparing left and right with op over a child with
+// estimate child
+func estimateFilter(child planEstimate, left Expr, op BoolOp, right Expr) planEstimate {
+	sel := defaultSelectivity(op)
+	field, value := left, right
+	if _, ok := field.(*FieldExpr); !ok {
+		field, value = value, field
+		op = flippedOp(op)
+	}
+	if c, ok := value.(*ConstExpr); ok {
+		if cs := child.colStats(field); cs != nil {
+			sel = cs.Selectivity(op, c.val.(DBValue))
+		}
+	}
+	return planEstimate{child.rows * sel, child.cost + child.rows, child.cols}
+}
+
+// Return the estimated selectivity of an equality join of two inputs on the
+// named fields: one over the number of distinct values of the side with more
+func joinSelectivity(left *planEstimate, leftCol string, right *planEstimate, rightCol string) float64 {
+	return 1 / math.Max(left.distinctValues(leftCol), right.distinctValues(rightCol))
+}
+
+// Return the name of the field expr reads, or "" if it isn't a field
+func exprCol(expr Expr) string {
+	if f, ok := expr.(*FieldExpr); ok {
+		return colKey(f.selectField)
+	}
+	return ""
+}
+
+// Estimate the size and cost of an existing join of left and right on the
+// given keys
+func estimateJoin(c *Catalog, method joinMethod, left Operator, leftFields []Expr, right Operator, rightFields []Expr, leftSorted bool, rightSorted bool) planEstimate {
+	l := joinInput{estimatePlan(c, left), left.Descriptor(), leftSorted}
+	r := joinInput{estimatePlan(c, right), right.Descriptor(), rightSorted}
+	rows := l.est.rows * r.est.rows
+	for i := range leftFields {
+		rows *= joinSelectivity(&l.est, exprCol(leftFields[i]), &r.est, exprCol(rightFields[i]))
+	}
+	return planEstimate{rows, joinCost(method, &l, &r, rows), mergeCols(l.est.cols, r.est.cols)}
+}
+
+// Return the union of two sets of field statistics
+func mergeCols(c1 map[string]*ColumnStats, c2 map[string]*ColumnStats) map[string]*ColumnStats {
+	if len(c1) == 0 {
+		return c2
+	}
+	if len(c2) == 0 {
+		return c1
+	}
+	cols := make(map[string]*ColumnStats, len(c1)+len(c2))
+	for k, cs := range c1 {
+		cols[k] = cs
+	}
+	for k, cs := range c2 {
+		cols[k] = cs
+	}
+	return cols
+}
+
+// The algorithms a join may use
+type joinMethod int
+
+const (
+	nestedLoopJoin joinMethod = iota
+	hashJoin
+	sortMergeJoin
+)
+
+// An input to a join whose cost is being estimated
+type joinInput struct {
+	est  planEstimate
+	desc *TupleDesc
+	// whether the input is already sorted on the join key
+	sorted bool
+}
+
+// The estimated number of pages the input would occupy if written to a file
+func (in *joinInput) pages() float64 {
+	return math.Ceil(in.est.rows / tuplesPerPage(in.desc))
+}
+
+// The estimated cost of sorting the input on the join key
+func (in *joinInput) sortCost() float64 {
+	if in.sorted {
+		return 0
+	}
+	cost := in.est.rows * math.Log2(in.est.rows+1) * compareCost
+	if in.est.rows > float64(SortBufferSize) {
+		//sorted runs are written and read back
+		cost += 2 * in.pages() * pageIOCost
+	}
+	return cost
+}
+
+// Estimate the cost of a join of outer and inner that outputs rows tuples,
+// including the cost of producing its inputs.  For a nested loop join, inner
+// is the input scanned once per outer tuple; for a hash join, it is the input
+// built into the hash table.
+func joinCost(method joinMethod, outer *joinInput, inner *joinInput, rows float64) float64 {
+	switch method {
+	case nestedLoopJoin:
+		return outer.est.cost + math.Max(outer.est.rows, 1)*inner.est.cost + outer.est.rows*inner.est.rows + rows
+	case hashJoin:
+		cost := outer.est.cost + inner.est.cost + 2*inner.est.rows + outer.est.rows + rows
+		if inner.est.rows > float64(HashBufferSize) {
+			//both inputs are partitioned to temporary files, which are
+			//then read back and joined
+			cost += outer.est.rows + inner.est.rows + 2*(outer.pages()+inner.pages())*pageIOCost
+		}
+		return cost
+	default:
+		return outer.est.cost + inner.est.cost + outer.sortCost() + inner.sortCost() + outer.est.rows + inner.est.rows + rows
+	}
+}
+
+// A relation of the from clause, i.e., a table or subquery, with the filters
+// that only reference it applied
+type joinRelation struct {
+	node *PlanNode
+	est  planEstimate
+}
+
+// An equality join predicate between two relations
+type joinEdge struct {
+	join        *LogicalJoinNode
+	left, right int // the relations referenced by join.left and join.right
+	// the names (table.field) of the fields compared, if the two sides of
+	// the predicate are plain fields
+	leftCol, rightCol string
+}
+
+// A plan joining a set of relations
+type joinPlan struct {
+	rels uint64 // bit i is set if relation i is joined
+	est  planEstimate
+	desc *TupleDesc
+	// the names of fields (all with equal values) that the output is
+	// sorted on, if any
+	order []string
+
+	// for a single relation, the relation; otherwise the inputs of the last
+	// join and the method it uses
+	rel                      int
+	outer, inner             *joinPlan
+	method                   joinMethod
+	outerSorted, innerSorted bool
+}
+
+// Return a key identifying the plan's interesting order
+func (p *joinPlan) orderKey() string {
+	cols := append([]string{}, p.order...)
+	sort.Strings(cols)
+	return strings.Join(cols, ",")
+}
+
+// Return true if the plan's output is sorted on the named field
+func (p *joinPlan) sortedOn(col string) bool {
+	if col == "" {
+		return false
+	}
+	for _, c := range p.order {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+type joinOptimizer struct {
+	c        *Catalog
+	tableMap map[string]*PlanNode
+	rels     []*joinRelation
+	edges    []*joinEdge
+}
+
+// Create an optimizer for the joins of plan, whose relations are the nodes of
+// tableMap
+func newJoinOptimizer(c *Catalog, plan *LogicalPlan, tableMap map[string]*PlanNode) (*joinOptimizer, error) {
+	o := &joinOptimizer{c: c, tableMap: tableMap}
+	names := make([]string, 0, len(tableMap))
+	for name := range tableMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	relOf := make(map[Operator]int)
+	for _, name := range names {
+		node := tableMap[name]
+		if _, ok := relOf[node.op]; !ok {
+			relOf[node.op] = len(o.rels)
+			o.rels = append(o.rels, &joinRelation{node, estimatePlan(c, node.op)})
+		}
+	}
+	if len(o.rels) > 64 {
+		return nil, GoDBError{ParseError, "too many tables to join"}
+	}
+
+	var filters []*joinEdge
+	for _, j := range plan.joins {
+		e := &joinEdge{join: j}
+		var err error
+		e.left, e.leftCol, err = o.relationOf(plan, j.left, relOf)
+		if err != nil {
+			return nil, err
+		}
+		e.right, e.rightCol, err = o.relationOf(plan, j.right, relOf)
+		if err != nil {
+			return nil, err
+		}
+		if e.left == e.right {
+			filters = append(filters, e)
+		} else {
+			o.edges = append(o.edges, e)
+		}
+	}
+	//predicates between fields of the same relation just filter it
+	for _, e := range filters {
+		rel := o.rels[e.left]
+		leftExpr, _, err := e.join.left.generateExpr(c, rel.node.desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		rightExpr, _, err := e.join.right.generateExpr(c, rel.node.desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		op, err := NewFilter(leftExpr, e.join.predOp, rightExpr, rel.node.op)
+		if err != nil {
+			return nil, err
+		}
+		rel.node = &PlanNode{op, rel.node.desc}
+		rel.est = estimatePlan(c, op)
+	}
+	return o, nil
+}
+
+// Return the relation referenced by one side of a join predicate, and the
+// name of the field it references if the side is a plain field
+func (o *joinOptimizer) relationOf(plan *LogicalPlan, side *LogicalSelectNode, relOf map[Operator]int) (int, string, error) {
+	tabName, fieldName, err := side.getTableField(o.c, plan.subqueries, plan.tables)
+	if err != nil {
+		return 0, "", err
+	}
+	node, err := fieldToOp(tabName, fieldName, o.tableMap)
+	if err != nil {
+		return 0, "", err
+	}
+	col := ""
+	if side.exprType == ExprField {
+		col = tabName + "." + fieldName
+	}
+	return relOf[node.op], col, nil
+}
+
+// Return the join predicates between the two sets of relations
+func (o *joinOptimizer) crossingEdges(s1 uint64, s2 uint64) []*joinEdge {
+	var edges []*joinEdge
+	for _, e := range o.edges {
+		l, r := uint64(1)<<e.left, uint64(1)<<e.right
+		if (s1&l != 0 && s2&r != 0) || (s1&r != 0 && s2&l != 0) {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// Return the plans for joining a and b, one for each join method and choice
+// of outer input
+func (o *joinOptimizer) joinCandidates(a *joinPlan, b *joinPlan) []*joinPlan {
+	edges := o.crossingEdges(a.rels, b.rels)
+	if len(edges) == 0 {
+		return nil
+	}
+	rows := a.est.rows * b.est.rows
+	for _, e := range edges {
+		rows *= joinSelectivity(&o.rels[e.left].est, e.leftCol, &o.rels[e.right].est, e.rightCol)
+	}
+	cols := mergeCols(a.est.cols, b.est.cols)
+	var plans []*joinPlan
+	for _, sides := range [][2]*joinPlan{{a, b}, {b, a}} {
+		outer, inner := sides[0], sides[1]
+		//the fields compared by the (first) join predicate
+		outerCol, innerCol := edges[0].leftCol, edges[0].rightCol
+		if outer.rels&(uint64(1)<<edges[0].left) == 0 {
+			outerCol, innerCol = innerCol, outerCol
+		}
+		outerIn := &joinInput{outer.est, outer.desc, len(edges) == 1 && outer.sortedOn(outerCol)}
+		innerIn := &joinInput{inner.est, inner.desc, len(edges) == 1 && inner.sortedOn(innerCol)}
+		for _, method := range []joinMethod{nestedLoopJoin, hashJoin, sortMergeJoin} {
+			p := &joinPlan{
+				rels:   a.rels | b.rels,
+				est:    planEstimate{rows, joinCost(method, outerIn, innerIn, rows), cols},
+				desc:   outer.desc.merge(inner.desc),
+				outer:  outer,
+				inner:  inner,
+				method: method,
+			}
+			switch method {
+			case nestedLoopJoin:
+				p.order = outer.order
+			case sortMergeJoin:
+				p.outerSorted, p.innerSorted = outerIn.sorted, innerIn.sorted
+				if len(edges) == 1 && outerCol != "" && innerCol != "" {
+					p.order = []string{outerCol, innerCol}
+					for _, in := range []*joinPlan{outer, inner} {
+						if in.sortedOn(outerCol) || in.sortedOn(innerCol) {
+							for _, c := range in.order {
+								if c != outerCol && c != innerCol {
+									p.order = append(p.order, c)
+								}
+							}
+						}
+					}
+				}
+			}
+			plans = append(plans, p)
+		}
+	}
+	return plans
+}
+
+// The best plans for a set of relations, keyed by the interesting order of
+// their output; the plan with the empty key is the cheapest overall
+type bestPlans map[string]*joinPlan
+
+// Add p to the plans if it is cheaper than the plan with the same order, or
+// the cheapest overall
+func (best bestPlans) add(p *joinPlan) {
+	for _, key := range []string{p.orderKey(), ""} {
+		if cur := best[key]; cur == nil || p.est.cost < cur.est.cost {
+			best[key] = p
+		}
+	}
+}
+
+// Return the plans, with the cheapest first and the rest in a deterministic
+// order
+func (best bestPlans) plans() []*joinPlan {
+	keys := make([]string, 0, len(best))
+	for key := range best {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	plans := make([]*joinPlan, len(keys))
+	for i, key := range keys {
+		plans[i] = best[key]
+	}
+	return plans
+}
+
+// Return the cheapest plan joining all of the relations
+func (o *joinOptimizer) bestPlan() (*joinPlan, error) {
+	n := len(o.rels)
+	singles := make([]*joinPlan, n)
+	for i, rel := range o.rels {
+		singles[i] = &joinPlan{rels: uint64(1) << i, est: rel.est, desc: rel.node.desc, rel: i}
+	}
+	if n > maxJoinOrderRelations {
+		return o.greedyPlan(singles)
+	}
+
+	best := make([]bestPlans, 1<<n)
+	for _, p := range singles {
+		best[p.rels] = bestPlans{"": p}
+	}
+	for size := 2; size <= n; size++ {
+		for s := uint64(1); s < 1<<n; s++ {
+			if bits.OnesCount64(s) != size {
+				continue
+			}
+			for i, single := range singles {
+				rest := s &^ (uint64(1) << i)
+				if rest == s || best[rest] == nil {
+					continue
+				}
+				for _, p := range best[rest].plans() {
+					for _, cand := range o.joinCandidates(p, single) {
+						if best[s] == nil {
+							best[s] = bestPlans{}
+						}
+						best[s].add(cand)
+					}
+				}
+			}
+		}
+	}
+	all := best[(1<<n)-1]
+	if all == nil {
+		return nil, GoDBError{ParseError, "not all tables are joined, cross products are not supported in GoDB"}
+	}
+	return all[""], nil
+}
+
+// Return a plan joining all of the relations that starts with the smallest
+// relation and repeatedly joins the relation that is cheapest to join next
+func (o *joinOptimizer) greedyPlan(singles []*joinPlan) (*joinPlan, error) {
+	cur := singles[0]
+	for _, p := range singles {
+		if p.est.rows < cur.est.rows {
+			cur = p
+		}
+	}
+	for bits.OnesCount64(cur.rels) < len(singles) {
+		var next *joinPlan
+		for _, single := range singles {
+			if cur.rels&single.rels != 0 {
+				continue
+			}
+			for _, cand := range o.joinCandidates(cur, single) {
+				if next == nil || cand.est.cost < next.est.cost {
+					next = cand
+				}
+			}
+		}
+		if next == nil {
+			return nil, GoDBError{ParseError, "not all tables are joined, cross products are not supported in GoDB"}
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// Build the operators of a plan
+func (o *joinOptimizer) build(p *joinPlan) (Operator, error) {
+	if p.outer == nil {
+		return o.rels[p.rel].node.op, nil
+	}
+	outer, err := o.build(p.outer)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := o.build(p.inner)
+	if err != nil {
+		return nil, err
+	}
+	var outerExprs, innerExprs []Expr
+	for _, e := range o.crossingEdges(p.outer.rels, p.inner.rels) {
+		outerSide, innerSide := e.join.left, e.join.right
+		if p.outer.rels&(uint64(1)<<e.left) == 0 {
+			outerSide, innerSide = innerSide, outerSide
+		}
+		outerExpr, _, err := outerSide.generateExpr(o.c, outer.Descriptor(), o.tableMap)
+		if err != nil {
+			return nil, err
+		}
+		innerExpr, _, err := innerSide.generateExpr(o.c, inner.Descriptor(), o.tableMap)
+		if err != nil {
+			return nil, err
+		}
+		outerExprs = append(outerExprs, outerExpr)
+		innerExprs = append(innerExprs, innerExpr)
+	}
+
+	switch p.method {
+	case hashJoin:
+		return NewHashJoin(outer, outerExprs, inner, innerExprs)
+	case sortMergeJoin:
+		smj, err := NewSortMergeJoin(outer, outerExprs, inner, innerExprs)
+		if err != nil {
+			return nil, err
+		}
+		smj.leftSorted, smj.rightSorted = p.outerSorted, p.innerSorted
+		return smj, nil
+	}
+	//a nested loop join compares a single pair of fields; further
+	//predicates filter its output
+	var op Operator
+	switch outerExprs[0].GetExprType().Ftype {
+	case IntType:
+		op, err = NewIntJoin(outer, outerExprs[0], inner, innerExprs[0], JoinBufferSize)
+	case StringType:
+		op, err = NewStringJoin(outer, outerExprs[0], inner, innerExprs[0], JoinBufferSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(outerExprs); i++ {
+		op, err = NewFilter(outerExprs[i], OpEq, innerExprs[i], op)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// Join the relations of plan, the nodes of tableMap, using the plan chosen by
+// the optimizer, and point all of tableMap at the result
+func planJoins(c *Catalog, plan *LogicalPlan, tableMap map[string]*PlanNode) (Operator, error) {
+	o, err := newJoinOptimizer(c, plan, tableMap)
+	if err != nil {
+		return nil, err
+	}
+	p, err := o.bestPlan()
+	if err != nil {
+		return nil, err
+	}
+	op, err := o.build(p)
+	if err != nil {
+		return nil, err
+	}
+	node := &PlanNode{op, op.Descriptor()}
+	for name := range tableMap {
+		tableMap[name] = node
+	}
+	return op, nil
+}
+
+// Return the node of the only relation in tableMap that the outer query side
+// of subquery filter f references, or nil if it references none, or several.
+// Such a filter can be applied to that relation before it is joined.
+func subqueryFilterRelation(c *Catalog, plan *LogicalPlan, f *LogicalFilterNode, tableMap map[string]*PlanNode) *PlanNode {
+	sq := f.subquery
+	var refs []*LogicalSelectNode
+	for _, key := range sq.outerKeys {
+		refs = append(refs, fieldRefs(key)...)
+	}
+	if sq.kind != ExistsSubquery {
+		refs = append(refs, fieldRefs(&f.left)...)
+	}
+	var node *PlanNode
+	check := func(n *PlanNode, err error) bool {
+		if err != nil || (node != nil && n.op != node.op) {
+			return false
+		}
+		node = n
+		return true
+	}
+	for _, ref := range refs {
+		tabName, fieldName, err := ref.getTableField(c, plan.subqueries, plan.tables)
+		if err != nil || !check(fieldToOp(tabName, fieldName, tableMap)) {
+			return nil
+		}
+	}
+	for _, param := range sq.params {
+		if !check(fieldToOp(param.table, param.field, tableMap)) {
+			return nil
+		}
+	}
+	return node
+}
@@ -0,0 +1,86 @@
+package godb
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Return an optimizer over relations with the given numbers of tuples, where
+// each join predicate compares field x of the two relations it connects
+func makeTestJoinOptimizer(sizes []float64, joins [][2]int) *joinOptimizer {
+	o := &joinOptimizer{}
+	for i, rows := range sizes {
+		desc := &TupleDesc{[]FieldType{{"x", fmt.Sprintf("r%d", i), IntType}}}
+		est := planEstimate{rows: rows, cost: rows/tuplesPerPage(desc)*pageIOCost + rows}
+		o.rels = append(o.rels, &joinRelation{&PlanNode{nil, desc}, est})
+	}
+	for _, j := range joins {
+		o.edges = append(o.edges, &joinEdge{nil, j[0], j[1], fmt.Sprintf("r%d.x", j[0]), fmt.Sprintf("r%d.x", j[1])})
+	}
+	return o
+}
+
+func TestJoinOrder(t *testing.T) {
+	//r2 is tiny, so r1 should be joined with it before joining the
+	//(large) result of joining r0 and r1
+	o := makeTestJoinOptimizer([]float64{100000, 100000, 1}, [][2]int{{0, 1}, {1, 2}})
+	p, err := o.bestPlan()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if p.rels != 7 {
+		t.Fatalf("expected plan joining all relations, got %b", p.rels)
+	}
+	if !((p.outer.rels == 6 && p.inner.rels == 1) || (p.outer.rels == 1 && p.inner.rels == 6)) {
+		t.Errorf("expected r1 and r2 to be joined first, got %b and %b", p.outer.rels, p.inner.rels)
+	}
+
+	//the greedy order used for many relations finds the same plan
+	greedy, err := o.greedyPlan([]*joinPlan{
+		{rels: 1, est: o.rels[0].est, desc: o.rels[0].node.desc, rel: 0},
+		{rels: 2, est: o.rels[1].est, desc: o.rels[1].node.desc, rel: 1},
+		{rels: 4, est: o.rels[2].est, desc: o.rels[2].node.desc, rel: 2},
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if greedy.est.cost != p.est.cost {
+		t.Errorf("expected greedy plan with cost %f, got %f", p.est.cost, greedy.est.cost)
+	}
+
+	//relations that aren't connected by join predicates can't be joined
+	o = makeTestJoinOptimizer([]float64{10, 10, 10}, [][2]int{{0, 1}})
+	if _, err := o.bestPlan(); err == nil {
+		t.Errorf("expected error for cross product")
+	}
+}
+
+func TestJoinMethod(t *testing.T) {
+	for _, test := range []struct {
+		sizes  []float64
+		joins  [][2]int
+		method joinMethod
+	}{
+		//a single outer tuple only requires a single scan of the inner
+		{[]float64{1, 100000}, [][2]int{{0, 1}}, nestedLoopJoin},
+		{[]float64{1000, 100000}, [][2]int{{0, 1}}, hashJoin},
+		//relations too large to hash in memory that are joined on the same
+		//field are best joined by sorting them once
+		{[]float64{1000000, 1000000, 1000000}, [][2]int{{0, 1}, {1, 2}}, sortMergeJoin},
+	} {
+		o := makeTestJoinOptimizer(test.sizes, test.joins)
+		p, err := o.bestPlan()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if p.method != test.method {
+			t.Errorf("sizes %v: expected join method %d, got %d", test.sizes, test.method, p.method)
+		}
+		if p.method == hashJoin && p.inner.est.rows > p.outer.est.rows {
+			t.Errorf("sizes %v: expected hash join to be built on the smaller input", test.sizes)
+		}
+		if p.method == sortMergeJoin && !p.outerSorted && !p.innerSorted {
+			t.Errorf("sizes %v: expected sort merge join to reuse the order of its input", test.sizes)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"sort"
 )
 
@@ -11,17 +12,19 @@ type OrderBy struct {
 	ascending []bool
 	tups      []*Tuple
 	//add additional fields here
+	maxBufferSize int // tuples sorted in memory before spilling runs to disk
 }
 
 // Order by constructor -- should save the list of field, child, and ascending
 // values for use in the Iterator() method. Here, orderByFields is a list of
 // expressions that can be extacted from the child operator's tuples, and the
 // ascending bitmap indicates whether the ith field in the orderByFields
-// list should be in ascending (true) or descending (false) order.
+// list should be in ascending (true) or descending (false) order.  At most
+// [SortBufferSize] tuples are sorted in memory.
 func NewOrderBy(orderByFields []Expr, child Operator, ascending []bool) (*OrderBy, error) {
 	// TODO: some code goes here
 	var tups []*Tuple
-	return &OrderBy{orderByFields, child, ascending, tups}, nil
+	return &OrderBy{orderByFields, child, ascending, tups, SortBufferSize}, nil
 
 }
 
@@ -41,88 +44,75 @@ func (ob *OrderBy) Swap(i, j int) {
 	ob.tups[i], ob.tups[j] = ob.tups[j], ob.tups[i]
 }
 
-// Less is part of sort.Interface. It is implemented by looping along the
-// less functions until it finds a comparison that discriminates between
-// the two items (one is less than the other). Note that it can call the
-// less functions twice per call.
+// Less is part of sort.Interface.
 func (ob *OrderBy) Less(i, j int) bool {
-	// Try all but the last comparison.
-	t1, t2 := ob.tups[i], ob.tups[j]
-	var k int
-	for k = 0; k < len(ob.orderBy)-1; k++ {
-		asc := ob.ascending[k]
-		expr := ob.orderBy[k]
+	return ob.less(ob.tups[i], ob.tups[j])
+}
+
+// Return true if t1 sorts before t2.
+func (ob *OrderBy) less(t1, t2 *Tuple) bool {
+	return tupleLess(t1, t2, ob.orderBy, ob.ascending)
+}
+
+// Return true if t1 sorts before t2 when ordering by exprs, where ascending
+// gives the direction of each expression.  It is implemented by looping along
+// the expressions until it finds a comparison that discriminates between the
+// two tuples (one is less than the other).
+func tupleLess(t1, t2 *Tuple, exprs []Expr, ascending []bool) bool {
+	for k, expr := range exprs {
 		obState, _ := t1.compareField(t2, expr)
 		switch obState {
 		case OrderedLessThan:
-			// p < q, so we have a decision.
-			if !asc {
-				return false
-			}
-			return true
+			return ascending[k]
 		case OrderedGreaterThan:
-			// p > q, so we have a decision.
-			if !asc {
-				return true
-			}
-			return false
+			return !ascending[k]
 		}
 	}
-	asc := ob.ascending[k]
-	expr := ob.orderBy[k]
-	obState, _ := t1.compareField(t2, expr)
-	if obState == OrderedLessThan {
-		return asc
-	}
-	if obState == OrderedGreaterThan {
-		return !asc
-	}
-	return true
+	return false
 }
 
 func (ob *OrderBy) Descriptor() *TupleDesc {
 	return ob.child.Descriptor().copy()
 }
 
+func (ob *OrderBy) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Order By", "keys", describeOrder(ob.orderBy, ob.ascending)), []Operator{ob.child}
+}
+
 // Return a function that iterators through the results of the child iterator in
-// ascending/descending order, as specified in the construtor.  This sort is
-// "blocking" -- it should first construct an in-memory sorted list of results
-// to return, and then iterate through them one by one on each subsequent
-// invocation of the iterator function.
+// ascending/descending order, as specified in the construtor.  This sort is
+// "blocking" -- it first consumes all of the child's tuples, and then iterates
+// through them in sorted order on each subsequent invocation of the iterator
+// function.
 //
-// Although you are free to implement your own sorting logic, you may wish to
-// leverage the go sort pacakge and the [sort.Sort] method for this purpose.  To
-// use this you will need to implement three methods:  Len, Swap, and Less that
-// the sort algorithm will invoke to preduce a sorted list. See the first
-// example, example of SortMultiKeys, and documentation at: https://pkg.go.dev/sort
-func (ob *OrderBy) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
-	// Get all tuples
-	iter, err := ob.child.Iterator(tid)
+// Inputs that don't fit in the operator's buffer, or in the query's memory
+// limit, are sorted externally: sorted runs of tuples are spilled to
+// temporary files, and merged as the iterator is invoked.
+func (ob *OrderBy) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := ob.child.Iterator(ctx, tid)
 	if err != nil {
 		return nil, err
 	}
+	// use a fresh sorter so that the operator can be iterated more than
+	// once, e.g., as the inner input of a join or a subquery
+	sorter := newExternalSorter(ob.child.Descriptor(), ob.less, ob.maxBufferSize, newMemoryAccount(ctx, "Order By"))
 	for {
 		tup, err := iter()
+		if err != nil {
+			sorter.close()
+			return nil, err
+		}
 		if tup == nil {
 			break
 		}
-		if err != nil {
+		if err := sorter.add(tup); err != nil {
+			sorter.close()
 			return nil, err
 		}
-		ob.tups = append(ob.tups, tup)
 	}
-	ob.Sort(ob.tups)
-
-	// return iterator
-	i := 0
-	return func() (*Tuple, error) {
-		for {
-			if i == len(ob.tups) {
-				return nil, nil
-			}
-			c := i
-			i += 1
-			return ob.tups[c], nil
-		}
-	}, nil
+	sorted, err := sorter.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return closeOnCancel(ctx, sorted, sorter.close), nil
 }
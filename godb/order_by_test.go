@@ -1,6 +1,8 @@
 package godb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -10,9 +12,9 @@ import (
 // in ascending and descending order and verifying the result
 func TestOrderBy(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	bs := make([]bool, 2)
 	for i := range bs {
 		bs[i] = false
@@ -27,7 +29,7 @@ func TestOrderBy(t *testing.T) {
 		t.Fatalf(err.Error())
 	}
 
-	iter, _ := oby.Iterator(tid)
+	iter, _ := oby.Iterator(context.Background(), tid)
 	if iter == nil {
 		t.Fatalf("iter was nil")
 	}
@@ -57,7 +59,7 @@ func TestOrderBy(t *testing.T) {
 		t.Fatalf(err.Error())
 	}
 
-	iter, _ = oby.Iterator(tid)
+	iter, _ = oby.Iterator(context.Background(), tid)
 	last = ""
 	for {
 		tup, _ := iter()
@@ -77,6 +79,38 @@ func TestOrderBy(t *testing.T) {
 }
 
 // harder order by test that inserts 4 tuples, and alternates ascending vs descending
+// An order by can be iterated more than once, e.g., as the inner input of a
+// join, and outputs the tuples of its child each time
+func TestOrderByRepeatedIteration(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	oby, err := NewOrderBy([]Expr{&FieldExpr{t1.Desc.Fields[0]}}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; i < 3; i++ {
+		iter, err := oby.Iterator(context.Background(), tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var tups []*Tuple
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			tups = append(tups, tup)
+		}
+		if len(tups) != 2 || !tups[0].equals(&t2) || !tups[1].equals(&t1) {
+			t.Fatalf("iteration %d: expected the 2 tuples in order, got %v", i, tups)
+		}
+	}
+}
+
 func TestMultiFieldOrderBy(t *testing.T) {
 	var td = TupleDesc{Fields: []FieldType{
 		{Fname: "name", Ftype: StringType},
@@ -116,10 +150,10 @@ func TestMultiFieldOrderBy(t *testing.T) {
 
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
-	hf.insertTuple(&t3, tid)
-	hf.insertTuple(&t4, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t3, tid)
+	hf.insertTuple(context.Background(), &t4, tid)
 
 	//order by name and then age, descending
 	ascDescs := [][]bool{{false, false}, {true, false}}
@@ -137,7 +171,7 @@ func TestMultiFieldOrderBy(t *testing.T) {
 		if err != nil {
 			t.Fatalf(err.Error())
 		}
-		iter, _ := oby.Iterator(tid)
+		iter, _ := oby.Iterator(context.Background(), tid)
 		if iter == nil {
 			t.Fatalf("iter was nil")
 		}
@@ -164,3 +198,100 @@ func TestMultiFieldOrderBy(t *testing.T) {
 	bp.CommitTransaction(tid)
 
 }
+
+// test that an order by whose input doesn't fit in its buffer produces the
+// same result as one sorted in memory
+func TestOrderBySpill(t *testing.T) {
+	td, _, _, hf, _, tid := makeTestVars()
+	for i := 0; i < 200; i++ {
+		tup := Tuple{td, []DBValue{StringField{"sam"}, IntField{int64((i * 37) % 101)}}, nil}
+		if err := hf.insertTuple(context.Background(), &tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	exprs := []Expr{&FieldExpr{td.Fields[1]}}
+	oby, err := NewOrderBy(exprs, hf, []bool{false})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	oby.maxBufferSize = 15
+	iter, err := oby.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	var last int64 = 101
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		age := tup.Fields[1].(IntField).Value
+		if age > last {
+			t.Fatalf("data was not descending, as expected")
+		}
+		last = age
+		cnt++
+	}
+	if cnt != 200 {
+		t.Errorf("expected 200 tuples, got %d", cnt)
+	}
+}
+
+func TestOrderByCancel(t *testing.T) {
+	td, _, _, hf, _, tid := makeTestVars()
+	for i := 0; i < 200; i++ {
+		tup := Tuple{td, []DBValue{StringField{"sam"}, IntField{int64(i)}}, nil}
+		if err := hf.insertTuple(context.Background(), &tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	oby, err := NewOrderBy([]Expr{&FieldExpr{td.Fields[1]}}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	oby.maxBufferSize = 15
+	tempFiles := countTempFiles(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	iter, err := oby.Iterator(ctx, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); tup == nil || err != nil {
+		t.Fatalf("expected a tuple, got %v, %v", tup, err)
+	}
+	cancel()
+	if _, err := iter(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled sort to fail with %v, got %v", context.Canceled, err)
+	}
+	if n := countTempFiles(t); n != tempFiles {
+		t.Errorf("expected temporary files to be removed, found %d more", n-tempFiles)
+	}
+
+	//a canceled context stops the scan of the file before anything is sorted
+	if _, err := iterateCanceled(hf, tid); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled scan to fail with %v, got %v", context.Canceled, err)
+	}
+}
+
+// Run op in tid with a context that is already canceled, returning the number
+// of tuples it produced before failing
+func iterateCanceled(op Operator, tid TransactionID) (int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	iter, err := op.Iterator(ctx, tid)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil || tup == nil {
+			return cnt, err
+		}
+		cnt++
+	}
+}
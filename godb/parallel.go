@@ -0,0 +1,565 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Number of workers that the scan of a large heap file, and the filters,
+// projections and partial aggregates applied to it, are split between, each
+// reading a range of the file's pages in its own goroutine.  Queries are
+// planned serially by default, as the workers of a plan whose iterator is
+// abandoned keep running, and may lock pages for its transaction after it
+// ends, unless the query's context is canceled and its workers waited for
+// (see [WithWorkerGroup]).  Callers that do so may set it to, e.g.,
+// runtime.GOMAXPROCS(0).
+var ParallelWorkers int = 1
+
+// Minimum number of pages of a heap file for scans of it to be planned in
+// parallel; smaller files aren't worth the cost of starting workers.
+var ParallelScanMinPages int = 64
+
+// Number of tuples buffered in each channel between the goroutines of a
+// parallel plan (see [Gather] and [Exchange]).  A worker blocks once its
+// consumer falls this far behind.
+var ExchangeBufferSize int = 1024
+
+// PartitionScan reads one of several ranges of the pages of a heap file, so
+// that the file can be scanned by several workers in parallel (see [Gather]).
+// The file is split into partitions of the same number of pages when the scan
+// starts, rather than when it is planned, so the partitions of a scan cover
+// pages added to the file since.
+type PartitionScan struct {
+	file                  *HeapFile
+	partition, partitions int
+}
+
+// Constructor for a scan of the given partition, numbered from 0, of the pages
+// of file split into partitions partitions
+func NewPartitionScan(file *HeapFile, partition int, partitions int) (*PartitionScan, error) {
+	if partition < 0 || partition >= partitions {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("no partition %d of %d", partition, partitions)}
+	}
+	return &PartitionScan{file, partition, partitions}, nil
+}
+
+func (s *PartitionScan) Descriptor() *TupleDesc {
+	return s.file.Descriptor()
+}
+
+func (s *PartitionScan) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Partition Scan", "file", s.file.Filename, "partition", fmt.Sprintf("%d of %d", s.partition+1, s.partitions)), nil
+}
+
+// Return an iterator through the tuples of the pages of the partition, in
+// order.  Pages are requested from the buffer pool with ReadPerm in tid, like
+// the pages of a [HeapFile.Iterator].
+func (s *PartitionScan) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	pages := s.file.NumPages()
+	pageNo := pages * s.partition / s.partitions
+	end := pages * (s.partition + 1) / s.partitions
+	var tuples []*Tuple
+	slot := 0
+	return func() (*Tuple, error) {
+		for {
+			for slot < len(tuples) {
+				t := tuples[slot]
+				slot++
+				if t != nil {
+					return t, nil
+				}
+			}
+			if pageNo >= end {
+				return nil, nil
+			}
+			page, err := s.file.bufPool.GetPage(ctx, s.file, pageNo, tid, ReadPerm)
+			if err != nil {
+				return nil, err
+			}
+			tuples, slot = (*page).(*heapPage).Tuples, 0
+			pageNo++
+		}
+	}, nil
+}
+
+// The state shared by the goroutines of one execution of a [Gather] or an
+// [Exchange].  The first error of any of them fails the execution, which
+// cancels the context the others run in; so does canceling the context the
+// execution was started in.  Once the execution fails, the consumers of its
+// tuples wait for all of the workers to exit before returning the error, so
+// that none of them is still requesting pages, and locks, for the transaction
+// when it is committed or aborted.
+type parallelRun struct {
+	parent context.Context    // the context the execution was started in
+	ctx    context.Context    // the context the workers run in
+	cancel context.CancelFunc // cancels ctx
+	done   chan struct{}      // closed when the execution fails
+	err    error
+	once   sync.Once
+	stop   func() bool     // stops failing the execution when parent is done
+	wg     sync.WaitGroup  // the workers
+	group  *sync.WaitGroup // the workers of the query, if tracked
+}
+
+func newParallelRun(ctx context.Context) *parallelRun {
+	r := &parallelRun{parent: ctx, done: make(chan struct{})}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	r.group, _ = ctx.Value(workerGroupKey{}).(*sync.WaitGroup)
+	r.stop = context.AfterFunc(ctx, func() {
+		r.fail(ctx.Err())
+	})
+	return r
+}
+
+type workerGroupKey struct{}
+
+// Return a copy of ctx in which the goroutines started by the parallel
+// operators of a query run with it are counted, along with a function that
+// waits until all of them have exited.  A query that may be canceled, or may
+// fail, before its iterator is exhausted should be run with such a context,
+// and the function called before its transaction is committed or aborted, as
+// operators may return the error without waiting for their children.
+func WithWorkerGroup(ctx context.Context) (context.Context, func()) {
+	group := &sync.WaitGroup{}
+	return context.WithValue(ctx, workerGroupKey{}, group), group.Wait
+}
+
+// Fail the execution with err, unless it has already failed
+func (r *parallelRun) fail(err error) {
+	r.once.Do(func() {
+		r.err = err
+		close(r.done)
+		r.cancel()
+	})
+}
+
+// Start a worker running op in tid (see [parallelRun.work])
+func (r *parallelRun) goWork(op Operator, tid TransactionID, emit func(*Tuple) bool) {
+	r.wg.Add(1)
+	if r.group != nil {
+		r.group.Add(1)
+	}
+	go func() {
+		if r.group != nil {
+			defer r.group.Done()
+		}
+		defer r.wg.Done()
+		r.work(op, tid, emit)
+	}()
+}
+
+// Call f, e.g., to close the channels of the execution, once all of its
+// workers have exited
+func (r *parallelRun) whenFinished(f func()) {
+	go func() {
+		r.wg.Wait()
+		r.stop()
+		r.cancel()
+		f()
+	}()
+}
+
+// Return the error the execution failed with, once all of its workers have
+// exited
+func (r *parallelRun) failure() error {
+	r.wg.Wait()
+	return r.err
+}
+
+// Send t on ch, returning false, without sending it, if the execution fails
+// first
+func (r *parallelRun) send(ch chan<- *Tuple, t *Tuple) bool {
+	select {
+	case ch <- t:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// Receive the next tuple from ch, returning nil once ch is closed, or the
+// error the execution failed with
+func (r *parallelRun) receive(ch <-chan *Tuple) (*Tuple, error) {
+	//the execution may not have been failed yet by the function registered
+	//with AfterFunc, which runs in a goroutine of its own
+	if err := r.parent.Err(); err != nil {
+		r.fail(err)
+	}
+	select {
+	case <-r.done:
+		return nil, r.failure()
+	default:
+	}
+	select {
+	case t, ok := <-ch:
+		if ok {
+			return t, nil
+		}
+		//ch is closed once its senders have stopped, which may be because
+		//the execution failed
+		select {
+		case <-r.done:
+			return nil, r.failure()
+		default:
+			return nil, nil
+		}
+	case <-r.done:
+		return nil, r.failure()
+	}
+}
+
+// Run op in tid, passing each of its tuples to emit until op is exhausted or
+// fails, or emit returns false.  A failure of op fails the execution.
+func (r *parallelRun) work(op Operator, tid TransactionID, emit func(*Tuple) bool) {
+	iter, err := op.Iterator(r.ctx, tid)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		if t == nil || !emit(t) {
+			return
+		}
+	}
+}
+
+// Gather runs each of its children, e.g., a filter over a partition of a
+// table (see [PartitionScan]), in its own goroutine, and outputs all of their
+// tuples, in no particular order.  Tuples are passed from the workers through
+// a channel holding up to [ExchangeBufferSize] tuples.
+//
+// The workers run in the transaction of the iterator, so they share its
+// locks: they request pages through the buffer pool, whose mutex serializes
+// the requests, and a page locked by another transaction blocks the worker
+// reading it until the lock is released.  If any worker fails, e.g., because
+// the transaction is aborted to break a deadlock, the other workers are
+// stopped and the iterator returns the error once they have exited.  The
+// workers of an iterator that is abandoned before it is exhausted stay
+// blocked until the context of the iterator is canceled, so parallel plans
+// should be run to completion or canceled, and waited for (see
+// [WithWorkerGroup]).
+type Gather struct {
+	children   []Operator
+	bufferSize int
+}
+
+// Constructor for a gather of children, which must have the same types of
+// fields.  The fields of the output are named after those of the first child.
+func NewGather(children []Operator) (*Gather, error) {
+	if err := checkParallelChildren(children); err != nil {
+		return nil, err
+	}
+	return &Gather{children, ExchangeBufferSize}, nil
+}
+
+// Check that there is at least one child, and that all children output the
+// same types of fields
+func checkParallelChildren(children []Operator) error {
+	if len(children) == 0 {
+		return GoDBError{IllegalOperationError, "parallel operator requires at least one child"}
+	}
+	desc := children[0].Descriptor()
+	for _, child := range children[1:] {
+		other := child.Descriptor()
+		if len(other.Fields) != len(desc.Fields) {
+			return GoDBError{TypeMismatchError, "children of parallel operator have different numbers of fields"}
+		}
+		for i, f := range other.Fields {
+			if f.Ftype != desc.Fields[i].Ftype {
+				return GoDBError{TypeMismatchError, "children of parallel operator have different types of fields"}
+			}
+		}
+	}
+	return nil
+}
+
+func (g *Gather) Descriptor() *TupleDesc {
+	return g.children[0].Descriptor()
+}
+
+func (g *Gather) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Gather", "workers", fmt.Sprint(len(g.children))), g.children
+}
+
+func (g *Gather) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	run := newParallelRun(ctx)
+	out := make(chan *Tuple, g.bufferSize)
+	for _, child := range g.children {
+		run.goWork(child, tid, func(t *Tuple) bool {
+			return run.send(out, t)
+		})
+	}
+	run.whenFinished(func() {
+		close(out)
+	})
+	return func() (*Tuple, error) {
+		return run.receive(out)
+	}, nil
+}
+
+// Exchange repartitions the tuples of its children, each run in its own
+// goroutine, between several outputs (see [Exchange.Output]) by the hash of
+// the values of its keys, so that tuples with equal keys go to the same
+// output.  The outputs are meant to be consumed in parallel, e.g., by the
+// workers of a [Gather] that each aggregate a disjoint set of groups.  A
+// child blocks while the channel of the output its next tuple goes to is full,
+// as for a [Gather].
+//
+// The children are started by the first iterator created through one of the
+// outputs, and started again, for the next execution, when an output whose
+// iterator has already been created is iterated again.  The iterators of all
+// of the outputs of an execution should thus be created in the same
+// transaction and consumed together, and none should be abandoned before it
+// is exhausted, unless the context of the execution is canceled.
+type Exchange struct {
+	children   []Operator
+	keys       []Expr
+	outputs    []*ExchangeOutput
+	bufferSize int
+
+	mutex sync.Mutex
+	run   *exchangeRun // the current execution
+}
+
+// One execution of an exchange
+type exchangeRun struct {
+	*parallelRun
+	outs    []chan *Tuple
+	started []bool // whether the iterator of each output has been created
+}
+
+// ExchangeOutput is an operator reading one of the outputs of an [Exchange]
+type ExchangeOutput struct {
+	exchange *Exchange
+	index    int
+}
+
+// Constructor for an exchange of the tuples of children, which must have the
+// same types of fields, between n outputs by the values of keys
+func NewExchange(children []Operator, keys []Expr, n int) (*Exchange, error) {
+	if err := checkParallelChildren(children); err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, GoDBError{IllegalOperationError, "exchange requires at least one output"}
+	}
+	e := &Exchange{children: children, keys: keys, bufferSize: ExchangeBufferSize}
+	for i := 0; i < n; i++ {
+		e.outputs = append(e.outputs, &ExchangeOutput{e, i})
+	}
+	return e, nil
+}
+
+// Return the ith output of the exchange, numbered from 0
+func (e *Exchange) Output(i int) *ExchangeOutput {
+	return e.outputs[i]
+}
+
+// Return the execution that the iterator of output i created in tid reads
+// from, starting a new one if needed
+func (e *Exchange) join(ctx context.Context, i int, tid TransactionID) *exchangeRun {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.run == nil || e.run.started[i] {
+		e.run = e.start(ctx, tid)
+	}
+	e.run.started[i] = true
+	return e.run
+}
+
+// Start an execution of the exchange in tid
+func (e *Exchange) start(ctx context.Context, tid TransactionID) *exchangeRun {
+	run := &exchangeRun{newParallelRun(ctx), make([]chan *Tuple, len(e.outputs)), make([]bool, len(e.outputs))}
+	for i := range run.outs {
+		run.outs[i] = make(chan *Tuple, e.bufferSize)
+	}
+	for _, child := range e.children {
+		var key []byte
+		run.goWork(child, tid, func(t *Tuple) bool {
+			var err error
+			key, err = appendJoinKey(key[:0], e.keys, t)
+			if err != nil {
+				run.fail(err)
+				return false
+			}
+			return run.send(run.outs[hashKey(key, 0)%uint64(len(run.outs))], t)
+		})
+	}
+	run.whenFinished(func() {
+		for _, out := range run.outs {
+			close(out)
+		}
+	})
+	return run
+}
+
+func (o *ExchangeOutput) Descriptor() *TupleDesc {
+	return o.exchange.children[0].Descriptor()
+}
+
+// The children of an exchange are shared by all of its outputs, so they are
+// only described under the first.
+func (o *ExchangeOutput) DescribePlan() (*PlanDescription, []Operator) {
+	e := o.exchange
+	d := newPlanDescription("Exchange", "keys", describeExprs(e.keys), "partition", fmt.Sprintf("%d of %d", o.index+1, len(e.outputs)))
+	if o.index > 0 {
+		return d, nil
+	}
+	return d, e.children
+}
+
+func (o *ExchangeOutput) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	run := o.exchange.join(ctx, o.index, tid)
+	out := run.outs[o.index]
+	return func() (*Tuple, error) {
+		return run.receive(out)
+	}, nil
+}
+
+// Return the heap file scanned by op, if op is a chain of aliases, filters
+// and projections (without distinct) over a heap file, or nil otherwise
+func scannedFile(op Operator) *HeapFile {
+	switch op := op.(type) {
+	case *HeapFile:
+		return op
+	case *AliasOp:
+		return scannedFile(op.child)
+	case *Filter[int64]:
+		return scannedFile(op.child)
+	case *Filter[string]:
+		return scannedFile(op.child)
+	case *Project:
+		if !op.distinct {
+			return scannedFile(op.child)
+		}
+	}
+	return nil
+}
+
+// Return a copy of op, which must be a chain of operators over a heap file
+// (see [scannedFile]), that reads only the given partition of the file
+func partitionPlan(op Operator, partition int, partitions int) Operator {
+	switch op := op.(type) {
+	case *HeapFile:
+		return &PartitionScan{op, partition, partitions}
+	case *AliasOp:
+		return NewAliasOp(partitionPlan(op.child, partition, partitions), op.alias)
+	case *Filter[int64]:
+		return &Filter[int64]{op.op, op.left, op.right, partitionPlan(op.child, partition, partitions), op.getter}
+	case *Filter[string]:
+		return &Filter[string]{op.op, op.left, op.right, partitionPlan(op.child, partition, partitions), op.getter}
+	case *Project:
+		return &Project{op.selectFields, op.outputNames, partitionPlan(op.child, partition, partitions), op.distinct}
+	}
+	return nil
+}
+
+// Return a plan that runs op, the scan of a table and the filters applied to
+// it, in [ParallelWorkers] workers that each read a partition of the table, or
+// nil if op doesn't scan a heap file of at least [ParallelScanMinPages] pages,
+// or scans are planned serially in c.
+func parallelScanPlan(c *Catalog, op Operator) (Operator, error) {
+	file := scannedFile(op)
+	n := ParallelWorkers
+	if c.serialScans || n < 2 || file == nil || file.NumPages() < ParallelScanMinPages {
+		return nil, nil
+	}
+	parts := make([]Operator, n)
+	for i := range parts {
+		parts[i] = partitionPlan(op, i, n)
+	}
+	return NewGather(parts)
+}
+
+// Return the aggregate that combines the outputs of partial aggregates agg
+// into the aggregate of all of their inputs, e.g., the sum of partial counts,
+// or nil if agg can't be computed from partial aggregates
+func mergeAggState(agg AggState) AggState {
+	field := agg.GetTupleDesc().Fields[0]
+	getter := intAggGetter
+	var merge AggState
+	switch agg.(type) {
+	case *CountAggState, *SumAggState[int64]:
+		merge = &SumAggState[int64]{}
+	case *MinAggState[int64]:
+		merge = &MinAggState[int64]{}
+	case *MaxAggState[int64]:
+		merge = &MaxAggState[int64]{}
+	case *MinAggState[string]:
+		merge, getter = &MinAggState[string]{}, stringAggGetter
+	case *MaxAggState[string]:
+		merge, getter = &MaxAggState[string]{}, stringAggGetter
+	default:
+		return nil
+	}
+	merge.Init(field.Fname, &FieldExpr{field}, getter)
+	return merge
+}
+
+// Return a plan aggregating the output of the workers of g by the aggregates
+// aggs and group by expressions gbys, with the same output as an [Aggregator]
+// over g.  If every aggregate can be computed from partial aggregates (see
+// [mergeAggState]), each worker aggregates its own tuples, and the partial
+// aggregates are merged.  Otherwise, if there is a group by, the tuples of the
+// workers are exchanged by their groups (see [Exchange]), so that each group
+// is aggregated by a single worker; with neither, g is aggregated serially.
+func parallelAggregatePlan(g *Gather, aggs []AggState, gbys []Expr) (Operator, error) {
+	var partialDesc TupleDesc
+	for _, gby := range gbys {
+		partialDesc.Fields = append(partialDesc.Fields, gby.GetExprType())
+	}
+	mergeable := true
+	merge := make([]AggState, len(aggs))
+	for i, agg := range aggs {
+		merge[i] = mergeAggState(agg)
+		mergeable = mergeable && merge[i] != nil
+		partialDesc.Fields = append(partialDesc.Fields, agg.GetTupleDesc().Fields...)
+	}
+	//the merge reads the group by fields and partial aggregates by name
+	for i, f := range partialDesc.Fields {
+		for _, other := range partialDesc.Fields[:i] {
+			if f.Fname == other.Fname && f.TableQualifier == other.TableQualifier {
+				mergeable = false
+			}
+		}
+	}
+
+	n := len(g.children)
+	workers := make([]Operator, n)
+	switch {
+	case mergeable:
+		for i, child := range g.children {
+			//a worker without input outputs no partial aggregate, rather
+			//than one of an empty group
+			workers[i] = NewGroupedAggregator(aggs, append([]Expr{}, gbys...), child)
+		}
+		partials, err := NewGather(workers)
+		if err != nil {
+			return nil, err
+		}
+		if len(gbys) == 0 {
+			return NewAggregator(merge, partials), nil
+		}
+		keys := make([]Expr, len(gbys))
+		for i := range keys {
+			keys[i] = &FieldExpr{partialDesc.Fields[i]}
+		}
+		return NewGroupedAggregator(merge, keys, partials), nil
+	case len(gbys) > 0:
+		ex, err := NewExchange(g.children, gbys, n)
+		if err != nil {
+			return nil, err
+		}
+		for i := range workers {
+			workers[i] = NewGroupedAggregator(aggs, gbys, ex.Output(i))
+		}
+		return NewGather(workers)
+	}
+	return NewAggregator(aggs, g), nil
+}
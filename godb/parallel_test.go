@@ -0,0 +1,485 @@
+package godb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Create a catalog with the tables of the parser tests, along with a table
+// big(name, age) of several pages, in which row i has name "n" + (i % 50) and
+// age i % 100, and plan scans of tables of at least two pages in parallel
+func makeParallelTestCatalog(t *testing.T) (*Catalog, *BufferPool, *HeapFile) {
+	workers, minPages := ParallelWorkers, ParallelScanMinPages
+	ParallelWorkers, ParallelScanMinPages = 4, 2
+	t.Cleanup(func() {
+		ParallelWorkers, ParallelScanMinPages = workers, minPages
+	})
+
+	bp := NewBufferPool(100)
+	if err := MakeTestDatabaseEasy(bp); err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", bp, "./")
+	if err != nil {
+		t.Fatalf("failed load catalog, %s", err.Error())
+	}
+	os.Remove("big.dat")
+	t.Cleanup(func() { os.Remove("big.dat") })
+	if _, _, err := Parse(c, "create table big (name text, age int)"); err != nil {
+		t.Fatalf("failed to create table big, %s", err.Error())
+	}
+	file, err := c.GetTable("big")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf := file.(*HeapFile)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	for i := 0; i < 3000; i++ {
+		tup := Tuple{*hf.Descriptor(), []DBValue{StringField{fmt.Sprintf("n%d", i%50)}, IntField{int64(i % 100)}}, nil}
+		if err := hf.insertTuple(context.Background(), &tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+	if hf.NumPages() < 4 {
+		t.Fatalf("expected big to have several pages, got %d", hf.NumPages())
+	}
+	return c, bp, hf
+}
+
+// Return the fields of tuples as sorted strings
+func sortedTupleStrings(tups []*Tuple) []string {
+	out := make([]string, len(tups))
+	for i, tup := range tups {
+		out[i] = fmt.Sprint(tup.Fields)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Return the names of the operators of the plan rooted at op
+func planOperatorNames(c *Catalog, op Operator) []string {
+	var names []string
+	var visit func(d *PlanDescription)
+	visit = func(d *PlanDescription) {
+		names = append(names, d.Name)
+		for _, child := range d.Children {
+			visit(child)
+		}
+	}
+	visit(DescribePlan(c, op))
+	return names
+}
+
+func TestPartitionScan(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	expected := sortedTupleStrings(collectTuples(t, hf, tid))
+
+	var tups []*Tuple
+	for i := 0; i < 3; i++ {
+		scan, err := NewPartitionScan(hf, i, 3)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		part := collectTuples(t, scan, tid)
+		if len(part) == 0 {
+			t.Errorf("expected partition %d to have tuples", i)
+		}
+		tups = append(tups, part...)
+	}
+	if out := sortedTupleStrings(tups); !slices.Equal(out, expected) {
+		t.Errorf("expected the partitions to have the %d tuples of the file, got %d", len(expected), len(out))
+	}
+	if _, err := NewPartitionScan(hf, 3, 3); err == nil {
+		t.Errorf("expected error scanning a partition that doesn't exist")
+	}
+}
+
+func TestGather(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	expected := sortedTupleStrings(collectTuples(t, hf, tid))
+
+	parts := make([]Operator, 4)
+	for i := range parts {
+		parts[i] = partitionPlan(hf, i, len(parts))
+	}
+	g, err := NewGather(parts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	//the buffer is smaller than the output of each worker
+	g.bufferSize = 10
+	for i := 0; i < 2; i++ {
+		if out := sortedTupleStrings(collectTuples(t, g, tid)); !slices.Equal(out, expected) {
+			t.Errorf("expected the %d tuples of the file, got %d", len(expected), len(out))
+		}
+	}
+
+	//a failing worker stops the gather
+	parts[2] = &failingOp{parts[2], 5}
+	g, _ = NewGather(parts)
+	g.bufferSize = 1
+	iter, err := g.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			break
+		}
+		if tup == nil {
+			t.Fatalf("expected the gather to fail")
+		}
+	}
+
+	if _, err := NewGather([]Operator{hf, NewAliasOp(&failingOp{hf, 0}, "x")}); err != nil {
+		t.Errorf("expected children with the same types to be gathered, %s", err.Error())
+	}
+	if _, err := NewGather([]Operator{hf, NewValueOp([][]Expr{{&ConstExpr{StringField{"a"}, StringType}}})}); err == nil {
+		t.Errorf("expected error gathering children of different types")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+
+	parts := make([]Operator, 4)
+	for i := range parts {
+		parts[i] = partitionPlan(hf, i, len(parts))
+	}
+	name := &FieldExpr{hf.Descriptor().Fields[0]}
+	ex, err := NewExchange(parts, []Expr{name}, 3)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	ex.bufferSize = 10
+	for run := 0; run < 2; run++ {
+		//the outputs are consumed in parallel
+		outputs := make([][]*Tuple, 3)
+		var wg sync.WaitGroup
+		for i := range outputs {
+			iter, err := ex.Output(i).Iterator(context.Background(), tid)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for tup, err := iter(); tup != nil && err == nil; tup, err = iter() {
+					outputs[i] = append(outputs[i], tup)
+				}
+			}(i)
+		}
+		wg.Wait()
+		output := make(map[string]int)
+		total := 0
+		for i, tups := range outputs {
+			for _, tup := range tups {
+				n := tup.Fields[0].(StringField).Value
+				if j, ok := output[n]; ok && j != i {
+					t.Fatalf("%s sent to outputs %d and %d", n, j, i)
+				}
+				output[n] = i
+			}
+			total += len(tups)
+		}
+		if total != 3000 || len(output) != 50 {
+			t.Errorf("expected 3000 tuples with 50 names, got %d with %d", total, len(output))
+		}
+	}
+}
+
+func TestParallelQueries(t *testing.T) {
+	c, bp, _ := makeParallelTestCatalog(t)
+	queries := map[string][]string{
+		"select name, age from big where age > 90":                                                             {"Gather", "Partition Scan"},
+		"select count(*), sum(age), min(name), max(age) from big where age < 50":                               {"Gather", "Aggregate"},
+		"select count(*), max(name) from big where age > 1000":                                                 {"Gather", "Aggregate"},
+		"select name, count(*), max(age) from big group by name":                                               {"Gather", "Aggregate"},
+		"select name, avg(age) from big group by name":                                                         {"Exchange"},
+		"select count(distinct age) from big":                                                                  {"Gather"},
+		"select avg(age) from big where name = 'n1'":                                                           {"Gather"},
+		"select distinct name from big where age < 10":                                                         {"Gather"},
+		"select name, age from big order by age, name limit 5":                                                 {"Gather"},
+		"select b1.age, count(*) from big b1, big b2 where b1.age = b2.age and b1.name = 'n1' group by b1.age": {"Gather"},
+		"select big.name, t.name from big, t where big.age = t.age":                                            {"Gather"},
+		"select name from t where age > 40":                                                                    nil,
+	}
+	for sql, operators := range queries {
+		ParallelWorkers = 1
+		expected := sortedTupleStrings(runParserTestQuery(t, c, bp, sql))
+		ParallelWorkers = 4
+		_, plan, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf("failed to parse, q=%s, %s", sql, err.Error())
+		}
+		names := planOperatorNames(c, plan)
+		for _, op := range operators {
+			if !slices.Contains(names, op) {
+				t.Errorf("'%s': expected a %s operator, got %v", sql, op, names)
+			}
+		}
+		if operators == nil && slices.Contains(names, "Gather") {
+			t.Errorf("'%s': expected a serial plan of a small table, got %v", sql, names)
+		}
+		if out := sortedTupleStrings(runParserTestQuery(t, c, bp, sql)); !slices.Equal(out, expected) || len(out) == 0 {
+			t.Errorf("'%s': expected %v, got %v", sql, expected, out)
+		}
+	}
+}
+
+func TestParallelQueryAnalyze(t *testing.T) {
+	c, bp, _ := makeParallelTestCatalog(t)
+	_, plan, err := Parse(c, "select name, count(*) from big where age < 10 group by name")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	analyzed, err := ExplainAnalyze(context.Background(), plan, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if analyzed.Stats.Rows != 10 {
+		t.Errorf("expected 10 groups, got %d", analyzed.Stats.Rows)
+	}
+	//the rows scanned by the workers add up to those of the table
+	scanned := 0
+	var visit func(d *PlanDescription)
+	visit = func(d *PlanDescription) {
+		if d.Name == "Partition Scan" && d.Actual != nil {
+			scanned += d.Actual.Rows
+		}
+		for _, child := range d.Children {
+			visit(child)
+		}
+	}
+	visit(DescribePlan(c, analyzed))
+	if scanned != 3000 {
+		t.Errorf("expected the partition scans to read 3000 rows, got %d", scanned)
+	}
+}
+
+func TestParallelInsertSelect(t *testing.T) {
+	c, bp, _ := makeParallelTestCatalog(t)
+	_, plan, err := Parse(c, "insert into t select name, age from big where age = 0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if names := planOperatorNames(c, plan); slices.Contains(names, "Gather") {
+		t.Errorf("expected the input of an insert to be scanned serially, got %v", names)
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	iter, err := plan.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); err != nil || tup.Fields[0].(IntField).Value != 30 {
+		t.Errorf("expected 30 tuples to be inserted, got %v (%v)", tup, err)
+	}
+	bp.CommitTransaction(tid)
+	if tups := runParserTestQuery(t, c, bp, "select count(*) from t where age = 0"); tups[0].Fields[0].(IntField).Value != 30 {
+		t.Errorf("expected 30 tuples of age 0, got %v", tups[0])
+	}
+}
+
+func TestGatherCancel(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+
+	parts := make([]Operator, 4)
+	for i := range parts {
+		parts[i] = partitionPlan(hf, i, len(parts))
+	}
+	g, err := NewGather(parts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	g.bufferSize = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	iter, err := g.Iterator(ctx, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup, err := iter(); tup == nil || err != nil {
+		t.Fatalf("expected a tuple, got %v, %v", tup, err)
+	}
+	//the workers, blocked on the full channel, are stopped by the cancel, so
+	//the iterator fails after at most a few more tuples
+	cancel()
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expected canceled gather to fail with %v, got %v", context.Canceled, err)
+			}
+			break
+		}
+		if tup == nil {
+			t.Fatalf("expected the canceled gather to fail")
+		}
+		cnt++
+	}
+	if cnt >= 2999 {
+		t.Errorf("expected the cancel to stop the workers before they were done")
+	}
+}
+
+// An operator that reads all of the tuples of its child, slowly, and outputs
+// none of them, like a very selective filter
+type slowFilter struct {
+	child Operator
+}
+
+func (f *slowFilter) Descriptor() *TupleDesc {
+	return f.child.Descriptor()
+}
+
+func (f *slowFilter) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := f.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for {
+			t, err := iter()
+			if err != nil || t == nil {
+				return nil, err
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}, nil
+}
+
+// A gather that fails, or is canceled, returns once its workers have exited,
+// so that aborting the transaction releases all of its locks for good
+func TestGatherReleasesLocks(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	//workers that are still scanning their partitions when the gather fails
+	parts := make([]Operator, 4)
+	for i := range parts {
+		parts[i] = &slowFilter{partitionPlan(hf, i, len(parts))}
+	}
+	failing := append([]Operator{}, parts...)
+	failing[2] = &failingOp{partitionPlan(hf, 2, len(parts)), 0}
+
+	for _, test := range []struct {
+		children []Operator
+		timeout  time.Duration
+	}{
+		{failing, time.Hour},
+		{parts, 10 * time.Millisecond},
+	} {
+		g, err := NewGather(test.children)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tid := NewTID()
+		bp.BeginTransaction(tid)
+		ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+		iter, err := g.Iterator(ctx, tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup, err := iter(); tup != nil || err == nil {
+			t.Fatalf("expected the gather to fail, got %v, %v", tup, err)
+		}
+		bp.AbortTransaction(tid)
+		//give any worker that was still running a chance to lock a page
+		time.Sleep(50 * time.Millisecond)
+		bp.mutex.Lock()
+		locks := len(bp.Locks[tid])
+		bp.mutex.Unlock()
+		if locks != 0 {
+			t.Errorf("expected the aborted transaction to hold no locks, found %d", locks)
+		}
+		cancel()
+	}
+}
+
+// sleepingOp sleeps, regardless of the context, before producing no tuples,
+// and counts the iterators that have returned
+type sleepingOp struct {
+	child  Operator
+	exited *atomic.Int32
+}
+
+func (s *sleepingOp) Descriptor() *TupleDesc {
+	return s.child.Descriptor()
+}
+
+func (s *sleepingOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	return func() (*Tuple, error) {
+		time.Sleep(50 * time.Millisecond)
+		s.exited.Add(1)
+		return nil, nil
+	}, nil
+}
+
+// A query that is abandoned once its deadline passes, without its gather
+// returning an error, can wait for the workers of the gather to exit before
+// its transaction is aborted
+func TestGatherDeadline(t *testing.T) {
+	_, bp, hf := makeParallelTestCatalog(t)
+	var exited atomic.Int32
+	parts := make([]Operator, 4)
+	for i := range parts {
+		parts[i] = &slowFilter{partitionPlan(hf, i, len(parts))}
+	}
+	parts[0] = &sleepingOp{parts[0], &exited}
+	g, err := NewGather(parts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ctx, wait := WithWorkerGroup(ctx)
+	if _, err := g.Iterator(ctx, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	<-ctx.Done()
+	wait()
+	if exited.Load() != 1 {
+		t.Fatalf("expected the workers to have exited")
+	}
+	bp.AbortTransaction(tid)
+	bp.mutex.Lock()
+	locks := len(bp.Locks[tid])
+	bp.mutex.Unlock()
+	if locks != 0 {
+		t.Fatalf("expected the aborted transaction to hold no locks, found %d", locks)
+	}
+
+	//another transaction can write the pages the workers were reading
+	tid2 := NewTID()
+	bp.BeginTransaction(tid2)
+	defer bp.CommitTransaction(tid2)
+	grabLock(t, bp, tid2, hf, 0, WritePerm, true)
+}
@@ -2,18 +2,36 @@ package godb
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
-	"unsafe"
 
 	"github.com/xwb1989/sqlparser"
 )
 
+// A predicate comparing two arbitrary expressions over (at most) one table,
+// e.g., t.price > t.cost * 2 or 25 < t.age, or, if subquery is non-nil, a
+// predicate on the result of a subquery (in which case left is the outer
+// expression of an IN or scalar comparison)
 type LogicalFilterNode struct {
-	fieldExpr LogicalSelectNode
-	constExpr LogicalSelectNode
-	predOp    BoolOp
+	left, right LogicalSelectNode
+	predOp      BoolOp
+	subquery    *LogicalSubqueryNode
+}
+
+// A subquery in the where clause, e.g., EXISTS (SELECT ...).  If semiJoin is
+// set, the subquery has been decorrelated: its output columns line up with
+// outerKeys, and an outer tuple passes if its outerKeys match some output
+// tuple.  Otherwise it is evaluated once per outer tuple, after binding params
+// (its references to the outer query) from that tuple.
+type LogicalSubqueryNode struct {
+	kind      SubqueryType
+	negated   bool
+	plan      *LogicalPlan
+	semiJoin  bool
+	outerKeys []*LogicalSelectNode
+	params    []*LogicalSelectNode
 }
 
 type LogicalJoinNode struct {
@@ -29,6 +47,12 @@ const (
 	ExprFunc  SelectExprType = iota
 	ExprStar  SelectExprType = iota
 	ExprAggr  SelectExprType = iota
+	// a reference from a correlated subquery to a field of the outer query
+	ExprCorrelated SelectExprType = iota
+	// a window function, e.g., rank() over (order by age)
+	ExprWindow SelectExprType = iota
+	// a placeholder of a prepared statement, e.g., $1, numbered by value
+	ExprParam SelectExprType = iota
 )
 
 type LogicalSelectNode struct {
@@ -40,6 +64,9 @@ type LogicalSelectNode struct {
 	value       string
 	args        []*LogicalSelectNode //for functions other than aggregates
 	cachedField *FieldType
+	param       *CorrelatedExpr    //bound when planning a correlated subquery
+	window      *LogicalWindowNode //for window functions
+	distinct    bool               //for aggregates over distinct values, e.g., count(distinct age)
 }
 
 func NewFieldSelectNode(table string, field string, alias string) LogicalSelectNode {
@@ -57,6 +84,13 @@ func NewConstSelectNode(value string, alias string) LogicalSelectNode {
 	lsn.alias = alias
 	return lsn
 }
+func NewParamSelectNode(number string, alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprParam
+	lsn.value = number
+	lsn.alias = alias
+	return lsn
+}
 func NewStarSelectNode(table string) LogicalSelectNode {
 	lsn := LogicalSelectNode{}
 	lsn.exprType = ExprStar
@@ -83,6 +117,42 @@ func NewFuncSelectNode(op string, args []*LogicalSelectNode, alias string) Logic
 	return lsn
 }
 
+func NewWindowSelectNode(op string, args []*LogicalSelectNode, window *LogicalWindowNode, alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprWindow
+	lsn.funcOp = &op
+	lsn.alias = alias
+	lsn.args = args
+	lsn.window = window
+	return lsn
+}
+
+// The window of a window function, OVER (PARTITION BY ... ORDER BY ... frame)
+type LogicalWindowNode struct {
+	partitionBy []*LogicalSelectNode
+	orderBy     []*OrderByNode
+	frame       WindowFrame
+}
+
+// Return true if the two windows have the same partition by and order by,
+// so that functions over them can be computed by the same window operator.
+func (w *LogicalWindowNode) samePartitioning(other *LogicalWindowNode) bool {
+	if len(w.partitionBy) != len(other.partitionBy) || len(w.orderBy) != len(other.orderBy) {
+		return false
+	}
+	for i := range w.partitionBy {
+		if !w.partitionBy[i].equivalent(other.partitionBy[i]) {
+			return false
+		}
+	}
+	for i := range w.orderBy {
+		if w.orderBy[i].ascending != other.orderBy[i].ascending || !w.orderBy[i].expr.equivalent(other.orderBy[i].expr) {
+			return false
+		}
+	}
+	return true
+}
+
 func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, error) {
 	if table == "" && subqueries != nil {
 		for _, q := range subqueries {
@@ -117,24 +187,34 @@ func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqu
 // if catalog is non null, will try to resolve table name from catalog
 // otherwise, will not
 func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, string, error) {
-	if lsn.exprType == ExprConst {
+	if lsn.exprType == ExprConst || lsn.exprType == ExprCorrelated || lsn.exprType == ExprParam {
 		return "", "", nil
 	}
+	if lsn.exprType == ExprWindow {
+		//window functions are computed over the output of the tables, so
+		//don't belong to any of them
+		field := *lsn.funcOp
+		if lsn.alias != "" {
+			field = lsn.alias
+		}
+		return "", field, nil
+	}
 	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr {
 		tabName := ""
 		fieldName := ""
+		//the expression belongs to the table of its first field, and all of
+		//its fields must be of that table
 		for _, subLsn := range lsn.args {
 			newTabName, newFieldName, err := subLsn.getTableField(c, subqueries, ts)
 			if err != nil {
 				return "", "", err
 			}
-			if tabName == "" && (newTabName != "" || newFieldName != "") {
-				tabName = newTabName
-				fieldName = newFieldName
-				break
-			} else if fieldName == "" && tabName == "" {
+			if fieldName == "" {
 				fieldName = newFieldName
-			} else if newTabName != "" {
+			}
+			if tabName == "" {
+				tabName = newTabName
+			} else if newTabName != "" && newTabName != tabName {
 				return "", "", GoDBError{AmbiguousNameError, fmt.Sprintf("multiple possible table names for field %s in select expression", fieldName)}
 			}
 		}
@@ -156,10 +236,27 @@ func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPla
 	return tabName, field, nil
 }
 
+// figure out which table & field a filter applies to.  Either side of the
+// predicate may reference the table (e.g., 25 < t.age); if neither does, the
+// predicate only compares constants and the returned table and field are empty
+func (f *LogicalFilterNode) getTableField(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, string, error) {
+	for _, side := range []*LogicalSelectNode{&f.left, &f.right} {
+		tabName, fieldName, err := side.getTableField(c, subqueries, ts)
+		if err != nil {
+			return "", "", err
+		}
+		if tabName != "" || fieldName != "" {
+			return tabName, fieldName, nil
+		}
+	}
+	return "", "", nil
+}
+
 type LogicalTableNode struct {
 	tableName string
 	alias     string
 	file      *DBFile
+	columns   []string //the columns the query uses, or nil for all of them
 }
 
 type GroupBy struct {
@@ -176,16 +273,60 @@ type LogicalPlan struct {
 	joins         []*LogicalJoinNode
 	selects       []*LogicalSelectNode
 	aggs          []*LogicalSelectNode
+	windows       []*LogicalSelectNode
 	tables        []*LogicalTableNode
 	subqueries    []*LogicalPlan
 	groupByFields []*GroupBy
+	having        []*LogicalFilterNode
 	orderByFields []*OrderByNode
 	limit         *LogicalSelectNode
+	offset        *LogicalSelectNode
 	distinct      bool
 	alias         string
+	setOp         *LogicalSetOpNode
+	recursive     *LogicalRecursiveNode
+	workTable     *LogicalRecursiveNode
+}
+
+// A set operation (UNION, INTERSECT or EXCEPT) combining the results of two
+// plans.  A plan with a set operation has no tables, filters or select list of
+// its own, just (optionally) an order by and limit applied to the combined
+// result.
+type LogicalSetOpNode struct {
+	op          SetOpType
+	all         bool
+	left, right *LogicalPlan
+}
+
+// A recursive common table expression, anchor UNION [ALL] recursive.  A plan
+// is either the recursive CTE itself (with recursive set) or, inside the
+// recursive term, a reference to the tuples produced by the previous iteration
+// (with workTable set).
+type LogicalRecursiveNode struct {
+	anchor, recursive *LogicalPlan
+	all               bool
+
+	// the work table of the physical plan being built for this node
+	work *WorkTable
 }
 
 func (p *LogicalPlan) getSubplanFields(c *Catalog) []*FieldType {
+	var inner *LogicalPlan
+	switch {
+	case p.setOp != nil:
+		inner = p.setOp.left
+	case p.recursive != nil:
+		inner = p.recursive.anchor
+	case p.workTable != nil:
+		inner = p.workTable.anchor
+	}
+	if inner != nil {
+		nodes := inner.getSubplanFields(c)
+		for _, n := range nodes {
+			n.TableQualifier = p.alias
+		}
+		return nodes
+	}
 	var nodes []*FieldType
 	for _, s := range p.selects {
 		_, field, _ := s.getTableField(c, p.subqueries, p.tables)
@@ -198,13 +339,49 @@ func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, e
 	switch expr := expr.(type) {
 	case *sqlparser.AndExpr:
 		//print("got and")
-		filterListLeft, joinListLeft, _ := parseWhere(c, subqueries, ts, expr.Left)
-		filterListRight, joinListRight, _ := parseWhere(c, subqueries, ts, expr.Right)
+		filterListLeft, joinListLeft, err := parseWhere(c, subqueries, ts, expr.Left)
+		if err != nil {
+			return nil, nil, err
+		}
+		filterListRight, joinListRight, err := parseWhere(c, subqueries, ts, expr.Right)
+		if err != nil {
+			return nil, nil, err
+		}
 		filterExprs := append(filterListLeft, filterListRight...)
 		joinExprs := append(joinListLeft, joinListRight...)
 		return filterExprs, joinExprs, nil
+	case *sqlparser.ExistsExpr:
+		filter, err := parseWhereSubquery(c, subqueries, ts, expr.Subquery.Select, ExistsSubquery, false, nil, OpEq)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*LogicalFilterNode{filter}, nil, nil
+	case *sqlparser.NotExpr:
+		exists, ok := expr.Expr.(*sqlparser.ExistsExpr)
+		if !ok {
+			return nil, nil, GoDBError{ParseError, "not is only supported before exists in where expressions"}
+		}
+		filter, err := parseWhereSubquery(c, subqueries, ts, exists.Subquery.Select, ExistsSubquery, true, nil, OpEq)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*LogicalFilterNode{filter}, nil, nil
 	case *sqlparser.ComparisonExpr:
-		op := BoolOpMap[expr.Operator]
+		if sq, ok := expr.Right.(*sqlparser.Subquery); ok {
+			return parseComparisonSubquery(c, subqueries, ts, expr.Operator, expr.Left, sq)
+		}
+		if sq, ok := expr.Left.(*sqlparser.Subquery); ok {
+			//put the subquery on the right hand side
+			flipped, ok := flippedOpStr[expr.Operator]
+			if !ok {
+				return nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s with subquery", expr.Operator)}
+			}
+			return parseComparisonSubquery(c, subqueries, ts, flipped, expr.Right, sq)
+		}
+		op, ok := BoolOpMap[expr.Operator]
+		if !ok {
+			return nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s in where expression", expr.Operator)}
+		}
 		//print(op)
 		//print("got compare")
 
@@ -235,7 +412,7 @@ func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, e
 			lj[0] = &join
 			return nil, lj, nil
 		} else {
-			filter := LogicalFilterNode{*left, *right, op}
+			filter := LogicalFilterNode{*left, *right, op, nil}
 			lf := make([]*LogicalFilterNode, 1)
 			lf[0] = &filter
 			return lf, nil, nil
@@ -245,6 +422,241 @@ func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, e
 	}
 }
 
+// the operator to use if the operands of a comparison are swapped, e.g.,
+// (select ...) < x becomes x > (select ...)
+var flippedOpStr = map[string]string{
+	">":  "<",
+	"<":  ">",
+	">=": "<=",
+	"<=": ">=",
+	"=":  "=",
+	"<>": "<>",
+	"!=": "!=",
+}
+
+func parseComparisonSubquery(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, opStr string, outer sqlparser.Expr, sq *sqlparser.Subquery) ([]*LogicalFilterNode, []*LogicalJoinNode, error) {
+	outerExpr, err := parseExpr(c, outer, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	var filter *LogicalFilterNode
+	switch opStr {
+	case sqlparser.InStr, sqlparser.NotInStr:
+		filter, err = parseWhereSubquery(c, subqueries, ts, sq.Select, InSubquery, opStr == sqlparser.NotInStr, outerExpr, OpEq)
+	default:
+		op, ok := BoolOpMap[opStr]
+		if !ok || op == OpLike {
+			return nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s with subquery", opStr)}
+		}
+		filter, err = parseWhereSubquery(c, subqueries, ts, sq.Select, ScalarSubquery, false, outerExpr, op)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return []*LogicalFilterNode{filter}, nil, nil
+}
+
+// The tables visible to a subquery in a where clause: its own, which take
+// precedence, and those of the enclosing query, which it may reference
+type subqueryScope struct {
+	c               *Catalog
+	inner           *LogicalPlan
+	outerSubqueries []*LogicalPlan
+	outerTables     []*LogicalTableNode
+}
+
+func scopeHasTable(table string, subqueries []*LogicalPlan, ts []*LogicalTableNode) bool {
+	for _, t := range ts {
+		if t.tableName == table || t.alias == table {
+			return true
+		}
+	}
+	for _, q := range subqueries {
+		if q.alias == table {
+			return true
+		}
+	}
+	return false
+}
+
+// Return true if the field expression refers to a table of the enclosing query
+// rather than one of the subquery's own tables
+func (sc *subqueryScope) isOuterRef(lsn *LogicalSelectNode) bool {
+	if lsn.table != "" {
+		return !scopeHasTable(lsn.table, sc.inner.subqueries, sc.inner.tables) && scopeHasTable(lsn.table, sc.outerSubqueries, sc.outerTables)
+	}
+	innerTab, err := checkNameInTablesOrSubqueries("", lsn.field, sc.c, sc.inner.subqueries, sc.inner.tables)
+	if err != nil || innerTab != "" {
+		return false
+	}
+	outerTab, err := checkNameInTablesOrSubqueries("", lsn.field, sc.c, sc.outerSubqueries, sc.outerTables)
+	return err == nil && outerTab != ""
+}
+
+// Return the field references in the expression
+func fieldRefs(lsn *LogicalSelectNode) []*LogicalSelectNode {
+	if lsn.exprType == ExprField {
+		return []*LogicalSelectNode{lsn}
+	}
+	var refs []*LogicalSelectNode
+	for _, arg := range lsn.args {
+		refs = append(refs, fieldRefs(arg)...)
+	}
+	return refs
+}
+
+// Return whether the expression references the subquery's own tables and
+// whether it references the outer query's tables
+func (sc *subqueryScope) classify(lsn *LogicalSelectNode) (bool, bool) {
+	hasInner, hasOuter := false, false
+	for _, ref := range fieldRefs(lsn) {
+		if sc.isOuterRef(ref) {
+			hasOuter = true
+		} else {
+			hasInner = true
+		}
+	}
+	return hasInner, hasOuter
+}
+
+func splitConjuncts(expr sqlparser.Expr) []sqlparser.Expr {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		return append(splitConjuncts(expr.Left), splitConjuncts(expr.Right)...)
+	case *sqlparser.ParenExpr:
+		return splitConjuncts(expr.Expr)
+	}
+	return []sqlparser.Expr{expr}
+}
+
+// Parse a subquery appearing in the where clause of a query over the tables ts
+// and subqueries.  Predicates in the subquery's where clause that reference
+// the outer query are correlation predicates.  If they are all equalities
+// between an inner and an outer expression (and the subquery doesn't
+// aggregate), the subquery is decorrelated into a semi-join on them; otherwise
+// it falls back to nested evaluation with the outer references as parameters.
+func parseWhereSubquery(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, stmt sqlparser.SelectStatement, kind SubqueryType, negated bool, outerExpr *LogicalSelectNode, op BoolOp) (*LogicalFilterNode, error) {
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, GoDBError{ParseError, "only simple select statements are supported in where clause subqueries"}
+	}
+	withoutWhere := *sel
+	withoutWhere.Where = nil
+	plan, err := parseStatement(c, &withoutWhere)
+	if err != nil {
+		return nil, err
+	}
+	if kind != ExistsSubquery && (len(plan.selects) != 1 || plan.selects[0].exprType == ExprStar) {
+		return nil, GoDBError{ParseError, "subquery must return exactly one column"}
+	}
+	sc := &subqueryScope{c, plan, subqueries, ts}
+
+	var correlated []*LogicalFilterNode
+	if sel.Where != nil {
+		for _, conj := range splitConjuncts(sel.Where.Expr) {
+			cmp, ok := conj.(*sqlparser.ComparisonExpr)
+			if ok {
+				_, leftSq := cmp.Left.(*sqlparser.Subquery)
+				_, rightSq := cmp.Right.(*sqlparser.Subquery)
+				op, isOp := BoolOpMap[cmp.Operator]
+				if isOp && !leftSq && !rightSq {
+					left, err := parseExpr(c, cmp.Left, "")
+					if err != nil {
+						return nil, err
+					}
+					right, err := parseExpr(c, cmp.Right, "")
+					if err != nil {
+						return nil, err
+					}
+					_, lOuter := sc.classify(left)
+					_, rOuter := sc.classify(right)
+					if lOuter || rOuter {
+						correlated = append(correlated, &LogicalFilterNode{*left, *right, op, nil})
+						continue
+					}
+				}
+			}
+			filters, joins, err := parseWhere(c, plan.subqueries, plan.tables, conj)
+			if err != nil {
+				return nil, err
+			}
+			plan.filters = append(plan.filters, filters...)
+			plan.joins = append(plan.joins, joins...)
+		}
+	}
+
+	sq := &LogicalSubqueryNode{kind: kind, negated: negated, plan: plan}
+	if kind != ScalarSubquery && canDecorrelate(sc, kind, correlated) {
+		var selects []*LogicalSelectNode
+		if kind == InSubquery {
+			selects = append(selects, plan.selects[0])
+			sq.outerKeys = append(sq.outerKeys, outerExpr)
+		}
+		for _, f := range correlated {
+			inner, outer := f.left, f.right
+			if lInner, _ := sc.classify(&f.left); !lInner {
+				inner, outer = f.right, f.left
+			}
+			selects = append(selects, &inner)
+			sq.outerKeys = append(sq.outerKeys, &outer)
+		}
+		//give every output column a distinct name, so they can be
+		//referenced unambiguously by the semi-join
+		for i, s := range selects {
+			s.alias = fmt.Sprintf("subquery_key%d", i)
+		}
+		plan.selects = selects
+		plan.orderByFields = nil
+		plan.distinct = false
+		sq.semiJoin = true
+	} else {
+		for _, f := range correlated {
+			for _, side := range []*LogicalSelectNode{&f.left, &f.right} {
+				for _, ref := range fieldRefs(side) {
+					if sc.isOuterRef(ref) {
+						ref.exprType = ExprCorrelated
+						sq.params = append(sq.params, ref)
+					}
+				}
+			}
+			plan.filters = append(plan.filters, f)
+		}
+	}
+
+	filter := &LogicalFilterNode{predOp: op, subquery: sq}
+	if outerExpr != nil {
+		filter.left = *outerExpr
+	}
+	return filter, nil
+}
+
+// A subquery can be evaluated as a semi-join if every correlation predicate is
+// an equality between an expression over the subquery's tables and one over
+// the outer query's, and the subquery doesn't aggregate or limit its output
+// (which would need to happen separately for each outer tuple).  Uncorrelated
+// IN subqueries can always be; uncorrelated EXISTS subqueries are cheaper to
+// evaluate just once.
+func canDecorrelate(sc *subqueryScope, kind SubqueryType, correlated []*LogicalFilterNode) bool {
+	if len(correlated) == 0 {
+		return kind == InSubquery
+	}
+	p := sc.inner
+	if len(p.aggs) > 0 || len(p.groupByFields) > 0 || len(p.having) > 0 || p.limit != nil {
+		return false
+	}
+	for _, f := range correlated {
+		if f.predOp != OpEq {
+			return false
+		}
+		lInner, lOuter := sc.classify(&f.left)
+		rInner, rOuter := sc.classify(&f.right)
+		if !((lInner && !lOuter && rOuter && !rInner) || (rInner && !rOuter && lOuter && !lInner)) {
+			return false
+		}
+	}
+	return true
+}
+
 func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*LogicalPlan, []*LogicalJoinNode, error) {
 	switch tableEx := t.(type) {
 	case *sqlparser.AliasedTableExpr:
@@ -252,27 +664,44 @@ func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*Logic
 		case *sqlparser.Subquery:
 			sq := (tableEx.Expr).(*sqlparser.Subquery)
 			//print("got subquery")
+			var subplan *LogicalPlan
+			var err error
 			switch stmt := sq.Select.(type) {
 			case *sqlparser.Select:
-				subplan, err := parseStatement(c, stmt)
+				subplan, err = parseStatement(c, stmt)
+			case *sqlparser.Union:
+				subplan, err = parseSetOpStatement(c, stmt, nil)
+			default:
+				return nil, nil, nil, GoDBError{ParseError, "unsupported subquery type in from clause"}
+			}
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			subplan.alias = strings.ToLower(sqlparser.String(tableEx.As))
+			subplans := make([]*LogicalPlan, 1)
+			subplans[0] = subplan
+			return nil, subplans, nil, nil
+		case sqlparser.SimpleTableExpr:
+			tableName := strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())
+			//fmt.Printf("got simple table, name %s\n", tableName)
+			if def := c.ctes[tableName]; def != nil {
+				subplan, err := def.plan()
 				if err != nil {
 					return nil, nil, nil, err
 				}
 				subplan.alias = strings.ToLower(sqlparser.String(tableEx.As))
-				subplans := make([]*LogicalPlan, 1)
-				subplans[0] = subplan
-				return nil, subplans, nil, nil
+				if subplan.alias == "" {
+					subplan.alias = tableName
+				}
+				return nil, []*LogicalPlan{subplan}, nil, nil
 			}
-		case sqlparser.SimpleTableExpr:
-			tableName := strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())
-			//fmt.Printf("got simple table, name %s\n", tableName)
 			dbFile, err := c.GetTable(tableName)
 			if err != nil {
 				return nil, nil, nil, err
 			}
 			table := LogicalTableNode{tableName,
 				strings.ToLower(sqlparser.String(tableEx.As)),
-				&dbFile}
+				&dbFile, nil}
 			table.alias = strings.ToLower(sqlparser.String(tableEx.As))
 			tables := make([]*LogicalTableNode, 1)
 			tables[0] = &table
@@ -320,7 +749,7 @@ func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*Logic
 }
 
 func isAgg(funcName string) bool {
-	aggs := []string{"count", "sum", "avg", "min", "max"}
+	aggs := []string{"count", "sum", "avg", "min", "max", "stddev", "variance", "median", "percentile_cont", "string_agg", "bool_and", "bool_or"}
 	for _, s := range aggs {
 		if s == funcName {
 			return true
@@ -333,14 +762,23 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 	//fmt.Println("parse expr")
 	switch expr := expr.(type) {
 	case *sqlparser.FuncExpr:
+		if spec, ok := windowSpec(expr); ok {
+			return parseWindowFunc(c, expr, spec, alias)
+		}
 		funName := strings.ToLower(sqlparser.String(expr.Name))
 		if isAgg(funName) {
-			if len(expr.Exprs) != 1 {
+			//percentile_cont and string_agg take a constant second argument,
+			//the percentile and the separator
+			if funName == "percentile_cont" || funName == "string_agg" {
+				if len(expr.Exprs) != 2 {
+					return nil, GoDBError{ParseError, fmt.Sprintf("expected two arguments to aggregate %s in select list", sqlparser.String(expr.Name))}
+				}
+			} else if len(expr.Exprs) != 1 {
 				return nil, GoDBError{ParseError, fmt.Sprintf("expected one argument to aggregate %s in select list", sqlparser.String(expr.Name))}
 			}
 			star, ok := expr.Exprs[0].(*sqlparser.StarExpr)
 			if ok {
-				if funName != "count" {
+				if funName != "count" || expr.Distinct {
 					return nil, GoDBError{ParseError, "got * in non-count aggregate"}
 				}
 				subField := NewFieldSelectNode(strings.ToLower(sqlparser.String(star.TableName)), "*", "")
@@ -352,6 +790,20 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 				return nil, err
 			}
 			outer := NewAggrSelectNode(funName, field, alias)
+			outer.distinct = expr.Distinct
+			if len(expr.Exprs) == 2 {
+				param, err := parseSelect(c, expr.Exprs[1])
+				if err != nil {
+					return nil, err
+				}
+				if param.exprType != ExprConst {
+					return nil, GoDBError{ParseError, fmt.Sprintf("second argument to aggregate %s must be a constant", funName)}
+				}
+				if f, err := strconv.ParseFloat(param.value, 64); funName == "percentile_cont" && (err != nil || f < 0 || f > 1) {
+					return nil, GoDBError{ParseError, fmt.Sprintf("percentile %s is not a number between 0 and 1", param.value)}
+				}
+				outer.args = append(outer.args, param)
+			}
 			return &outer, nil
 		} else {
 			funName := strings.ToLower(sqlparser.String(expr.Name))
@@ -369,6 +821,27 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 			outer := NewFuncSelectNode(funName, exprList, alias)
 			return &outer, nil
 		}
+	case *sqlparser.GroupConcatExpr:
+		//group_concat(expr [separator 'sep']) is string_agg(expr, 'sep')
+		if len(expr.Exprs) != 1 {
+			return nil, GoDBError{ParseError, "expected one argument to aggregate group_concat in select list"}
+		}
+		if len(expr.OrderBy) > 0 {
+			return nil, GoDBError{ParseError, "order by in group_concat is not supported"}
+		}
+		field, err := parseSelect(c, expr.Exprs[0])
+		if err != nil {
+			return nil, err
+		}
+		sep := ","
+		if expr.Separator != "" {
+			sep = strings.TrimSuffix(strings.TrimPrefix(expr.Separator, " separator '"), "'")
+		}
+		outer := NewAggrSelectNode("group_concat", field, alias)
+		outer.distinct = expr.Distinct != ""
+		sepNode := NewConstSelectNode(sep, "")
+		outer.args = append(outer.args, &sepNode)
+		return &outer, nil
 	case *sqlparser.BinaryExpr:
 		opname := expr.Operator
 		left, err := parseExpr(c, expr.Left, "")
@@ -397,6 +870,15 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 
 		return &field, nil
 	case *sqlparser.SQLVal:
+		if expr.Type == sqlparser.ValArg {
+			//placeholders are rewritten to :v1, :v2, ... by Prepare
+			number := strings.TrimPrefix(string(expr.Val), ":v")
+			if _, err := strconv.Atoi(number); err != nil {
+				return nil, GoDBError{ParseError, fmt.Sprintf("unsupported placeholder %s", expr.Val)}
+			}
+			field := NewParamSelectNode(number, alias)
+			return &field, nil
+		}
 		str := sqlparser.String(expr)
 		if str[0] == '\'' {
 			str = str[1 : len(str)-1]
@@ -438,10 +920,106 @@ func extractAggs(s *LogicalSelectNode) []*LogicalSelectNode {
 			aggs = append(aggs, extractAggs(subs)...)
 		}
 		return aggs
+	case ExprWindow:
+		//window functions are computed after grouping, so may be computed
+		//over aggregates, e.g., rank() over (order by count(*))
+		var aggs []*LogicalSelectNode
+		for _, subs := range s.args {
+			aggs = append(aggs, extractAggs(subs)...)
+		}
+		for _, subs := range s.window.partitionBy {
+			aggs = append(aggs, extractAggs(subs)...)
+		}
+		for _, oby := range s.window.orderBy {
+			aggs = append(aggs, extractAggs(oby.expr)...)
+		}
+		return aggs
+	}
+	return nil
+}
+
+func extractWindows(s *LogicalSelectNode) []*LogicalSelectNode {
+	switch s.exprType {
+	case ExprWindow:
+		return []*LogicalSelectNode{s}
+	case ExprFunc:
+		var windows []*LogicalSelectNode
+		for _, subs := range s.args {
+			windows = append(windows, extractWindows(subs)...)
+		}
+		return windows
+	}
+	return nil
+}
+
+// Return true if the two expressions compute the same value, ignoring their
+// aliases, e.g., count(*) in a select list and in a having clause
+func (lsn *LogicalSelectNode) equivalent(other *LogicalSelectNode) bool {
+	if lsn.exprType != other.exprType || lsn.table != other.table || lsn.field != other.field || lsn.value != other.value || lsn.distinct != other.distinct {
+		return false
+	}
+	if (lsn.funcOp == nil) != (other.funcOp == nil) || (lsn.funcOp != nil && *lsn.funcOp != *other.funcOp) {
+		return false
+	}
+	if len(lsn.args) != len(other.args) {
+		return false
+	}
+	if (lsn.window == nil) != (other.window == nil) || (lsn.window != nil && (!lsn.window.samePartitioning(other.window) || lsn.window.frame != other.window.frame)) {
+		return false
+	}
+	for i := range lsn.args {
+		if !lsn.args[i].equivalent(other.args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func findEquivalentAgg(aggs []*LogicalSelectNode, agg *LogicalSelectNode) *LogicalSelectNode {
+	for _, a := range aggs {
+		if a.equivalent(agg) {
+			return a
+		}
 	}
 	return nil
 }
 
+// Parse a having clause into a list of conjunctive predicates.  Unlike the
+// where clause, predicates may reference aggregates and are never joins; they
+// are applied to the output of the aggregator.
+func parseHaving(c *Catalog, expr sqlparser.Expr) ([]*LogicalFilterNode, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		left, err := parseHaving(c, expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseHaving(c, expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	case *sqlparser.ComparisonExpr:
+		op, ok := BoolOpMap[expr.Operator]
+		if !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s in having clause", expr.Operator)}
+		}
+		left, err := parseExpr(c, expr.Left, "")
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseExpr(c, expr.Right, "")
+		if err != nil {
+			return nil, err
+		}
+		return []*LogicalFilterNode{{*left, *right, op, nil}}, nil
+	case *sqlparser.ParenExpr:
+		return parseHaving(c, expr.Expr)
+	default:
+		return nil, GoDBError{ParseError, "having expression must be a conjunction of comparisons"}
+	}
+}
+
 func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 	from := s.From
 	var (
@@ -450,8 +1028,10 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		joins    []*LogicalJoinNode
 		filters  []*LogicalFilterNode
 		aggs     []*LogicalSelectNode
+		windows  []*LogicalSelectNode
 		selects  []*LogicalSelectNode
 		groupBys []*GroupBy
+		having   []*LogicalFilterNode
 		orderBys []*OrderByNode
 	)
 
@@ -490,6 +1070,7 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		}
 		selects = append(selects, sel)
 		aggs = append(aggs, extractAggs(sel)...)
+		windows = append(windows, extractWindows(sel)...)
 	}
 
 	for _, gby := range s.GroupBy {
@@ -500,31 +1081,730 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		groupBys = append(groupBys, &GroupBy{expr})
 	}
 
-	for _, oby := range s.OrderBy {
-		expr, err := parseExpr(c, oby.Expr, "")
+	if s.Having != nil {
+		var err error
+		having, err = parseHaving(c, s.Having.Expr)
 		if err != nil {
 			return nil, err
 		}
+		//aggregates that only appear in the having clause still need to be
+		//computed by the aggregator, even though they aren't output
+		for _, f := range having {
+			for _, side := range []*LogicalSelectNode{&f.left, &f.right} {
+				for _, agg := range extractAggs(side) {
+					if findEquivalentAgg(aggs, agg) == nil {
+						aggs = append(aggs, agg)
+					}
+				}
+			}
+		}
+		if len(aggs) == 0 && len(groupBys) == 0 {
+			return nil, GoDBError{ParseError, "having clause requires a group by or an aggregate"}
+		}
+	}
+
+	//window functions are computed after the where, group by and having
+	//clauses, so they may only appear in the select list
+	var clauses []*LogicalSelectNode
+	for _, f := range append(filters, having...) {
+		clauses = append(clauses, &f.left, &f.right)
+	}
+	for _, j := range joins {
+		clauses = append(clauses, j.left, j.right)
+	}
+	for _, gby := range groupBys {
+		clauses = append(clauses, gby.expr)
+	}
+	for _, clause := range clauses {
+		if len(extractWindows(clause)) > 0 {
+			return nil, GoDBError{ParseError, "window functions are only allowed in the select list"}
+		}
+	}
+
+	orderBys, limExpr, offsetExpr, err := parseOrderByLimit(c, s.OrderBy, s.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	p := LogicalPlan{filters, joins, selects, aggs, windows, tables, subplans, groupBys, having, orderBys, limExpr, offsetExpr, s.Distinct != "", "", nil, nil, nil}
+
+	return &p, nil
+}
+
+// Parse an order by and limit, returning the order by expressions, the limit
+// and the offset (nil if there is none)
+func parseOrderByLimit(c *Catalog, orderBy sqlparser.OrderBy, lim *sqlparser.Limit) ([]*OrderByNode, *LogicalSelectNode, *LogicalSelectNode, error) {
+	var orderBys []*OrderByNode
+	for _, oby := range orderBy {
+		expr, err := parseExpr(c, oby.Expr, "")
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		orderBys = append(orderBys, &OrderByNode{expr, oby.Direction == sqlparser.AscScr})
 
 	}
 
-	lim := s.Limit
-	var limExpr *LogicalSelectNode
+	var limExpr, offsetExpr *LogicalSelectNode
 	if lim != nil {
 		var err error
 		limExpr, err = parseExpr(c, lim.Rowcount, "")
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
+		}
+		if lim.Offset != nil {
+			offsetExpr, err = parseExpr(c, lim.Offset, "")
+			if err != nil {
+				return nil, nil, nil, err
+			}
 		}
 	}
-
-	p := LogicalPlan{filters, joins, selects, aggs, tables, subplans, groupBys, orderBys, limExpr, s.Distinct != "", ""}
-
-	return &p, nil
+	return orderBys, limExpr, offsetExpr, nil
 }
 
-func fieldToOp(tab string, field string, opMap map[string]*PlanNode) (*PlanNode, error) {
+// Parse a tree of set operations.  The vendored sql parser only understands
+// UNION, so [rewriteSetOps] turns INTERSECT and EXCEPT into UNION before the
+// query is parsed; kinds records the real operation of each rewritten union
+// node.  Unions missing from kinds (e.g., because kinds is nil) are UNIONs.
+// Set operations are evaluated left to right unless parenthesized.
+func parseSetOpStatement(c *Catalog, stmt sqlparser.SelectStatement, kinds map[*sqlparser.Union]SetOpType) (*LogicalPlan, error) {
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		return parseStatement(c, stmt)
+	case *sqlparser.ParenSelect:
+		return parseSetOpStatement(c, stmt.Select, kinds)
+	case *sqlparser.Union:
+		left, err := parseSetOpStatement(c, stmt.Left, kinds)
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseSetOpStatement(c, stmt.Right, kinds)
+		if err != nil {
+			return nil, err
+		}
+		orderBys, limExpr, offsetExpr, err := parseOrderByLimit(c, stmt.OrderBy, stmt.Limit)
+		if err != nil {
+			return nil, err
+		}
+		setOp := &LogicalSetOpNode{kinds[stmt], stmt.Type == sqlparser.UnionAllStr, left, right}
+		return &LogicalPlan{orderByFields: orderBys, limit: limExpr, offset: offsetExpr, setOp: setOp}, nil
+	}
+	return nil, GoDBError{ParseError, fmt.Sprintf("unsupported statement %s in set operation", sqlparser.String(stmt))}
+}
+
+// Match each union node of the statement to the operation recorded for it by
+// [rewriteSetOps].  The operations were recorded in the order they appear in
+// the query, which is the order of an in-order traversal of the tree, provided
+// all of them belong to the tree (and not, e.g., to a subquery).
+func setOpKinds(stmt sqlparser.SelectStatement, ops []SetOpType) (map[*sqlparser.Union]SetOpType, error) {
+	kinds := make(map[*sqlparser.Union]SetOpType)
+	var visit func(stmt sqlparser.SelectStatement)
+	visit = func(stmt sqlparser.SelectStatement) {
+		switch stmt := stmt.(type) {
+		case *sqlparser.ParenSelect:
+			visit(stmt.Select)
+		case *sqlparser.Union:
+			visit(stmt.Left)
+			if len(kinds) < len(ops) {
+				kinds[stmt] = ops[len(kinds)]
+			}
+			visit(stmt.Right)
+		}
+	}
+	visit(stmt)
+	if len(kinds) != len(ops) {
+		return nil, GoDBError{ParseError, "intersect and except are only supported at the outermost level of a query"}
+	}
+	return kinds, nil
+}
+
+type queryTokenType int
+
+const (
+	tokWord   queryTokenType = iota // keyword or unquoted identifier
+	tokQuoted queryTokenType = iota // quoted string or identifier
+	tokSpace  queryTokenType = iota // whitespace or comment
+	tokOther  queryTokenType = iota // any other character
+)
+
+// A minimal scanner over the text of a query, used to handle syntax the sql
+// parser does not support before handing the query to it.
+type queryScanner struct {
+	query string
+	pos   int
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+func isSpaceChar(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+// Advance past the next token, returning its type and text.  At the end of
+// the query, returns a tokSpace token with empty text.
+func (s *queryScanner) next() (queryTokenType, string) {
+	q := s.query
+	start := s.pos
+	if s.pos >= len(q) {
+		return tokSpace, ""
+	}
+	ch := q[s.pos]
+	typ := tokOther
+	switch {
+	case ch == '\'' || ch == '"' || ch == '`':
+		typ = tokQuoted
+		s.pos++
+		for s.pos < len(q) && q[s.pos] != ch {
+			if q[s.pos] == '\\' {
+				s.pos++
+			}
+			s.pos++
+		}
+		s.pos++
+	case ch == '#' || strings.HasPrefix(q[s.pos:], "-- "):
+		typ = tokSpace
+		for s.pos < len(q) && q[s.pos] != '\n' {
+			s.pos++
+		}
+	case strings.HasPrefix(q[s.pos:], "/*"):
+		typ = tokSpace
+		end := strings.Index(q[s.pos+2:], "*/")
+		if end < 0 {
+			s.pos = len(q)
+		} else {
+			s.pos += end + 4
+		}
+	case isSpaceChar(ch):
+		typ = tokSpace
+		for s.pos < len(q) && isSpaceChar(q[s.pos]) {
+			s.pos++
+		}
+	case isWordChar(ch):
+		typ = tokWord
+		for s.pos < len(q) && isWordChar(q[s.pos]) {
+			s.pos++
+		}
+	default:
+		s.pos++
+	}
+	if s.pos > len(q) {
+		s.pos = len(q)
+	}
+	return typ, q[start:s.pos]
+}
+
+// Advance past the next token that isn't whitespace or a comment.
+func (s *queryScanner) nextToken() (queryTokenType, string) {
+	for {
+		typ, text := s.next()
+		if typ != tokSpace || text == "" {
+			return typ, text
+		}
+	}
+}
+
+// Rewrite the INTERSECT and EXCEPT keywords in query, which the sql parser
+// does not support, to UNION, keeping any ALL or DISTINCT that follows them.
+// Returns the rewritten query and the operations of all of the set operation
+// keywords in the order they appear, or nil if the query has no INTERSECT or
+// EXCEPT.  Quoted strings, identifiers and comments are left untouched, as
+// are the keywords when they aren't followed by a query, e.g., when they are
+// used as aliases.
+func rewriteSetOps(query string) (string, []SetOpType) {
+	var out strings.Builder
+	var ops []SetOpType
+	rewritten := false
+	s := &queryScanner{query, 0}
+	for s.pos < len(query) {
+		typ, text := s.next()
+		if typ == tokWord && startsSetOpQuery(*s) {
+			switch strings.ToLower(text) {
+			case "union":
+				ops = append(ops, UnionOp)
+			case "intersect":
+				ops = append(ops, IntersectOp)
+				text = "union"
+				rewritten = true
+			case "except":
+				ops = append(ops, ExceptOp)
+				text = "union"
+				rewritten = true
+			}
+		}
+		out.WriteString(text)
+	}
+	if !rewritten {
+		return query, nil
+	}
+	return out.String(), ops
+}
+
+// Return whether the tokens that s is positioned at can follow a set operation
+// keyword: the query it is applied to, or ALL or DISTINCT.  s is a copy, so
+// the caller's scanner doesn't advance.
+func startsSetOpQuery(s queryScanner) bool {
+	typ, text := s.nextToken()
+	switch strings.ToLower(text) {
+	case "select", "all", "distinct":
+		return typ == tokWord
+	case "(":
+		return typ == tokOther
+	}
+	return false
+}
+
+// The name of the pseudo-function used by [rewriteWindows] to pass the window
+// specification of a window function through the sql parser.
+const windowSpecFunc = "__over"
+
+// Rewrite the OVER clauses of window functions in query, which the sql parser
+// does not support, into an extra argument of the function holding the window
+// specification as a string, e.g., rank() OVER (ORDER BY age) becomes
+// rank(__over('ORDER BY age')).  Quoted strings, identifiers and comments are
+// left untouched.
+func rewriteWindows(query string) (string, error) {
+	var out strings.Builder
+	rewritten := false
+	closeParen := -1   // position in out of the preceding token, if it is a ')'
+	emptyArgs := false // whether the parentheses closed at closeParen are empty
+	prev := ""         // the last token that isn't whitespace or a comment
+	s := &queryScanner{query, 0}
+	for s.pos < len(query) {
+		typ, text := s.next()
+		if typ == tokWord && strings.EqualFold(text, "over") && closeParen >= 0 {
+			if _, text = s.nextToken(); text != "(" {
+				return "", GoDBError{ParseError, fmt.Sprintf("expected '(' after OVER, got '%s'", text)}
+			}
+			specStart := s.pos
+			for depth := 1; depth > 0; {
+				typ, text = s.next()
+				switch {
+				case text == "":
+					return "", GoDBError{ParseError, "unbalanced parentheses in window specification"}
+				case typ == tokOther && text == "(":
+					depth++
+				case typ == tokOther && text == ")":
+					depth--
+				}
+			}
+			spec := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(query[specStart : s.pos-1])
+			arg := fmt.Sprintf("%s('%s')", windowSpecFunc, spec)
+			if !emptyArgs {
+				arg = ", " + arg
+			}
+			q := out.String()
+			out.Reset()
+			out.WriteString(q[:closeParen] + arg + q[closeParen:])
+			rewritten = true
+			closeParen = -1
+			continue
+		}
+		if typ != tokSpace {
+			closeParen = -1
+			if typ == tokOther && text == ")" {
+				closeParen = out.Len()
+				emptyArgs = prev == "("
+			}
+			prev = text
+		}
+		out.WriteString(text)
+	}
+	if !rewritten {
+		return query, nil
+	}
+	return out.String(), nil
+}
+
+// If the last argument of expr is the window specification added by
+// [rewriteWindows], return the specification.
+func windowSpec(expr *sqlparser.FuncExpr) (string, bool) {
+	if len(expr.Exprs) == 0 {
+		return "", false
+	}
+	arg, ok := expr.Exprs[len(expr.Exprs)-1].(*sqlparser.AliasedExpr)
+	if !ok {
+		return "", false
+	}
+	spec, ok := arg.Expr.(*sqlparser.FuncExpr)
+	if !ok || spec.Name.String() != windowSpecFunc || len(spec.Exprs) != 1 {
+		return "", false
+	}
+	specArg, ok := spec.Exprs[0].(*sqlparser.AliasedExpr)
+	if !ok {
+		return "", false
+	}
+	val, ok := specArg.Expr.(*sqlparser.SQLVal)
+	if !ok || val.Type != sqlparser.StrVal {
+		return "", false
+	}
+	return string(val.Val), true
+}
+
+// Parse a window function, e.g., lag(age, 2) OVER (ORDER BY age), whose OVER
+// clause has been rewritten by [rewriteWindows] into spec.
+func parseWindowFunc(c *Catalog, expr *sqlparser.FuncExpr, spec string, alias string) (*LogicalSelectNode, error) {
+	window, err := parseWindowSpec(c, spec)
+	if err != nil {
+		return nil, err
+	}
+	funName := strings.ToLower(sqlparser.String(expr.Name))
+	argExprs := expr.Exprs[:len(expr.Exprs)-1]
+	var args []*LogicalSelectNode
+	switch {
+	case funName == "row_number" || funName == "rank" || funName == "dense_rank":
+		if len(argExprs) != 0 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("window function %s takes no arguments", funName)}
+		}
+	case funName == "lag" || funName == "lead":
+		if len(argExprs) < 1 || len(argExprs) > 3 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("window function %s takes an expression, an optional offset and an optional default value", funName)}
+		}
+		for _, argExpr := range argExprs {
+			arg, err := parseSelect(c, argExpr)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		if len(args) > 1 {
+			if _, err := strconv.Atoi(args[1].value); args[1].exprType != ExprConst || err != nil {
+				return nil, GoDBError{ParseError, fmt.Sprintf("offset of window function %s must be an integer constant", funName)}
+			}
+		}
+	case isAgg(funName):
+		agg, err := parseExpr(c, &sqlparser.FuncExpr{Qualifier: expr.Qualifier, Name: expr.Name, Distinct: expr.Distinct, Exprs: argExprs}, "")
+		if err != nil {
+			return nil, err
+		}
+		args = agg.args
+	default:
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown window function %s", funName)}
+	}
+	node := NewWindowSelectNode(funName, args, window, alias)
+	node.distinct = expr.Distinct
+	return &node, nil
+}
+
+// Parse a window specification, [PARTITION BY expr, ...] [ORDER BY expr
+// [ASC|DESC], ...] [frame], where the frame is ROWS|RANGE start or ROWS|RANGE
+// BETWEEN start AND end.  The partition by and order by lists are handed to the
+// sql parser as the group by and order by of a dummy query.
+func parseWindowSpec(c *Catalog, spec string) (*LogicalWindowNode, error) {
+	var head strings.Builder
+	frameStart := -1
+	depth := 0
+	s := &queryScanner{spec, 0}
+	for s.pos < len(spec) {
+		start := s.pos
+		typ, text := s.next()
+		switch {
+		case typ == tokOther && text == "(":
+			depth++
+		case typ == tokOther && text == ")":
+			depth--
+		case typ == tokWord && depth == 0:
+			switch strings.ToLower(text) {
+			case "partition":
+				text = "group"
+			case "rows", "range":
+				frameStart = start
+			}
+		}
+		if frameStart >= 0 {
+			break
+		}
+		head.WriteString(text)
+	}
+
+	stmt, err := sqlparser.Parse(fmt.Sprintf("select 1 from %s %s", windowSpecFunc, head.String()))
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid window specification '%s'", spec)}
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || sel.Where != nil || sel.Having != nil || sel.Limit != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid window specification '%s'", spec)}
+	}
+	window := &LogicalWindowNode{frame: DefaultWindowFrame}
+	for _, pby := range sel.GroupBy {
+		expr, err := parseExpr(c, pby, "")
+		if err != nil {
+			return nil, err
+		}
+		window.partitionBy = append(window.partitionBy, expr)
+	}
+	window.orderBy, _, _, err = parseOrderByLimit(c, sel.OrderBy, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if frameStart >= 0 {
+		window.frame.rows = strings.EqualFold(spec[frameStart:s.pos], "rows")
+		_, text := s.nextToken()
+		between := strings.EqualFold(text, "between")
+		if between {
+			_, text = s.nextToken()
+		}
+		window.frame.start, err = parseFrameBound(s, text)
+		if err != nil {
+			return nil, err
+		}
+		window.frame.end = FrameBound{CurrentRow, 0}
+		if between {
+			if _, text = s.nextToken(); !strings.EqualFold(text, "and") {
+				return nil, GoDBError{ParseError, fmt.Sprintf("expected AND in window frame, got '%s'", text)}
+			}
+			_, text = s.nextToken()
+			window.frame.end, err = parseFrameBound(s, text)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if _, text = s.nextToken(); text != "" {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unexpected '%s' after window frame", text)}
+		}
+		if err := window.frame.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return window, nil
+}
+
+// Parse a window frame bound starting with the token text: UNBOUNDED
+// PRECEDING, n PRECEDING, CURRENT ROW, n FOLLOWING or UNBOUNDED FOLLOWING.
+func parseFrameBound(s *queryScanner, text string) (FrameBound, error) {
+	if strings.EqualFold(text, "current") {
+		if _, row := s.nextToken(); !strings.EqualFold(row, "row") {
+			return FrameBound{}, GoDBError{ParseError, fmt.Sprintf("expected CURRENT ROW in window frame, got CURRENT %s", row)}
+		}
+		return FrameBound{CurrentRow, 0}, nil
+	}
+	unbounded := strings.EqualFold(text, "unbounded")
+	n, err := strconv.Atoi(text)
+	if !unbounded && (err != nil || n < 0) {
+		return FrameBound{}, GoDBError{ParseError, fmt.Sprintf("invalid window frame bound '%s'", text)}
+	}
+	_, dir := s.nextToken()
+	switch {
+	case strings.EqualFold(dir, "preceding") && unbounded:
+		return FrameBound{UnboundedPreceding, 0}, nil
+	case strings.EqualFold(dir, "preceding"):
+		return FrameBound{OffsetPreceding, n}, nil
+	case strings.EqualFold(dir, "following") && unbounded:
+		return FrameBound{UnboundedFollowing, 0}, nil
+	case strings.EqualFold(dir, "following"):
+		return FrameBound{OffsetFollowing, n}, nil
+	}
+	return FrameBound{}, GoDBError{ParseError, fmt.Sprintf("expected PRECEDING or FOLLOWING in window frame, got '%s'", dir)}
+}
+
+// A common table expression defined by a WITH clause.
+type cteDef struct {
+	name    string
+	columns []string
+	stmt    sqlparser.SelectStatement
+	kinds   map[*sqlparser.Union]SetOpType
+
+	// the catalog in which the body of the expression is parsed, in which the
+	// expressions defined before it in the same WITH clause are visible
+	scope *Catalog
+
+	// set if the body references the expression itself, in which case it is
+	// a union of an anchor and a recursive term
+	recursive bool
+
+	// if set, this is the definition visible inside the recursive term of a
+	// recursive expression, and references to it read the work table
+	work *LogicalRecursiveNode
+}
+
+// Split the WITH clause, if any, off the front of query, returning the rest of
+// the query and a catalog in which the common table expressions it defines are
+// visible.  The sql parser does not support WITH, so the clause is scanned here
+// and the body of each expression is parsed on its own.
+func parseWith(c *Catalog, query string) (*Catalog, string, error) {
+	s := &queryScanner{query, 0}
+	typ, text := s.nextToken()
+	if typ != tokWord || !strings.EqualFold(text, "with") {
+		return c, query, nil
+	}
+	typ, text = s.nextToken()
+	recursive := false
+	if typ == tokWord && strings.EqualFold(text, "recursive") {
+		recursive = true
+		typ, text = s.nextToken()
+	}
+	defined := make(map[string]bool)
+	for {
+		//name [(column, ...)] AS (query)
+		if typ == tokQuoted && text[0] == '`' {
+			text = strings.Trim(text, "`")
+		} else if typ != tokWord {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("expected name of common table expression, got '%s'", text)}
+		}
+		def := &cteDef{name: strings.ToLower(text), scope: c}
+		if defined[def.name] {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("common table expression %s is defined more than once", def.name)}
+		}
+		defined[def.name] = true
+
+		_, text = s.nextToken()
+		if text == "(" {
+			for {
+				typ, text = s.nextToken()
+				if typ != tokWord {
+					return nil, "", GoDBError{ParseError, fmt.Sprintf("expected column name in column list of %s, got '%s'", def.name, text)}
+				}
+				def.columns = append(def.columns, strings.ToLower(text))
+				_, text = s.nextToken()
+				if text == ")" {
+					break
+				}
+				if text != "," {
+					return nil, "", GoDBError{ParseError, fmt.Sprintf("expected ',' or ')' in column list of %s, got '%s'", def.name, text)}
+				}
+			}
+			_, text = s.nextToken()
+		}
+		if !strings.EqualFold(text, "as") {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("expected AS after %s, got '%s'", def.name, text)}
+		}
+		if _, text = s.nextToken(); text != "(" {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("expected '(' before body of %s, got '%s'", def.name, text)}
+		}
+		bodyStart := s.pos
+		for depth := 1; depth > 0; {
+			typ, text = s.next()
+			switch {
+			case text == "":
+				return nil, "", GoDBError{ParseError, fmt.Sprintf("unbalanced parentheses in body of %s", def.name)}
+			case typ == tokOther && text == "(":
+				depth++
+			case typ == tokOther && text == ")":
+				depth--
+			}
+		}
+		if err := def.parse(query[bodyStart:s.pos-1], recursive); err != nil {
+			return nil, "", err
+		}
+		c = c.withCTE(def)
+
+		typ, text = s.nextToken()
+		if text != "," {
+			break
+		}
+		typ, text = s.nextToken()
+	}
+	return c, query[s.pos-len(text):], nil
+}
+
+// Parse the body of a common table expression, checking that recursive
+// expressions have the form anchor UNION [ALL] recursive term.
+func (def *cteDef) parse(body string, recursive bool) error {
+	body, ops := rewriteSetOps(body)
+	stmt, err := sqlparser.Parse(body)
+	if err != nil {
+		return err
+	}
+	sel, ok := stmt.(sqlparser.SelectStatement)
+	if !ok {
+		return GoDBError{ParseError, fmt.Sprintf("body of common table expression %s must be a query", def.name)}
+	}
+	def.kinds, err = setOpKinds(sel, ops)
+	if err != nil {
+		return err
+	}
+	def.stmt = sel
+	if !recursive || countTableRefs(sel, def.name) == 0 {
+		return nil
+	}
+
+	union, ok := sel.(*sqlparser.Union)
+	if !ok || def.kinds[union] != UnionOp {
+		return GoDBError{ParseError, fmt.Sprintf("recursive query %s must have the form anchor UNION [ALL] recursive term", def.name)}
+	}
+	if len(union.OrderBy) > 0 || union.Limit != nil {
+		return GoDBError{ParseError, fmt.Sprintf("order by and limit are not supported in recursive query %s", def.name)}
+	}
+	if countTableRefs(union.Left, def.name) > 0 {
+		return GoDBError{ParseError, fmt.Sprintf("anchor of recursive query %s may not reference %s", def.name, def.name)}
+	}
+	if countTableRefs(union.Right, def.name) > 1 {
+		return GoDBError{ParseError, fmt.Sprintf("recursive term of %s may only reference %s once", def.name, def.name)}
+	}
+	def.recursive = true
+	return nil
+}
+
+// Count the number of times the table with the supplied name appears in the
+// from clauses of node, including those of its subqueries.
+func countTableRefs(node sqlparser.SQLNode, name string) int {
+	n := 0
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if t, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if tn, ok := t.Expr.(sqlparser.TableName); ok && strings.ToLower(tn.Name.CompliantName()) == name {
+				n++
+			}
+		}
+		return true, nil
+	}, node)
+	return n
+}
+
+// Build the logical plan for a reference to the common table expression.  Each
+// reference gets its own plan, so the expression is evaluated once for every
+// time it is referenced.
+func (def *cteDef) plan() (*LogicalPlan, error) {
+	if def.work != nil {
+		return &LogicalPlan{workTable: def.work}, nil
+	}
+	if !def.recursive {
+		p, err := parseSetOpStatement(def.scope, def.stmt, def.kinds)
+		if err != nil {
+			return nil, err
+		}
+		return p, def.renameColumns(p)
+	}
+
+	union := def.stmt.(*sqlparser.Union)
+	anchor, err := parseSetOpStatement(def.scope, union.Left, def.kinds)
+	if err != nil {
+		return nil, err
+	}
+	if err := def.renameColumns(anchor); err != nil {
+		return nil, err
+	}
+	node := &LogicalRecursiveNode{anchor: anchor, all: union.Type == sqlparser.UnionAllStr}
+	scope := def.scope.withCTE(&cteDef{name: def.name, work: node})
+	node.recursive, err = parseSetOpStatement(scope, union.Right, def.kinds)
+	if err != nil {
+		return nil, err
+	}
+	return &LogicalPlan{recursive: node}, nil
+}
+
+// Name the output columns of p after the column list of the expression, if it
+// has one.
+func (def *cteDef) renameColumns(p *LogicalPlan) error {
+	if def.columns == nil {
+		return nil
+	}
+	for p.setOp != nil {
+		p = p.setOp.left
+	}
+	if len(p.selects) != len(def.columns) {
+		return GoDBError{ParseError, fmt.Sprintf("column list of %s has %d columns, but its query returns %d", def.name, len(def.columns), len(p.selects))}
+	}
+	for i, sel := range p.selects {
+		if sel.exprType == ExprStar {
+			return GoDBError{ParseError, fmt.Sprintf("query of %s must list its columns explicitly to use a column list", def.name)}
+		}
+		sel.alias = def.columns[i]
+	}
+	return nil
+}
+
+func fieldToOp(tab string, field string, opMap map[string]*PlanNode) (*PlanNode, error) {
 	node := opMap[tab]
 
 	if node == nil && tab != "" {
@@ -610,7 +1890,11 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		}
 		//fieldList = append(fieldList, field)
 		var fieldName string
-		if s.funcOp != nil {
+		if s.exprType == ExprAggr && s.args[0].exprType != ExprField {
+			//as for other functions, aggregates of expressions are named by
+			//the function alone
+			fieldName = *s.funcOp
+		} else if s.funcOp != nil {
 			tName, fName, err := (*s).getTableField(nil, nil, nil)
 			if err != nil {
 				return nil, "", err
@@ -618,6 +1902,9 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 			if tName != "" {
 				tName = tName + "."
 			}
+			if s.distinct {
+				tName = "distinct " + tName
+			}
 			fieldName = fmt.Sprintf("%s(%s%s)", *s.funcOp, tName, fName)
 		} else {
 			fieldName = s.field
@@ -663,6 +1950,30 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 
 		fe := FuncExpr{*s.funcOp, exprs}
 		return &fe, fieldName, nil
+	case ExprWindow:
+		if s.cachedField == nil {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("window function %s is only allowed in the select list", *s.funcOp)}
+		}
+		fieldName := *s.funcOp
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		return &FieldExpr{*s.cachedField}, fieldName, nil
+	case ExprParam:
+		i, _ := strconv.Atoi(s.value)
+		if c == nil || i < 1 || i > len(c.params) {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("placeholder $%s is only allowed in a prepared statement", s.value)}
+		}
+		fieldName := "$" + s.value
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		return c.params[i-1], fieldName, nil
+	case ExprCorrelated:
+		if s.param == nil {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("correlated reference to %s is not bound to an outer query", s.field)}
+		}
+		return s.param, s.field, nil
 	}
 	return nil, "", GoDBError{ParseError, "unhandled expression type in select list"}
 
@@ -680,6 +1991,13 @@ func exprToStr(e Expr) string {
 		return fmt.Sprintf("%s%s", tbl, ex.selectField.Fname)
 	case *ConstExpr:
 		return fmt.Sprintf("%v", ex.val)
+	case *ParamExpr:
+		return fmt.Sprintf("$%d", ex.index)
+	case *CorrelatedExpr:
+		if ex.outerField.TableQualifier == "" {
+			return "$" + ex.outerField.Fname
+		}
+		return fmt.Sprintf("$%s.%s", ex.outerField.TableQualifier, ex.outerField.Fname)
 	case *FuncExpr:
 		argStr := ""
 		for _, arg := range ex.args {
@@ -712,97 +2030,10 @@ func opToStr(op BoolOp) string {
 	return "??"
 }
 
-// following is absolute grossness because we forgot to ask students
-// to expose heapfile name
-func GetUnexportedField(field reflect.Value) interface{} {
-	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Interface()
-}
-
-func getStrFromObj(obj any) string {
-	var v reflect.Value
-	t := reflect.TypeOf(obj)
-	if t.Kind() == reflect.Pointer {
-		v = reflect.ValueOf(obj).Elem()
-	} else {
-		v = reflect.ValueOf(obj)
-	}
-	if reflect.TypeOf(v).Kind() != reflect.Struct {
-		return fmt.Sprintf("%v", obj)
-	}
-	for i := 0; i < v.NumField(); i++ {
-		v := GetUnexportedField(v.Field(i))
-		str, ok := v.(string)
-		if ok {
-			return str
-		}
-	}
-	return fmt.Sprintf("%v", obj)
-}
-
+// Print the plan rooted at o as text, one operator per line, indented by
+// indent; see [DescribePlan] and [WritePlan]
 func PrintPhysicalPlan(o Operator, indent string) {
-	switch op := o.(type) {
-	case *EqualityJoin[int64]:
-		fmt.Printf("%sJoin, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
-		indent = indent + "\t"
-		PrintPhysicalPlan(*op.left, indent)
-		PrintPhysicalPlan(*op.right, indent)
-	case *EqualityJoin[string]:
-		fmt.Printf("%sJoin, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
-		indent = indent + "\t"
-		PrintPhysicalPlan(*op.left, indent)
-		PrintPhysicalPlan(*op.right, indent)
-
-	case *Project:
-		selectStr := ""
-		for _, ex := range op.selectFields {
-			selectStr += exprToStr(ex) + ","
-		}
-		fmt.Printf("%sProject %+v -> %+v\n", indent, selectStr, op.outputNames)
-		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
-	case *Filter[int64]:
-		fmt.Printf("%sFilter %s %s %s\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
-		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
-	case *Filter[string]:
-		fmt.Printf("%sFilter %s %s %s\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
-		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
-	case *HeapFile:
-		fmt.Printf("%sHeap Scan %v\n", indent, getStrFromObj(op))
-	case *OrderBy:
-		orderStr := ""
-		for _, ex := range op.orderBy {
-			orderStr += exprToStr(ex) + ","
-		}
-		fmt.Printf("%sOrder By %s\n", indent, orderStr)
-		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
-	case *LimitOp:
-		fmt.Printf("%sLimit %s\n", indent, exprToStr(op.limitTups))
-		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
-	case *Aggregator:
-		gbyStr := ""
-		if len(op.groupByFields) > 0 {
-			gbyStr = "Group By "
-		}
-		for _, ex := range op.groupByFields {
-			gbyStr += exprToStr(ex) + ","
-		}
-
-		aggStr := ""
-		for _, ex := range op.newAggState {
-
-			aggStr += fmt.Sprintf("%s(%s),", reflect.TypeOf(ex), ex.GetTupleDesc().HeaderString(false))
-		}
-
-		fmt.Printf("%sAggregate, %s %s\n", indent, aggStr, gbyStr)
-		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
-	default:
-		fmt.Printf("%sUnknown op, %s\n", indent, reflect.TypeOf(op))
-	}
+	writePlanText(os.Stdout, DescribePlan(nil, o), indent)
 }
 
 func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
@@ -810,13 +2041,50 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 
 	tableMap := make(map[string]*PlanNode)
 
+	if plan.setOp != nil {
+		left, err := makePhysicalPlan(c, plan.setOp.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := makePhysicalPlan(c, plan.setOp.right)
+		if err != nil {
+			return nil, err
+		}
+		setOp, err := NewSetOp(left, right, plan.setOp.op, plan.setOp.all)
+		if err != nil {
+			return nil, err
+		}
+		return makeOrderByLimitPlan(c, plan, setOp, tableMap)
+	}
+	if plan.recursive != nil {
+		node := plan.recursive
+		anchor, err := makePhysicalPlan(c, node.anchor)
+		if err != nil {
+			return nil, err
+		}
+		node.work = NewWorkTable(anchor.Descriptor())
+		recursive, err := makePhysicalPlan(c, node.recursive)
+		work := node.work
+		node.work = nil
+		if err != nil {
+			return nil, err
+		}
+		return NewRecursiveCTE(anchor, recursive, work, node.all)
+	}
+	if plan.workTable != nil {
+		if plan.workTable.work == nil {
+			return nil, GoDBError{ParseError, "reference to a recursive query outside of its recursive term"}
+		}
+		return plan.workTable.work, nil
+	}
+
 	for _, p := range plan.subqueries {
 		subPhysP, err := makePhysicalPlan(c, p)
 		if err != nil {
 			return nil, err
 		}
+		subPhysP = NewAliasOp(subPhysP, p.alias)
 		var td *TupleDesc = subPhysP.Descriptor()
-		td.setTableAlias(p.alias)
 		//td = td.setTableAlias(p.alias)
 		tableMap[p.alias] = &PlanNode{subPhysP, td}
 	}
@@ -825,139 +2093,125 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		if t.alias != "" {
 			name = t.alias
 		}
-		var td *TupleDesc = (*t.file).Descriptor()
-		td.setTableAlias(name)
+		//label the tuples of the table with its name, so that fields of
+		//different tables with the same name (e.g., in a self join) can be
+		//told apart
+		var file Operator = *t.file
+		if cf, ok := file.(*ColumnFile); ok && t.columns != nil {
+			file = NewColumnScan(cf, t.columns)
+		}
+		scan := NewAliasOp(file, name)
+		var td *TupleDesc = scan.Descriptor()
 		//td = td.setTableAlias(name)
-		tableMap[name] = &PlanNode{*t.file, td}
+		tableMap[name] = &PlanNode{scan, td}
 	}
 
-	//now apply each filter to appropriate table
+	//now apply each filter to appropriate table; filters that only compare
+	//constants don't belong to any table, so apply them after the joins
+	var constFilters []*LogicalFilterNode
+	var subqueryFilters []*LogicalFilterNode
 	for _, f := range plan.filters {
-		tabName, fieldName, err := f.fieldExpr.getTableField(c, plan.subqueries, plan.tables)
+		if f.subquery != nil {
+			subqueryFilters = append(subqueryFilters, f)
+			continue
+		}
+		tabName, fieldName, err := f.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
 		}
+		if tabName == "" && fieldName == "" {
+			constFilters = append(constFilters, f)
+			continue
+		}
 		node, err := fieldToOp(tabName, fieldName, tableMap)
 		if err != nil {
 			return nil, err
 		}
-		leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
+		leftExpr, _, err := f.left.generateExpr(c, node.desc, tableMap)
 		if err != nil {
 			return nil, err
 		}
-		rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
+		rightExpr, _, err := f.right.generateExpr(c, node.desc, tableMap)
 		if err != nil {
 			return nil, err
 		}
 
-		op := node.op
-		desc := *op.Descriptor()
-		desc.setTableAlias(tabName)
-
-		switch leftExpr.GetExprType().Ftype {
-		case IntType:
-			newOp, err := NewIntFilter(rightExpr, f.predOp, leftExpr, op)
-			if err != nil {
-				return nil, err
-			}
-			tableMap[leftExpr.GetExprType().TableQualifier] = &PlanNode{newOp, &desc}
-		case StringType:
-			newOp, err := NewStringFilter(rightExpr, f.predOp, leftExpr, op)
-			if err != nil {
-				return nil, err
+		newOp, err := NewFilter(leftExpr, f.predOp, rightExpr, node.op)
+		if err != nil {
+			return nil, err
+		}
+		newNode := &PlanNode{newOp, node.desc}
+		for key, n := range tableMap {
+			if n.op == node.op {
+				tableMap[key] = newNode
 			}
-			tableMap[leftExpr.GetExprType().TableQualifier] = &PlanNode{newOp, &desc}
 		}
 	}
-	//finally apply joins
-	for _, j := range plan.joins {
-		lTabName, lFieldName, err := j.left.getTableField(c, plan.subqueries, plan.tables)
+	//scans of large tables, along with the filters applied to them, are run
+	//in parallel
+	for key, node := range tableMap {
+		op, err := parallelScanPlan(c, node.op)
 		if err != nil {
 			return nil, err
 		}
-
-		node1, err := fieldToOp(lTabName, lFieldName, tableMap)
-		if err != nil {
-			return nil, err
+		if op != nil {
+			tableMap[key] = &PlanNode{op, node.desc}
 		}
-
-		rTabName, rFieldName, err := j.right.getTableField(c, plan.subqueries, plan.tables)
+	}
+	//subquery filters that only reference one table can be applied to it before
+	//the joins; others may reference any of the joined tables
+	var topSubqueryFilters []*LogicalFilterNode
+	for _, f := range subqueryFilters {
+		node := subqueryFilterRelation(c, plan, f, tableMap)
+		if node == nil {
+			topSubqueryFilters = append(topSubqueryFilters, f)
+			continue
+		}
+		newOp, err := makeSubqueryPlan(c, f, node.op, tableMap)
 		if err != nil {
 			return nil, err
 		}
-
-		node2, err := fieldToOp(rTabName, rFieldName, tableMap)
-		if err != nil {
-			return nil, err
+		newNode := &PlanNode{newOp, node.desc}
+		for key, n := range tableMap {
+			if n.op == node.op {
+				tableMap[key] = newNode
+			}
 		}
+	}
 
-		/*desc1 := *op1.Descriptor()
-		desc1.setTableAlias(j.t1)
-		desc2 := *op2.Descriptor()
-		desc2.setTableAlias(j.t2)
-		*/
-		op1 := node1.op
-		op2 := node2.op
+	//finally join the tables, in the order and using the join algorithms
+	//chosen by the optimizer
+	topOp, err := planJoins(c, plan, tableMap)
+	if err != nil {
+		return nil, err
+	}
 
-		/*
-			leftField, _ := fieldNameToField(j.t1, j.f1, node1)
-			rightField, _ := fieldNameToField(j.t2, j.f2, node2)
-		*/
-		leftExpr, _, err := j.left.generateExpr(c, node1.desc, tableMap)
+	for _, f := range constFilters {
+		leftExpr, _, err := f.left.generateExpr(c, topOp.Descriptor(), tableMap)
 		if err != nil {
 			return nil, err
 		}
-		rightExpr, _, err := j.right.generateExpr(c, node2.desc, tableMap)
+		rightExpr, _, err := f.right.generateExpr(c, topOp.Descriptor(), tableMap)
 		if err != nil {
 			return nil, err
 		}
-
-		var (
-			newOp Operator
-		)
-		switch leftExpr.GetExprType().Ftype {
-		case IntType:
-			newOp, err = NewIntJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
-		case StringType:
-			newOp, err = NewStringJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
-		}
+		topOp, err = NewFilter(leftExpr, f.predOp, rightExpr, topOp)
 		if err != nil {
 			return nil, err
 		}
-		newNode := &PlanNode{newOp, newOp.Descriptor()}
-		for key, node := range tableMap {
-			if node.op == op1 {
-				tableMap[key] = newNode
-			}
-			if node.op == op2 {
-				tableMap[key] = newNode
-			}
-		}
-		tableMap[lTabName] = newNode
-		tableMap[rTabName] = newNode
-		//&PlanNode{newOp, newOp.Descriptor()}
-
 	}
 
-	//check that all tables have the same op (all tables are joined)
-	first := true
-	var curOp Operator
-	for _, node := range tableMap {
-		if first {
-			curOp = node.op
-			first = false
-		} else {
-			if curOp != node.op {
-				return nil, GoDBError{ParseError, "not all tables are joined, cross products are not supported in GoDB"}
-			}
+	for _, f := range topSubqueryFilters {
+		var err error
+		topOp, err = makeSubqueryPlan(c, f, topOp, tableMap)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	topOp := curOp
-
 	//var fieldList []FieldType
 	var fieldNames []string
-	hasAgg := len(plan.aggs) > 0
+	hasAgg := len(plan.aggs) > 0 || len(plan.groupByFields) > 0
 	selectAll := false
 
 	/*
@@ -986,60 +2240,27 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 				}
 			*/
 
-			var getter func(DBValue) any
 			if s.exprType == ExprAggr {
-				var as AggState
-
-				tabName, fieldName, err := s.args[0].getTableField(c, plan.subqueries, plan.tables)
-				if err != nil {
-					return nil, err
-				}
-				node, err := fieldToOp(tabName, fieldName, tableMap)
-				if err != nil {
-					return nil, err
-				}
-				aggExpr, _, err := s.args[0].generateExpr(c, node.desc, tableMap)
-				if err != nil {
-					return nil, err
-				}
-
-				switch aggExpr.GetExprType().Ftype {
-				case IntType:
-					getter = intAggGetter
-				case StringType:
-					getter = stringAggGetter
-				}
-
-				switch *s.funcOp {
-				case "max":
-					if aggExpr.GetExprType().Ftype == StringType {
-						as = &MaxAggState[string]{}
-					} else {
-						as = &MaxAggState[int64]{}
-					}
-
-				case "min":
-					if aggExpr.GetExprType().Ftype == StringType {
-						as = &MinAggState[string]{}
-					} else {
-						as = &MinAggState[int64]{}
+				//the argument may be any expression over the joined tables, so
+				//aggregates of expressions are named by the function alone
+				name := *s.funcOp
+				if s.args[0].exprType == ExprField {
+					tabName, fieldName, err := s.args[0].getTableField(c, plan.subqueries, plan.tables)
+					if err != nil {
+						return nil, err
 					}
-				case "avg":
-					as = &AvgAggState[int64]{}
-				case "sum":
-					as = &SumAggState[int64]{}
-				case "count":
-					as = &CountAggState{}
-				default:
-					return nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", *s.funcOp)}
+					name = fmt.Sprintf("%s(%s.%s)", *s.funcOp, tabName, fieldName)
 				}
 				//make sure name has unique id
-				name := fmt.Sprintf("%s(%s.%s)%d", *s.funcOp, tabName, fieldName, aggCnt)
+				name = fmt.Sprintf("%s%d", name, aggCnt)
 				aggCnt++
 				if s.alias != "" {
 					name = s.alias
 				}
-				as.Init(name, aggExpr, getter)
+				as, err := makeAggState(c, s, name, topOp.Descriptor(), tableMap)
+				if err != nil {
+					return nil, err
+				}
 				aggs = append(aggs, as)
 				s.cachedField = &as.GetTupleDesc().Fields[0] //track aggregates by reference rather than name
 			}
@@ -1053,11 +2274,48 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 			gbys = append(gbys, expr)
 		}
 
-		if len(gbys) == 0 {
+		if g, ok := topOp.(*Gather); ok {
+			var err error
+			topOp, err = parallelAggregatePlan(g, aggs, gbys)
+			if err != nil {
+				return nil, err
+			}
+		} else if len(gbys) == 0 {
 			topOp = NewAggregator(aggs, topOp)
 		} else {
 			topOp = NewGroupedAggregator(aggs, gbys, topOp)
 		}
+
+		for _, f := range plan.having {
+			//having aggregates that duplicate one in the select list were not
+			//added to plan.aggs, so they read the select list's output field
+			for _, side := range []*LogicalSelectNode{&f.left, &f.right} {
+				for _, agg := range extractAggs(side) {
+					if agg.cachedField == nil {
+						agg.cachedField = findEquivalentAgg(plan.aggs, agg).cachedField
+					}
+				}
+			}
+			leftExpr, _, err := f.left.generateExpr(c, topOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
+			}
+			rightExpr, _, err := f.right.generateExpr(c, topOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
+			}
+			topOp, err = NewFilter(leftExpr, f.predOp, rightExpr, topOp)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(plan.windows) > 0 {
+		var err error
+		topOp, err = makeWindowPlan(c, plan.windows, topOp, tableMap)
+		if err != nil {
+			return nil, err
+		}
 	}
 	exprList := make([]Expr, len(plan.selects))
 	for i, s := range plan.selects {
@@ -1076,32 +2334,272 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		}
 	}
 	if !selectAll {
-		projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, topOp)
+		//distinct is planned along with the order by
+		projOp, err := NewProjectOp(exprList, fieldNames, false, topOp)
 		if err != nil {
 			return nil, err
 		}
 		topOp = projOp
 	}
 
-	if len(plan.orderByFields) > 0 {
-		var ascs []bool
+	return makeOrderByLimitPlan(c, plan, topOp, tableMap)
+}
 
-		exprs := make([]Expr, len(plan.orderByFields))
-		for i, oby := range plan.orderByFields {
-			expr, _, err := oby.expr.generateExpr(c, topOp.Descriptor(), tableMap)
+// Return an empty aggregation state for the aggregate s over values of type
+// ftype, along with the getter that extracts those values.
+func (s *LogicalSelectNode) newAggState(ftype DBType) (AggState, func(DBValue) any, error) {
+	getter := intAggGetter
+	if ftype == StringType {
+		getter = stringAggGetter
+	}
+	op := *s.funcOp
+	var as AggState
+	switch op {
+	case "max":
+		if ftype == StringType {
+			as = &MaxAggState[string]{}
+		} else {
+			as = &MaxAggState[int64]{}
+		}
+	case "min":
+		if ftype == StringType {
+			as = &MinAggState[string]{}
+		} else {
+			as = &MinAggState[int64]{}
+		}
+	case "count":
+		as = &CountAggState{}
+	case "string_agg", "group_concat":
+		as = &StringAggState{sep: s.args[1].value}
+	default:
+		if ftype != IntType {
+			return nil, nil, GoDBError{TypeMismatchError, fmt.Sprintf("aggregate %s requires an integer argument", op)}
+		}
+		switch op {
+		case "avg":
+			as = &AvgAggState[int64]{}
+		case "sum":
+			as = &SumAggState[int64]{}
+		case "variance", "stddev":
+			as = &VarianceAggState{stddev: op == "stddev"}
+		case "median":
+			as = &PercentileAggState{fraction: 0.5}
+		case "percentile_cont":
+			fraction, _ := strconv.ParseFloat(s.args[1].value, 64)
+			as = &PercentileAggState{fraction: fraction}
+		case "bool_and", "bool_or":
+			as = &BoolAggState{or: op == "bool_or"}
+		default:
+			return nil, nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", op)}
+		}
+	}
+	if s.distinct {
+		as = NewDistinctAggState(as)
+	}
+	return as, getter, nil
+}
+
+// Add window operators computing the window functions of the select list on
+// top of topOp.  Functions over windows with the same partition by and order
+// by share an operator.  Each function's output field is given a unique name,
+// and tracked by reference (as for aggregates) when generating the select list.
+func makeWindowPlan(c *Catalog, windows []*LogicalSelectNode, topOp Operator, tableMap map[string]*PlanNode) (Operator, error) {
+	var groups [][]*LogicalSelectNode
+	for _, w := range windows {
+		found := false
+		for i, g := range groups {
+			if g[0].window.samePartitioning(w.window) {
+				groups[i] = append(g, w)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []*LogicalSelectNode{w})
+		}
+	}
+
+	windowCnt := 0
+	for _, g := range groups {
+		desc := topOp.Descriptor()
+		var partitionBy, orderBy []Expr
+		var ascending []bool
+		for _, pby := range g[0].window.partitionBy {
+			expr, _, err := pby.generateExpr(c, desc, tableMap)
 			if err != nil {
 				return nil, err
 			}
-			exprs[i] = expr
-			ascs = append(ascs, oby.ascending)
+			partitionBy = append(partitionBy, expr)
+		}
+		for _, oby := range g[0].window.orderBy {
+			expr, _, err := oby.expr.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			orderBy = append(orderBy, expr)
+			ascending = append(ascending, oby.ascending)
+		}
 
+		var funcs []*WindowFunc
+		for _, s := range g {
+			name := fmt.Sprintf("%s_over%d", *s.funcOp, windowCnt)
+			windowCnt++
+			f, err := makeWindowFunc(c, s, name, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			funcs = append(funcs, f)
+		}
+		window, err := NewWindow(partitionBy, orderBy, ascending, funcs, topOp)
+		if err != nil {
+			return nil, err
+		}
+		outDesc := window.Descriptor()
+		for i, s := range g {
+			s.cachedField = &outDesc.Fields[len(desc.Fields)+i]
+		}
+		topOp = window
+	}
+	return topOp, nil
+}
+
+// Build the window function s, whose output field is named name, over tuples
+// with the supplied descriptor.
+func makeWindowFunc(c *Catalog, s *LogicalSelectNode, name string, desc *TupleDesc, tableMap map[string]*PlanNode) (*WindowFunc, error) {
+	switch *s.funcOp {
+	case "row_number":
+		return NewRankingWindowFunc(RowNumberFunc, name)
+	case "rank":
+		return NewRankingWindowFunc(RankFunc, name)
+	case "dense_rank":
+		return NewRankingWindowFunc(DenseRankFunc, name)
+	case "lag", "lead":
+		expr, _, err := s.args[0].generateExpr(c, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		offset := 1
+		if len(s.args) > 1 {
+			offset, _ = strconv.Atoi(s.args[1].value)
 		}
+		var def Expr
+		if len(s.args) > 2 {
+			def, _, err = s.args[2].generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+		}
+		kind := LagFunc
+		if *s.funcOp == "lead" {
+			kind = LeadFunc
+		}
+		return NewOffsetWindowFunc(kind, name, expr, offset, def)
+	}
+
+	as, err := makeAggState(c, s, name, desc, tableMap)
+	if err != nil {
+		return nil, err
+	}
+	return NewAggWindowFunc(as, s.window.frame)
+}
+
+// Return an initialized aggregation state named name for the aggregate s,
+// whose argument is evaluated over tuples with descriptor desc
+func makeAggState(c *Catalog, s *LogicalSelectNode, name string, desc *TupleDesc, tableMap map[string]*PlanNode) (AggState, error) {
+	var aggExpr Expr
+	if arg := s.args[0]; arg.exprType == ExprField && arg.field == "*" {
+		//count(*) doesn't evaluate its argument
+		aggExpr = &ConstExpr{IntField{1}, IntType}
+	} else {
 		var err error
-		topOp, err = NewOrderBy(exprs, topOp, ascs)
+		aggExpr, _, err = arg.generateExpr(c, desc, tableMap)
 		if err != nil {
 			return nil, err
 		}
+	}
+	as, getter, err := s.newAggState(aggExpr.GetExprType().Ftype)
+	if err != nil {
+		return nil, err
+	}
+	if err := as.Init(name, aggExpr, getter); err != nil {
+		return nil, err
+	}
+	return as, nil
+}
 
+// Return true if the expressions include every field of desc
+func sortsOnAllFields(exprs []Expr, desc *TupleDesc) bool {
+	covered := make([]bool, len(desc.Fields))
+	for _, expr := range exprs {
+		if fe, ok := expr.(*FieldExpr); ok {
+			if i, err := findFieldInTd(fe.selectField, desc); err == nil {
+				covered[i] = true
+			}
+		}
+	}
+	for _, c := range covered {
+		if !c {
+			return false
+		}
+	}
+	return true
+}
+
+// Add the distinct, order by and limit of plan, if any, on top of topOp.  If
+// the order by sorts on every output field, duplicates are adjacent once
+// sorted, so a sort-based distinct is applied after the order by; otherwise,
+// a hash-based distinct is applied before it.
+func makeOrderByLimitPlan(c *Catalog, plan *LogicalPlan, topOp Operator, tableMap map[string]*PlanNode) (Operator, error) {
+	//an order by with a constant limit (and offset) only needs to keep the
+	//first limit + offset tuples, so use a top n operator unless they might
+	//not fit in memory
+	topN := -1
+	if plan.limit != nil && plan.limit.exprType == ExprConst && (plan.offset == nil || plan.offset.exprType == ExprConst) {
+		lim, err := strconv.Atoi(plan.limit.value)
+		offset := 0
+		if err == nil && plan.offset != nil {
+			offset, err = strconv.Atoi(plan.offset.value)
+		}
+		if err == nil && lim >= 0 && offset >= 0 && lim+offset <= SortBufferSize {
+			topN = lim + offset
+		}
+	}
+	var ascs []bool
+	exprs := make([]Expr, len(plan.orderByFields))
+	for i, oby := range plan.orderByFields {
+		expr, _, err := oby.expr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		exprs[i] = expr
+		ascs = append(ascs, oby.ascending)
+	}
+	sortedDistinct := plan.distinct && len(exprs) > 0 && sortsOnAllFields(exprs, topOp.Descriptor())
+	if plan.distinct && !sortedDistinct {
+		topOp = NewDistinct(topOp)
+	}
+	if sortedDistinct {
+		//the top n tuples may contain duplicates, so sort all of them
+		topN = -1
+	}
+
+	if len(plan.orderByFields) > 0 {
+		var err error
+		if topN >= 0 {
+			topOp, err = NewTopN(exprs, topOp, ascs, topN)
+			if err == nil && plan.offset == nil {
+				return topOp, nil
+			}
+		} else {
+			topOp, err = NewOrderBy(exprs, topOp, ascs)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	}
+	if sortedDistinct {
+		topOp = NewSortedDistinct(topOp)
 	}
 
 	if plan.limit != nil {
@@ -1109,11 +2607,66 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		if err != nil {
 			return nil, err
 		}
-		topOp = NewLimitOp(expr, topOp)
+		var offsetExpr Expr
+		if plan.offset != nil {
+			offsetExpr, _, err = plan.offset.generateExpr(c, topOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
+			}
+		}
+		topOp = NewLimitOffsetOp(expr, offsetExpr, topOp)
 	}
 	return topOp, nil
 }
 
+// Build the physical plan for a where clause subquery filtering the tuples of
+// child, either as a semi-join or as a nested evaluation.
+func makeSubqueryPlan(c *Catalog, f *LogicalFilterNode, child Operator, tableMap map[string]*PlanNode) (Operator, error) {
+	sq := f.subquery
+	desc := child.Descriptor()
+	if sq.semiJoin {
+		subOp, err := makePhysicalPlan(c, sq.plan)
+		if err != nil {
+			return nil, err
+		}
+		subDesc := subOp.Descriptor()
+		leftExprs := make([]Expr, len(sq.outerKeys))
+		rightExprs := make([]Expr, len(sq.outerKeys))
+		for i, key := range sq.outerKeys {
+			leftExprs[i], _, err = key.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			rightExprs[i] = &FieldExpr{subDesc.Fields[i]}
+		}
+		return NewSemiJoin(child, leftExprs, subOp, rightExprs, sq.negated)
+	}
+
+	//bind the subquery's references to the outer query to parameters that
+	//are set from each child tuple
+	params := make([]*CorrelatedExpr, len(sq.params))
+	for i, ref := range sq.params {
+		fieldNo, err := findFieldInTd(FieldType{ref.field, ref.table, UnknownType}, desc)
+		if err != nil {
+			return nil, err
+		}
+		ref.param = &CorrelatedExpr{desc.Fields[fieldNo], nil}
+		params[i] = ref.param
+	}
+	subOp, err := makePhysicalPlan(c, sq.plan)
+	if err != nil {
+		return nil, err
+	}
+	var expr Expr
+	if sq.kind != ExistsSubquery {
+		expr, _, err = f.left.generateExpr(c, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewSubqueryFilter(child, subOp, params, sq.kind, sq.negated, expr, f.predOp)
+}
+
 func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 	if insStmt.Columns != nil {
 		return nil, GoDBError{ParseError, "GoDB doesn't support inserts of incomplete tuples"}
@@ -1151,7 +2704,10 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 		if err != nil {
 			return nil, err
 		}
-		op, err := makePhysicalPlan(c, plan)
+		rewritePlan(c, plan, defaultRewriteRules)
+		//the workers of a parallel scan of the file inserted into would
+		//read its pages while they are modified
+		op, err := makePhysicalPlan(c.withSerialScans(), plan)
 		if err != nil {
 			return nil, err
 		}
@@ -1193,38 +2749,36 @@ func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
 	var newOp Operator
 	newOp = *tables[0].file
 	for _, f := range filters {
-		tabName, fieldName, err := f.fieldExpr.getTableField(c, subplans, tables)
-		if err != nil {
-			return nil, err
+		if f.subquery != nil {
+			newOp, err = makeSubqueryPlan(c, f, newOp, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			continue
 		}
-		node, err := fieldToOp(tabName, fieldName, tableMap)
+		tabName, fieldName, err := f.getTableField(c, subplans, tables)
 		if err != nil {
 			return nil, err
 		}
-		leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
+		node := tableMap[tables[0].tableName]
+		if tabName != "" || fieldName != "" {
+			node, err = fieldToOp(tabName, fieldName, tableMap)
+			if err != nil {
+				return nil, err
+			}
+		}
+		leftExpr, _, err := f.left.generateExpr(c, node.desc, tableMap)
 		if err != nil {
 			return nil, err
 		}
-		rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
+		rightExpr, _, err := f.right.generateExpr(c, node.desc, tableMap)
 		if err != nil {
 			return nil, err
 		}
 
-		//op := node.op
-		//dbField, _ := fieldNameToField(f.table, f.field, &PlanNode{op, &desc})
-
-		switch leftExpr.GetExprType().Ftype {
-		case IntType:
-			//newInt, _ := strconv.Atoi(f.constVal)
-			newOp, err = NewIntFilter(rightExpr, f.predOp, leftExpr, newOp)
-			if err != nil {
-				return nil, err
-			}
-		case StringType:
-			newOp, err = NewStringFilter(rightExpr, f.predOp, leftExpr, newOp)
-			if err != nil {
-				return nil, err
-			}
+		newOp, err = NewFilter(leftExpr, f.predOp, rightExpr, newOp)
+		if err != nil {
+			return nil, err
 		}
 	}
 	return NewDeleteOp(*tables[0].file, newOp), nil
@@ -1287,36 +2841,85 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 }
 
 func Parse(c *Catalog, query string) (QueryType, Operator, error) {
-	stmt, err := sqlparser.Parse(query)
+	qtype, build, err := parseQuery(c, query)
+	if err != nil || build == nil {
+		return qtype, nil, err
+	}
+	op, err := build()
 	if err != nil {
 		return UnknownQueryType, nil, err
 	}
-	switch stmt := stmt.(type) {
-	case *sqlparser.Select:
-		plan, err := parseStatement(c, stmt)
+	//fmt.Println("QUERY PLAN:", IteratorType, op.Descriptor().copy())
+	return qtype, op, nil
+}
+
+// planBuilder builds the physical plan of a parsed query, insert, delete or
+// analyze.  Each plan it returns is new, with its own state, e.g., the values
+// of the parameters of correlated subqueries, so the plans it builds may be
+// run concurrently.  Building a plan temporarily modifies the logical plan it
+// is built from, so a builder must not be called concurrently.
+type planBuilder func() (Operator, error)
+
+// Parse query like [Parse], returning a builder for its physical plan, if it
+// has one, rather than the plan itself
+func parseQuery(c *Catalog, query string) (QueryType, planBuilder, error) {
+	//the sql parser doesn't support ANALYZE
+	if tables, ok, err := parseAnalyze(query); ok {
 		if err != nil {
-			fmt.Printf("Err: %s\n", err.Error())
 			return UnknownQueryType, nil, err
 		}
-		op, err := makePhysicalPlan(c, plan)
+		return IteratorType, func() (Operator, error) {
+			return NewAnalyze(c, tables)
+		}, nil
+	}
+	query, err := rewriteWindows(query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	c, query, err = parseWith(c, query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	query, setOps := rewriteSetOps(query)
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	if _, ok := stmt.(*sqlparser.Union); !ok && setOps != nil {
+		return UnknownQueryType, nil, GoDBError{ParseError, "intersect and except are only supported at the outermost level of a query"}
+	}
+	switch stmt := stmt.(type) {
+	case *sqlparser.Union:
+		kinds, err := setOpKinds(stmt, setOps)
 		if err != nil {
-			//fmt.Printf("Err: %s\n", err.Error())
 			return UnknownQueryType, nil, err
 		}
-		//fmt.Println("QUERY PLAN:", IteratorType, op.Descriptor().copy())
-		return IteratorType, op, nil
-	case *sqlparser.Insert:
-		op, err := parseInsert(c, stmt)
+		plan, err := parseSetOpStatement(c, stmt, kinds)
 		if err != nil {
 			return UnknownQueryType, nil, err
 		}
-		return IteratorType, op, nil
-	case *sqlparser.Delete:
-		op, err := parseDelete(c, stmt)
+		rewritePlan(c, plan, defaultRewriteRules)
+		return IteratorType, func() (Operator, error) {
+			return makePhysicalPlan(c, plan)
+		}, nil
+	case *sqlparser.Select:
+		plan, err := parseStatement(c, stmt)
 		if err != nil {
+			fmt.Printf("Err: %s\n", err.Error())
 			return UnknownQueryType, nil, err
 		}
-		return IteratorType, op, nil
+		rewritePlan(c, plan, defaultRewriteRules)
+		return IteratorType, func() (Operator, error) {
+			return makePhysicalPlan(c, plan)
+		}, nil
+	case *sqlparser.Insert:
+		return IteratorType, func() (Operator, error) {
+			return parseInsert(c, stmt)
+		}, nil
+	case *sqlparser.Delete:
+		return IteratorType, func() (Operator, error) {
+			return parseDelete(c, stmt)
+		}, nil
 	case *sqlparser.Begin:
 		return BeginXactionType, nil, nil
 	case *sqlparser.Commit:
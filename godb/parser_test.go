@@ -0,0 +1,589 @@
+package godb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// Load the easy test database (tables t and t2) and return its catalog
+func makeParserTestCatalog(t *testing.T) (*Catalog, *BufferPool) {
+	bp := NewBufferPool(10)
+	err := MakeTestDatabaseEasy(bp)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", bp, "./")
+	if err != nil {
+		t.Fatalf("failed load catalog, %s", err.Error())
+	}
+	return c, bp
+}
+
+// Parse and run the supplied query in its own transaction, returning all of
+// the tuples it produces
+func runParserTestQuery(t *testing.T, c *Catalog, bp *BufferPool, sql string) []*Tuple {
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", sql, err.Error())
+	}
+	iter, err := plan.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf("failed to get iterator, q=%s, %s", sql, err.Error())
+	}
+	var tups []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf("failed to run, q=%s, %s", sql, err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		tups = append(tups, tup)
+	}
+	return tups
+}
+
+func TestParseExprFilters(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	queries := map[string]int{
+		"select name, age from t where age > 40":                                   6,
+		"select name, age from t where 40 < age":                                   6,
+		"select name, age from t where t.age * 2 > t.age + 50":                     3,
+		"select name from t where age + 1 > age and 1 = 1":                         12,
+		"select name from t where 1 = 2":                                           0,
+		"select t.name from t join t2 on t.name = t2.name where t.age < t.age + 0": 0,
+	}
+	for sql, n := range queries {
+		tups := runParserTestQuery(t, c, bp, sql)
+		if len(tups) != n {
+			t.Errorf("query '%s' returned %d results, expected %d", sql, len(tups), n)
+		}
+	}
+
+	_, _, err := Parse(c, "select name from t where name = age")
+	if err == nil {
+		t.Errorf("expected error comparing string and int columns")
+	}
+	//an expression over the fields of two tables can't be applied to either
+	for _, sql := range []string{
+		"select t.name from t, t2 where t.name = t2.name and t.age + t2.age > 50",
+		"select t.name from t, t2 where t.name = t2.name and (t.age - 1) * t2.age > 50",
+	} {
+		_, _, err = Parse(c, sql)
+		var dbErr GoDBError
+		if !errors.As(err, &dbErr) || dbErr.code != AmbiguousNameError {
+			t.Errorf("'%s': expected an ambiguous name error, got %v", sql, err)
+		}
+	}
+	//but may be computed over their join
+	for _, sql := range []string{
+		"select t.age + t2.age from t, t2 where t.name = t2.name",
+		"select sum(t.age * t2.age) from t, t2 where t.name = t2.name",
+	} {
+		if tups := runParserTestQuery(t, c, bp, sql); len(tups) == 0 {
+			t.Errorf("query '%s' returned no results", sql)
+		}
+	}
+}
+
+func TestParseHaving(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	queries := map[string]int{
+		"select name, count(*) from t group by name having count(*) > 1":                 2,
+		"select name, count(*) c from t group by name having c > 1":                      2,
+		"select name from t group by name having sum(age) > 60":                          3,
+		"select name, max(age) from t group by name having name > 'r' and min(age) < 30": 2,
+		"select name from t group by name having name = 'sam'":                           1,
+		"select count(*) from t having sum(age) > 10000":                                 0,
+	}
+	for sql, n := range queries {
+		tups := runParserTestQuery(t, c, bp, sql)
+		if len(tups) != n {
+			t.Errorf("query '%s' returned %d results, expected %d", sql, len(tups), n)
+		}
+	}
+
+	// aggregates only in the having clause should not be output
+	tups := runParserTestQuery(t, c, bp, "select name from t group by name having sum(age) > 60 and count(*) = 2")
+	if len(tups) != 2 || len(tups[0].Fields) != 1 {
+		t.Errorf("unexpected result for having with aggregates not in select list: %v", tups)
+	}
+
+	_, _, err := Parse(c, "select name from t having 1 = 1")
+	if err == nil {
+		t.Errorf("expected error for having without group by or aggregate")
+	}
+}
+
+func TestParseSubqueries(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	queries := map[string]int{
+		"select name from t where name in (select name from t2 where age > 40)":                         8,
+		"select name from t where name not in (select name from t2 where age > 40)":                     4,
+		"select name from t where exists (select * from t2 where t2.name = t.name and t2.age > 50)":     4,
+		"select name from t where not exists (select * from t2 where t2.name = t.name and t2.age > 50)": 8,
+		"select name from t where exists (select * from t2 where t2.age > t.age)":                       10,
+		"select name from t where age > (select avg(age) from t2)":                                      4,
+		"select name from t where (select avg(age) from t2) < age":                                      4,
+		"select name from t where age = (select max(age) from t2 where t2.name = t.name)":               10,
+		"select name from t where age in (select age from t2 where t2.name = t.name and t2.age > 30)":   8,
+		"select name from t where not exists (select * from t2 where age > 1000)":                       12,
+		"select name from t where age > 40 and name in (select name from t2 where name = t.name)":       6,
+		"select name, count(*) from t where name in (select name from t2 where age < 30) group by name": 3,
+	}
+	for sql, n := range queries {
+		tups := runParserTestQuery(t, c, bp, sql)
+		if len(tups) != n {
+			t.Errorf("query '%s' returned %d results, expected %d", sql, len(tups), n)
+		}
+	}
+
+	// subqueries that can be turned into semi-joins should be
+	_, plan, err := Parse(c, "select name from t where exists (select * from t2 where t2.name = t.name)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := plan.(*Project).child.(*SemiJoin); !ok {
+		t.Errorf("expected correlated exists to be decorrelated into a semi join")
+	}
+
+	_, _, err = Parse(c, "select name from t where name in (select name, age from t2)")
+	if err == nil {
+		t.Errorf("expected error for in subquery returning two columns")
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	_, plan, err = Parse(c, "select name from t where age = (select age from t2)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := plan.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = iter(); err == nil {
+		t.Errorf("expected error for scalar subquery returning several rows")
+	}
+}
+
+func TestParseSetOps(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	queries := map[string]int{
+		"select name from t union select name from t2":                                                               10,
+		"select name from t union all select name from t2":                                                           24,
+		"select name from t where age > 40 intersect select name from t2 where age < 30":                             2,
+		"select name from t intersect all select name from t2 where age < 30":                                        3,
+		"select name from t except select name from t2 where age < 30":                                               7,
+		"select name from t except all select name from t2 where age < 30":                                           9,
+		"select name from t except select name from t2 where age < 30 union select name from t2 where name = 'sam'":  8,
+		"select name from t except (select name from t2 where age < 30 union select name from t2 where name = 'bo')": 6,
+		"select x.name from (select name from t union select name from t2) x where x.name > 'r'":                     3,
+		"select name from t where name = 'except' union select name from t2 where name = 'sam'":                      1,
+		"select name as except from t union select name from t2":                                                     10,
+		"select age as intersect from t where age > 40":                                                              6,
+	}
+	for sql, n := range queries {
+		tups := runParserTestQuery(t, c, bp, sql)
+		if len(tups) != n {
+			t.Errorf("query '%s' returned %d results, expected %d", sql, len(tups), n)
+		}
+	}
+
+	tups := runParserTestQuery(t, c, bp, "select name, age from t union select name, age from t2 order by age desc, name limit 3")
+	expected := []string{"bo", "sam", "sarah"}
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d results from ordered union, got %d", len(expected), len(tups))
+	}
+	for i, name := range expected {
+		if tups[i].Fields[0].(StringField).Value != name {
+			t.Errorf("expected %s at position %d of ordered union, got %v", name, i, tups[i].Fields[0])
+		}
+	}
+
+	for _, sql := range []string{
+		"select name from t union select age from t2",
+		"select name, age from t union select name from t2",
+		"select name from t where name in (select name from t2 intersect select name from t)",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected error for query '%s'", sql)
+		}
+	}
+}
+
+// Create a table emp(name, manager) describing an org chart, in which x and y
+// manage each other
+func makeOrgChartTable(t *testing.T, c *Catalog, bp *BufferPool) {
+	os.Remove("emp.dat")
+	t.Cleanup(func() { os.Remove("emp.dat") })
+	if _, _, err := Parse(c, "create table emp (name text, manager text)"); err != nil {
+		t.Fatalf("failed to create table emp, %s", err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	_, plan, err := Parse(c, "insert into emp values ('ann', ''), ('bob', 'ann'), ('cat', 'ann'), ('dan', 'bob'), ('eve', 'dan'), ('fay', 'cat'), ('x', 'y'), ('y', 'x')")
+	if err != nil {
+		t.Fatalf("failed to parse insert, %s", err.Error())
+	}
+	iter, err := plan.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf("failed to get insert iterator, %s", err.Error())
+	}
+	//the insert outputs a single tuple with the number of rows inserted
+	if _, err := iter(); err != nil {
+		t.Fatalf("failed to insert into emp, %s", err.Error())
+	}
+}
+
+func TestParseCTEs(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	makeOrgChartTable(t, c, bp)
+	queries := map[string]int{
+		"with old as (select name, age from t where age > 40) select name from old where age < 60":                                                                                        3,
+		"with old as (select name, age from t where age > 40) select o1.name from old o1 join old o2 on o1.name = o2.name":                                                                6,
+		"with o(n, a) as (select name, age from t) select n from o where a > 90":                                                                                                          2,
+		"with a as (select name, age from t where age > 30), b as (select name from a where age < 50) select count(*) from b":                                                             1,
+		"with t as (select name from t2 where age > 90) select * from t":                                                                                                                  2,
+		"with u as (select name from t union select name from t2) select * from u":                                                                                                        10,
+		"with recursive reports(name) as (select name from emp where manager = 'ann' union select emp.name from emp join reports on emp.manager = reports.name) select name from reports": 5,
+		"with recursive r(name) as (select name from emp where name = 'x' union select emp.name from emp join r on emp.manager = r.name) select * from r":                                 2,
+		"with recursive nums(n) as (select age from t where name = 'bill' union all select n + 1 from nums where n < 40) select n from nums":                                              11,
+	}
+	for sql, n := range queries {
+		tups := runParserTestQuery(t, c, bp, sql)
+		if len(tups) != n {
+			t.Errorf("query '%s' returned %d results, expected %d", sql, len(tups), n)
+		}
+	}
+
+	// walk up the management chain from eve
+	tups := runParserTestQuery(t, c, bp, "with recursive chain as (select name, manager from emp where name = 'eve' union all select emp.name, emp.manager from chain join emp on chain.manager = emp.name) select name from chain order by name")
+	expected := []string{"ann", "bob", "dan", "eve"}
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d results from recursive query, got %d", len(expected), len(tups))
+	}
+	for i, name := range expected {
+		if tups[i].Fields[0].(StringField).Value != name {
+			t.Errorf("expected %s at position %d of recursive query, got %v", name, i, tups[i].Fields[0])
+		}
+	}
+
+	// fields of different references to the same expression are distinct
+	tups = runParserTestQuery(t, c, bp, "with s as (select name, age from t where name = 'sam') select s1.age, s2.age from s s1 join s s2 on s1.name = s2.name")
+	mixed := 0
+	for _, tup := range tups {
+		if tup.Fields[0].(IntField).Value != tup.Fields[1].(IntField).Value {
+			mixed++
+		}
+	}
+	if len(tups) != 4 || mixed != 2 {
+		t.Errorf("unexpected result for self join of common table expression: %v", tups)
+	}
+
+	for _, sql := range []string{
+		"with o(n) as (select name, age from t) select n from o",
+		"with recursive r(name) as (select name from r union select name from t) select * from r",
+		"with recursive r(name) as (select name from t union select r.name from r join r r2 on r.name = r2.name) select * from r",
+		"with a as (select name from t), a as (select name from t2) select * from a",
+		"with a as (select name from t select * from a",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected error for query '%s'", sql)
+		}
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	queries := map[string]int{
+		"select name, row_number() over (order by age) from t":                                                       12,
+		"select * from (select name, age, rank() over (partition by name order by age desc) r from t) s where r = 1": 10,
+		"with r as (select name, row_number() OVER (ORDER BY age DESC) n from t) select name from r where n <= 3":    3,
+		"select name, count(*) c, rank() over (order by count(*) desc) from t group by name":                         10,
+		"select distinct name, count(*) over (partition by name) from t":                                             10,
+	}
+	for sql, n := range queries {
+		tups := runParserTestQuery(t, c, bp, sql)
+		if len(tups) != n {
+			t.Errorf("query '%s' returned %d results, expected %d", sql, len(tups), n)
+		}
+	}
+
+	//ages in ascending order are 22, 22, 25, 30, 38, 40, 43, 45, 50, 60, 99, 99
+	tups := runParserTestQuery(t, c, bp, "select age, "+
+		"rank() over (order by age) r, "+
+		"dense_rank() over (order by age) dr, "+
+		"lag(age, 1, -1) over (order by age) l, "+
+		"sum(age) over (order by age) s, "+
+		"sum(age) over (order by age rows between 1 preceding and current row) s2, "+
+		"count(*) over (partition by name) c "+
+		"from t order by age, c")
+	expected := [][]int64{
+		{22, 1, 1, -1, 44, 22, 1},
+		{22, 1, 1, 22, 44, 44, 2},
+		{25, 3, 2, 22, 69, 47, 2},
+		{30, 4, 3, 25, 99, 55, 1},
+	}
+	for i, row := range expected {
+		for j, v := range row {
+			if got := tups[i].Fields[j].(IntField).Value; got != v {
+				t.Errorf("row %d, column %d: expected %d, got %d", i, j, v, got)
+			}
+		}
+	}
+	if got := tups[11].Fields[4].(IntField).Value; got != 573 {
+		t.Errorf("expected running sum of 573 for the last row, got %d", got)
+	}
+
+	for _, sql := range []string{
+		"select name from t where rank() over (order by age) > 1",
+		"select name from t order by rank() over (order by age)",
+		"select name, rank(age) over () from t",
+		"select name, lag(age, age) over () from t",
+		"select name, ntile(age) over () from t",
+		"select name, sum(age) over (order by age range 1 preceding) from t",
+		"select name, sum(age) over (order by age rows between current row and 1 preceding) from t",
+		"select name, sum(age) over (order by age rows 1 sideways) from t",
+		"select name, sum(age) over w from t",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected error for query '%s'", sql)
+		}
+	}
+}
+
+func TestParseExtendedAggs(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	//ages are 22, 22, 25, 30, 38, 40, 43, 45, 50, 60, 99, 99
+	tups := runParserTestQuery(t, c, bp, "select count(distinct name), count(name), sum(distinct age), "+
+		"variance(age), stddev(age), median(age), percentile_cont(age, 0.9), bool_and(age), bool_or(age - age) from t")
+	if len(tups) != 1 {
+		t.Fatalf("expected one result, got %d", len(tups))
+	}
+	for i, expected := range []int64{10, 12, 452, 704, 26, 41, 95, 1, 0} {
+		if v := tups[0].Fields[i].(IntField).Value; v != expected {
+			t.Errorf("unexpected value %d for column %d, expected %d", v, i, expected)
+		}
+	}
+
+	tups = runParserTestQuery(t, c, bp, "select name, count(distinct age) c, string_agg(age, '+') a, group_concat(distinct name separator ';') n from t group by name having count(distinct age) > 1 order by name")
+	expected := [][]string{{"riza", "43+22", "riza"}, {"sam", "25+99", "sam"}}
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(tups))
+	}
+	for i, row := range expected {
+		if tups[i].Fields[0].(StringField).Value != row[0] || tups[i].Fields[1].(IntField).Value != 2 ||
+			tups[i].Fields[2].(StringField).Value != row[1] || tups[i].Fields[3].(StringField).Value != row[2] {
+			t.Errorf("unexpected result %v, expected %v", tups[i].Fields, row)
+		}
+	}
+
+	tups = runParserTestQuery(t, c, bp, "select name, count(distinct age) over () from t")
+	if len(tups) != 12 || tups[0].Fields[1].(IntField).Value != 10 {
+		t.Errorf("unexpected result for count(distinct) window function")
+	}
+
+	for _, sql := range []string{
+		"select sum(name) from t",
+		"select stddev(name) from t",
+		"select percentile_cont(age, 2) from t",
+		"select percentile_cont(age, age) from t",
+		"select percentile_cont(age) from t",
+		"select string_agg(name) from t",
+		"select group_concat(name order by age) from t",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("expected error for query '%s'", sql)
+		}
+	}
+}
+
+func TestParseAggExprs(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	tups := runParserTestQuery(t, c, bp, "select sum(t.age * t2.age), count(*), sum(1), sum(t.age + 1) - count(*) from t join t2 on t.name = t2.name")
+	if len(tups) != 1 {
+		t.Fatalf("expected one result, got %d", len(tups))
+	}
+	for i, expected := range []int64{41955, 16, 16, 762} {
+		if v := tups[0].Fields[i].(IntField).Value; v != expected {
+			t.Errorf("unexpected value %d for column %d, expected %d", v, i, expected)
+		}
+	}
+	if name := tups[0].Desc.Fields[0].Fname; name != "sum" {
+		t.Errorf("expected aggregate of an expression to be named sum, got %s", name)
+	}
+
+	tups = runParserTestQuery(t, c, bp, "select t.name, sum(t.age * (100 - t2.age)) as revenue from t, t2 where t.name = t2.name group by t.name order by revenue desc limit 3")
+	expected := []struct {
+		name    string
+		revenue int64
+	}{{"sam", 9424}, {"riza", 8775}, {"mark", 2500}}
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(tups))
+	}
+	for i, row := range expected {
+		if tups[i].Fields[0].(StringField).Value != row.name || tups[i].Fields[1].(IntField).Value != row.revenue {
+			t.Errorf("unexpected result %v, expected %v", tups[i].Fields, row)
+		}
+	}
+
+	tups = runParserTestQuery(t, c, bp, "select name, sum(age) / count(*) a from t group by name having sum(age) / count(*) > 50 order by name")
+	expectedNames := []string{"bo", "sam", "sarah"}
+	if len(tups) != len(expectedNames) {
+		t.Fatalf("expected %d results, got %d", len(expectedNames), len(tups))
+	}
+	for i, name := range expectedNames {
+		if tups[i].Fields[0].(StringField).Value != name {
+			t.Errorf("unexpected result %v, expected %s", tups[i].Fields, name)
+		}
+	}
+
+	if _, _, err := Parse(c, "select sum(nosuch + 1) from t"); err == nil {
+		t.Errorf("expected error for aggregate of unknown field")
+	}
+}
+
+func TestParseTopN(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	sql := "select name, age from t order by age desc, name limit 3"
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := plan.(*TopN); !ok {
+		t.Errorf("expected order by with a constant limit to be planned as a top n, got %T", plan)
+	}
+	tups := runParserTestQuery(t, c, bp, sql)
+	expected := []string{"bo", "sam", "sarah"}
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(tups))
+	}
+	for i, name := range expected {
+		if tups[i].Fields[0].(StringField).Value != name {
+			t.Errorf("unexpected result %v, expected %s", tups[i].Fields, name)
+		}
+	}
+
+	//limits larger than the sort buffer use a full (external) sort
+	saved := SortBufferSize
+	SortBufferSize = 2
+	defer func() { SortBufferSize = saved }()
+	_, plan, err = Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := plan.(*LimitOp); !ok {
+		t.Errorf("expected limit larger than the sort buffer to be planned as a limit, got %T", plan)
+	}
+	if tups := runParserTestQuery(t, c, bp, sql); len(tups) != 3 || tups[2].Fields[0].(StringField).Value != "sarah" {
+		t.Errorf("unexpected result of spilling order by with limit")
+	}
+}
+
+func TestParseLimitOffset(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	queries := map[string][]string{
+		"select name, age from t order by age desc, name limit 3 offset 2":            {"sarah", "mark", "kathy"},
+		"select name, age from t order by age, name limit 2, 2":                       {"sam", "bill"},
+		"select name from t limit 2 offset 10":                                        {"sam", "riza"},
+		"select name from t limit 2 offset 20":                                        nil,
+		"select name from t union select name from t2 order by name limit 2 offset 1": {"bill", "bo"},
+	}
+	for sql, expected := range queries {
+		tups := runParserTestQuery(t, c, bp, sql)
+		var names []string
+		for _, tup := range tups {
+			names = append(names, tup.Fields[0].(StringField).Value)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(expected) {
+			t.Errorf("query '%s': expected %v, got %v", sql, expected, names)
+		}
+	}
+}
+
+func TestParseDistinct(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	queries := map[string][]string{
+		"select distinct name from t order by name limit 3":                              {"ang", "bill", "bo"},
+		"select distinct name, age from t where age > 40 order by name limit 2 offset 1": {"kathy", "mark"},
+		"select distinct t.name from t join t2 on t.name = t2.name order by name desc":   {"sarah", "sam", "riza", "pat", "mark", "kathy", "joe", "bo", "bill", "ang"},
+	}
+	for sql, expected := range queries {
+		tups := runParserTestQuery(t, c, bp, sql)
+		var names []string
+		for _, tup := range tups {
+			names = append(names, tup.Fields[0].(StringField).Value)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(expected) {
+			t.Errorf("query '%s': expected %v, got %v", sql, expected, names)
+		}
+	}
+	if tups := runParserTestQuery(t, c, bp, "select distinct * from t"); len(tups) != 12 {
+		t.Errorf("expected 12 distinct tuples, got %d", len(tups))
+	}
+
+	//a sort on every output field makes duplicates adjacent
+	_, plan, err := Parse(c, "select distinct name from t order by name")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if d, ok := plan.(*Distinct); !ok || !d.sorted {
+		t.Errorf("expected sorted distinct, got %T", plan)
+	}
+	_, plan, err = Parse(c, "select distinct name, age from t order by name")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := plan.(*OrderBy); !ok {
+		t.Errorf("expected hash distinct below order by, got %T", plan)
+	}
+}
+
+func TestParseJoinPlan(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	queries := map[string]int{
+		"select t.name from t, t2, t as t3 where t.name = t2.name and t2.name = t3.name":                       24,
+		"select t.name from t join t2 on t.name = t2.name join t as t3 on t3.name = t2.name where t3.age > 40": 12,
+		//both predicates are join keys, rather than joining t with itself
+		"select t.name from t, t2 where t.name = t2.name and t.age = t2.age":                               12,
+		"select t.name from t, t2 where t.name = t2.name and t.age in (select age from t2 where age > 40)": 8,
+	}
+	for sql, expected := range queries {
+		if tups := runParserTestQuery(t, c, bp, sql); len(tups) != expected {
+			t.Errorf("query '%s': expected %d results, got %d", sql, expected, len(tups))
+		}
+	}
+
+	//a subquery filter that only references one table is applied to it
+	//before the join
+	_, plan, err := Parse(c, "select t.name from t, t2 where t.name = t2.name and t.age in (select age from t2 where age > 40)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	proj, ok := plan.(*Project)
+	if !ok {
+		t.Fatalf("expected project, got %T", plan)
+	}
+	hj, ok := proj.child.(*HashJoin)
+	if !ok {
+		t.Fatalf("expected hash join, got %T", proj.child)
+	}
+	_, leftSemi := hj.left.(*SemiJoin)
+	_, rightSemi := hj.right.(*SemiJoin)
+	if !leftSemi && !rightSemi {
+		t.Errorf("expected semi join below hash join, got %T and %T", hj.left, hj.right)
+	}
+
+	if _, _, err := Parse(c, "select t.name from t, t2"); err == nil {
+		t.Errorf("expected error for cross product")
+	}
+}
@@ -0,0 +1,163 @@
+package godb
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// PlanCache is a least recently used cache of the plans of queries, in front
+// of [Parse].  Plans are keyed by the normalized text of the query (see
+// [normalizeQuery]), so queries that differ only in the amount of whitespace,
+// comments or the case of keywords and names share a plan, but queries that
+// differ in their constants do not; use [Prepare] for statements that are run
+// with different values.
+//
+// All of the cached plans are dropped when tables are added to or dropped from
+// the catalog, or their statistics change, as the plans may no longer be
+// valid, or the best ones.  Other statements are passed to [Parse] without
+// being cached: inserts and deletes are planned straight from their syntax
+// tree, so there is nothing to save by caching them.
+//
+// The cache holds the optimized logical plans of queries, from which a new
+// physical plan is built each time a query is parsed, so that the plans
+// returned for a query have their own state and may be run concurrently, or
+// modified, e.g., by [Instrument].  The cache is safe for concurrent use.
+type PlanCache struct {
+	c        *Catalog
+	capacity int
+
+	mutex   sync.Mutex
+	version int64                    // of the catalog when the cached plans were built
+	plans   map[string]*list.Element // of *cachedPlan, by normalized query
+	lru     *list.List               // of *cachedPlan, most recently used first
+}
+
+type cachedPlan struct {
+	query string
+
+	mutex sync.Mutex // held while building a plan, as builders aren't safe for concurrent use
+	build planBuilder
+}
+
+// Create a plan cache for queries against the catalog c, holding at most
+// capacity plans
+func NewPlanCache(c *Catalog, capacity int) (*PlanCache, error) {
+	if capacity < 1 {
+		return nil, GoDBError{IllegalOperationError, "plan cache capacity must be at least 1"}
+	}
+	return &PlanCache{c: c, capacity: capacity, version: c.version.Load(), plans: make(map[string]*list.Element), lru: list.New()}, nil
+}
+
+// Parse query like [Parse], building its plan from the cached logical plan of
+// the query if there is one, and otherwise caching the logical plan that is
+// built.
+func (pc *PlanCache) Parse(query string) (QueryType, Operator, error) {
+	s := &queryScanner{query, 0}
+	typ, text := s.nextToken()
+	for typ == tokOther && text == "(" {
+		typ, text = s.nextToken()
+	}
+	if typ != tokWord || !cacheableStatements[strings.ToLower(text)] {
+		return Parse(pc.c, query)
+	}
+
+	key := normalizeQuery(query)
+	pc.mutex.Lock()
+	pc.checkVersion()
+	var cached *cachedPlan
+	if e := pc.plans[key]; e != nil {
+		pc.lru.MoveToFront(e)
+		cached = e.Value.(*cachedPlan)
+	}
+	pc.mutex.Unlock()
+	if cached != nil {
+		op, err := cached.newPlan()
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
+	}
+
+	//the plan is only cached if the catalog didn't change while it was built
+	version := pc.c.version.Load()
+	qtype, build, err := parseQuery(pc.c, query)
+	if err != nil || qtype != IteratorType || build == nil {
+		return qtype, nil, err
+	}
+	cached = &cachedPlan{query: key, build: build}
+	op, err := cached.newPlan()
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	pc.checkVersion()
+	if pc.version != version || pc.plans[key] != nil {
+		return qtype, op, nil
+	}
+	pc.plans[key] = pc.lru.PushFront(cached)
+	if pc.lru.Len() > pc.capacity {
+		oldest := pc.lru.Back()
+		pc.lru.Remove(oldest)
+		delete(pc.plans, oldest.Value.(*cachedPlan).query)
+	}
+	return qtype, op, nil
+}
+
+// The statements whose plans are cached, by their first word
+var cacheableStatements = map[string]bool{
+	"select": true,
+	"with":   true,
+}
+
+// Build a new physical plan from the cached plan
+func (cp *cachedPlan) newPlan() (Operator, error) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	return cp.build()
+}
+
+// Return the number of plans in the cache
+func (pc *PlanCache) Len() int {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	pc.checkVersion()
+	return pc.lru.Len()
+}
+
+// Drop all of the cached plans if the catalog has changed since they were
+// built.  The caller must hold pc.mutex.
+func (pc *PlanCache) checkVersion() {
+	if version := pc.c.version.Load(); version != pc.version {
+		pc.plans = make(map[string]*list.Element)
+		pc.lru.Init()
+		pc.version = version
+	}
+}
+
+// Return the text of query with comments removed, runs of whitespace replaced
+// by a single space and unquoted keywords and names, which are case
+// insensitive, in lower case.  Quoted strings and identifiers are left
+// untouched.
+func normalizeQuery(query string) string {
+	var out strings.Builder
+	s := &queryScanner{query, 0}
+	space := false
+	for s.pos < len(query) {
+		typ, text := s.next()
+		if typ == tokSpace {
+			space = true
+			continue
+		}
+		if space && out.Len() > 0 {
+			out.WriteByte(' ')
+		}
+		if typ == tokWord {
+			text = strings.ToLower(text)
+		}
+		out.WriteString(text)
+		space = false
+	}
+	return out.String()
+}
@@ -0,0 +1,229 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Parse sql through the plan cache, failing the test on error
+func parseCachedTestQuery(t *testing.T, pc *PlanCache, sql string) Operator {
+	_, op, err := pc.Parse(sql)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", sql, err.Error())
+	}
+	return op
+}
+
+// Return the cache entry of sql, or nil if it isn't cached
+func cachedTestPlan(pc *PlanCache, sql string) *cachedPlan {
+	pc.mutex.Lock()
+	defer pc.mutex.Unlock()
+	if e := pc.plans[normalizeQuery(sql)]; e != nil {
+		return e.Value.(*cachedPlan)
+	}
+	return nil
+}
+
+func TestPlanCache(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	pc, err := NewPlanCache(c, 10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sql := "select name from t where age > 40 order by name"
+	expected := len(runParserTestQuery(t, c, bp, sql))
+	first := parseCachedTestQuery(t, pc, sql)
+	cached := cachedTestPlan(pc, sql)
+	for _, same := range []string{
+		sql,
+		"SELECT name\n\tFROM T  WHERE age > 40 /* old */ ORDER BY Name",
+		"  select name from t where age > 40 order by name -- sorted\n",
+	} {
+		op := parseCachedTestQuery(t, pc, same)
+		if cachedTestPlan(pc, same) != cached {
+			t.Errorf("expected '%s' to reuse the cached plan", same)
+		}
+		if op == first {
+			t.Errorf("expected '%s' to get a plan of its own built from the cached plan", same)
+		}
+		//the plan built from the cached plan can be run
+		tid := NewTID()
+		bp.BeginTransaction(tid)
+		if tups := collectTuples(t, op, tid); len(tups) != expected {
+			t.Errorf("expected %d tuples, got %d", expected, len(tups))
+		}
+		bp.CommitTransaction(tid)
+	}
+	for _, different := range []string{
+		"select name from t where age > 41 order by name",
+		"select name from t where name = 'SAM' order by name",
+		"select name from t where name = 'sam' order by name",
+	} {
+		parseCachedTestQuery(t, pc, different)
+		if cachedTestPlan(pc, different) == cached {
+			t.Errorf("expected '%s' to have its own plan", different)
+		}
+	}
+	if pc.Len() != 4 {
+		t.Errorf("expected 4 cached plans, got %d", pc.Len())
+	}
+
+	if _, _, err := pc.Parse("select nosuchfield from t"); err == nil {
+		t.Errorf("expected error parsing an invalid query")
+	}
+	if pc.Len() != 4 {
+		t.Errorf("expected failed queries not to be cached, got %d plans", pc.Len())
+	}
+	for _, dml := range []string{"insert into t values ('sam', 25)", "delete from t where age > 40"} {
+		if op := parseCachedTestQuery(t, pc, dml); op == nil {
+			t.Errorf("expected '%s' to be planned", dml)
+		}
+		if cachedTestPlan(pc, dml) != nil {
+			t.Errorf("expected '%s' not to be cached", dml)
+		}
+	}
+	if _, err := NewPlanCache(c, 0); err == nil {
+		t.Errorf("expected error creating an empty cache")
+	}
+}
+
+// Plans built from the same cached plan, of a correlated subquery and of a
+// parallel aggregate, can run at the same time
+func TestPlanCacheConcurrent(t *testing.T) {
+	c, bp, _ := makeParallelTestCatalog(t)
+	pc, err := NewPlanCache(c, 10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, sql := range []string{
+		"select name from t where age = (select max(age) from t2 where t2.name = t.name)",
+		"select name, avg(age) from big group by name",
+	} {
+		expected := sortedTupleStrings(runParserTestQuery(t, c, bp, sql))
+		errs := make(chan error, 8)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			//NewTID isn't safe for concurrent use
+			tids := make([]TransactionID, 5)
+			for j := range tids {
+				tids[j] = NewTID()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, tid := range tids {
+					_, op, err := pc.Parse(sql)
+					if err != nil {
+						errs <- err
+						return
+					}
+					bp.BeginTransaction(tid)
+					tups, err := runWithMemory(op, tid, NewMemoryTracker(0))
+					bp.CommitTransaction(tid)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if out := sortedTupleStrings(tups); !slices.Equal(out, expected) {
+						errs <- fmt.Errorf("expected %v, got %v", expected, out)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("%s: %s", sql, err.Error())
+		}
+	}
+}
+
+func TestPlanCacheEviction(t *testing.T) {
+	c, _ := makeParserTestCatalog(t)
+	pc, err := NewPlanCache(c, 2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	parseCachedTestQuery(t, pc, "select name from t")
+	first := cachedTestPlan(pc, "select name from t")
+	parseCachedTestQuery(t, pc, "select age from t")
+	//using the first plan makes the second the least recently used
+	parseCachedTestQuery(t, pc, "select name from t")
+	parseCachedTestQuery(t, pc, "select name, age from t")
+	if pc.Len() != 2 {
+		t.Errorf("expected 2 cached plans, got %d", pc.Len())
+	}
+	if cachedTestPlan(pc, "select name from t") != first {
+		t.Errorf("expected the recently used plan to be kept")
+	}
+	if cachedTestPlan(pc, "select age from t") != nil {
+		t.Errorf("expected the least recently used plan to be evicted")
+	}
+}
+
+func TestPlanCacheInvalidation(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	pc, err := NewPlanCache(c, 10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sql := "select t.name from t, t2 where t.name = t2.name"
+	parseCachedTestQuery(t, pc, sql)
+	cached := cachedTestPlan(pc, sql)
+
+	//a table is added
+	if qtype, _, err := pc.Parse("create table u (a int)"); err != nil || qtype != CreateTableQueryType {
+		t.Fatalf("failed to create table, %v", err)
+	}
+	if pc.Len() != 0 {
+		t.Errorf("expected plans to be dropped when a table is created, got %d", pc.Len())
+	}
+	parseCachedTestQuery(t, pc, sql)
+	next := cachedTestPlan(pc, sql)
+	if next == nil || next == cached {
+		t.Errorf("expected the query to be planned again after creating a table")
+	}
+	cached = next
+
+	//statistics change
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	collectTuples(t, parseCachedTestQuery(t, pc, "analyze t"), tid)
+	bp.CommitTransaction(tid)
+	if pc.Len() != 0 {
+		t.Errorf("expected plans to be dropped when statistics change, got %d", pc.Len())
+	}
+	parseCachedTestQuery(t, pc, sql)
+	if next = cachedTestPlan(pc, sql); next == nil || next == cached {
+		t.Errorf("expected the query to be planned again after analyze")
+	}
+
+	//a table is dropped
+	parseCachedTestQuery(t, pc, "select a from u")
+	if qtype, _, err := pc.Parse("drop table u"); err != nil || qtype != DropTableQueryType {
+		t.Fatalf("failed to drop table, %v", err)
+	}
+	if _, _, err := pc.Parse("select a from u"); err == nil {
+		t.Errorf("expected error querying a dropped table")
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	queries := map[string]string{
+		"SELECT Name FROM t":                      "select name from t",
+		"  select\tname\n from t  ":               "select name from t",
+		"select a-b, c /* comment */ from t":      "select a-b, c from t",
+		"select 'Sam  I am', \"Name\" from t":     "select 'Sam  I am', \"Name\" from t",
+		"select a from t -- trailing\nwhere a>1":  "select a from t where a>1",
+		"select a from t where a = - -1":          "select a from t where a = - -1",
+		"select a from t where name = 'It''s ok'": "select a from t where name = 'It''s ok'",
+	}
+	for query, expected := range queries {
+		if normalized := normalizeQuery(query); normalized != expected {
+			t.Errorf("'%s': expected '%s', got '%s'", query, expected, normalized)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// A structured description of an operator of a query plan and its children,
+// as output by EXPLAIN.
+type PlanDescription struct {
+	Name       string         `json:"name"`
+	Properties []PlanProperty `json:"properties,omitempty"`
+	// The number of tuples the optimizer estimates the operator outputs
+	EstimatedRows float64 `json:"estimated_rows"`
+	// What the operator did, if the plan was run by [ExplainAnalyze]
+	Actual *OperatorStats `json:"actual,omitempty"`
+	// Set if the plan was run by [ExplainAnalyze], but the operator wasn't
+	// instrumented, as it is below one whose children [Instrument] doesn't
+	// wrap
+	NotInstrumented bool               `json:"not_instrumented,omitempty"`
+	Children        []*PlanDescription `json:"children,omitempty"`
+}
+
+// A named detail of an operator, e.g., the predicate of a filter
+type PlanProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PlanDescriber is implemented by every operator, to describe itself in the
+// output of EXPLAIN.
+type PlanDescriber interface {
+	// Return a description of the operator, without its children (or
+	// estimates), and the children to describe below it, in order
+	DescribePlan() (*PlanDescription, []Operator)
+}
+
+// Return the description of the plan rooted at op, with the number of rows
+// of each operator estimated using the statistics of catalog c (which may be
+// nil, to estimate without statistics).  The stats of instrumented operators
+// (see [Instrument]) are included in the descriptions of the operators they
+// wrap, and the operators below them that weren't instrumented are marked as
+// such.  Operators that don't implement [PlanDescriber] are described by their
+// type, without children.
+func DescribePlan(c *Catalog, op Operator) *PlanDescription {
+	if instrumented, ok := op.(*InstrumentedOp); ok {
+		d := DescribePlan(c, instrumented.child)
+		stats := instrumented.Stats
+		d.Actual = &stats
+		for _, child := range d.Children {
+			child.markNotInstrumented()
+		}
+		return d
+	}
+	describer, ok := op.(PlanDescriber)
+	if !ok {
+		return &PlanDescription{Name: reflect.TypeOf(op).String(), EstimatedRows: estimatePlan(c, op).rows}
+	}
+	d, children := describer.DescribePlan()
+	d.EstimatedRows = estimatePlan(c, op).rows
+	for _, child := range children {
+		d.Children = append(d.Children, DescribePlan(c, child))
+	}
+	return d
+}
+
+// Mark d, and its children, as not instrumented, unless d was instrumented
+func (d *PlanDescription) markNotInstrumented() {
+	if d.Actual != nil {
+		return
+	}
+	d.NotInstrumented = true
+	for _, child := range d.Children {
+		child.markNotInstrumented()
+	}
+}
+
+// Return a description named name with the given properties, which are pairs
+// of names and values; properties with empty values are left out
+func newPlanDescription(name string, props ...string) *PlanDescription {
+	d := &PlanDescription{Name: name}
+	for i := 0; i+1 < len(props); i += 2 {
+		if props[i+1] != "" {
+			d.Properties = append(d.Properties, PlanProperty{props[i], props[i+1]})
+		}
+	}
+	return d
+}
+
+// Describe the keys of an equality join, e.g., "t.a == t2.a, t.b == t2.b"
+func describeJoinKeys(leftFields []Expr, rightFields []Expr) string {
+	keys := make([]string, len(leftFields))
+	for i := range leftFields {
+		keys[i] = exprToStr(leftFields[i]) + " == " + exprToStr(rightFields[i])
+	}
+	return strings.Join(keys, ", ")
+}
+
+// Describe a list of expressions, e.g., "t.a, t.b"
+func describeExprs(exprs []Expr) string {
+	strs := make([]string, len(exprs))
+	for i, e := range exprs {
+		strs[i] = exprToStr(e)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// Describe a sort order, e.g., "t.a asc, t.b desc"
+func describeOrder(exprs []Expr, ascending []bool) string {
+	strs := make([]string, len(exprs))
+	for i, e := range exprs {
+		strs[i] = exprToStr(e) + " asc"
+		if !ascending[i] {
+			strs[i] = exprToStr(e) + " desc"
+		}
+	}
+	return strings.Join(strs, ", ")
+}
+
+// The formats EXPLAIN can output plans in
+type PlanFormat int
+
+const (
+	PlanText PlanFormat = iota // an indented tree, one operator per line
+	PlanJSON PlanFormat = iota // the [PlanDescription] as JSON
+	PlanDOT  PlanFormat = iota // a Graphviz digraph, with an edge to each child
+)
+
+var planFormatNames = map[string]PlanFormat{
+	"text": PlanText,
+	"json": PlanJSON,
+	"dot":  PlanDOT,
+}
+
+// Write the plan described by d to w in the given format
+func WritePlan(w io.Writer, d *PlanDescription, format PlanFormat) error {
+	switch format {
+	case PlanText:
+		return writePlanText(w, d, "")
+	case PlanJSON:
+		buf, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", buf)
+		return err
+	case PlanDOT:
+		if _, err := fmt.Fprintf(w, "digraph plan {\n\tnode [shape=box];\n"); err != nil {
+			return err
+		}
+		n := 0
+		if _, err := writePlanDOT(w, d, &n); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "}\n")
+		return err
+	}
+	return GoDBError{IllegalOperationError, fmt.Sprintf("unknown plan format %d", format)}
+}
+
+// Return the line of text describing d, without indentation
+func (d *PlanDescription) textLine() string {
+	line := d.Name
+	if len(d.Properties) > 0 {
+		props := make([]string, len(d.Properties))
+		for i, p := range d.Properties {
+			props[i] = p.Name + "=" + p.Value
+		}
+		line += " [" + strings.Join(props, ", ") + "]"
+	}
+	line += fmt.Sprintf(" (estimated rows=%.0f", d.EstimatedRows)
+	if d.Actual != nil {
+		line += "; actual " + d.Actual.String()
+	} else if d.NotInstrumented {
+		line += "; not instrumented"
+	}
+	return line + ")"
+}
+
+// Write d and its children to w as lines of text, indenting each child below
+// its parent
+func writePlanText(w io.Writer, d *PlanDescription, indent string) error {
+	if _, err := fmt.Fprintf(w, "%s%s\n", indent, d.textLine()); err != nil {
+		return err
+	}
+	for _, child := range d.Children {
+		if err := writePlanText(w, child, indent+"\t"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quote s as a DOT string
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// Write the nodes of d and its children to w, numbering them from *n, and the
+// edges from each node to its children.  Returns the name of d's node.
+func writePlanDOT(w io.Writer, d *PlanDescription, n *int) (string, error) {
+	name := fmt.Sprintf("n%d", *n)
+	*n++
+	label := d.Name
+	for _, p := range d.Properties {
+		label += "\n" + p.Name + "=" + p.Value
+	}
+	label += fmt.Sprintf("\nestimated rows=%.0f", d.EstimatedRows)
+	if d.Actual != nil {
+		label += "\nactual " + d.Actual.String()
+	} else if d.NotInstrumented {
+		label += "\nnot instrumented"
+	}
+	if _, err := fmt.Fprintf(w, "\t%s [label=%s];\n", name, dotQuote(label)); err != nil {
+		return "", err
+	}
+	for _, child := range d.Children {
+		childName, err := writePlanDOT(w, child, n)
+		if err != nil {
+			return "", err
+		}
+		if _, err := fmt.Fprintf(w, "\t%s -> %s;\n", name, childName); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// The options of an EXPLAIN command
+type ExplainOptions struct {
+	Analyze bool // run the query, see [ExplainAnalyze]
+	Format  PlanFormat
+}
+
+// If query is an EXPLAIN [ANALYZE] [FORMAT=TEXT|JSON|DOT] command, return its
+// options and the query it explains; ok is false if it isn't.
+func ParseExplain(query string) (options ExplainOptions, rest string, ok bool, err error) {
+	s := &queryScanner{query, 0}
+	typ, text := s.nextToken()
+	if typ != tokWord || !strings.EqualFold(text, "explain") {
+		return options, query, false, nil
+	}
+	for {
+		pos := s.pos
+		typ, text = s.nextToken()
+		switch {
+		case typ == tokWord && strings.EqualFold(text, "analyze") && !options.Analyze:
+			options.Analyze = true
+		case typ == tokWord && strings.EqualFold(text, "format"):
+			if _, eq := s.nextToken(); eq != "=" {
+				return options, "", true, GoDBError{ParseError, "expected '=' after format in explain command"}
+			}
+			_, name := s.nextToken()
+			format, found := planFormatNames[strings.ToLower(name)]
+			if !found {
+				return options, "", true, GoDBError{ParseError, fmt.Sprintf("unknown explain format '%s'", name)}
+			}
+			options.Format = format
+		default:
+			return options, strings.TrimSpace(query[pos:]), true, nil
+		}
+	}
+}
+
+// Describe the file a DBFile is stored in
+func describeFile(file DBFile) string {
+	switch file := file.(type) {
+	case *HeapFile:
+		return file.Filename
+	case *ColumnFile:
+		return file.Filename
+	}
+	return reflect.TypeOf(file).String()
+}
@@ -0,0 +1,117 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Parse sql and return the description of its plan
+func describeTestQuery(t *testing.T, c *Catalog, sql string) *PlanDescription {
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", sql, err.Error())
+	}
+	return DescribePlan(c, plan)
+}
+
+func TestDescribePlan(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	d := describeTestQuery(t, c, "select t.name from t, t2 where t.name = t2.name and t.age > 40")
+	if d.Name != "Project" || len(d.Children) != 1 {
+		t.Fatalf("expected project with one child, got %+v", d)
+	}
+	join := d.Children[0]
+	if join.Name != "Hash Join" || len(join.Children) != 2 {
+		t.Fatalf("expected hash join with two children, got %+v", join)
+	}
+	if len(join.Properties) != 1 || join.Properties[0].Name != "keys" || !strings.Contains(join.Properties[0].Value, "t.name") {
+		t.Errorf("expected join keys on t.name, got %+v", join.Properties)
+	}
+	names := map[string]bool{}
+	for _, child := range join.Children {
+		names[child.Name] = true
+		if child.EstimatedRows <= 0 {
+			t.Errorf("expected positive estimate for %s, got %f", child.Name, child.EstimatedRows)
+		}
+	}
+	if !names["Filter"] || !names["Heap Scan"] {
+		t.Errorf("expected filter and scan below join, got %v", names)
+	}
+	if d.Actual != nil {
+		t.Errorf("expected no actual stats for a plan that hasn't run")
+	}
+
+	//estimates use the statistics of analyzed tables
+	runParserTestQuery(t, c, bp, "analyze t")
+	d = describeTestQuery(t, c, "select name from t where age = 99")
+	if filter := d.Children[0]; filter.Name != "Filter" || filter.EstimatedRows != 2 {
+		t.Errorf("expected filter estimated at 2 rows, got %+v", filter)
+	}
+}
+
+func TestWritePlan(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	sql := "select t.name from t, t2 where t.name = t2.name"
+	d := DescribePlan(c, runExplainAnalyze(t, c, bp, sql))
+
+	var buf bytes.Buffer
+	if err := WritePlan(&buf, d, PlanJSON); err != nil {
+		t.Fatalf(err.Error())
+	}
+	var decoded PlanDescription
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("failed to decode plan, %s", err.Error())
+	}
+	if decoded.Name != "Project" || decoded.Actual == nil || decoded.Actual.Rows != d.Actual.Rows || len(decoded.Children[0].Children) != 2 {
+		t.Errorf("expected decoded plan to match, got %+v", decoded)
+	}
+
+	buf.Reset()
+	if err := WritePlan(&buf, d, PlanDOT); err != nil {
+		t.Fatalf(err.Error())
+	}
+	dot := buf.String()
+	if !strings.HasPrefix(dot, "digraph plan {") || strings.Count(dot, "->") != 3 || strings.Count(dot, "label=") != 4 {
+		t.Errorf("expected graph with 4 nodes and 3 edges, got\n%s", dot)
+	}
+
+	buf.Reset()
+	if err := WritePlan(&buf, d, PlanText); err != nil {
+		t.Fatalf(err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "Project [fields=t.name as name]") || !strings.HasPrefix(lines[2], "\t\tHeap Scan") {
+		t.Errorf("unexpected text plan\n%s", buf.String())
+	}
+}
+
+func TestParseExplain(t *testing.T) {
+	commands := map[string]ExplainOptions{
+		"explain select * from t":                      {false, PlanText},
+		"EXPLAIN ANALYZE select * from t":              {true, PlanText},
+		"explain format=json select * from t":          {false, PlanJSON},
+		"explain analyze format = DOT select * from t": {true, PlanDOT},
+		"explain format=text analyze select * from t":  {true, PlanText},
+		"explain /* plan */ analyze select * from t":   {true, PlanText},
+	}
+	for sql, expected := range commands {
+		options, rest, ok, err := ParseExplain(sql)
+		if !ok || err != nil {
+			t.Errorf("failed to parse '%s': %v", sql, err)
+			continue
+		}
+		if options != expected || rest != "select * from t" {
+			t.Errorf("'%s': expected %+v, got %+v and query '%s'", sql, expected, options, rest)
+		}
+	}
+	if _, rest, ok, _ := ParseExplain("select * from t"); ok || rest != "select * from t" {
+		t.Errorf("expected select not to be an explain command")
+	}
+	for _, sql := range []string{"explain format=xml select * from t", "explain format json select * from t"} {
+		if _, _, _, err := ParseExplain(sql); err == nil {
+			t.Errorf("expected error for '%s'", sql)
+		}
+	}
+}
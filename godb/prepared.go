@@ -0,0 +1,217 @@
+package godb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParamExpr is a placeholder of a prepared statement, e.g., $1, whose value
+// is bound each time the statement is executed; see [Prepare].
+type ParamExpr struct {
+	index int // numbered from 1
+	ftype DBType
+	val   DBValue
+}
+
+func (p *ParamExpr) EvalExpr(_ *Tuple) (DBValue, error) {
+	if p.val == nil {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("placeholder $%d is unbound", p.index)}
+	}
+	return p.val, nil
+}
+
+func (p *ParamExpr) GetExprType() FieldType {
+	return FieldType{fmt.Sprintf("$%d", p.index), "", p.ftype}
+}
+
+// PreparedStatement is a query, insert or delete that is parsed once by
+// [Prepare] and run any number of times with different values for its
+// placeholders.  Placeholders are written either ? (numbered in the order
+// they appear) or $1, $2, ... (which may be repeated), but not both, and stand
+// for values, e.g., in comparisons, select lists, limits and inserted tuples,
+// not for the names of tables or fields.
+//
+// Whether a plan compares ints or strings depends on the types of the values,
+// so the logical plan of the statement is built the first time it is executed
+// with values of each combination of types and cached, like the plans of a
+// [PlanCache], and dropped when the catalog changes.  Each execution builds a
+// new physical plan from the cached plan with its own placeholders bound to
+// its values, so the plans returned by [PreparedStatement.Execute] may be run
+// while the statement is executed again.  A statement is not safe for
+// concurrent use.
+type PreparedStatement struct {
+	c         *Catalog
+	query     string // with placeholders rewritten by [rewritePlaceholders]
+	numParams int
+	version   int64                    // of the catalog when the cached plans were built
+	plans     map[string]*preparedPlan // by the types of the values bound to them
+}
+
+// A plan of a prepared statement and the placeholders its physical plans are
+// built with, in order, which are replaced before building each plan
+type preparedPlan struct {
+	build  planBuilder
+	params []*ParamExpr
+}
+
+// The statements that can be prepared, by their first word
+var preparableStatements = map[string]bool{
+	"select": true,
+	"with":   true,
+	"insert": true,
+	"delete": true,
+}
+
+// Prepare the query, insert or delete in sql, with placeholders for values,
+// for execution against catalog c (see [PreparedStatement]).  Statements
+// without placeholders are planned right away; others when first executed, so
+// errors other than syntax errors in the placeholders may only be reported by
+// [PreparedStatement.Execute].
+func Prepare(c *Catalog, sql string) (*PreparedStatement, error) {
+	s := &queryScanner{sql, 0}
+	typ, text := s.nextToken()
+	for typ == tokOther && text == "(" {
+		typ, text = s.nextToken()
+	}
+	if typ != tokWord || !preparableStatements[strings.ToLower(text)] {
+		return nil, GoDBError{ParseError, "only queries, inserts and deletes can be prepared"}
+	}
+	query, n, err := rewritePlaceholders(sql)
+	if err != nil {
+		return nil, err
+	}
+	stmt := &PreparedStatement{c, query, n, c.version.Load(), make(map[string]*preparedPlan)}
+	if n == 0 {
+		if _, err := stmt.Execute(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// Return the number of values the statement must be executed with
+func (s *PreparedStatement) NumParams() int {
+	return s.numParams
+}
+
+// Bind the placeholders of the statement to args, in order, and return a new
+// plan of it, which may then be run like a plan returned by [Parse].  Values
+// may be ints, int64s or strings, or an [IntField] or [StringField].
+func (s *PreparedStatement) Execute(args ...any) (Operator, error) {
+	if len(args) != s.numParams {
+		return nil, GoDBError{ParseError, fmt.Sprintf("statement has %d placeholders, but got %d values", s.numParams, len(args))}
+	}
+	vals := make([]DBValue, len(args))
+	var types strings.Builder
+	for i, arg := range args {
+		v, err := toDBValue(arg)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+		if _, ok := v.(IntField); ok {
+			types.WriteByte('i')
+		} else {
+			types.WriteByte('s')
+		}
+	}
+	if version := s.c.version.Load(); version != s.version {
+		s.plans = make(map[string]*preparedPlan)
+		s.version = version
+	}
+	plan := s.plans[types.String()]
+	if plan == nil {
+		var err error
+		plan, err = s.plan(vals)
+		if err != nil {
+			return nil, err
+		}
+		s.plans[types.String()] = plan
+	}
+	//the plan is built with new placeholders, so that plans returned earlier
+	//keep their values
+	for i, p := range plan.params {
+		plan.params[i] = &ParamExpr{p.index, p.ftype, vals[i]}
+	}
+	return plan.build()
+}
+
+// Build the plan of the statement for values of the types of vals
+func (s *PreparedStatement) plan(vals []DBValue) (*preparedPlan, error) {
+	params := make([]*ParamExpr, len(vals))
+	for i, v := range vals {
+		ftype := IntType
+		if _, ok := v.(StringField); ok {
+			ftype = StringType
+		}
+		params[i] = &ParamExpr{i + 1, ftype, nil}
+	}
+	qtype, build, err := parseQuery(s.c.withParams(params), s.query)
+	if err != nil {
+		return nil, err
+	}
+	if qtype != IteratorType || build == nil {
+		return nil, GoDBError{ParseError, "only queries, inserts and deletes can be prepared"}
+	}
+	return &preparedPlan{build, params}, nil
+}
+
+// Convert a value passed to [PreparedStatement.Execute] to the value it binds
+// a placeholder to
+func toDBValue(arg any) (DBValue, error) {
+	switch arg := arg.(type) {
+	case int:
+		return IntField{int64(arg)}, nil
+	case int32:
+		return IntField{int64(arg)}, nil
+	case int64:
+		return IntField{arg}, nil
+	case string:
+		return StringField{arg}, nil
+	case IntField:
+		return arg, nil
+	case StringField:
+		return arg, nil
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("unsupported value %v of type %T for placeholder", arg, arg)}
+}
+
+// Rewrite the placeholders of a prepared statement, ? or $1, $2, ..., to the
+// form the sql parser understands, :v1, :v2, ..., returning the rewritten query
+// and the number of values it takes.  Quoted strings, identifiers and
+// comments are left untouched.
+func rewritePlaceholders(query string) (string, int, error) {
+	var out strings.Builder
+	n := 0
+	positional, numbered := false, false
+	s := &queryScanner{query, 0}
+	for s.pos < len(query) {
+		typ, text := s.next()
+		switch {
+		case typ == tokOther && text == "?":
+			positional = true
+			n++
+			text = fmt.Sprintf(":v%d", n)
+		case typ == tokWord && text[0] == '$':
+			i, err := strconv.Atoi(text[1:])
+			if err != nil {
+				//an identifier starting with $
+				break
+			}
+			if i < 1 {
+				return "", 0, GoDBError{ParseError, fmt.Sprintf("placeholder %s must be numbered from 1", text)}
+			}
+			numbered = true
+			if i > n {
+				n = i
+			}
+			text = fmt.Sprintf(":v%d", i)
+		}
+		out.WriteString(text)
+	}
+	if positional && numbered {
+		return "", 0, GoDBError{ParseError, "placeholders ? and $1, $2, ... can't be mixed in a statement"}
+	}
+	return out.String(), n, nil
+}
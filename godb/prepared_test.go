@@ -0,0 +1,204 @@
+package godb
+
+import (
+	"context"
+	"testing"
+)
+
+// Execute the prepared statement with args and run its plan in its own
+// transaction, returning the tuples it produces
+func runPreparedTestStatement(t *testing.T, bp *BufferPool, stmt *PreparedStatement, args ...any) []*Tuple {
+	plan, err := stmt.Execute(args...)
+	if err != nil {
+		t.Fatalf("failed to execute with %v, %s", args, err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	return collectTuples(t, plan, tid)
+}
+
+// Execute the prepared insert or delete with args in its own transaction,
+// returning the number of tuples it inserted or deleted
+func runPreparedTestModification(t *testing.T, bp *BufferPool, stmt *PreparedStatement, args ...any) int64 {
+	plan, err := stmt.Execute(args...)
+	if err != nil {
+		t.Fatalf("failed to execute with %v, %s", args, err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	iter, err := plan.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return tup.Fields[0].(IntField).Value
+}
+
+func TestPreparedStatement(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	stmt, err := Prepare(c, "select name from t where age > ? and name <> ?")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if stmt.NumParams() != 2 {
+		t.Errorf("expected 2 placeholders, got %d", stmt.NumParams())
+	}
+	executions := []struct {
+		args []any
+		sql  string
+	}{
+		{[]any{40, "sam"}, "select name from t where age > 40 and name <> 'sam'"},
+		{[]any{int64(25), "bo"}, "select name from t where age > 25 and name <> 'bo'"},
+		{[]any{IntField{90}, StringField{"x"}}, "select name from t where age > 90 and name <> 'x'"},
+	}
+	var first *preparedPlan
+	for _, ex := range executions {
+		expected := len(runParserTestQuery(t, c, bp, ex.sql))
+		if tups := runPreparedTestStatement(t, bp, stmt, ex.args...); len(tups) != expected {
+			t.Errorf("%v: expected %d tuples, got %d", ex.args, expected, len(tups))
+		}
+		//values of the same types are bound to plans built from the same
+		//cached plan
+		if first == nil {
+			first = stmt.plans["is"]
+		} else if stmt.plans["is"] != first {
+			t.Errorf("%v: expected the cached plan to be reused", ex.args)
+		}
+	}
+
+	//a plan keeps its values when the statement is executed again
+	plan, err := stmt.Execute(40, "sam")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if next, _ := stmt.Execute(90, "x"); next == plan {
+		t.Errorf("expected each execution to get a plan of its own")
+	}
+	expected := len(runParserTestQuery(t, c, bp, executions[0].sql))
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	if tups := collectTuples(t, plan, tid); len(tups) != expected {
+		t.Errorf("expected a plan executed earlier to keep its values, got %d tuples, expected %d", len(tups), expected)
+	}
+	bp.CommitTransaction(tid)
+
+	//the statement is planned again when the catalog changes
+	if err := c.addTable("u", TupleDesc{[]FieldType{{Fname: "a", Ftype: IntType}}}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runPreparedTestStatement(t, bp, stmt, 40, "sam")
+	if stmt.plans["is"] == first {
+		t.Errorf("expected the statement to be planned again after the catalog changed")
+	}
+
+	if _, err := stmt.Execute(40); err == nil {
+		t.Errorf("expected error executing with too few values")
+	}
+	if _, err := stmt.Execute(40, 1.5); err == nil {
+		t.Errorf("expected error executing with a float")
+	}
+	//a string compared with an int age
+	if _, err := stmt.Execute("old", "sam"); err == nil {
+		t.Errorf("expected error comparing age with a string")
+	}
+}
+
+func TestPreparedStatementPlaceholders(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	statements := []struct {
+		sql      string
+		args     []any
+		expected int
+	}{
+		{"select name, $2 from t where age > $1 and age < $1 + 20", []any{40, "x"}, 3},
+		{"select name from t order by name limit ? offset ?", []any{3, 1}, 3},
+		{"select name from t where name in (select name from t2 where age > ?)", []any{90}, 3},
+		{"with old as (select name, age from t where age > ?) select name from old", []any{50}, 3},
+		{"select name from t where name <> '?' and name = ?", []any{"sam"}, 2},
+	}
+	for _, s := range statements {
+		stmt, err := Prepare(c, s.sql)
+		if err != nil {
+			t.Errorf("failed to prepare '%s', %s", s.sql, err.Error())
+			continue
+		}
+		if tups := runPreparedTestStatement(t, bp, stmt, s.args...); len(tups) != s.expected {
+			t.Errorf("'%s': expected %d tuples, got %d", s.sql, s.expected, len(tups))
+		}
+	}
+}
+
+func TestPreparedStatementModifications(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	makeOrgChartTable(t, c, bp)
+	insert, err := Prepare(c, "insert into emp values (?, ?)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, name := range []string{"gus", "hal"} {
+		if n := runPreparedTestModification(t, bp, insert, name, "fay"); n != 1 {
+			t.Errorf("expected 1 tuple inserted, got %d", n)
+		}
+	}
+	count, err := Prepare(c, "select count(*) from emp where manager = $1")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tups := runPreparedTestStatement(t, bp, count, "fay"); tups[0].Fields[0].(IntField).Value != 2 {
+		t.Errorf("expected 2 inserted employees, got %v", tups[0])
+	}
+
+	del, err := Prepare(c, "delete from emp where name = ?")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := runPreparedTestModification(t, bp, del, "gus"); n != 1 {
+		t.Errorf("expected 1 tuple deleted, got %d", n)
+	}
+	if tups := runPreparedTestStatement(t, bp, count, "fay"); tups[0].Fields[0].(IntField).Value != 1 {
+		t.Errorf("expected 1 employee after delete, got %v", tups[0])
+	}
+}
+
+func TestPrepareErrors(t *testing.T) {
+	c, _ := makeParserTestCatalog(t)
+	for _, sql := range []string{
+		"create table u (a int)",
+		"begin",
+		"select name from t where age > ? and age < $1",
+		"select name from t where age > $0",
+		"select name from nosuchtable",
+	} {
+		if _, err := Prepare(c, sql); err == nil {
+			t.Errorf("expected error preparing '%s'", sql)
+		}
+	}
+	//placeholders are only bound in prepared statements
+	if _, _, err := Parse(c, "select name from t where age > ?"); err == nil {
+		t.Errorf("expected error parsing a placeholder")
+	}
+}
+
+func TestRewritePlaceholders(t *testing.T) {
+	rewrites := map[string]struct {
+		query string
+		n     int
+	}{
+		"select * from t where a = ? and b = ?":       {"select * from t where a = :v1 and b = :v2", 2},
+		"select * from t where a = $2 and b = $1":     {"select * from t where a = :v2 and b = :v1", 2},
+		"select $1, $1 from t":                        {"select :v1, :v1 from t", 1},
+		"select '?', \"$1\" from t /* ? */ where a=?": {"select '?', \"$1\" from t /* ? */ where a=:v1", 1},
+		"select $x from t":                            {"select $x from t", 0},
+	}
+	for query, expected := range rewrites {
+		rewritten, n, err := rewritePlaceholders(query)
+		if err != nil || rewritten != expected.query || n != expected.n {
+			t.Errorf("'%s': expected '%s' with %d placeholders, got '%s' with %d (%v)", query, expected.query, expected.n, rewritten, n, err)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package godb
 
 import (
+	"context"
 	"errors"
+	"strings"
 )
 
 type Project struct {
@@ -37,54 +39,46 @@ func (p *Project) Descriptor() *TupleDesc {
 	return &TupleDesc{Fields: fields}
 }
 
+func (p *Project) DescribePlan() (*PlanDescription, []Operator) {
+	fields := make([]string, len(p.selectFields))
+	for i, e := range p.selectFields {
+		fields[i] = exprToStr(e) + " as " + p.outputNames[i]
+	}
+	distinct := ""
+	if p.distinct {
+		distinct = "true"
+	}
+	return newPlanDescription("Project", "fields", strings.Join(fields, ", "), "distinct", distinct), []Operator{p.child}
+}
+
 // Project operator implementation.  This function should iterate over the
 // results of the child iterator, projecting out the fields from each tuple. In
-// the case of distinct projection, duplicate tuples should be removed.
-// To implement this you will need to record in some data structure with the
-// distinct tuples seen so far.  Note that support for the distinct keyword is
-// optional as specified in the lab 2 assignment.
-func (p *Project) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
-	iter, err := p.child.Iterator(tid)
-	//i := 0
+// the case of distinct projection, duplicate tuples are removed by a hash-based
+// [Distinct] operator over the projected tuples.
+func (p *Project) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	if p.distinct {
+		return NewDistinct(&Project{p.selectFields, p.outputNames, p.child, false}).Iterator(ctx, tid)
+	}
+	iter, err := p.child.Iterator(ctx, tid)
 	if err != nil {
 		return nil, err
 	}
-	var seen []*Tuple
+	desc := p.Descriptor()
 
 	return func() (*Tuple, error) {
-		for {
-			t, err := iter()
-			if t == nil {
-				return nil, nil
-			}
+		t, err := iter()
+		if err != nil || t == nil {
+			return nil, err
+		}
+
+		projected := make([]DBValue, len(p.selectFields))
+		for i, expr := range p.selectFields {
+			field, err := expr.EvalExpr(t)
 			if err != nil {
 				return nil, err
 			}
-
-			projected := make([]DBValue, len(p.selectFields))
-			for i, expr := range p.selectFields {
-				field, err := expr.EvalExpr(t)
-				if err != nil {
-					return nil, err
-				}
-				projected[i] = field
-			}
-
-			tt := &Tuple{Desc: *p.Descriptor(), Fields: projected}
-			if p.distinct {
-				sawT := false
-				for _, seenT := range seen {
-					if tt.equals(seenT) {
-						sawT = true
-						break
-					}
-				}
-				if sawT {
-					continue
-				}
-				seen = append(seen, tt)
-			}
-			return tt, nil
+			projected[i] = field
 		}
+		return &Tuple{Desc: *desc, Fields: projected}, nil
 	}, nil
 }
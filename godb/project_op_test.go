@@ -1,13 +1,14 @@
 package godb
 
 import (
+	"context"
 	"testing"
 )
 
 func TestProject(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 	//fs := make([]FieldType, 1)
 	//fs[0] = t1.Desc.Fields[0]
 	var outNames []string = make([]string, 1)
@@ -17,7 +18,7 @@ func TestProject(t *testing.T) {
 	if proj == nil {
 		t.Fatalf("project was nil")
 	}
-	iter, _ := proj.Iterator(tid)
+	iter, _ := proj.Iterator(context.Background(), tid)
 	if iter == nil {
 		t.Fatalf("iter was nil")
 	}
@@ -31,12 +32,23 @@ func TestProject(t *testing.T) {
 
 }
 
+func TestProjectChildError(t *testing.T) {
+	_, t1, t2, hf, _, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	proj, err := NewProjectOp([]Expr{&FieldExpr{t1.Desc.Fields[0]}}, []string{"outf"}, false, &failingOp{hf, 1})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expectChildError(t, proj, tid, 1)
+}
+
 func TestProjectDistinctOptional(t *testing.T) {
 	_, t1, t2, hf, _, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
-	hf.insertTuple(&t1, tid)
-	hf.insertTuple(&t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
 
 	//fs := make([]FieldType, 1)
 	//fs[0] = t1.Desc.Fields[0]
@@ -47,7 +59,7 @@ func TestProjectDistinctOptional(t *testing.T) {
 	if proj == nil {
 		t.Fatalf("project was nil")
 	}
-	iter, _ := proj.Iterator(tid)
+	iter, _ := proj.Iterator(context.Background(), tid)
 	if iter == nil {
 		t.Fatalf("iter was nil")
 	}
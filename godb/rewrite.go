@@ -0,0 +1,606 @@
+package godb
+
+import (
+	"slices"
+	"strconv"
+)
+
+// Rewrites of logical plans, applied by [rewritePlan] after a query is parsed
+// and before its physical plan is built.  Each rule rewrites a single level of
+// a plan, whose subplans are rewritten separately, and reports whether it
+// changed anything, so that the rules can be applied (and tested) one at a
+// time.
+type rewriteRule struct {
+	name    string
+	rewrite func(c *Catalog, plan *LogicalPlan) bool
+}
+
+// The rules applied to every query, in order
+var defaultRewriteRules = []rewriteRule{
+	{"fold constants", foldConstants},
+	{"push filters into subqueries", pushFiltersIntoSubqueries},
+	{"eliminate redundant sorts", eliminateRedundantSorts},
+	{"prune columns", pruneColumns},
+}
+
+// The most passes of the rules over one level of a plan.  Every rewrite
+// removes something from the level it applies to, so this is only reached if
+// a rule misbehaves.
+const maxRewritePasses = 10
+
+// Apply the rules to plan until none of them change it, then to each of its
+// subplans.  Subplans are rewritten after the plans containing them, as rules
+// may push work into them or prune their output.
+func rewritePlan(c *Catalog, plan *LogicalPlan, rules []rewriteRule) {
+	for pass := 0; pass < maxRewritePasses; pass++ {
+		changed := false
+		for _, r := range rules {
+			if r.rewrite(c, plan) {
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	for _, sub := range plan.subplans() {
+		rewritePlan(c, sub, rules)
+	}
+}
+
+// Return the plans nested in p: its FROM subqueries, the inputs of its set
+// operation or recursive query, and its WHERE subqueries
+func (p *LogicalPlan) subplans() []*LogicalPlan {
+	plans := append([]*LogicalPlan{}, p.subqueries...)
+	if p.setOp != nil {
+		plans = append(plans, p.setOp.left, p.setOp.right)
+	}
+	if p.recursive != nil {
+		plans = append(plans, p.recursive.anchor, p.recursive.recursive)
+	}
+	for _, fs := range [][]*LogicalFilterNode{p.filters, p.having} {
+		for _, f := range fs {
+			if f.subquery != nil {
+				plans = append(plans, f.subquery.plan)
+			}
+		}
+	}
+	return plans
+}
+
+// Return the expressions of p itself, but not those of its subplans.  The
+// aggregates and window functions of a plan are part of its other
+// expressions, so aren't returned separately.
+func (p *LogicalPlan) exprs() []*LogicalSelectNode {
+	var exprs []*LogicalSelectNode
+	for _, fs := range [][]*LogicalFilterNode{p.filters, p.having} {
+		for _, f := range fs {
+			exprs = append(exprs, &f.left, &f.right)
+			if f.subquery != nil {
+				exprs = append(exprs, f.subquery.outerKeys...)
+			}
+		}
+	}
+	for _, j := range p.joins {
+		exprs = append(exprs, j.left, j.right)
+	}
+	exprs = append(exprs, p.selects...)
+	for _, gby := range p.groupByFields {
+		exprs = append(exprs, gby.expr)
+	}
+	for _, oby := range p.orderByFields {
+		exprs = append(exprs, oby.expr)
+	}
+	for _, e := range []*LogicalSelectNode{p.limit, p.offset} {
+		if e != nil {
+			exprs = append(exprs, e)
+		}
+	}
+	return exprs
+}
+
+// Call fn on e and on each expression nested in it
+func visitExpr(e *LogicalSelectNode, fn func(*LogicalSelectNode)) {
+	fn(e)
+	for _, arg := range e.args {
+		visitExpr(arg, fn)
+	}
+	if e.window != nil {
+		for _, pby := range e.window.partitionBy {
+			visitExpr(pby, fn)
+		}
+		for _, oby := range e.window.orderBy {
+			visitExpr(oby.expr, fn)
+		}
+	}
+}
+
+// Return a copy of e that shares none of its nested expressions
+func copyExpr(e *LogicalSelectNode) LogicalSelectNode {
+	copied := *e
+	copied.args = make([]*LogicalSelectNode, len(e.args))
+	for i, arg := range e.args {
+		argCopy := copyExpr(arg)
+		copied.args[i] = &argCopy
+	}
+	return copied
+}
+
+// Return the name of the field the select list expression e is output as,
+// or "" if it isn't known before the physical plan is built
+func outputName(e *LogicalSelectNode) string {
+	if e.alias != "" {
+		return e.alias
+	}
+	switch e.exprType {
+	case ExprField:
+		return e.field
+	case ExprConst:
+		return e.value
+	case ExprFunc, ExprWindow:
+		return *e.funcOp
+	}
+	return ""
+}
+
+// Replace calls of functions whose arguments are all constants with their
+// results, e.g., 60 * 60 with 3600, so that they are computed once rather
+// than for every tuple (and a limit of 2 + 3 can use a top n).  Functions
+// without arguments, such as rand, aren't folded, as they may return a
+// different value each time they are called.
+func foldConstants(c *Catalog, plan *LogicalPlan) bool {
+	changed := false
+	for _, e := range plan.exprs() {
+		//keep the name of output fields, which for functions is theirs
+		name := outputName(e)
+		if foldExpr(e) {
+			changed = true
+			if e.exprType == ExprConst && e.alias == "" && slices.Contains(plan.selects, e) {
+				e.alias = name
+			}
+		}
+	}
+	return changed
+}
+
+// Fold the constant function calls in e, innermost first, returning true if
+// any were folded
+func foldExpr(e *LogicalSelectNode) bool {
+	changed := false
+	for _, arg := range e.args {
+		if foldExpr(arg) {
+			changed = true
+		}
+	}
+	if e.window != nil {
+		for _, pby := range e.window.partitionBy {
+			if foldExpr(pby) {
+				changed = true
+			}
+		}
+		for _, oby := range e.window.orderBy {
+			if foldExpr(oby.expr) {
+				changed = true
+			}
+		}
+	}
+	if e.exprType != ExprFunc || len(e.args) == 0 {
+		return changed
+	}
+	for _, arg := range e.args {
+		if arg.exprType != ExprConst {
+			return changed
+		}
+	}
+	if op := *e.funcOp; op == "/" || op == "mod" {
+		//leave dividing by zero to fail when the query runs
+		if divisor, err := strconv.Atoi(e.args[1].value); err == nil && divisor == 0 {
+			return changed
+		}
+	}
+	expr, _, err := e.generateExpr(nil, nil, nil)
+	if err != nil {
+		return changed
+	}
+	v, err := expr.EvalExpr(nil)
+	if err != nil {
+		return changed
+	}
+	var value string
+	switch v := v.(type) {
+	case IntField:
+		value = strconv.FormatInt(v.Value, 10)
+	case StringField:
+		//constants that look like numbers are ints
+		if _, err := strconv.Atoi(v.Value); err == nil {
+			return changed
+		}
+		value = v.Value
+	default:
+		return changed
+	}
+	*e = NewConstSelectNode(value, e.alias)
+	return true
+}
+
+// Move filters that only reference the output of one of the plan's FROM
+// subqueries into that subquery, rewritten in terms of its select list, so
+// that they are applied before its joins (or pushed further down, into its own
+// subqueries).  Filters aren't pushed into subqueries whose output depends on
+// which of their tuples are filtered, i.e., those with aggregates, window
+// functions or a limit, or into set operations.
+func pushFiltersIntoSubqueries(c *Catalog, plan *LogicalPlan) bool {
+	changed := false
+	var kept []*LogicalFilterNode
+	for _, f := range plan.filters {
+		if sub, pushed := pushableFilter(c, plan, f); pushed != nil {
+			sub.filters = append(sub.filters, pushed)
+			changed = true
+			continue
+		}
+		kept = append(kept, f)
+	}
+	plan.filters = kept
+	return changed
+}
+
+// If f only references the output of one of plan's FROM subqueries, return
+// that subquery and f rewritten to filter the subquery's tables; otherwise
+// return nils
+func pushableFilter(c *Catalog, plan *LogicalPlan, f *LogicalFilterNode) (*LogicalPlan, *LogicalFilterNode) {
+	if f.subquery != nil {
+		return nil, nil
+	}
+	var sub *LogicalPlan
+	for _, side := range []*LogicalSelectNode{&f.left, &f.right} {
+		simple := true
+		visitExpr(side, func(e *LogicalSelectNode) {
+			if e.exprType != ExprField && e.exprType != ExprConst && e.exprType != ExprParam && e.exprType != ExprFunc {
+				simple = false
+			}
+		})
+		if !simple {
+			return nil, nil
+		}
+		for _, ref := range fieldRefs(side) {
+			tab, err := checkNameInTablesOrSubqueries(ref.table, ref.field, c, plan.subqueries, plan.tables)
+			if err != nil {
+				return nil, nil
+			}
+			refSub := plan.findSubquery(tab)
+			if refSub == nil || (sub != nil && refSub != sub) {
+				return nil, nil
+			}
+			sub = refSub
+		}
+	}
+	if sub == nil || !sub.filterable() {
+		return nil, nil
+	}
+	outputs := sub.outputExprs()
+	if outputs == nil {
+		return nil, nil
+	}
+	left, okLeft := substituteOutputs(&f.left, outputs)
+	right, okRight := substituteOutputs(&f.right, outputs)
+	if !okLeft || !okRight {
+		return nil, nil
+	}
+	pushed := &LogicalFilterNode{left: left, right: right, predOp: f.predOp}
+
+	//filters are applied to a single table (or subquery) of a plan, so the
+	//rewritten filter can't span several
+	tab := ""
+	for _, ref := range append(fieldRefs(&pushed.left), fieldRefs(&pushed.right)...) {
+		refTab, err := checkNameInTablesOrSubqueries(ref.table, ref.field, c, sub.subqueries, sub.tables)
+		if err != nil || refTab == "" || (tab != "" && refTab != tab) {
+			return nil, nil
+		}
+		tab = refTab
+	}
+	return sub, pushed
+}
+
+// Return the FROM subquery of p with the given alias, or nil if there is none
+func (p *LogicalPlan) findSubquery(alias string) *LogicalPlan {
+	for _, sub := range p.subqueries {
+		if alias != "" && sub.alias == alias {
+			return sub
+		}
+	}
+	return nil
+}
+
+// Return true if filtering the output of p is the same as filtering the
+// tuples of its tables
+func (p *LogicalPlan) filterable() bool {
+	return p.setOp == nil && p.recursive == nil && p.workTable == nil &&
+		len(p.aggs) == 0 && len(p.groupByFields) == 0 && len(p.windows) == 0 &&
+		p.limit == nil && p.offset == nil
+}
+
+// Return the expressions p outputs, by the name of the field they are output
+// as; names output more than once map to nil.  The fields selected by * are
+// those of p's tables.  Returns nil if the names aren't known, because p
+// selects * from a subquery.
+func (p *LogicalPlan) outputExprs() map[string]*LogicalSelectNode {
+	outputs := make(map[string]*LogicalSelectNode)
+	add := func(name string, e *LogicalSelectNode) {
+		if _, ok := outputs[name]; ok {
+			outputs[name] = nil
+		} else {
+			outputs[name] = e
+		}
+	}
+	for _, s := range p.selects {
+		if s.exprType != ExprStar {
+			if name := outputName(s); name != "" {
+				add(name, s)
+			}
+			continue
+		}
+		if len(p.subqueries) > 0 {
+			return nil
+		}
+		for _, t := range p.tables {
+			name := t.tableName
+			if t.alias != "" {
+				name = t.alias
+			}
+			for _, f := range (*t.file).Descriptor().Fields {
+				field := NewFieldSelectNode(name, f.Fname, "")
+				add(f.Fname, &field)
+			}
+		}
+	}
+	return outputs
+}
+
+// Return a copy of e with its field references replaced by the expressions
+// they name in outputs; false if one of them isn't in outputs
+func substituteOutputs(e *LogicalSelectNode, outputs map[string]*LogicalSelectNode) (LogicalSelectNode, bool) {
+	if e.exprType == ExprField {
+		out := outputs[e.field]
+		if out == nil {
+			return LogicalSelectNode{}, false
+		}
+		//the alias names the subquery's output, not the field it reads
+		copied := copyExpr(out)
+		copied.alias = ""
+		return copied, true
+	}
+	copied := *e
+	copied.args = make([]*LogicalSelectNode, len(e.args))
+	for i, arg := range e.args {
+		argCopy, ok := substituteOutputs(arg, outputs)
+		if !ok {
+			return LogicalSelectNode{}, false
+		}
+		copied.args[i] = &argCopy
+	}
+	return copied, true
+}
+
+// Remove sorts and duplicate eliminations whose effect can't be observed: the
+// order by of a FROM or WHERE subquery without a limit, as the order of a
+// subquery's output isn't preserved; the distinct of an IN or EXISTS
+// subquery, which only tests whether some tuple matches; the distinct of a
+// plan that outputs each of its groups once; and the order by of a plan that
+// outputs a single aggregate tuple.
+func eliminateRedundantSorts(c *Catalog, plan *LogicalPlan) bool {
+	changed := false
+	unordered := func(sub *LogicalPlan) {
+		if len(sub.orderByFields) > 0 && sub.limit == nil && sub.offset == nil {
+			sub.orderByFields = nil
+			changed = true
+		}
+	}
+	for _, sub := range plan.subqueries {
+		unordered(sub)
+	}
+	for _, fs := range [][]*LogicalFilterNode{plan.filters, plan.having} {
+		for _, f := range fs {
+			if f.subquery == nil {
+				continue
+			}
+			unordered(f.subquery.plan)
+			if f.subquery.kind != ScalarSubquery && f.subquery.plan.distinct {
+				f.subquery.plan.distinct = false
+				changed = true
+			}
+		}
+	}
+	if plan.distinct && plan.outputsDistinctGroups() {
+		plan.distinct = false
+		changed = true
+	}
+	if len(plan.orderByFields) > 0 && len(plan.aggs) > 0 && len(plan.groupByFields) == 0 {
+		plan.orderByFields = nil
+		changed = true
+	}
+	return changed
+}
+
+// Return true if p aggregates its tuples into groups and outputs each group
+// once, identified by its group by fields (or, without a group by, outputs a
+// single tuple)
+func (p *LogicalPlan) outputsDistinctGroups() bool {
+	if len(p.aggs) == 0 && len(p.groupByFields) == 0 {
+		return false
+	}
+	for _, gby := range p.groupByFields {
+		selected := false
+		for _, s := range p.selects {
+			if s.exprType != ExprStar && s.equivalent(gby.expr) {
+				selected = true
+			}
+		}
+		if !selected {
+			return false
+		}
+	}
+	return true
+}
+
+// The columns referenced by a set of expressions
+type columnRef struct {
+	table, field string // table is "" for unqualified references
+}
+type columnRefs map[columnRef]bool
+
+// The reference of select *, to all columns
+var allColumns = columnRef{"", "*"}
+
+// Add the columns referenced by e.  If stars is false, select * isn't
+// counted, e.g., because it selects from another plan's tables.
+func (refs columnRefs) addExpr(e *LogicalSelectNode, stars bool) {
+	visitExpr(e, func(e *LogicalSelectNode) {
+		switch e.exprType {
+		case ExprField, ExprCorrelated:
+			//count(*) is a reference to * that doesn't need any column
+			if e.field != "*" {
+				refs[columnRef{e.table, e.field}] = true
+			}
+		case ExprStar:
+			if stars {
+				refs[allColumns] = true
+			}
+		}
+	})
+}
+
+// Add the columns referenced by p, and the fields referenced by its subplans
+// other than skip (which may be nil), as they may refer to p's tables
+func (refs columnRefs) addPlan(p *LogicalPlan, skip *LogicalPlan) {
+	for _, e := range p.exprs() {
+		refs.addExpr(e, true)
+	}
+	for _, sub := range p.subplans() {
+		if sub != skip {
+			refs.addFields(sub)
+		}
+	}
+}
+
+// Add the fields referenced by p and all of its subplans
+func (refs columnRefs) addFields(p *LogicalPlan) {
+	for _, e := range p.exprs() {
+		refs.addExpr(e, false)
+	}
+	for _, sub := range p.subplans() {
+		refs.addFields(sub)
+	}
+}
+
+// Return true if the field of the table (or subquery) named table may be
+// referenced
+func (refs columnRefs) uses(table string, field string) bool {
+	return refs[allColumns] || refs[columnRef{"", field}] || refs[columnRef{table, field}]
+}
+
+// Remove the columns the plan doesn't use from the select lists of its FROM
+// subqueries, and record which columns of each of its tables it uses.  Only
+// those columns are read from files that store each column separately (see
+// [ColumnFile.ColumnIterator]); heap files store whole tuples on each page, so
+// reading fewer of their columns saves nothing.
+func pruneColumns(c *Catalog, plan *LogicalPlan) bool {
+	changed := false
+	for _, sub := range plan.subqueries {
+		refs := columnRefs{}
+		refs.addPlan(plan, sub)
+		if pruneSelects(sub, refs) {
+			changed = true
+		}
+	}
+	refs := columnRefs{}
+	refs.addPlan(plan, nil)
+	for _, t := range plan.tables {
+		cols := refs.tableColumns(t)
+		if !slices.Equal(cols, t.columns) {
+			t.columns = cols
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Remove the select list expressions of the subquery sub whose output isn't
+// in refs, or used by its own order by or having clause, returning true if
+// any were removed.  The output of distinct subqueries and set operations
+// depends on all of their columns, so they aren't pruned.
+func pruneSelects(sub *LogicalPlan, refs columnRefs) bool {
+	if sub.distinct || sub.setOp != nil || sub.recursive != nil || sub.workTable != nil {
+		return false
+	}
+	own := columnRefs{}
+	for _, oby := range sub.orderByFields {
+		own.addExpr(oby.expr, false)
+	}
+	for _, f := range sub.having {
+		own.addExpr(&f.left, false)
+		own.addExpr(&f.right, false)
+	}
+	usedByOwn := func(name string) bool {
+		for ref := range own {
+			if ref.field == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var kept, pruned []*LogicalSelectNode
+	for _, s := range sub.selects {
+		name := outputName(s)
+		if s.exprType == ExprStar || name == "" || refs.uses(sub.alias, name) || usedByOwn(name) {
+			kept = append(kept, s)
+		} else {
+			pruned = append(pruned, s)
+		}
+	}
+	if len(pruned) == 0 {
+		return false
+	}
+	if len(kept) == 0 {
+		//the number of tuples still matters, e.g., to count(*)
+		kept, pruned = pruned[:1], pruned[1:]
+		if len(pruned) == 0 {
+			return false
+		}
+	}
+	sub.selects = kept
+	//window functions are only computed for the select list; aggregates are
+	//kept, as the having clause may use them
+	for _, s := range pruned {
+		for _, w := range extractWindows(s) {
+			if i := slices.Index(sub.windows, w); i >= 0 {
+				sub.windows = slices.Delete(sub.windows, i, i+1)
+			}
+		}
+	}
+	return true
+}
+
+// Return the columns of table t that refs may reference, in the order of its
+// descriptor, or nil if that is all of them
+func (refs columnRefs) tableColumns(t *LogicalTableNode) []string {
+	name := t.tableName
+	if t.alias != "" {
+		name = t.alias
+	}
+	fields := (*t.file).Descriptor().Fields
+	var cols []string
+	for _, f := range fields {
+		if refs.uses(name, f.Fname) {
+			cols = append(cols, f.Fname)
+		}
+	}
+	if len(cols) == len(fields) {
+		return nil
+	}
+	if len(cols) == 0 && len(fields) > 0 {
+		//the number of tuples still matters, e.g., to count(*)
+		cols = []string{fields[0].Fname}
+	}
+	return cols
+}
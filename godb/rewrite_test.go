@@ -0,0 +1,285 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Parse the select statement sql into a logical plan, without rewriting it
+func parseTestLogicalPlan(t *testing.T, c *Catalog, sql string) *LogicalPlan {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", sql, err.Error())
+	}
+	plan, err := parseStatement(c, stmt.(*sqlparser.Select))
+	if err != nil {
+		t.Fatalf("failed to plan, q=%s, %s", sql, err.Error())
+	}
+	return plan
+}
+
+// Run the physical plan of a logical plan, returning its output as sorted
+// strings
+func runTestLogicalPlan(t *testing.T, c *Catalog, bp *BufferPool, plan *LogicalPlan) []string {
+	op, err := makePhysicalPlan(c, plan)
+	if err != nil {
+		t.Fatalf("failed to make physical plan, %s", err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	iter, err := op.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var out []string
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		out = append(out, fmt.Sprint(tup.Fields))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestFoldConstants(t *testing.T) {
+	c, _ := makeParserTestCatalog(t)
+	plan := parseTestLogicalPlan(t, c, "select name, 60 * 60 as secs, age + 1, 4 * 1 + 2 from t where age > 10 * 4 limit 2 + 3")
+	if !foldConstants(c, plan) {
+		t.Fatalf("expected constants to be folded")
+	}
+	expected := []struct {
+		e     *LogicalSelectNode
+		value string
+		alias string
+	}{
+		{plan.selects[1], "3600", "secs"},
+		{plan.selects[3], "6", "+"},
+		{&plan.filters[0].right, "40", ""},
+		{plan.limit, "5", ""},
+	}
+	for _, ex := range expected {
+		if ex.e.exprType != ExprConst || ex.e.value != ex.value || ex.e.alias != ex.alias {
+			t.Errorf("expected constant %s named '%s', got %+v", ex.value, ex.alias, ex.e)
+		}
+	}
+	if plan.selects[2].exprType != ExprFunc {
+		t.Errorf("expected age + 1 not to be folded")
+	}
+	if foldConstants(c, plan) {
+		t.Errorf("expected folding to be done after one pass")
+	}
+
+	for _, sql := range []string{"select rand() from t", "select age / 0 from t", "select 1 / 0 from t", "select getsubstr('12345', 0, 2) from t"} {
+		if plan := parseTestLogicalPlan(t, c, sql); foldConstants(c, plan) {
+			t.Errorf("expected nothing to be folded in '%s', got %+v", sql, plan.selects[0])
+		}
+	}
+}
+
+func TestPushFiltersIntoSubqueries(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	sql := "select s.n from (select name as n, age from t) s, t2 where s.n = t2.name and s.age > 40 and s.n = 'sam'"
+	plan := parseTestLogicalPlan(t, c, sql)
+	expected := runTestLogicalPlan(t, c, bp, parseTestLogicalPlan(t, c, sql))
+	if !pushFiltersIntoSubqueries(c, plan) {
+		t.Fatalf("expected filters to be pushed")
+	}
+	sub := plan.subqueries[0]
+	if len(plan.filters) != 0 || len(sub.filters) != 2 {
+		t.Fatalf("expected both filters in the subquery, got %d outside and %d inside", len(plan.filters), len(sub.filters))
+	}
+	//the output name n is replaced by the field it selects
+	if f := sub.filters[1]; f.left.exprType != ExprField || f.left.field != "name" || f.left.alias != "" {
+		t.Errorf("expected filter on name, got %+v", f.left)
+	}
+	if pushFiltersIntoSubqueries(c, plan) {
+		t.Errorf("expected nothing more to push")
+	}
+	if out := runTestLogicalPlan(t, c, bp, plan); !slices.Equal(out, expected) || len(out) != 2 {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+
+	//the output of aggregates and limits depends on their input
+	for _, sql := range []string{
+		"select s.c from (select count(*) as c from t) s where s.c > 1",
+		"select s.name from (select name from t limit 3) s where s.name = 'sam'",
+		"select s.name from (select name from t) s, t2 where s.name = t2.name",
+	} {
+		if plan := parseTestLogicalPlan(t, c, sql); pushFiltersIntoSubqueries(c, plan) {
+			t.Errorf("expected no filter to be pushed in '%s'", sql)
+		}
+	}
+}
+
+func TestEliminateRedundantSorts(t *testing.T) {
+	c, _ := makeParserTestCatalog(t)
+	plan := parseTestLogicalPlan(t, c, "select s.name from (select name from t order by name) s where s.name in (select distinct name from t2 order by name)")
+	if !eliminateRedundantSorts(c, plan) {
+		t.Fatalf("expected sorts to be eliminated")
+	}
+	if len(plan.subqueries[0].orderByFields) != 0 {
+		t.Errorf("expected order by of subquery to be removed")
+	}
+	if sq := plan.filters[0].subquery.plan; sq.distinct || len(sq.orderByFields) != 0 {
+		t.Errorf("expected distinct and order by of in subquery to be removed")
+	}
+	if eliminateRedundantSorts(c, plan) {
+		t.Errorf("expected nothing more to eliminate")
+	}
+
+	plan = parseTestLogicalPlan(t, c, "select distinct name, count(*) from t group by name")
+	if !eliminateRedundantSorts(c, plan) || plan.distinct {
+		t.Errorf("expected distinct over groups to be removed")
+	}
+	plan = parseTestLogicalPlan(t, c, "select count(*), max(age) from t order by max(age)")
+	if !eliminateRedundantSorts(c, plan) || len(plan.orderByFields) != 0 {
+		t.Errorf("expected order by of a single tuple to be removed")
+	}
+	for _, sql := range []string{
+		"select distinct name from t",
+		"select distinct count(*) from t group by name",
+		"select s.name from (select name from t order by age limit 3) s",
+		"select name from t order by name",
+	} {
+		if plan := parseTestLogicalPlan(t, c, sql); eliminateRedundantSorts(c, plan) {
+			t.Errorf("expected nothing to be eliminated in '%s'", sql)
+		}
+	}
+}
+
+func TestPruneColumns(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	sql := "select s.n from (select name as n, age, age + 1 as a from t) s where s.n = 'sam'"
+	plan := parseTestLogicalPlan(t, c, sql)
+	expected := runTestLogicalPlan(t, c, bp, parseTestLogicalPlan(t, c, sql))
+	if !pruneColumns(c, plan) {
+		t.Fatalf("expected columns to be pruned")
+	}
+	sub := plan.subqueries[0]
+	if len(sub.selects) != 1 || sub.selects[0].alias != "n" {
+		t.Errorf("expected only n to be selected by the subquery, got %d selects", len(sub.selects))
+	}
+	if !pruneColumns(c, sub) || !slices.Equal(sub.tables[0].columns, []string{"name"}) {
+		t.Errorf("expected only name to be read from t, got %v", sub.tables[0].columns)
+	}
+	if pruneColumns(c, plan) || pruneColumns(c, sub) {
+		t.Errorf("expected nothing more to prune")
+	}
+	if out := runTestLogicalPlan(t, c, bp, plan); !slices.Equal(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+
+	//a subquery keeps one column to count, and all of them if selected by *
+	plan = parseTestLogicalPlan(t, c, "select count(*) from (select name, age from t) s")
+	if !pruneColumns(c, plan) || len(plan.subqueries[0].selects) != 1 {
+		t.Errorf("expected one column of the subquery to be kept")
+	}
+	for _, sql := range []string{
+		"select * from (select name, age from t) s",
+		"select s.name from (select distinct name, age from t) s",
+		"select t.name from t where t.age in (select t2.age from t2 where t2.name = t.name)",
+	} {
+		if plan := parseTestLogicalPlan(t, c, sql); pruneColumns(c, plan) {
+			t.Errorf("expected nothing to be pruned in '%s'", sql)
+		}
+	}
+}
+
+func TestPruneColumnsColumnFile(t *testing.T) {
+	c, _ := makeParserTestCatalog(t)
+	_, _, _, _, cf, _, tid, _ := makeLargeColumnTestVars()
+	f, err := os.Open("test_column_file.csv")
+	if err != nil {
+		t.Fatalf("couldn't open test_column_file.csv")
+	}
+	defer f.Close()
+	if err := cf.LoadFromCSV(f, true, ",", false); err != nil {
+		t.Fatalf("load failed, %s", err)
+	}
+
+	//plan against t, then read from the column file instead, which has name
+	//and age along with other columns
+	plan := parseTestLogicalPlan(t, c, "select t.name from t where t.age > 15")
+	var file DBFile = cf
+	plan.tables[0].file = &file
+	rewritePlan(c, plan, defaultRewriteRules)
+	if !slices.Equal(plan.tables[0].columns, []string{"name", "age"}) {
+		t.Fatalf("expected name and age to be read, got %v", plan.tables[0].columns)
+	}
+	op, err := makePhysicalPlan(c, plan)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	d := DescribePlan(c, op)
+	for len(d.Children) > 0 {
+		d = d.Children[0]
+	}
+	if d.Name != "Column Scan" || d.Properties[1].Value != "name, age" {
+		t.Errorf("expected a scan of name and age, got %+v", d)
+	}
+
+	expected := 0
+	iter, err := cf.ColumnIterator(context.Background(), []FieldType{{Fname: "age", Ftype: IntType}}, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup.Fields[0].(IntField).Value > 15 {
+			expected++
+		}
+	}
+	iter, err = op.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	n := 0
+	for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, ok := tup.Fields[0].(StringField); !ok || len(tup.Fields) != 1 {
+			t.Fatalf("expected tuples of names, got %v", tup)
+		}
+		n++
+	}
+	if n != expected || n == 0 {
+		t.Errorf("expected %d tuples older than 15, got %d", expected, n)
+	}
+}
+
+// The rules together don't change the results of queries
+func TestRewritePlanResults(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	for _, sql := range []string{
+		"select s.n, s.a from (select name as n, age * 2 as a, age from t where age > 1 + 1) s where s.age < 30 * 2",
+		"select distinct s.name from (select name, age from t order by age) s, t2 where s.name = t2.name and s.age > 25",
+		"select name, count(*) from t where name in (select distinct name from t2 where age > 30) group by name",
+		"select name from t where exists (select name from t2 where t2.age = t.age and t2.name <> t.name)",
+		"select count(*) from (select s.name from (select name, age from t) s where s.age >= 40) q",
+		"select distinct name, max(age) from t group by name",
+		"select 60 * 60 as secs, name from t where age > 50 - 10 limit 1 + 2",
+	} {
+		plan := parseTestLogicalPlan(t, c, sql)
+		expected := runTestLogicalPlan(t, c, bp, plan)
+		plan = parseTestLogicalPlan(t, c, sql)
+		rewritePlan(c, plan, defaultRewriteRules)
+		if out := runTestLogicalPlan(t, c, bp, plan); !slices.Equal(out, expected) || len(out) == 0 {
+			t.Errorf("'%s': expected %v, got %v", sql, expected, out)
+		}
+	}
+}
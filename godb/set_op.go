@@ -0,0 +1,175 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Operator implementing the set operations UNION, INTERSECT and EXCEPT, e.g.,
+//
+//	SELECT name FROM t INTERSECT ALL SELECT name FROM t2
+//
+// With all set, duplicates are retained (bag semantics): UNION ALL outputs
+// every tuple of both inputs, INTERSECT ALL outputs a tuple min(m, n) times and
+// EXCEPT ALL max(m-n, 0) times, where m and n are the number of times the tuple
+// appears in the left and right inputs.  Otherwise (set semantics), each
+// distinct tuple is output at most once.
+
+type SetOpType int
+
+const (
+	UnionOp     SetOpType = iota
+	IntersectOp SetOpType = iota
+	ExceptOp    SetOpType = iota
+)
+
+var setOpNames = map[SetOpType]string{
+	UnionOp:     "union",
+	IntersectOp: "intersect",
+	ExceptOp:    "except",
+}
+
+type SetOp struct {
+	left, right Operator
+	op          SetOpType
+	all         bool
+}
+
+// Constructor for a set operation.  The two inputs must be union compatible,
+// that is, have the same number of fields with the same types in the same
+// order; returns an error if they are not.  The output fields are named after
+// those of the left input.
+func NewSetOp(left Operator, right Operator, op SetOpType, all bool) (*SetOp, error) {
+	ld, rd := left.Descriptor(), right.Descriptor()
+	if len(ld.Fields) != len(rd.Fields) {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("inputs of %s have different numbers of columns (%d and %d)", setOpNames[op], len(ld.Fields), len(rd.Fields))}
+	}
+	for i := range ld.Fields {
+		if ld.Fields[i].Ftype != rd.Fields[i].Ftype {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("column %d of the inputs of %s have different types", i+1, setOpNames[op])}
+		}
+	}
+	return &SetOp{left, right, op, all}, nil
+}
+
+// The set operation outputs tuples with the fields of its left input.
+func (s *SetOp) Descriptor() *TupleDesc {
+	return s.left.Descriptor().copy()
+}
+
+func (s *SetOp) DescribePlan() (*PlanDescription, []Operator) {
+	name := strings.ToUpper(setOpNames[s.op])
+	if s.all {
+		name += " ALL"
+	}
+	return newPlanDescription(name), []Operator{s.left, s.right}
+}
+
+// Set operation implementation.  UNION ALL simply streams the left input and
+// then the right.  For the other operations, the first call to the iterator
+// reads the right input into a hash table of tuple counts, which the left
+// tuples are then streamed against.  UNION DISTINCT instead remembers the keys
+// of the tuples it has output.
+func (s *SetOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	desc := s.Descriptor()
+	leftIter, err := s.left.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	var rightIter func() (*Tuple, error)
+	if s.op == UnionOp {
+		rightIter, err = s.right.Iterator(ctx, tid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var counts map[string]int
+	seen := make(map[string]bool)
+	leftDone := false
+	mem := newMemoryAccount(ctx, strings.ToUpper(setOpNames[s.op]))
+	return func() (*Tuple, error) {
+		if s.op != UnionOp && counts == nil {
+			counts = make(map[string]int)
+			iter, err := s.right.Iterator(ctx, tid)
+			if err != nil {
+				return nil, err
+			}
+			for {
+				t, err := iter()
+				if err != nil {
+					mem.release()
+					return nil, err
+				}
+				if t == nil {
+					break
+				}
+				key := t.tupleKey()
+				if _, ok := counts[key]; !ok {
+					if err := mem.reserve(keyMemorySize(len(key))); err != nil {
+						mem.release()
+						return nil, err
+					}
+				}
+				counts[key]++
+			}
+		}
+
+		for {
+			var t *Tuple
+			var err error
+			if !leftDone {
+				t, err = leftIter()
+				if err != nil {
+					mem.release()
+					return nil, err
+				}
+				leftDone = t == nil
+			}
+			if leftDone {
+				if s.op != UnionOp {
+					mem.release()
+					return nil, nil
+				}
+				t, err = rightIter()
+				if err != nil || t == nil {
+					mem.release()
+					return nil, err
+				}
+			}
+			if s.op == UnionOp && s.all {
+				return &Tuple{*desc, t.Fields, t.Rid}, nil
+			}
+
+			key := t.tupleKey()
+			output := false
+			switch s.op {
+			case UnionOp:
+				output = !seen[key]
+			case IntersectOp:
+				output = counts[key] > 0 && !seen[key]
+				if s.all {
+					output = counts[key] > 0
+					counts[key]--
+				}
+			case ExceptOp:
+				output = counts[key] == 0 && !seen[key]
+				if s.all {
+					output = counts[key] <= 0
+					counts[key]--
+				}
+			}
+			if output {
+				if _, ok := seen[key]; !ok {
+					if err := mem.reserve(keyMemorySize(len(key))); err != nil {
+						mem.release()
+						return nil, err
+					}
+				}
+				seen[key] = !s.all
+				return &Tuple{*desc, t.Fields, t.Rid}, nil
+			}
+		}
+	}, nil
+}
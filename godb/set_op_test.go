@@ -0,0 +1,75 @@
+package godb
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// Make a second heap file with the same schema as the one returned by
+// makeTestVars; the first file contains t1 once and t2 twice, the second t2
+// once
+func makeSetOpTestVars(t *testing.T) (TupleDesc, Tuple, Tuple, *HeapFile, *HeapFile, TransactionID) {
+	td, t1, t2, hf, bp, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+
+	os.Remove(JoinTestFile)
+	hf2, err := NewHeapFile(JoinTestFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2.insertTuple(context.Background(), &t2, tid)
+	return td, t1, t2, hf, hf2, tid
+}
+
+func TestSetOps(t *testing.T) {
+	_, t1, t2, hf, hf2, tid := makeSetOpTestVars(t)
+
+	cases := []struct {
+		op       SetOpType
+		all      bool
+		expected []*Tuple
+	}{
+		{UnionOp, true, []*Tuple{&t1, &t2, &t2, &t2}},
+		{UnionOp, false, []*Tuple{&t1, &t2}},
+		{IntersectOp, true, []*Tuple{&t2}},
+		{IntersectOp, false, []*Tuple{&t2}},
+		{ExceptOp, true, []*Tuple{&t1, &t2}},
+		{ExceptOp, false, []*Tuple{&t1}},
+	}
+	for _, tc := range cases {
+		op, err := NewSetOp(hf, hf2, tc.op, tc.all)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		iter, err := op.Iterator(context.Background(), tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !CheckIfOutputMatches(iter, tc.expected) {
+			t.Errorf("unexpected output for %s (all = %t)", setOpNames[tc.op], tc.all)
+		}
+	}
+}
+
+func TestSetOpIncompatible(t *testing.T) {
+	td, _, _, hf, hf2, _ := makeSetOpTestVars(t)
+	proj, err := NewProjectOp([]Expr{&FieldExpr{td.Fields[1]}, &FieldExpr{td.Fields[0]}}, []string{"age", "name"}, false, hf2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = NewSetOp(hf, proj, UnionOp, false)
+	if err == nil {
+		t.Errorf("expected error for inputs with different field types")
+	}
+	proj, err = NewProjectOp([]Expr{&FieldExpr{td.Fields[0]}}, []string{"name"}, false, hf2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = NewSetOp(hf, proj, UnionOp, false)
+	if err == nil {
+		t.Errorf("expected error for inputs with different numbers of fields")
+	}
+}
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"testing"
 )
 
@@ -46,7 +47,7 @@ func TestSimpleQuery(t *testing.T) {
 	agg := NewAggregator([]AggState{&sa}, filterOp)
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	f, err := agg.Iterator(tid)
+	f, err := agg.Iterator(context.Background(), tid)
 	if err != nil {
 		t.Fatalf("failed to get iterator, %s", err.Error())
 	}
@@ -0,0 +1,226 @@
+package godb
+
+import (
+	"context"
+	"strings"
+)
+
+// SortMergeJoin is an equality join that sorts both of its inputs on their join
+// keys (externally, if they don't fit in memory, see [SortBufferSize]) and
+// then merges them, joining each left tuple with the group of right tuples
+// with the same key.  Only one such group is buffered in memory at a time, but
+// a group that exceeds the query's memory limit fails the join.
+// The output is sorted on the join keys.
+//
+// An input that is already sorted on its join keys, e.g., because it is the
+// output of another sort merge join on the same keys, need not be sorted
+// again; leftSorted and rightSorted record whether that is the case.
+type SortMergeJoin struct {
+	leftFields, rightFields []Expr
+	left, right             Operator
+	leftSorted, rightSorted bool
+	maxBufferSize           int
+}
+
+// Constructor for a sort merge join.  Returns an error if the two lists of
+// expressions differ in length or in the types of their expressions.
+func NewSortMergeJoin(left Operator, leftFields []Expr, right Operator, rightFields []Expr) (*SortMergeJoin, error) {
+	if err := checkJoinKeys(leftFields, rightFields); err != nil {
+		return nil, err
+	}
+	return &SortMergeJoin{leftFields, rightFields, left, right, false, false, SortBufferSize}, nil
+}
+
+// The sort merge join outputs the fields of the left input followed by those
+// of the right input.
+func (smj *SortMergeJoin) Descriptor() *TupleDesc {
+	return smj.left.Descriptor().merge(smj.right.Descriptor())
+}
+
+// Inputs that are already sorted on the join keys are listed as presorted.
+func (smj *SortMergeJoin) DescribePlan() (*PlanDescription, []Operator) {
+	var presorted []string
+	if smj.leftSorted {
+		presorted = append(presorted, "left")
+	}
+	if smj.rightSorted {
+		presorted = append(presorted, "right")
+	}
+	return newPlanDescription("Sort Merge Join", "keys", describeJoinKeys(smj.leftFields, smj.rightFields), "presorted", strings.Join(presorted, ", ")), []Operator{smj.left, smj.right}
+}
+
+// Compare two lists of values of the same types, returning -1, 0 or 1 if k1
+// sorts before, with, or after k2
+func compareKeys(k1 []DBValue, k2 []DBValue) int {
+	for i := range k1 {
+		if compareValues(k1[i], k2[i], OpLt) {
+			return -1
+		}
+		if compareValues(k1[i], k2[i], OpGt) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// An input of a sort merge join, positioned at its current tuple
+type mergeInput struct {
+	iter   func() (*Tuple, error)
+	fields []Expr
+	sorter *externalSorter
+	tup    *Tuple
+	key    []DBValue
+}
+
+// Return an input iterating through the tuples of op in order of fields,
+// sorting them unless sorted is set
+func newMergeInput(ctx context.Context, op Operator, fields []Expr, sorted bool, maxBufferSize int, tid TransactionID) (*mergeInput, error) {
+	iter, err := op.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	in := &mergeInput{iter: iter, fields: fields}
+	if sorted {
+		return in, nil
+	}
+	ascending := make([]bool, len(fields))
+	for i := range ascending {
+		ascending[i] = true
+	}
+	in.sorter = newExternalSorter(op.Descriptor(), func(t1, t2 *Tuple) bool {
+		return tupleLess(t1, t2, fields, ascending)
+	}, maxBufferSize, newMemoryAccount(ctx, "Sort Merge Join"))
+	for {
+		t, err := iter()
+		if err != nil {
+			in.close()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		if err := in.sorter.add(t); err != nil {
+			in.close()
+			return nil, err
+		}
+	}
+	iter, err = in.sorter.Iterator()
+	if err != nil {
+		in.close()
+		return nil, err
+	}
+	in.iter = closeOnCancel(ctx, iter, in.sorter.close)
+	return in, nil
+}
+
+// Advance to the next tuple, which is nil once the input is exhausted
+func (in *mergeInput) next() error {
+	t, err := in.iter()
+	if err != nil {
+		return err
+	}
+	in.tup = t
+	if t == nil {
+		return nil
+	}
+	key, err := evalKeyTuple(in.fields, t)
+	if err != nil {
+		return err
+	}
+	in.key = key.Fields
+	return nil
+}
+
+// Delete any runs spilled by the sort of the input
+func (in *mergeInput) close() {
+	if in.sorter != nil {
+		in.sorter.close()
+	}
+}
+
+// Sort merge join implementation.  Both inputs are sorted the first time the
+// iterator is invoked.
+func (smj *SortMergeJoin) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	var left, right *mergeInput
+	closeInputs := func() {
+		if left != nil {
+			left.close()
+		}
+		if right != nil {
+			right.close()
+		}
+	}
+	//the group of right tuples with the same key as the current left tuple,
+	//and the next of them to join with it
+	var group []*Tuple
+	var groupKey []DBValue
+	next := 0
+	mem := newMemoryAccount(ctx, "Sort Merge Join")
+	return func() (*Tuple, error) {
+		var err error
+		if left == nil {
+			left, err = newMergeInput(ctx, smj.left, smj.leftFields, smj.leftSorted, smj.maxBufferSize, tid)
+			if err != nil {
+				return nil, err
+			}
+			right, err = newMergeInput(ctx, smj.right, smj.rightFields, smj.rightSorted, smj.maxBufferSize, tid)
+			if err == nil {
+				err = left.next()
+			}
+			if err == nil {
+				err = right.next()
+			}
+			if err != nil {
+				closeInputs()
+				return nil, err
+			}
+		}
+		for left.tup != nil {
+			if group != nil && compareKeys(left.key, groupKey) == 0 {
+				if next < len(group) {
+					next++
+					return joinTuples(left.tup, group[next-1]), nil
+				}
+				next = 0
+				if err := left.next(); err != nil {
+					closeInputs()
+					return nil, err
+				}
+				continue
+			}
+			group = nil
+			mem.release()
+			for right.tup != nil && compareKeys(right.key, left.key) < 0 {
+				if err := right.next(); err != nil {
+					closeInputs()
+					return nil, err
+				}
+			}
+			if right.tup == nil {
+				break
+			}
+			if compareKeys(right.key, left.key) > 0 {
+				if err := left.next(); err != nil {
+					closeInputs()
+					return nil, err
+				}
+				continue
+			}
+			groupKey = right.key
+			for right.tup != nil && compareKeys(right.key, groupKey) == 0 {
+				if err := mem.reserve(tupleMemorySize(right.tup)); err != nil {
+					closeInputs()
+					return nil, err
+				}
+				group = append(group, right.tup)
+				if err := right.next(); err != nil {
+					closeInputs()
+					return nil, err
+				}
+			}
+		}
+		closeInputs()
+		mem.release()
+		return nil, nil
+	}, nil
+}
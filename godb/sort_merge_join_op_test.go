@@ -0,0 +1,74 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestSortMergeJoin(t *testing.T) {
+	td, hf, tid := makeDistinctTestVars(t, 300, 60)
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+	right := makeJoinTestFilter(t, td, hf)
+	expected, err := NewStringJoin(hf, name, right, name, JoinBufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	smj, err := NewSortMergeJoin(hf, []Expr{name}, right, []Expr{name})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkJoinOutput(t, smj, expected, tid)
+
+	//the output is sorted on the join key
+	var last *Tuple
+	for _, tup := range collectTuples(t, smj, tid) {
+		if last != nil && tupleLess(tup, last, []Expr{name}, []bool{true}) {
+			t.Fatalf("output not sorted: %v after %v", tup.Fields, last.Fields)
+		}
+		last = tup
+	}
+
+	smj, err = NewSortMergeJoin(hf, []Expr{age, name}, hf, []Expr{age, name})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected, err = NewStringJoin(hf, name, hf, name, JoinBufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	checkJoinOutput(t, smj, expected, tid)
+}
+
+func TestSortMergeJoinSpill(t *testing.T) {
+	td, hf, tid := makeDistinctTestVars(t, 300, 60)
+	name := &FieldExpr{td.Fields[0]}
+	expected, err := NewStringJoin(hf, name, hf, name, JoinBufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	smj, err := NewSortMergeJoin(hf, []Expr{name}, hf, []Expr{name})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	smj.maxBufferSize = 7
+	checkJoinOutput(t, smj, expected, tid)
+}
+
+// An input that is already sorted on its join key is not sorted again
+func TestSortMergeJoinSortedInput(t *testing.T) {
+	td, hf, tid := makeDistinctTestVars(t, 300, 60)
+	name := &FieldExpr{td.Fields[0]}
+	sorted, err := NewOrderBy([]Expr{name}, hf, []bool{true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected, err := NewStringJoin(hf, name, hf, name, JoinBufferSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	smj, err := NewSortMergeJoin(sorted, []Expr{name}, hf, []Expr{name})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	smj.leftSorted = true
+	checkJoinOutput(t, smj, expected, tid)
+}
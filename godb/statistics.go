@@ -0,0 +1,533 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Number of buckets in the histograms computed by ANALYZE
+const histogramBuckets = 20
+
+// Statistics about the contents of a table, computed by the ANALYZE command
+// and kept in the statistics section of the [Catalog], which is saved with
+// its tables (see [Catalog.SaveToFile]).  They are a snapshot: they aren't
+// updated as the table is modified, until it is analyzed again.
+type TableStats struct {
+	Rows    int
+	Pages   int
+	Columns []*ColumnStats // one per field of the table, in order
+}
+
+// Statistics about the values of one column of a table
+type ColumnStats struct {
+	Name     string
+	Distinct int
+	// The smallest and largest values, which are nil if the table is empty
+	Min, Max DBValue
+	// An equi-depth histogram of the values: each bucket holds (roughly) the
+	// same number of values, in sorted order
+	Histogram []*HistogramBucket
+}
+
+// A bucket of an equi-depth histogram, holding the Count values (of which
+// Distinct are distinct) between Low and High, inclusive.  Adjacent buckets
+// may overlap by one value, if its occurrences span the bucket boundary.
+type HistogramBucket struct {
+	Low, High DBValue
+	Count     int
+	Distinct  int
+}
+
+// Return the statistics of the named column, or nil if there is none
+func (ts *TableStats) Column(name string) *ColumnStats {
+	for _, cs := range ts.Columns {
+		if cs.Name == name {
+			return cs
+		}
+	}
+	return nil
+}
+
+// Return the estimated number of values in the bucket equal to v
+func (b *HistogramBucket) equalCount(v DBValue) float64 {
+	if compareValues(v, b.Low, OpLt) || compareValues(v, b.High, OpGt) {
+		return 0
+	}
+	return float64(b.Count) / float64(b.Distinct)
+}
+
+// Return the estimated fraction of the values in the bucket less than v,
+// which is between Low and High, assuming they are uniformly distributed
+func (b *HistogramBucket) fractionBelow(v DBValue) float64 {
+	low, ok1 := b.Low.(IntField)
+	high, ok2 := b.High.(IntField)
+	val, ok3 := v.(IntField)
+	if !ok1 || !ok2 || !ok3 {
+		return 0.5
+	}
+	if high.Value == low.Value {
+		return 0
+	}
+	return float64(val.Value-low.Value) / float64(high.Value-low.Value)
+}
+
+// Return the estimated number of values less than v, or less than or equal
+// to v if inclusive is set
+func (cs *ColumnStats) countBelow(v DBValue, inclusive bool) float64 {
+	count := 0.0
+	for _, b := range cs.Histogram {
+		switch {
+		case compareValues(b.High, v, OpLt):
+			count += float64(b.Count)
+		case compareValues(b.Low, v, OpLt):
+			count += b.fractionBelow(v) * float64(b.Count)
+			if inclusive {
+				count += b.equalCount(v)
+			}
+		case inclusive && compareValues(b.Low, v, OpEq):
+			count += b.equalCount(v)
+		}
+	}
+	return count
+}
+
+// Return the estimated fraction of the values of the column that satisfy
+// "value op v".  Predicates that the statistics can't estimate, e.g., LIKE or
+// comparisons with values of another type, get the same fixed selectivity
+// used for columns without statistics.
+func (cs *ColumnStats) Selectivity(op BoolOp, v DBValue) float64 {
+	total := 0
+	for _, b := range cs.Histogram {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+	if !compareValues(v, cs.Min, OpEq) && !compareValues(v, cs.Min, OpNeq) {
+		//v is of a different type than the column
+		return defaultSelectivity(op)
+	}
+	var count float64
+	switch op {
+	case OpEq, OpNeq:
+		for _, b := range cs.Histogram {
+			count += b.equalCount(v)
+		}
+		if op == OpNeq {
+			count = float64(total) - count
+		}
+	case OpLt:
+		count = cs.countBelow(v, false)
+	case OpLe:
+		count = cs.countBelow(v, true)
+	case OpGt:
+		count = float64(total) - cs.countBelow(v, true)
+	case OpGe:
+		count = float64(total) - cs.countBelow(v, false)
+	default:
+		return defaultSelectivity(op)
+	}
+	return math.Min(math.Max(count/float64(total), 0), 1)
+}
+
+// Return the statistics of the named table, or nil if it hasn't been analyzed
+func (c *Catalog) Statistics(table string) *TableStats {
+	return c.stats[table]
+}
+
+// Return the statistics of the table stored in the named file, or nil if it
+// hasn't been analyzed
+func (c *Catalog) statisticsForFile(filename string) *TableStats {
+	for name, stats := range c.stats {
+		if c.tableNameToFile(name) == filename {
+			return stats
+		}
+	}
+	return nil
+}
+
+// Return the estimated fraction of the tuples of the named table that pass
+// filter f.  Filters comparing a field of the table with a constant are
+// estimated using the table's statistics, if it has been analyzed; other
+// filters get a fixed selectivity depending on their operator.
+func (c *Catalog) FilterSelectivity(table string, f *LogicalFilterNode) float64 {
+	stats := c.Statistics(table)
+	if stats == nil || f.subquery != nil {
+		return defaultSelectivity(f.predOp)
+	}
+	field, value, op := &f.left, &f.right, f.predOp
+	if field.exprType != ExprField {
+		field, value = value, field
+		op = flippedOp(op)
+	}
+	if field.exprType != ExprField || value.exprType != ExprConst || (field.table != "" && field.table != table) {
+		return defaultSelectivity(f.predOp)
+	}
+	cs := stats.Column(field.field)
+	if cs == nil {
+		return defaultSelectivity(f.predOp)
+	}
+	expr, _, err := value.generateExpr(c, nil, nil)
+	if err != nil {
+		return defaultSelectivity(f.predOp)
+	}
+	return cs.Selectivity(op, expr.(*ConstExpr).val.(DBValue))
+}
+
+// Return the operator to use if the operands of a comparison are swapped
+func flippedOp(op BoolOp) BoolOp {
+	switch op {
+	case OpLt:
+		return OpGt
+	case OpGt:
+		return OpLt
+	case OpLe:
+		return OpGe
+	case OpGe:
+		return OpLe
+	}
+	return op
+}
+
+// Compute the statistics of the named table, reading it in transaction tid,
+// and store them in the catalog.  Each column's values are sorted (externally,
+// if necessary) to count its distinct values and build its histogram.
+func (c *Catalog) analyzeTable(ctx context.Context, table string, tid TransactionID) (*TableStats, error) {
+	file, err := c.GetTable(table)
+	if err != nil {
+		return nil, err
+	}
+	desc := file.Descriptor()
+	sorters := make([]*externalSorter, len(desc.Fields))
+	for i, f := range desc.Fields {
+		colDesc := &TupleDesc{[]FieldType{f}}
+		expr := []Expr{&FieldExpr{f}}
+		sorters[i] = newExternalSorter(colDesc, func(t1, t2 *Tuple) bool {
+			return tupleLess(t1, t2, expr, []bool{true})
+		}, SortBufferSize, newMemoryAccount(ctx, "Analyze"))
+	}
+	closeSorters := func() {
+		for _, s := range sorters {
+			s.close()
+		}
+	}
+
+	stats := &TableStats{}
+	if hf, ok := file.(*HeapFile); ok {
+		stats.Pages = hf.NumPages()
+	}
+	iter, err := file.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			closeSorters()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		stats.Rows++
+		for i, s := range sorters {
+			if err := s.add(&Tuple{*s.desc, []DBValue{t.Fields[i]}, nil}); err != nil {
+				closeSorters()
+				return nil, err
+			}
+		}
+	}
+	for i, s := range sorters {
+		cs, err := columnStats(desc.Fields[i].Fname, s, stats.Rows)
+		if err != nil {
+			closeSorters()
+			return nil, err
+		}
+		stats.Columns = append(stats.Columns, cs)
+	}
+	c.stats[table] = stats
+	c.version.Add(1)
+	return stats, nil
+}
+
+// Compute the statistics of a column from a sorter holding its rows values
+func columnStats(name string, sorter *externalSorter, rows int) (*ColumnStats, error) {
+	iter, err := sorter.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	cs := &ColumnStats{Name: name}
+	bucketSize := (rows + histogramBuckets - 1) / histogramBuckets
+	var bucket *HistogramBucket
+	for i := 0; ; i++ {
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		v := t.Fields[0]
+		if i%bucketSize == 0 {
+			bucket = &HistogramBucket{Low: v}
+			cs.Histogram = append(cs.Histogram, bucket)
+		}
+		if i == 0 || v != cs.Max {
+			cs.Distinct++
+			bucket.Distinct++
+		} else if bucket.Count == 0 {
+			//the value also ends the previous bucket
+			bucket.Distinct++
+		}
+		bucket.High = v
+		bucket.Count++
+		if i == 0 {
+			cs.Min = v
+		}
+		cs.Max = v
+	}
+	return cs, nil
+}
+
+// The line of a catalog file that starts its statistics section, which
+// follows the tables (see [Catalog.SaveToFile])
+const statisticsHeader = "-- statistics"
+
+// Return the statistics section of the catalog file of c, or "" if no table
+// has been analyzed.  The statistics of a table are a line
+//
+//	table <name> <rows> <pages>
+//
+// followed by a line for each of its columns
+//
+//	column <table> <name> <distinct> <min> <max> [<low> <high> <count> <distinct>]...
+//
+// with one group of four values per histogram bucket.  Int values are written
+// in decimal, strings quoted as Go string literals, and missing values as
+// null.
+func (c *Catalog) statisticsString() string {
+	var out strings.Builder
+	for _, t := range c.tables {
+		stats := c.stats[t.name]
+		if stats == nil {
+			continue
+		}
+		if out.Len() == 0 {
+			out.WriteString(statisticsHeader + "\n")
+		}
+		fmt.Fprintf(&out, "table %s %d %d\n", t.name, stats.Rows, stats.Pages)
+		for _, cs := range stats.Columns {
+			fmt.Fprintf(&out, "column %s %s %d %s %s", t.name, cs.Name, cs.Distinct, statisticsValue(cs.Min), statisticsValue(cs.Max))
+			for _, b := range cs.Histogram {
+				fmt.Fprintf(&out, " %s %s %d %d", statisticsValue(b.Low), statisticsValue(b.High), b.Count, b.Distinct)
+			}
+			out.WriteString("\n")
+		}
+	}
+	return out.String()
+}
+
+// Return v as it is written in the statistics section of a catalog file
+func statisticsValue(v DBValue) string {
+	switch v := v.(type) {
+	case IntField:
+		return strconv.FormatInt(v.Value, 10)
+	case StringField:
+		return strconv.Quote(v.Value)
+	}
+	return "null"
+}
+
+// Split the next value off of a line of the statistics section of a catalog
+// file, returning it and the rest of the line
+func nextStatisticsValue(line string) (DBValue, string, error) {
+	line = strings.TrimLeft(line, " ")
+	if strings.HasPrefix(line, "\"") {
+		quoted, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("malformed string in statistics (%s)", line)}
+		}
+		str, _ := strconv.Unquote(quoted)
+		return StringField{str}, line[len(quoted):], nil
+	}
+	tok, rest, _ := strings.Cut(line, " ")
+	if tok == "null" {
+		return nil, rest, nil
+	}
+	n, err := strconv.ParseInt(tok, 10, 64)
+	if err != nil {
+		return nil, "", GoDBError{ParseError, fmt.Sprintf("malformed value '%s' in statistics", tok)}
+	}
+	return IntField{n}, rest, nil
+}
+
+// Split the next count off of a line of the statistics section of a catalog
+// file, returning it and the rest of the line
+func nextStatisticsCount(line string) (int, string, error) {
+	v, rest, err := nextStatisticsValue(line)
+	if err != nil {
+		return 0, "", err
+	}
+	n, ok := v.(IntField)
+	if !ok {
+		return 0, "", GoDBError{ParseError, fmt.Sprintf("expected count in statistics, got %v", v)}
+	}
+	return int(n.Value), rest, nil
+}
+
+// Load the statistics of the tables of c from the lines of the statistics
+// section of a catalog file, as written by [Catalog.statisticsString]
+func (c *Catalog) parseStatistics(lines []string) error {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		kind, rest, _ := strings.Cut(line, " ")
+		table, rest, _ := strings.Cut(rest, " ")
+		table = strings.ToLower(table)
+		if _, err := c.GetTable(table); err != nil {
+			return GoDBError{ParseError, fmt.Sprintf("statistics of unknown table %s (line %s)", table, line)}
+		}
+		switch kind {
+		case "table":
+			stats := &TableStats{}
+			var err error
+			if stats.Rows, rest, err = nextStatisticsCount(rest); err != nil {
+				return err
+			}
+			if stats.Pages, _, err = nextStatisticsCount(rest); err != nil {
+				return err
+			}
+			c.stats[table] = stats
+		case "column":
+			stats := c.stats[table]
+			if stats == nil {
+				return GoDBError{ParseError, fmt.Sprintf("statistics of a column before those of its table (line %s)", line)}
+			}
+			cs, err := parseColumnStatistics(rest)
+			if err != nil {
+				return err
+			}
+			stats.Columns = append(stats.Columns, cs)
+		default:
+			return GoDBError{ParseError, fmt.Sprintf("malformed statistics entry (line %s)", line)}
+		}
+	}
+	return nil
+}
+
+// Parse the statistics of a column, following the name of its table in a
+// line of the statistics section of a catalog file
+func parseColumnStatistics(line string) (*ColumnStats, error) {
+	name, rest, _ := strings.Cut(line, " ")
+	cs := &ColumnStats{Name: strings.ToLower(name)}
+	var err error
+	if cs.Distinct, rest, err = nextStatisticsCount(rest); err != nil {
+		return nil, err
+	}
+	if cs.Min, rest, err = nextStatisticsValue(rest); err != nil {
+		return nil, err
+	}
+	if cs.Max, rest, err = nextStatisticsValue(rest); err != nil {
+		return nil, err
+	}
+	for strings.TrimSpace(rest) != "" {
+		b := &HistogramBucket{}
+		if b.Low, rest, err = nextStatisticsValue(rest); err != nil {
+			return nil, err
+		}
+		if b.High, rest, err = nextStatisticsValue(rest); err != nil {
+			return nil, err
+		}
+		if b.Count, rest, err = nextStatisticsCount(rest); err != nil {
+			return nil, err
+		}
+		if b.Distinct, rest, err = nextStatisticsCount(rest); err != nil {
+			return nil, err
+		}
+		cs.Histogram = append(cs.Histogram, b)
+	}
+	return cs, nil
+}
+
+// Analyze computes the statistics of tables, for the ANALYZE command.  It
+// outputs one tuple per table, with the table's name and number of rows and
+// pages.
+type Analyze struct {
+	c      *Catalog
+	tables []string
+}
+
+// Construct an operator analyzing the named tables, or all of the tables of
+// the catalog if there are none.
+func NewAnalyze(c *Catalog, tables []string) (*Analyze, error) {
+	if len(tables) == 0 {
+		for _, t := range c.tables {
+			tables = append(tables, t.name)
+		}
+	}
+	for _, t := range tables {
+		if _, err := c.GetTable(t); err != nil {
+			return nil, err
+		}
+	}
+	return &Analyze{c, tables}, nil
+}
+
+func (a *Analyze) Descriptor() *TupleDesc {
+	return &TupleDesc{[]FieldType{
+		{"table", "", StringType},
+		{"rows", "", IntType},
+		{"pages", "", IntType},
+	}}
+}
+
+func (a *Analyze) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Analyze", "tables", strings.Join(a.tables, ", ")), nil
+}
+
+// Analyze implementation.  Each table is analyzed when its tuple is produced.
+func (a *Analyze) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	i := 0
+	return func() (*Tuple, error) {
+		if i == len(a.tables) {
+			return nil, nil
+		}
+		table := a.tables[i]
+		i++
+		stats, err := a.c.analyzeTable(ctx, table, tid)
+		if err != nil {
+			return nil, err
+		}
+		return &Tuple{*a.Descriptor(), []DBValue{StringField{table}, IntField{int64(stats.Rows)}, IntField{int64(stats.Pages)}}, nil}, nil
+	}, nil
+}
+
+// If query is an ANALYZE [TABLE] [name] command, return the names of the
+// tables it analyzes (none, for all tables); ok is false if it isn't.
+func parseAnalyze(query string) (tables []string, ok bool, err error) {
+	s := &queryScanner{query, 0}
+	typ, text := s.nextToken()
+	if typ != tokWord || !strings.EqualFold(text, "analyze") {
+		return nil, false, nil
+	}
+	typ, text = s.nextToken()
+	if typ == tokWord && strings.EqualFold(text, "table") {
+		typ, text = s.nextToken()
+	}
+	for typ == tokWord {
+		tables = append(tables, text)
+		typ, text = s.nextToken()
+		if text != "," {
+			break
+		}
+		typ, text = s.nextToken()
+	}
+	if text != "" && text != ";" {
+		return nil, true, GoDBError{ParseError, fmt.Sprintf("unexpected '%s' in analyze command", text)}
+	}
+	return tables, true, nil
+}
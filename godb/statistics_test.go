@@ -0,0 +1,175 @@
+package godb
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	if c.Statistics("t") != nil {
+		t.Fatalf("expected no statistics before analyze")
+	}
+	tups := runParserTestQuery(t, c, bp, "analyze table t")
+	if len(tups) != 1 || tups[0].Fields[0].(StringField).Value != "t" || tups[0].Fields[1].(IntField).Value != 12 {
+		t.Fatalf("expected one tuple for t with 12 rows, got %v", tups)
+	}
+	stats := c.Statistics("t")
+	if stats == nil || stats.Rows != 12 || stats.Pages < 1 {
+		t.Fatalf("unexpected statistics %+v", stats)
+	}
+	if c.Statistics("t2") != nil {
+		t.Errorf("expected t2 not to be analyzed")
+	}
+
+	name, age := stats.Column("name"), stats.Column("age")
+	if name == nil || age == nil {
+		t.Fatalf("expected statistics for name and age")
+	}
+	if name.Distinct != 10 || age.Distinct != 10 {
+		t.Errorf("expected 10 distinct names and ages, got %d and %d", name.Distinct, age.Distinct)
+	}
+	if age.Min != (IntField{22}) || age.Max != (IntField{99}) {
+		t.Errorf("expected ages between 22 and 99, got %v and %v", age.Min, age.Max)
+	}
+	count := 0
+	for _, b := range age.Histogram {
+		count += b.Count
+	}
+	if count != 12 {
+		t.Errorf("expected histogram of 12 values, got %d", count)
+	}
+
+	selectivities := []struct {
+		op       BoolOp
+		v        DBValue
+		expected float64
+	}{
+		{OpEq, IntField{99}, 2.0 / 12},
+		{OpNeq, IntField{99}, 10.0 / 12},
+		{OpEq, IntField{100}, 0},
+		{OpGt, IntField{40}, 6.0 / 12},
+		{OpLe, IntField{22}, 2.0 / 12},
+		{OpLt, IntField{22}, 0},
+		{OpGe, IntField{22}, 1},
+	}
+	for _, s := range selectivities {
+		if sel := age.Selectivity(s.op, s.v); math.Abs(sel-s.expected) > 0.01 {
+			t.Errorf("age %v %v: expected selectivity %f, got %f", s.op, s.v, s.expected, sel)
+		}
+	}
+	if sel := name.Selectivity(OpEq, StringField{"sam"}); math.Abs(sel-2.0/12) > 0.01 {
+		t.Errorf("expected selectivity of name = sam %f, got %f", 2.0/12, sel)
+	}
+	if sel := age.Selectivity(OpEq, StringField{"sam"}); sel != defaultSelectivity(OpEq) {
+		t.Errorf("expected default selectivity comparing with a string, got %f", sel)
+	}
+
+	//all tables are analyzed without a name
+	if tups := runParserTestQuery(t, c, bp, "analyze"); len(tups) != 2 || c.Statistics("t2") == nil {
+		t.Errorf("expected both tables to be analyzed, got %v", tups)
+	}
+}
+
+func TestParseAnalyze(t *testing.T) {
+	commands := map[string][]string{
+		"analyze":             nil,
+		"ANALYZE TABLE t;":    {"t"},
+		"analyze t, t2":       {"t", "t2"},
+		"analyze table t, t2": {"t", "t2"},
+	}
+	for sql, expected := range commands {
+		tables, ok, err := parseAnalyze(sql)
+		if !ok || err != nil {
+			t.Errorf("failed to parse '%s': %v", sql, err)
+			continue
+		}
+		if len(tables) != len(expected) {
+			t.Errorf("'%s': expected tables %v, got %v", sql, expected, tables)
+			continue
+		}
+		for i := range tables {
+			if tables[i] != expected[i] {
+				t.Errorf("'%s': expected tables %v, got %v", sql, expected, tables)
+			}
+		}
+	}
+	if _, ok, _ := parseAnalyze("select * from t"); ok {
+		t.Errorf("expected select not to be an analyze command")
+	}
+	if _, _, err := parseAnalyze("analyze t t2"); err == nil {
+		t.Errorf("expected error for missing comma")
+	}
+
+	c, _ := makeParserTestCatalog(t)
+	if _, _, err := Parse(c, "analyze nosuchtable"); err == nil {
+		t.Errorf("expected error analyzing unknown table")
+	}
+}
+
+func TestStatisticsEstimates(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	filter := &LogicalFilterNode{
+		left:   LogicalSelectNode{exprType: ExprField, field: "age"},
+		right:  LogicalSelectNode{exprType: ExprConst, value: "40"},
+		predOp: OpGt,
+	}
+	if sel := c.FilterSelectivity("t", filter); sel != defaultSelectivity(OpGt) {
+		t.Errorf("expected default selectivity before analyze, got %f", sel)
+	}
+	runParserTestQuery(t, c, bp, "analyze t")
+	if sel := c.FilterSelectivity("t", filter); math.Abs(sel-0.5) > 0.01 {
+		t.Errorf("expected selectivity 0.5 after analyze, got %f", sel)
+	}
+
+	//the estimated size of a plan uses the statistics
+	_, plan, err := Parse(c, "select name from t where age = 99")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if est := estimatePlan(c, plan); math.Abs(est.rows-2) > 0.1 {
+		t.Errorf("expected estimate of 2 rows, got %f", est.rows)
+	}
+}
+
+// Statistics are saved with the catalog and loaded back with it
+func TestStatisticsSaveToFile(t *testing.T) {
+	c, bp := makeParserTestCatalog(t)
+	runParserTestQuery(t, c, bp, "analyze table t")
+	//a string that must be quoted
+	odd := &ColumnStats{Name: "name", Distinct: 1, Min: StringField{"it's \"odd\" "}, Max: StringField{"it's \"odd\" "}}
+	odd.Histogram = []*HistogramBucket{{odd.Min, odd.Max, 3, 1}}
+	c.stats["t2"] = &TableStats{Rows: 3, Pages: 1, Columns: []*ColumnStats{odd, {Name: "age"}}}
+
+	const catalogFile = "stats_catalog.txt"
+	t.Cleanup(func() { os.Remove(catalogFile) })
+	if err := c.SaveToFile(catalogFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	loaded, err := NewCatalogFromFile(catalogFile, bp, ".")
+	if err != nil {
+		t.Fatalf("failed to load catalog, %s", err.Error())
+	}
+	if loaded.CatalogString() != c.CatalogString() {
+		t.Errorf("expected tables\n%s, got\n%s", c.CatalogString(), loaded.CatalogString())
+	}
+	for _, table := range []string{"t", "t2"} {
+		if stats := loaded.Statistics(table); !reflect.DeepEqual(stats, c.Statistics(table)) {
+			t.Errorf("%s: expected statistics %+v, got %+v", table, c.Statistics(table), stats)
+		}
+	}
+
+	//a catalog without statistics has none
+	c, _ = makeParserTestCatalog(t)
+	if err := c.SaveToFile(catalogFile, "."); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if loaded, err = NewCatalogFromFile(catalogFile, bp, "."); err != nil {
+		t.Fatalf("failed to load catalog, %s", err.Error())
+	}
+	if loaded.Statistics("t") != nil {
+		t.Errorf("expected no statistics")
+	}
+}
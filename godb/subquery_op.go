@@ -0,0 +1,332 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Operators for evaluating subqueries that appear in a WHERE clause, e.g.,
+// x IN (SELECT ...), EXISTS (SELECT ...) or x > (SELECT ...).  Where possible
+// the parser decorrelates these into a [SemiJoin]; otherwise they are
+// evaluated once per outer tuple by a [SubqueryFilter].
+
+type SubqueryType int
+
+const (
+	ExistsSubquery SubqueryType = iota
+	InSubquery     SubqueryType = iota
+	ScalarSubquery SubqueryType = iota
+)
+
+// CorrelatedExpr is a reference from inside a correlated subquery to a field
+// of the enclosing query, e.g., t.name in
+//
+//	EXISTS (SELECT * FROM t2 WHERE t2.name = t.name)
+//
+// Its value is bound by the [SubqueryFilter] from each outer tuple before the
+// subquery is evaluated, so to the subquery it behaves like a constant.
+type CorrelatedExpr struct {
+	outerField FieldType
+	val        DBValue
+}
+
+func (c *CorrelatedExpr) EvalExpr(_ *Tuple) (DBValue, error) {
+	if c.val == nil {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("correlated field %s.%s is unbound", c.outerField.TableQualifier, c.outerField.Fname)}
+	}
+	return c.val, nil
+}
+
+func (c *CorrelatedExpr) GetExprType() FieldType {
+	return c.outerField
+}
+
+// SemiJoin returns the tuples of left that have at least one match in right,
+// or, if anti is set, the tuples of left that have no match in right.  A left
+// tuple matches a right tuple if every leftFields expression evaluates to the
+// same value as the corresponding rightFields expression.  Unlike
+// [EqualityJoin], each left tuple is returned at most once and only the left
+// fields are output.
+type SemiJoin struct {
+	leftFields, rightFields []Expr
+	left, right             Operator
+	anti                    bool
+}
+
+// Constructor for a semi (or anti) join.  Returns an error if the two lists of
+// expressions differ in length or in the types of their expressions.
+func NewSemiJoin(left Operator, leftFields []Expr, right Operator, rightFields []Expr, anti bool) (*SemiJoin, error) {
+	if len(leftFields) != len(rightFields) {
+		return nil, GoDBError{IllegalOperationError, "semi join requires the same number of fields on each side"}
+	}
+	for i := range leftFields {
+		if leftFields[i].GetExprType().Ftype != rightFields[i].GetExprType().Ftype {
+			return nil, GoDBError{TypeMismatchError, "can't semi join fields of different types"}
+		}
+	}
+	return &SemiJoin{leftFields, rightFields, left, right, anti}, nil
+}
+
+// The semi join outputs only tuples of its left input.
+func (sj *SemiJoin) Descriptor() *TupleDesc {
+	return sj.left.Descriptor().copy()
+}
+
+func (sj *SemiJoin) DescribePlan() (*PlanDescription, []Operator) {
+	name := "Semi Join"
+	if sj.anti {
+		name = "Anti Join"
+	}
+	return newPlanDescription(name, "keys", describeJoinKeys(sj.leftFields, sj.rightFields)), []Operator{sj.left, sj.right}
+}
+
+// Return the tuple of values of exprs applied to t, used as the key of t in
+// the semi join's hash table.
+func evalKeyTuple(exprs []Expr, t *Tuple) (*Tuple, error) {
+	key := &Tuple{Fields: make([]DBValue, len(exprs))}
+	for i, e := range exprs {
+		v, err := e.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		key.Fields[i] = v
+	}
+	return key, nil
+}
+
+// Semi join implementation.  The right input is read in its entirety into a
+// hash table of its join keys the first time the iterator is invoked; left
+// tuples are then streamed through and probe the table.
+func (sj *SemiJoin) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	leftIter, err := sj.left.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]bool
+	mem := newMemoryAccount(ctx, "Semi Join")
+	return func() (*Tuple, error) {
+		if keys == nil {
+			keys = make(map[string]bool)
+			rightIter, err := sj.right.Iterator(ctx, tid)
+			if err != nil {
+				return nil, err
+			}
+			for {
+				t, err := rightIter()
+				if err != nil {
+					mem.release()
+					return nil, err
+				}
+				if t == nil {
+					break
+				}
+				key, err := evalKeyTuple(sj.rightFields, t)
+				if err != nil {
+					mem.release()
+					return nil, err
+				}
+				k := key.tupleKey()
+				if !keys[k] {
+					if err := mem.reserve(keyMemorySize(len(k))); err != nil {
+						mem.release()
+						return nil, err
+					}
+					keys[k] = true
+				}
+			}
+		}
+		for {
+			t, err := leftIter()
+			if err != nil {
+				mem.release()
+				return nil, err
+			}
+			if t == nil {
+				mem.release()
+				return nil, nil
+			}
+			key, err := evalKeyTuple(sj.leftFields, t)
+			if err != nil {
+				return nil, err
+			}
+			if keys[key.tupleKey()] != sj.anti {
+				return t, nil
+			}
+		}
+	}, nil
+}
+
+// SubqueryFilter filters the tuples of its child on the result of a subquery,
+// re-evaluating the subquery for each child tuple after binding its correlated
+// parameters from that tuple.  This is the fallback for subqueries the parser
+// cannot decorrelate into a [SemiJoin]; an uncorrelated subquery (one without
+// params) is only evaluated once.
+type SubqueryFilter struct {
+	child    Operator
+	subquery Operator
+	params   []*CorrelatedExpr
+	kind     SubqueryType
+	negated  bool
+
+	// For IN and scalar subqueries, the expression over the child's tuples
+	// that is compared against the subquery's output column using op
+	expr Expr
+	op   BoolOp
+}
+
+// Constructor for a subquery filter.  For an [InSubquery] the child tuple
+// passes if expr is equal to some value returned by the subquery; for a
+// [ScalarSubquery] it passes if expr op value is true for the single value the
+// subquery returns; for an [ExistsSubquery] it passes if the subquery returns
+// any tuple.  If negated is set, the result of the test is inverted (e.g., for
+// NOT IN and NOT EXISTS).
+func NewSubqueryFilter(child Operator, subquery Operator, params []*CorrelatedExpr, kind SubqueryType, negated bool, expr Expr, op BoolOp) (*SubqueryFilter, error) {
+	if kind != ExistsSubquery {
+		desc := subquery.Descriptor()
+		if len(desc.Fields) != 1 {
+			return nil, GoDBError{IllegalOperationError, "subquery must return exactly one column"}
+		}
+		if expr == nil || expr.GetExprType().Ftype != desc.Fields[0].Ftype {
+			return nil, GoDBError{TypeMismatchError, "cannot compare expression to subquery of a different type"}
+		}
+	}
+	return &SubqueryFilter{child, subquery, params, kind, negated, expr, op}, nil
+}
+
+func (sf *SubqueryFilter) Descriptor() *TupleDesc {
+	return sf.child.Descriptor().copy()
+}
+
+// The subquery is described as the second child of the filter.
+func (sf *SubqueryFilter) DescribePlan() (*PlanDescription, []Operator) {
+	pred := "exists"
+	switch sf.kind {
+	case InSubquery:
+		pred = exprToStr(sf.expr) + " in"
+	case ScalarSubquery:
+		pred = exprToStr(sf.expr) + " " + strings.TrimSpace(opToStr(sf.op))
+	}
+	if sf.negated {
+		pred = "not " + pred
+	}
+	params := ""
+	if len(sf.params) > 0 {
+		params = fmt.Sprint(len(sf.params))
+	}
+	return newPlanDescription("Subquery Filter", "predicate", pred+" (subquery)", "correlated params", params), []Operator{sf.child, sf.subquery}
+}
+
+// Run the subquery and return the values of its first column (for EXISTS,
+// just whether it produced any tuple, as a single element list), charging
+// the values to mem
+func (sf *SubqueryFilter) evalSubquery(ctx context.Context, tid TransactionID, mem *memoryAccount) ([]DBValue, error) {
+	//an EXISTS subquery stops at its first tuple, so cancel the rest of it
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	iter, err := sf.subquery.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	var vals []DBValue
+	for {
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return vals, nil
+		}
+		if sf.kind == ExistsSubquery {
+			return []DBValue{IntField{1}}, nil
+		}
+		if sf.kind == ScalarSubquery && len(vals) > 0 {
+			return nil, GoDBError{IllegalOperationError, "scalar subquery returned more than one row"}
+		}
+		if err := mem.reserve(tupleMemorySize(&Tuple{Fields: t.Fields[:1]})); err != nil {
+			return nil, err
+		}
+		vals = append(vals, t.Fields[0])
+	}
+}
+
+// Compare two values using op, returning false if they are not both ints or
+// both strings
+func compareValues(v1 DBValue, v2 DBValue, op BoolOp) bool {
+	switch v1 := v1.(type) {
+	case IntField:
+		v2, ok := v2.(IntField)
+		return ok && evalPred(v1.Value, v2.Value, op)
+	case StringField:
+		v2, ok := v2.(StringField)
+		return ok && evalPred(v1.Value, v2.Value, op)
+	}
+	return false
+}
+
+// Subquery filter implementation.  For each child tuple, binds the
+// subquery's correlated parameters, evaluates the subquery, and returns the
+// child tuple if it passes the test described in [NewSubqueryFilter].
+func (sf *SubqueryFilter) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := sf.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	var cached []DBValue
+	haveCached := false
+	mem := newMemoryAccount(ctx, "Subquery Filter")
+	return func() (*Tuple, error) {
+		for {
+			t, err := iter()
+			if err != nil || t == nil {
+				mem.release()
+				return nil, err
+			}
+
+			vals := cached
+			if !haveCached {
+				for _, p := range sf.params {
+					p.val, err = (&FieldExpr{p.outerField}).EvalExpr(t)
+					if err != nil {
+						return nil, err
+					}
+				}
+				//the values of the previous evaluation are no longer needed
+				mem.release()
+				vals, err = sf.evalSubquery(ctx, tid, mem)
+				if err != nil {
+					mem.release()
+					return nil, err
+				}
+				if len(sf.params) == 0 {
+					cached = vals
+					haveCached = true
+				}
+			}
+
+			match := false
+			switch sf.kind {
+			case ExistsSubquery:
+				match = len(vals) > 0
+			case InSubquery, ScalarSubquery:
+				v, err := sf.expr.EvalExpr(t)
+				if err != nil {
+					return nil, err
+				}
+				op := sf.op
+				if sf.kind == InSubquery {
+					op = OpEq
+				}
+				for _, subv := range vals {
+					if compareValues(v, subv, op) {
+						match = true
+						break
+					}
+				}
+			}
+			if match != sf.negated {
+				return t, nil
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,104 @@
+package godb
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// Make a second heap file with the same schema as the one returned by
+// makeTestVars, containing a single copy of t1
+func makeSubqueryTestVars(t *testing.T) (TupleDesc, Tuple, Tuple, *HeapFile, *HeapFile, TransactionID) {
+	td, t1, t2, hf, bp, tid := makeTestVars()
+	hf.insertTuple(context.Background(), &t1, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+	hf.insertTuple(context.Background(), &t2, tid)
+
+	os.Remove(JoinTestFile)
+	hf2, err := NewHeapFile(JoinTestFile, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	hf2.insertTuple(context.Background(), &t1, tid)
+	return td, t1, t2, hf, hf2, tid
+}
+
+func TestSemiJoin(t *testing.T) {
+	td, t1, t2, hf, hf2, tid := makeSubqueryTestVars(t)
+	hf2.insertTuple(context.Background(), &t1, tid)
+
+	field := []Expr{&FieldExpr{td.Fields[0]}}
+	sj, err := NewSemiJoin(hf, field, hf2, field, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := sj.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// each matching left tuple is output once, no matter how many matches
+	if !CheckIfOutputMatches(iter, []*Tuple{&t1}) {
+		t.Errorf("unexpected semi join output")
+	}
+
+	aj, err := NewSemiJoin(hf, field, hf2, field, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = aj.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !CheckIfOutputMatches(iter, []*Tuple{&t2, &t2}) {
+		t.Errorf("unexpected anti join output")
+	}
+
+	_, err = NewSemiJoin(hf, field, hf2, []Expr{&FieldExpr{td.Fields[1]}}, false)
+	if err == nil {
+		t.Errorf("expected error semi joining fields of different types")
+	}
+}
+
+func TestSubqueryFilter(t *testing.T) {
+	td, t1, t2, hf, hf2, tid := makeSubqueryTestVars(t)
+
+	// IN: hf.name in (select name from hf2)
+	sub, err := NewProjectOp([]Expr{&FieldExpr{td.Fields[0]}}, []string{"name"}, false, hf2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sf, err := NewSubqueryFilter(hf, sub, nil, InSubquery, false, &FieldExpr{td.Fields[0]}, OpEq)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err := sf.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !CheckIfOutputMatches(iter, []*Tuple{&t1}) {
+		t.Errorf("unexpected in subquery output")
+	}
+
+	// correlated NOT EXISTS: not exists (select * from hf2 where hf2.age = hf.age)
+	param := &CorrelatedExpr{td.Fields[1], nil}
+	filt, err := NewFilter(&FieldExpr{td.Fields[1]}, OpEq, param, hf2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	sf, err = NewSubqueryFilter(hf, filt, []*CorrelatedExpr{param}, ExistsSubquery, true, nil, OpEq)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	iter, err = sf.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !CheckIfOutputMatches(iter, []*Tuple{&t2, &t2}) {
+		t.Errorf("unexpected correlated not exists output")
+	}
+
+	_, err = NewSubqueryFilter(hf, hf2, nil, InSubquery, false, &FieldExpr{td.Fields[0]}, OpEq)
+	if err == nil {
+		t.Errorf("expected error for in subquery with two columns")
+	}
+}
@@ -0,0 +1,161 @@
+package godb
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+// tempFile is a heap file holding intermediate results of a query, e.g., a
+// materialized common table expression.  A temporary file is private to the
+// operator that created it and is deleted once it is no longer needed, so
+// rather than going through the buffer pool (which would pin its dirty pages
+// in memory until the transaction ends), its pages are written and read
+// directly.  Tuples are appended to an in-memory page that is written to the
+// end of the file when it fills up.
+type tempFile struct {
+	file      *HeapFile
+	page      *heapPage
+	numPages  int
+	numTuples int
+}
+
+// Create a new, empty temporary file for tuples with the supplied descriptor
+// in the operating system's temporary directory.
+func newTempFile(desc *TupleDesc) (*tempFile, error) {
+	f, err := os.CreateTemp("", "godb-*.dat")
+	if err != nil {
+		return nil, err
+	}
+	name := f.Name()
+	f.Close()
+	hf, err := NewHeapFile(name, desc, nil)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	return &tempFile{file: hf}, nil
+}
+
+// Append a copy of t to the file.
+func (tf *tempFile) append(t *Tuple) error {
+	tup := &Tuple{Desc: tf.file.Desc, Fields: t.Fields}
+	if tf.page != nil {
+		rid, err := tf.page.insertTuple(tup)
+		if err != nil {
+			return err
+		}
+		if rid != nil {
+			tf.numTuples++
+			return nil
+		}
+		//page is full, so write it out and start a new one
+		if err := tf.flush(); err != nil {
+			return err
+		}
+	}
+	tf.page = newHeapPage(&tf.file.Desc, tf.numPages, tf.file)
+	rid, err := tf.page.insertTuple(tup)
+	if err != nil {
+		return err
+	}
+	if rid == nil {
+		return GoDBError{MalformedDataError, "tuple does not fit on an empty page"}
+	}
+	tf.numTuples++
+	return nil
+}
+
+// Write the current page, if any, to the end of the file.
+func (tf *tempFile) flush() error {
+	if tf.page == nil {
+		return nil
+	}
+	var p Page = tf.page
+	if err := tf.file.flushPage(&p); err != nil {
+		return err
+	}
+	tf.page = nil
+	tf.numPages++
+	return nil
+}
+
+// Iterate through the tuples of the file in the order they were appended.
+// Tuples must not be appended while an iterator is in use.
+func (tf *tempFile) Iterator() (func() (*Tuple, error), error) {
+	if err := tf.flush(); err != nil {
+		return nil, err
+	}
+	pageNo := 0
+	var pageIter func() (*Tuple, error)
+	return func() (*Tuple, error) {
+		for {
+			if pageIter == nil {
+				if pageNo >= tf.numPages {
+					return nil, nil
+				}
+				p, err := tf.file.readPage(pageNo)
+				if err != nil {
+					return nil, err
+				}
+				pageIter = (*p).(*heapPage).tupleIter()
+				pageNo++
+			}
+			t, err := pageIter()
+			if err != nil {
+				return nil, err
+			}
+			if t != nil {
+				return t, nil
+			}
+			pageIter = nil
+		}
+	}, nil
+}
+
+// Delete the file.  It may not be used afterwards.
+func (tf *tempFile) close() error {
+	tf.page = nil
+	return os.Remove(tf.file.Filename)
+}
+
+// Wrap the iterator of an operator that holds temporary files so that they
+// are deleted, by calling cleanup, once ctx is done, even if the iterator is
+// abandoned before it is exhausted, e.g., under a [LimitOp].  The iterator
+// returns ctx's error from then on, and deletes the files itself if it is
+// called before cleanup has been.  Calls to the iterator and cleanup are
+// serialized, as ctx may be canceled from another goroutine; cleanup must be
+// safe to call after the iterator has deleted some of the files itself.
+func closeOnCancel(ctx context.Context, iter func() (*Tuple, error), cleanup func()) func() (*Tuple, error) {
+	var mutex sync.Mutex
+	closed := false
+	stop := context.AfterFunc(ctx, func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !closed {
+			closed = true
+			cleanup()
+		}
+	})
+	return func() (*Tuple, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		//ctx may be done before the function registered with AfterFunc,
+		//which runs in a goroutine of its own, has been called
+		if !closed && ctx.Err() != nil {
+			closed = true
+			stop()
+			cleanup()
+		}
+		if closed {
+			return nil, ctx.Err()
+		}
+		t, err := iter()
+		if err != nil || t == nil {
+			//the iterator deletes its files once it is done
+			closed = true
+			stop()
+		}
+		return t, err
+	}
+}
@@ -0,0 +1,62 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTempFile(t *testing.T) {
+	td, t1, t2, _, _, _ := makeTestVars()
+	tf, err := newTempFile(&td)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// enough tuples to span several pages
+	n := 3 * (PageSize / 40)
+	for i := 0; i < n; i++ {
+		tup := &t1
+		if i%2 == 1 {
+			tup = &t2
+		}
+		if err := tf.append(tup); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if tf.numPages < 2 {
+		t.Errorf("expected tuples to be written to more than one page, got %d pages", tf.numPages)
+	}
+
+	iter, err := tf.Iterator()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		expected := &t1
+		if cnt%2 == 1 {
+			expected = &t2
+		}
+		if !tup.equals(expected) {
+			t.Fatalf("unexpected tuple %v at position %d", tup, cnt)
+		}
+		cnt++
+	}
+	if cnt != n {
+		t.Errorf("expected %d tuples, got %d", n, cnt)
+	}
+
+	name := tf.file.Filename
+	if err := tf.close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected temporary file to be removed")
+	}
+}
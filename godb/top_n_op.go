@@ -0,0 +1,162 @@
+package godb
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// TopN returns the first limit tuples of its child in the order given by its
+// order by expressions, i.e., it computes ORDER BY ... LIMIT limit.  Rather
+// than sorting all of its input, it keeps the best limit tuples seen so far in
+// a bounded heap, so it takes O(n log k) time and O(k) memory for n input
+// tuples and a limit of k.
+type TopN struct {
+	orderBy   []Expr
+	ascending []bool
+	limit     int
+	child     Operator
+}
+
+// Construct a TopN operator.  orderByFields and ascending are as for
+// [NewOrderBy], and limit is the number of tuples to return.
+func NewTopN(orderByFields []Expr, child Operator, ascending []bool, limit int) (*TopN, error) {
+	if len(orderByFields) != len(ascending) {
+		return nil, GoDBError{IllegalOperationError, "number of order by expressions and sort directions differ"}
+	}
+	if limit < 0 {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("limit %d is negative", limit)}
+	}
+	return &TopN{orderByFields, ascending, limit, child}, nil
+}
+
+func (tn *TopN) Descriptor() *TupleDesc {
+	return tn.child.Descriptor().copy()
+}
+
+func (tn *TopN) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Top N", "limit", fmt.Sprint(tn.limit), "keys", describeOrder(tn.orderBy, tn.ascending)), []Operator{tn.child}
+}
+
+// TopN implementation.  Like [OrderBy], the operator is blocking: it consumes
+// all of the child's tuples the first time the iterator is invoked, and then
+// returns the kept tuples in order.  Tuples that compare equal are returned in
+// the order the child produced them, so the result is the same as that of an
+// [OrderBy] followed by a [LimitOp].
+func (tn *TopN) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := tn.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	var tups []*Tuple
+	i := 0
+	done := false
+	mem := newMemoryAccount(ctx, "Top N")
+	return func() (*Tuple, error) {
+		if !done {
+			var err error
+			tups, err = tn.top(childIter, mem)
+			if err != nil {
+				mem.release()
+				return nil, err
+			}
+			done = true
+		}
+		if i == len(tups) {
+			mem.release()
+			return nil, nil
+		}
+		i++
+		return tups[i-1], nil
+	}, nil
+}
+
+// Return the first tn.limit tuples of iter, in order, charging the kept
+// tuples to mem.
+func (tn *TopN) top(iter func() (*Tuple, error), mem *memoryAccount) ([]*Tuple, error) {
+	h := &topNHeap{less: func(t1, t2 *Tuple) bool {
+		return tupleLess(t1, t2, tn.orderBy, tn.ascending)
+	}}
+	for seq := 0; ; seq++ {
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		if tn.limit == 0 {
+			continue
+		}
+		entry := topNEntry{t, seq}
+		if h.Len() < tn.limit {
+			if err := mem.reserve(tupleMemorySize(t)); err != nil {
+				return nil, err
+			}
+			heap.Push(h, entry)
+		} else if h.before(entry, h.entries[0]) {
+			//t sorts before the worst tuple kept so far, which it replaces
+			mem.releaseBytes(tupleMemorySize(h.entries[0].tup))
+			if err := mem.reserve(tupleMemorySize(t)); err != nil {
+				return nil, err
+			}
+			h.entries[0] = entry
+			heap.Fix(h, 0)
+		}
+	}
+	sort.Slice(h.entries, func(i, j int) bool {
+		return h.before(h.entries[i], h.entries[j])
+	})
+	tups := make([]*Tuple, len(h.entries))
+	for i, e := range h.entries {
+		tups[i] = e.tup
+	}
+	return tups, nil
+}
+
+// A tuple kept by a [TopN], along with its position in the input
+type topNEntry struct {
+	tup *Tuple
+	seq int
+}
+
+// topNHeap implements [heap.Interface] as a max-heap, so that the root is the
+// tuple that sorts last among those kept, i.e., the one to evict first.
+type topNHeap struct {
+	entries []topNEntry
+	less    func(t1, t2 *Tuple) bool
+}
+
+// Return true if a sorts before b; ties are broken by input position.
+func (h *topNHeap) before(a, b topNEntry) bool {
+	if h.less(a.tup, b.tup) {
+		return true
+	}
+	if h.less(b.tup, a.tup) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (h *topNHeap) Len() int {
+	return len(h.entries)
+}
+
+func (h *topNHeap) Less(i, j int) bool {
+	return h.before(h.entries[j], h.entries[i])
+}
+
+func (h *topNHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+}
+
+func (h *topNHeap) Push(x any) {
+	h.entries = append(h.entries, x.(topNEntry))
+}
+
+func (h *topNHeap) Pop() any {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return e
+}
@@ -0,0 +1,73 @@
+package godb
+
+import (
+	"context"
+	"testing"
+)
+
+// Return all tuples produced by op
+func collectTuples(t *testing.T, op Operator, tid TransactionID) []*Tuple {
+	iter, err := op.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var tups []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return tups
+		}
+		tups = append(tups, tup)
+	}
+}
+
+// check that a top n operator returns the same tuples, in the same order, as
+// a full sort followed by a limit, including when the sort keys have ties
+func TestTopN(t *testing.T) {
+	td, _, _, hf, _, tid := makeTestVars()
+	for i := 0; i < 50; i++ {
+		name := string(rune('a' + i%26))
+		tup := Tuple{td, []DBValue{StringField{name}, IntField{int64((i * 7) % 13)}}, nil}
+		if err := hf.insertTuple(context.Background(), &tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	age := &FieldExpr{td.Fields[1]}
+	name := &FieldExpr{td.Fields[0]}
+	for _, test := range []struct {
+		exprs     []Expr
+		ascending []bool
+	}{
+		{[]Expr{age}, []bool{true}},
+		{[]Expr{age}, []bool{false}},
+		{[]Expr{age, name}, []bool{false, true}},
+	} {
+		for _, limit := range []int{0, 1, 5, 13, 50, 100} {
+			topN, err := NewTopN(test.exprs, hf, test.ascending, limit)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			oby, err := NewOrderBy(test.exprs, hf, test.ascending)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			lim := NewLimitOp(&ConstExpr{IntField{int64(limit)}, IntType}, oby)
+			got, expected := collectTuples(t, topN, tid), collectTuples(t, lim, tid)
+			if len(got) != len(expected) {
+				t.Fatalf("limit %d: expected %d tuples, got %d", limit, len(expected), len(got))
+			}
+			for i := range got {
+				if !got[i].equals(expected[i]) {
+					t.Fatalf("limit %d: expected %v at position %d, got %v", limit, expected[i].Fields, i, got[i].Fields)
+				}
+			}
+		}
+	}
+
+	if _, err := NewTopN([]Expr{age}, hf, []bool{true}, -1); err == nil {
+		t.Errorf("expected error for negative limit")
+	}
+}
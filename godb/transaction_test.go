@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -32,7 +33,7 @@ func readXaction(hf *HeapFile, bp *BufferPool, wg *sync.WaitGroup) {
 		tid := NewTID()
 		bp.BeginTransaction(tid)
 		pgCnt1 := hf.NumPages()
-		it, _ := hf.Iterator(tid)
+		it, _ := hf.Iterator(context.Background(), tid)
 		cnt1 := 0
 
 		for {
@@ -48,7 +49,7 @@ func readXaction(hf *HeapFile, bp *BufferPool, wg *sync.WaitGroup) {
 			cnt1++
 		}
 
-		it, _ = hf.Iterator(tid)
+		it, _ = hf.Iterator(context.Background(), tid)
 		cnt2 := 0
 		for {
 			t, err := it()
@@ -83,7 +84,7 @@ func writeXaction(hf *HeapFile, bp *BufferPool, writeTuple Tuple, wg *sync.WaitG
 		tid := NewTID()
 		bp.BeginTransaction(tid)
 		for i := 0; i < 10; i++ {
-			err := hf.insertTuple(&writeTuple, tid)
+			err := hf.insertTuple(context.Background(), &writeTuple, tid)
 			if err != nil {
 				// Assume this is because of a deadlock, restart txn
 				time.Sleep(time.Duration(rand.Intn(8)) * 100 * time.Microsecond)
@@ -107,12 +108,12 @@ func TestTransactions(t *testing.T) {
 	var wg sync.WaitGroup
 
 	for i := 0; i < 1000; i++ {
-		err := hf.insertTuple(&t1, tid)
+		err := hf.insertTuple(context.Background(), &t1, tid)
 		if err != nil {
 			fmt.Print(err.Error())
 			t.Errorf("transaction test failed 1")
 		}
-		err = hf.insertTuple(&t2, tid)
+		err = hf.insertTuple(context.Background(), &t2, tid)
 		if err != nil {
 			fmt.Print(err.Error())
 			t.Errorf("transaction test failed 2")
@@ -167,18 +168,18 @@ func transactionTestSetUp(t *testing.T) (*BufferPool, *HeapFile, TransactionID,
 
 func TestAttemptTransactionTwice(t *testing.T) {
 	bp, hf, tid1, tid2, _ := transactionTestSetUp(t)
-	bp.GetPage(hf, 0, tid1, ReadPerm)
-	bp.GetPage(hf, 1, tid1, WritePerm)
+	bp.GetPage(context.Background(), hf, 0, tid1, ReadPerm)
+	bp.GetPage(context.Background(), hf, 1, tid1, WritePerm)
 	bp.CommitTransaction(tid1)
 
-	bp.GetPage(hf, 0, tid2, WritePerm)
-	bp.GetPage(hf, 1, tid2, WritePerm)
+	bp.GetPage(context.Background(), hf, 0, tid2, WritePerm)
+	bp.GetPage(context.Background(), hf, 1, tid2, WritePerm)
 }
 
 func testTransactionComplete(t *testing.T, commit bool) {
 	bp, hf, tid1, tid2, t1 := transactionTestSetUp(t)
 
-	pg, _ := bp.GetPage(hf, 2, tid1, WritePerm)
+	pg, _ := bp.GetPage(context.Background(), hf, 2, tid1, WritePerm)
 	heapp := (*pg).(*heapPage)
 	heapp.insertTuple(&t1)
 	heapp.setDirty(true)
@@ -191,7 +192,7 @@ func testTransactionComplete(t *testing.T, commit bool) {
 
 	bp.FlushAllPages()
 
-	pg, _ = bp.GetPage(hf, 2, tid2, WritePerm)
+	pg, _ = bp.GetPage(context.Background(), hf, 2, tid2, WritePerm)
 	heapp = (*pg).(*heapPage)
 	iter := heapp.tupleIter()
 
@@ -229,7 +230,7 @@ func (i *Singleton) Descriptor() *TupleDesc {
 	return &i.tup.Desc
 }
 
-func (i *Singleton) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+func (i *Singleton) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	return func() (*Tuple, error) {
 		if i.ran {
 			return nil, nil
@@ -260,7 +261,7 @@ func validateTransactions(t *testing.T, threads int) {
 		for tid := TransactionID(nil); ; bp.AbortTransaction(tid) {
 			tid = NewTID()
 			bp.BeginTransaction(tid)
-			iter1, err := hf.Iterator(tid)
+			iter1, err := hf.Iterator(context.Background(), tid)
 			if err != nil {
 				continue
 			}
@@ -279,7 +280,7 @@ func validateTransactions(t *testing.T, threads int) {
 			time.Sleep(1 * time.Millisecond)
 
 			dop := NewDeleteOp(hf, hf)
-			iterDel, err := dop.Iterator(tid)
+			iterDel, err := dop.Iterator(context.Background(), tid)
 			if err != nil {
 				continue
 			}
@@ -291,7 +292,7 @@ func validateTransactions(t *testing.T, threads int) {
 				t.Errorf("Delete Op should return 1")
 			}
 			iop := NewInsertOp(hf, &Singleton{writeTup, false})
-			iterIns, err := iop.Iterator(tid)
+			iterIns, err := iop.Iterator(context.Background(), tid)
 			if err != nil {
 				continue
 			}
@@ -328,7 +329,7 @@ func validateTransactions(t *testing.T, threads int) {
 
 	tid := NewTID()
 	bp.BeginTransaction(tid)
-	iter, _ := hf.Iterator(tid)
+	iter, _ := hf.Iterator(context.Background(), tid)
 	tup, _ := iter()
 
 	diff := tup.Fields[1].(IntField).Value - t2.Fields[1].(IntField).Value
@@ -357,7 +358,7 @@ func TestAllDirtyFails(t *testing.T) {
 	td, t1, _, hf, bp, tid := makeTestVars()
 
 	for hf.NumPages() < 3 {
-		hf.insertTuple(&t1, tid)
+		hf.insertTuple(context.Background(), &t1, tid)
 		if hf.NumPages() == 0 {
 			t.Fatalf("Heap file should have at least one page after insertion.")
 		}
@@ -370,13 +371,13 @@ func TestAllDirtyFails(t *testing.T) {
 	bp.BeginTransaction(tid2)
 
 	for hf2.NumPages() < 3 { // make three dirty pages
-		hf2.insertTuple(&t1, tid2)
+		hf2.insertTuple(context.Background(), &t1, tid2)
 		if hf2.NumPages() == 0 {
 			t.Fatalf("Heap file should have at least one page after insertion.")
 		}
 	}
 
-	_, err := bp.GetPage(hf, 0, tid2, ReadPerm) // since bp capacity = 3, should return error due to all dirty pages
+	_, err := bp.GetPage(context.Background(), hf, 0, tid2, ReadPerm) // since bp capacity = 3, should return error due to all dirty pages
 	if err == nil {
 		t.Errorf("Expected error due to all dirty pages")
 	}
@@ -384,7 +385,7 @@ func TestAllDirtyFails(t *testing.T) {
 
 func TestAbortEviction(t *testing.T) {
 	tupExists := func(t0 Tuple, tid TransactionID, hf *HeapFile) (bool, error) {
-		iter, err := hf.Iterator(tid)
+		iter, err := hf.Iterator(context.Background(), tid)
 		if err != nil {
 			return false, err
 		}
@@ -400,7 +401,7 @@ func TestAbortEviction(t *testing.T) {
 	}
 
 	_, t1, _, hf, bp, tid := makeTestVars()
-	hf.insertTuple(&t1, tid)
+	hf.insertTuple(context.Background(), &t1, tid)
 	if exists, err := tupExists(t1, tid, hf); !(exists == true && err == nil) {
 		t.Errorf("Tuple should exist")
 	}
@@ -8,8 +8,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strings"
-
-	"github.com/mitchellh/hashstructure/v2"
 )
 
 // DBType is the type of a tuple field, in GoDB, e.g., IntType or StringType
@@ -340,31 +338,34 @@ func (t *Tuple) compareField(t2 *Tuple, field Expr) (orderByState, error) {
 func (t *Tuple) project(fields []FieldType) (*Tuple, error) {
 	projected := &Tuple{}
 
-	add := []int{}
 	for _, field := range fields {
-		for i, t := range t.Desc.Fields {
-			if field.Fname == t.Fname && field.TableQualifier == t.TableQualifier {
-				add = append(add, i)
-			} else if field.Fname == t.Fname {
-				add = append(add, i)
+		best := -1
+		for i, f := range t.Desc.Fields {
+			if field.Fname != f.Fname {
+				continue
+			}
+			if field.TableQualifier == f.TableQualifier {
+				best = i
+				break
+			}
+			if best == -1 {
+				best = i
 			}
 		}
-	}
-
-	for _, i := range add {
-		projected.Fields = append(projected.Fields, t.Fields[i])
+		if best == -1 {
+			return nil, GoDBError{IncompatibleTypesError, fmt.Sprintf("field %s.%s not found", field.TableQualifier, field.Fname)}
+		}
+		projected.Fields = append(projected.Fields, t.Fields[best])
 	}
 
 	return projected, nil
 }
 
-// Compute a key for the tuple to be used in a map structure
-func (t *Tuple) tupleKey() any {
-
-	//todo efficiency here is poor - hashstructure is probably slow
-	hash, _ := hashstructure.Hash(t, hashstructure.FormatV2, nil)
-
-	return hash
+// Compute a key for the tuple to be used in a map structure.  The key is the
+// encoding of the tuple's field values (see [appendTupleKey]), so it depends
+// only on the values and not on the tuple's descriptor.
+func (t *Tuple) tupleKey() string {
+	return string(appendTupleKey(nil, t.Fields))
 }
 
 var winWidth int = 120
@@ -0,0 +1,58 @@
+package godb
+
+import (
+	"encoding/binary"
+)
+
+// Hash-based operators (e.g., [Aggregator], [Distinct] and [SetOp]) key tuples
+// by a byte encoding of their field values.  The encoding is typed and
+// self-delimiting: each value is a type tag followed by the 8 byte big endian
+// integer, or the varint length and bytes of the string.  Two lists of values
+// thus have the same encoding if and only if they are equal, so maps keyed by
+// the encoding (as a string) compare keys exactly, and never confuse tuples
+// whose hashes collide.
+
+const (
+	intKeyTag    byte = 'i'
+	stringKeyTag byte = 's'
+)
+
+// Append the key encoding of fields to buf, returning the extended buffer.
+// Encoding into a buffer that is reused across tuples, and looking the key up
+// with m[string(buf)], doesn't allocate.
+func appendTupleKey(buf []byte, fields []DBValue) []byte {
+	for _, f := range fields {
+		switch f := f.(type) {
+		case IntField:
+			buf = append(buf, intKeyTag)
+			buf = binary.BigEndian.AppendUint64(buf, uint64(f.Value))
+		case StringField:
+			buf = append(buf, stringKeyTag)
+			buf = binary.AppendUvarint(buf, uint64(len(f.Value)))
+			buf = append(buf, f.Value...)
+		}
+	}
+	return buf
+}
+
+const (
+	fnvOffset uint64 = 14695981039346656037
+	fnvPrime  uint64 = 1099511628211
+)
+
+// Return the 64-bit FNV-1a hash of key, seeded with seed.  Tuples are
+// partitioned on hashes with different seeds at each level of recursive
+// partitioning, so that a partition that is too large is split differently at
+// the next level.
+func hashKey(key []byte, seed uint64) uint64 {
+	h := fnvOffset
+	for i := 0; i < 8; i++ {
+		h ^= (seed >> (8 * i)) & 0xff
+		h *= fnvPrime
+	}
+	for _, b := range key {
+		h ^= uint64(b)
+		h *= fnvPrime
+	}
+	return h
+}
@@ -0,0 +1,65 @@
+package godb
+
+import (
+	"testing"
+)
+
+// tuples have the same key if and only if their fields are equal
+func TestTupleKey(t *testing.T) {
+	td, t1, t2, _, _, _ := makeTestVars()
+	distinct := [][]DBValue{
+		t1.Fields,
+		t2.Fields,
+		{StringField{"ab"}, StringField{"c"}},
+		{StringField{"a"}, StringField{"bc"}},
+		{StringField{""}, StringField{"abc"}},
+		{IntField{0}},
+		{IntField{-1}},
+		{StringField{""}},
+		{StringField{"\x00"}},
+		{IntField{97}, StringField{""}},
+		{},
+	}
+	keys := make(map[string]int)
+	for i, fields := range distinct {
+		key := string(appendTupleKey(nil, fields))
+		if j, ok := keys[key]; ok {
+			t.Errorf("fields %v and %v have the same key", distinct[j], fields)
+		}
+		keys[key] = i
+	}
+
+	//the key depends only on the values of the fields, not the descriptor
+	other := Tuple{TupleDesc{[]FieldType{{"n", "x", StringType}, {"a", "x", IntType}}}, t1.Fields, nil}
+	if t1.tupleKey() != other.tupleKey() {
+		t.Errorf("expected tuples with equal fields to have equal keys")
+	}
+	copied := Tuple{td, []DBValue{StringField{"sam"}, IntField{25}}, nil}
+	if t1.tupleKey() != copied.tupleKey() {
+		t.Errorf("expected tuples with equal fields to have equal keys")
+	}
+
+	//appending to a reused buffer doesn't allocate
+	buf := appendTupleKey(nil, t2.Fields)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = appendTupleKey(buf[:0], t2.Fields)
+		_ = keys[string(buf)]
+	})
+	if allocs != 0 {
+		t.Errorf("expected encoding keys into a reused buffer not to allocate, got %v allocations", allocs)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	_, t1, t2, _, _, _ := makeTestVars()
+	k1, k2 := appendTupleKey(nil, t1.Fields), appendTupleKey(nil, t2.Fields)
+	if hashKey(k1, 0) != hashKey(append([]byte{}, k1...), 0) {
+		t.Errorf("expected equal keys to have equal hashes")
+	}
+	if hashKey(k1, 0) == hashKey(k2, 0) {
+		t.Errorf("expected different keys to have different hashes")
+	}
+	if hashKey(k1, 0) == hashKey(k1, 1) {
+		t.Errorf("expected hashes with different seeds to differ")
+	}
+}
@@ -81,6 +81,37 @@ func TestTupleProject(t *testing.T) {
 	}
 }
 
+// Tuple.project() picks one field for each requested field, preferring the
+// one with the same table qualifier, and fails if there is none
+func TestTupleProjectQualifier(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{
+		{Fname: "name", TableQualifier: "t1", Ftype: StringType},
+		{Fname: "name", TableQualifier: "t2", Ftype: StringType},
+		{Fname: "age", TableQualifier: "t2", Ftype: IntType},
+	}}
+	t1 := Tuple{Desc: td, Fields: []DBValue{StringField{"sam"}, StringField{"george jones"}, IntField{25}}}
+	tNew, err := t1.project([]FieldType{
+		{Fname: "name", TableQualifier: "t2", Ftype: StringType},
+		{Fname: "name", TableQualifier: "t3", Ftype: StringType},
+		{Fname: "age", Ftype: IntType},
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []DBValue{StringField{"george jones"}, StringField{"sam"}, IntField{25}}
+	if len(tNew.Fields) != len(expected) {
+		t.Fatalf("expected %d fields after project, got %d", len(expected), len(tNew.Fields))
+	}
+	for i, f := range expected {
+		if tNew.Fields[i] != f {
+			t.Errorf("expected field %d to be %v, got %v", i, f, tNew.Fields[i])
+		}
+	}
+	if _, err := t1.project([]FieldType{{Fname: "salary", Ftype: IntType}}); err == nil {
+		t.Errorf("expected error projecting a field that doesn't exist")
+	}
+}
+
 // Unit test for Tuple.joinTuples()
 func TestTupleJoin(t *testing.T) {
 	_, t1, t2, _, _, _ := makeTestVars()
@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
@@ -24,6 +25,7 @@ const (
 	IllegalOperationError   GoDBErrorCode = iota
 	DeadlockError           GoDBErrorCode = iota
 	IllegalTransactionError GoDBErrorCode = iota
+	MemoryLimitError        GoDBErrorCode = iota
 )
 
 type GoDBError struct {
@@ -49,8 +51,8 @@ type Page interface {
 }
 
 type DBFile interface {
-	insertTuple(t *Tuple, tid TransactionID) error
-	deleteTuple(t *Tuple, tid TransactionID) error
+	insertTuple(ctx context.Context, t *Tuple, tid TransactionID) error
+	deleteTuple(ctx context.Context, t *Tuple, tid TransactionID) error
 
 	//methods used by buffer pool to manage retrieval of pages
 	readPage(pageNo int) (*Page, error)
@@ -62,7 +64,7 @@ type DBFile interface {
 
 type Operator interface {
 	Descriptor() *TupleDesc
-	Iterator(tid TransactionID) (func() (*Tuple, error), error)
+	Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error)
 }
 
 type BoolOp int
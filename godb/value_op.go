@@ -1,5 +1,10 @@
 package godb
 
+import (
+	"context"
+	"fmt"
+)
+
 //methods to expose an array of constant expressions as tuples
 // to iterate through (e.g., for insert statements or select from a constant list)
 
@@ -26,7 +31,11 @@ func (v *ValueOp) Descriptor() *TupleDesc {
 	return v.td
 }
 
-func (v *ValueOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+func (v *ValueOp) DescribePlan() (*PlanDescription, []Operator) {
+	return newPlanDescription("Values", "rows", fmt.Sprint(len(v.exprs))), nil
+}
+
+func (v *ValueOp) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
 	curTup := 0
 	return func() (*Tuple, error) {
 		if curTup >= len(v.exprs) {
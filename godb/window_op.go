@@ -0,0 +1,452 @@
+package godb
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Operator computing analytic window functions, e.g.,
+//
+//	SELECT name, age, RANK() OVER (PARTITION BY name ORDER BY age DESC) FROM t
+//
+// Unlike an aggregate, a window function produces one value per input tuple,
+// computed over the other tuples of its partition (the tuples with the same
+// values of the partition by expressions).  The window operator outputs each
+// input tuple extended with one field per window function, sorted by the
+// partition by expressions and then by the order by expressions.
+
+// The kinds of window functions.  Aggregate window functions compute an
+// [AggState] over a frame of the partition surrounding each tuple.
+type WindowFuncType int
+
+const (
+	RowNumberFunc WindowFuncType = iota
+	RankFunc      WindowFuncType = iota
+	DenseRankFunc WindowFuncType = iota
+	LagFunc       WindowFuncType = iota
+	LeadFunc      WindowFuncType = iota
+	AggWindowFunc WindowFuncType = iota
+)
+
+// One end of the frame of an aggregate window function, e.g., 2 PRECEDING
+type FrameBoundType int
+
+const (
+	UnboundedPreceding FrameBoundType = iota
+	OffsetPreceding    FrameBoundType = iota
+	CurrentRow         FrameBoundType = iota
+	OffsetFollowing    FrameBoundType = iota
+	UnboundedFollowing FrameBoundType = iota
+)
+
+type FrameBound struct {
+	kind   FrameBoundType
+	offset int // number of rows, for OffsetPreceding and OffsetFollowing
+}
+
+// The frame of an aggregate window function: the tuples of the partition,
+// relative to the current tuple, that the aggregate is computed over.  A ROWS
+// frame counts individual tuples; in a RANGE frame, CURRENT ROW includes all
+// of the peers of the current tuple (those with the same order by values), and
+// offsets are not supported.
+type WindowFrame struct {
+	rows       bool
+	start, end FrameBound
+}
+
+// The frame used when none is specified, RANGE BETWEEN UNBOUNDED PRECEDING
+// AND CURRENT ROW.  With an order by, this computes running aggregates;
+// without one, all tuples of a partition are peers, so it spans the partition.
+var DefaultWindowFrame = WindowFrame{false, FrameBound{UnboundedPreceding, 0}, FrameBound{CurrentRow, 0}}
+
+// Check that the frame is well formed, e.g., that it does not start after
+// the current row and end before it.
+func (f WindowFrame) validate() error {
+	if f.start.kind == UnboundedFollowing {
+		return GoDBError{ParseError, "window frame cannot start at UNBOUNDED FOLLOWING"}
+	}
+	if f.end.kind == UnboundedPreceding {
+		return GoDBError{ParseError, "window frame cannot end at UNBOUNDED PRECEDING"}
+	}
+	if f.start.kind > f.end.kind {
+		return GoDBError{ParseError, "window frame cannot start after it ends"}
+	}
+	if !f.rows && (f.start.kind == OffsetPreceding || f.start.kind == OffsetFollowing || f.end.kind == OffsetPreceding || f.end.kind == OffsetFollowing) {
+		return GoDBError{ParseError, "offsets are only supported in ROWS window frames"}
+	}
+	return nil
+}
+
+type WindowFunc struct {
+	kind  WindowFuncType
+	alias string
+
+	// argument, offset and default value of LAG and LEAD; if def is nil,
+	// the default is the zero value of the argument's type
+	expr   Expr
+	offset int
+	def    Expr
+
+	// aggregate computed by an aggregate window function, and its frame
+	agg   AggState
+	frame WindowFrame
+}
+
+// Construct a ROW_NUMBER, RANK or DENSE_RANK window function, whose output
+// field is named alias.
+func NewRankingWindowFunc(kind WindowFuncType, alias string) (*WindowFunc, error) {
+	if kind != RowNumberFunc && kind != RankFunc && kind != DenseRankFunc {
+		return nil, GoDBError{IllegalOperationError, "not a ranking window function"}
+	}
+	return &WindowFunc{kind: kind, alias: alias}, nil
+}
+
+// Construct a LAG or LEAD window function, which outputs the value of expr on
+// the tuple offset tuples before (LAG) or after (LEAD) the current one in its
+// partition, or the value of def on the current tuple if there is no such
+// tuple.  def may be nil.
+func NewOffsetWindowFunc(kind WindowFuncType, alias string, expr Expr, offset int, def Expr) (*WindowFunc, error) {
+	if kind != LagFunc && kind != LeadFunc {
+		return nil, GoDBError{IllegalOperationError, "not an offset window function"}
+	}
+	if offset < 0 {
+		return nil, GoDBError{IllegalOperationError, "offset of window function must not be negative"}
+	}
+	if def != nil && def.GetExprType().Ftype != expr.GetExprType().Ftype {
+		return nil, GoDBError{TypeMismatchError, "default value of window function must have the same type as its argument"}
+	}
+	return &WindowFunc{kind: kind, alias: alias, expr: expr, offset: offset, def: def}, nil
+}
+
+// Construct an aggregate window function computing agg over the supplied
+// frame.  The output field is named after the aggregate.
+func NewAggWindowFunc(agg AggState, frame WindowFrame) (*WindowFunc, error) {
+	if err := frame.validate(); err != nil {
+		return nil, err
+	}
+	return &WindowFunc{kind: AggWindowFunc, alias: agg.GetTupleDesc().Fields[0].Fname, agg: agg, frame: frame}, nil
+}
+
+// Return the type of the field output by the function.
+func (w *WindowFunc) getFieldType() FieldType {
+	switch w.kind {
+	case LagFunc, LeadFunc:
+		return FieldType{w.alias, "", w.expr.GetExprType().Ftype}
+	case AggWindowFunc:
+		return FieldType{w.alias, "", w.agg.GetTupleDesc().Fields[0].Ftype}
+	}
+	return FieldType{w.alias, "", IntType}
+}
+
+type Window struct {
+	partitionBy []Expr
+	orderBy     []Expr
+	ascending   []bool
+	funcs       []*WindowFunc
+	child       Operator
+}
+
+// Constructor for a window operator computing funcs over the partitions of
+// child defined by partitionBy, each ordered by orderBy (where ascending[i]
+// gives the direction of orderBy[i]).  Either list may be empty.
+func NewWindow(partitionBy []Expr, orderBy []Expr, ascending []bool, funcs []*WindowFunc, child Operator) (*Window, error) {
+	if len(orderBy) != len(ascending) {
+		return nil, GoDBError{IllegalOperationError, "window order by expressions and directions have different lengths"}
+	}
+	if len(funcs) == 0 {
+		return nil, GoDBError{IllegalOperationError, "window operator requires at least one window function"}
+	}
+	return &Window{partitionBy, orderBy, ascending, funcs, child}, nil
+}
+
+// The window operator outputs the fields of its child, followed by one field
+// for each window function.
+func (w *Window) Descriptor() *TupleDesc {
+	fields := []FieldType{}
+	for _, f := range w.funcs {
+		fields = append(fields, f.getFieldType())
+	}
+	return w.child.Descriptor().merge(&TupleDesc{fields})
+}
+
+func (w *Window) DescribePlan() (*PlanDescription, []Operator) {
+	funcs := make([]string, len(w.funcs))
+	for i, f := range w.funcs {
+		funcs[i] = f.alias
+	}
+	return newPlanDescription("Window", "functions", strings.Join(funcs, ", "), "partition by", describeExprs(w.partitionBy), "order by", describeOrder(w.orderBy, w.ascending)), []Operator{w.child}
+}
+
+// Compare two tuples by the partition by expressions and then by the order by
+// expressions, returning a negative number if t1 sorts first, a positive one if
+// t2 does, and 0 if they are peers.
+func (w *Window) compare(t1, t2 *Tuple) (int, error) {
+	nPart := len(w.partitionBy)
+	for i := 0; i < nPart+len(w.orderBy); i++ {
+		var expr Expr
+		asc := true
+		if i < nPart {
+			expr = w.partitionBy[i]
+		} else {
+			expr, asc = w.orderBy[i-nPart], w.ascending[i-nPart]
+		}
+		state, err := t1.compareField(t2, expr)
+		if err != nil {
+			return 0, err
+		}
+		cmp := 0
+		switch state {
+		case OrderedLessThan:
+			cmp = -1
+		case OrderedGreaterThan:
+			cmp = 1
+		}
+		if !asc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp, nil
+		}
+	}
+	return 0, nil
+}
+
+// Return true if the two tuples belong to the same partition.
+func (w *Window) samePartition(t1, t2 *Tuple) (bool, error) {
+	for _, expr := range w.partitionBy {
+		state, err := t1.compareField(t2, expr)
+		if err != nil || state != OrderedEqual {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Return the zero value of a field of type t, used as the default of LAG and
+// LEAD since GoDB has no NULL.
+func zeroValue(t DBType) DBValue {
+	if t == StringType {
+		return StringField{""}
+	}
+	return IntField{0}
+}
+
+// Return the (inclusive) range of tuples of a partition in the frame of the
+// tuple at position i.  peerStart and peerEnd are the positions of the first
+// and last peers of the tuple.  The frame is empty if start > end.
+func (f WindowFrame) bounds(i, n, peerStart, peerEnd int) (int, int) {
+	var start, end int
+	switch f.start.kind {
+	case UnboundedPreceding:
+		start = 0
+	case OffsetPreceding:
+		start = i - f.start.offset
+	case CurrentRow:
+		start = i
+		if !f.rows {
+			start = peerStart
+		}
+	case OffsetFollowing:
+		start = i + f.start.offset
+	}
+	switch f.end.kind {
+	case OffsetPreceding:
+		end = i - f.end.offset
+	case CurrentRow:
+		end = i
+		if !f.rows {
+			end = peerEnd
+		}
+	case OffsetFollowing:
+		end = i + f.end.offset
+	case UnboundedFollowing:
+		end = n - 1
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > n-1 {
+		end = n - 1
+	}
+	return start, end
+}
+
+// Compute the values of the window function for each tuple of a sorted
+// partition.  peers[i] is the index of the peer group of tuple i, and
+// peerStarts and peerEnds give the positions of the first and last tuple of
+// each peer group.
+func (w *WindowFunc) compute(part []*Tuple, peers []int, peerStarts []int, peerEnds []int) ([]DBValue, error) {
+	vals := make([]DBValue, len(part))
+	switch w.kind {
+	case RowNumberFunc:
+		for i := range part {
+			vals[i] = IntField{int64(i + 1)}
+		}
+	case RankFunc:
+		for i := range part {
+			vals[i] = IntField{int64(peerStarts[peers[i]] + 1)}
+		}
+	case DenseRankFunc:
+		for i := range part {
+			vals[i] = IntField{int64(peers[i] + 1)}
+		}
+	case LagFunc, LeadFunc:
+		for i, t := range part {
+			j := i - w.offset
+			if w.kind == LeadFunc {
+				j = i + w.offset
+			}
+			var err error
+			switch {
+			case j >= 0 && j < len(part):
+				vals[i], err = w.expr.EvalExpr(part[j])
+			case w.def != nil:
+				vals[i], err = w.def.EvalExpr(t)
+			default:
+				vals[i] = zeroValue(w.expr.GetExprType().Ftype)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	case AggWindowFunc:
+		//frames that start at the beginning of the partition only ever grow,
+		//so a single aggregation state can be extended from one tuple to the
+		//next; other frames are aggregated from scratch for each tuple
+		var running AggState
+		added := 0
+		for i := range part {
+			start, end := w.frame.bounds(i, len(part), peerStarts[peers[i]], peerEnds[peers[i]])
+			state := running
+			if w.frame.start.kind != UnboundedPreceding || running == nil {
+				state = w.agg.Copy()
+				added = start
+			}
+			for ; added <= end; added++ {
+				state.AddTuple(part[added])
+			}
+			if w.frame.start.kind == UnboundedPreceding {
+				running = state
+			}
+			vals[i] = state.Finalize().Fields[0]
+		}
+	}
+	return vals, nil
+}
+
+// Window operator implementation.  The first call to the iterator reads and
+// sorts all of the child's tuples; the window functions are then computed one
+// partition at a time as the tuples are output.
+func (w *Window) Iterator(ctx context.Context, tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := w.child.Iterator(ctx, tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := w.Descriptor()
+
+	var tups []*Tuple
+	sorted := false
+	next := 0                  // position of the next tuple to output
+	partStart, partEnd := 0, 0 // positions of the current partition
+	var partVals [][]DBValue   // window function values of each tuple of the partition
+	mem := newMemoryAccount(ctx, "Window")
+	return func() (*Tuple, error) {
+		if !sorted {
+			for {
+				t, err := childIter()
+				if err != nil {
+					mem.release()
+					return nil, err
+				}
+				if t == nil {
+					break
+				}
+				if err := mem.reserve(tupleMemorySize(t)); err != nil {
+					mem.release()
+					return nil, err
+				}
+				tups = append(tups, t)
+			}
+			var sortErr error
+			sort.SliceStable(tups, func(i, j int) bool {
+				cmp, err := w.compare(tups[i], tups[j])
+				if err != nil {
+					sortErr = err
+				}
+				return cmp < 0
+			})
+			if sortErr != nil {
+				mem.release()
+				return nil, sortErr
+			}
+			sorted = true
+		}
+
+		if next == len(tups) {
+			mem.release()
+			return nil, nil
+		}
+		if next == partEnd {
+			partStart = next
+			partEnd = next + 1
+			for partEnd < len(tups) {
+				same, err := w.samePartition(tups[partStart], tups[partEnd])
+				if err != nil {
+					return nil, err
+				}
+				if !same {
+					break
+				}
+				partEnd++
+			}
+			var err error
+			partVals, err = w.computePartition(tups[partStart:partEnd])
+			if err != nil {
+				return nil, err
+			}
+		}
+		t := tups[next]
+		fields := make([]DBValue, 0, len(desc.Fields))
+		fields = append(fields, t.Fields...)
+		fields = append(fields, partVals[next-partStart]...)
+		next++
+		return &Tuple{*desc, fields, t.Rid}, nil
+	}, nil
+}
+
+// Compute the values of all of the window functions for each tuple of a
+// sorted partition.
+func (w *Window) computePartition(part []*Tuple) ([][]DBValue, error) {
+	//group the tuples into runs of peers
+	peers := make([]int, len(part))
+	var peerStarts, peerEnds []int
+	for i := range part {
+		cmp := 1
+		if i > 0 {
+			var err error
+			cmp, err = w.compare(part[i-1], part[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if cmp != 0 {
+			peerStarts = append(peerStarts, i)
+			peerEnds = append(peerEnds, i)
+		}
+		peers[i] = len(peerStarts) - 1
+		peerEnds[peers[i]] = i
+	}
+
+	vals := make([][]DBValue, len(part))
+	for _, f := range w.funcs {
+		fVals, err := f.compute(part, peers, peerStarts, peerEnds)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range fVals {
+			vals[i] = append(vals[i], v)
+		}
+	}
+	return vals, nil
+}
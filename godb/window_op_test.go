@@ -0,0 +1,159 @@
+package godb
+
+import (
+	"context"
+	"testing"
+)
+
+// Make a heap file with the schema of makeTestVars holding the tuples
+// (b, 7), (a, 2), (b, 5), (a, 1), (a, 2)
+func makeWindowTestVars(t *testing.T) (TupleDesc, *HeapFile, TransactionID) {
+	td, _, _, hf, _, tid := makeTestVars()
+	for _, v := range []struct {
+		name string
+		age  int64
+	}{{"b", 7}, {"a", 2}, {"b", 5}, {"a", 1}, {"a", 2}} {
+		tup := Tuple{td, []DBValue{StringField{v.name}, IntField{v.age}}, nil}
+		if err := hf.insertTuple(context.Background(), &tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	return td, hf, tid
+}
+
+// Run a window operator over hf, partitioned by name and ordered by age,
+// returning the ages and the values of the window functions of its output
+func runWindowTest(t *testing.T, td TupleDesc, hf *HeapFile, tid TransactionID, funcs ...*WindowFunc) [][]DBValue {
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+	w, err := NewWindow([]Expr{name}, []Expr{age}, []bool{true}, funcs, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(w.Descriptor().Fields) != len(td.Fields)+len(funcs) {
+		t.Fatalf("expected window descriptor with %d fields, got %d", len(td.Fields)+len(funcs), len(w.Descriptor().Fields))
+	}
+	iter, err := w.Iterator(context.Background(), tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var rows [][]DBValue
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		rows = append(rows, tup.Fields[1:])
+	}
+	return rows
+}
+
+func checkWindowOutput(t *testing.T, rows [][]DBValue, expected [][]int64) {
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d tuples, got %d", len(expected), len(rows))
+	}
+	for i, row := range rows {
+		for j, v := range expected[i] {
+			if row[j].(IntField).Value != v {
+				t.Errorf("row %d: expected %v, got %v", i, expected[i], row)
+				break
+			}
+		}
+	}
+}
+
+func TestWindowRanking(t *testing.T) {
+	td, hf, tid := makeWindowTestVars(t)
+	rowNumber, _ := NewRankingWindowFunc(RowNumberFunc, "row_number")
+	rank, _ := NewRankingWindowFunc(RankFunc, "rank")
+	denseRank, _ := NewRankingWindowFunc(DenseRankFunc, "dense_rank")
+	rows := runWindowTest(t, td, hf, tid, rowNumber, rank, denseRank)
+	//age, row_number, rank, dense_rank
+	checkWindowOutput(t, rows, [][]int64{
+		{1, 1, 1, 1},
+		{2, 2, 2, 2},
+		{2, 3, 2, 2},
+		{5, 1, 1, 1},
+		{7, 2, 2, 2},
+	})
+	if _, err := NewRankingWindowFunc(LagFunc, "lag"); err == nil {
+		t.Errorf("expected error for lag as a ranking function")
+	}
+}
+
+func TestWindowLagLead(t *testing.T) {
+	td, hf, tid := makeWindowTestVars(t)
+	age := &FieldExpr{td.Fields[1]}
+	lag, err := NewOffsetWindowFunc(LagFunc, "lag", age, 1, nil)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	lead, err := NewOffsetWindowFunc(LeadFunc, "lead", age, 2, &ConstExpr{IntField{-1}, IntType})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	rows := runWindowTest(t, td, hf, tid, lag, lead)
+	//age, lag(age), lead(age, 2, -1)
+	checkWindowOutput(t, rows, [][]int64{
+		{1, 0, 2},
+		{2, 1, -1},
+		{2, 2, -1},
+		{5, 0, -1},
+		{7, 5, -1},
+	})
+	_, err = NewOffsetWindowFunc(LagFunc, "lag", age, 1, &ConstExpr{StringField{"none"}, StringType})
+	if err == nil {
+		t.Errorf("expected error for default value of a different type")
+	}
+}
+
+func TestWindowAggFrames(t *testing.T) {
+	td, hf, tid := makeWindowTestVars(t)
+	age := &FieldExpr{td.Fields[1]}
+	frames := []WindowFrame{
+		DefaultWindowFrame,
+		{true, FrameBound{UnboundedPreceding, 0}, FrameBound{CurrentRow, 0}},
+		{true, FrameBound{OffsetPreceding, 1}, FrameBound{OffsetFollowing, 1}},
+		{false, FrameBound{UnboundedPreceding, 0}, FrameBound{UnboundedFollowing, 0}},
+		{true, FrameBound{OffsetFollowing, 1}, FrameBound{UnboundedFollowing, 0}},
+	}
+	var funcs []*WindowFunc
+	for _, frame := range frames {
+		sum := &SumAggState[int64]{}
+		sum.Init("sum", age, intAggGetter)
+		f, err := NewAggWindowFunc(sum, frame)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		funcs = append(funcs, f)
+	}
+	rows := runWindowTest(t, td, hf, tid, funcs...)
+	//age, followed by the sum over each frame; in the default (range)
+	//frame, the two tuples of age 2 are peers
+	checkWindowOutput(t, rows, [][]int64{
+		{1, 1, 1, 3, 5, 4},
+		{2, 5, 3, 5, 5, 2},
+		{2, 5, 5, 4, 5, 0},
+		{5, 5, 5, 12, 12, 7},
+		{7, 12, 12, 12, 12, 0},
+	})
+}
+
+func TestWindowFrameInvalid(t *testing.T) {
+	td, _, _ := makeWindowTestVars(t)
+	frames := []WindowFrame{
+		{true, FrameBound{UnboundedFollowing, 0}, FrameBound{UnboundedFollowing, 0}},
+		{true, FrameBound{CurrentRow, 0}, FrameBound{UnboundedPreceding, 0}},
+		{true, FrameBound{OffsetFollowing, 1}, FrameBound{OffsetPreceding, 1}},
+		{false, FrameBound{OffsetPreceding, 1}, FrameBound{CurrentRow, 0}},
+	}
+	for _, frame := range frames {
+		sum := &SumAggState[int64]{}
+		sum.Init("sum", &FieldExpr{td.Fields[1]}, intAggGetter)
+		if _, err := NewAggWindowFunc(sum, frame); err == nil {
+			t.Errorf("expected error for frame %v", frame)
+		}
+	}
+}
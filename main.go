@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"runtime"
 	"runtime/pprof"
 	"strconv"
 	"strings"
@@ -22,6 +25,7 @@ func check(e error) {
 }
 
 var helpText = `Enter a SQL query terminated by a ; to process it.  Commands prefixed with \ are processed as shell commands.
+Prefix a query with EXPLAIN [ANALYZE] [FORMAT=TEXT|JSON|DOT] to show its plan (after running it, with ANALYZE).
 
 Available shell commands:
 	\h : This help
@@ -54,23 +58,76 @@ func printCatalog(c *godb.Catalog) {
 	fmt.Printf("\033[34m%s\n\033[0m", s)
 }
 
+// Return a context for running a query that is canceled when an interrupt
+// arrives on alarm, and the function to call once the query is done, before
+// its transaction is committed or aborted.  The function cancels the query
+// and waits for the goroutines of its parallel operators to exit, so that
+// none of them requests locks for the transaction once it has ended.  The
+// query may use up to godb.QueryMemoryLimit bytes to buffer tuples.
+func queryContext(alarm chan int) (context.Context, func()) {
+	//forget interrupts that arrived while no query was running
+	select {
+	case <-alarm:
+	default:
+	}
+	ctx := godb.WithMemoryTracker(context.Background(), godb.NewMemoryTracker(godb.QueryMemoryLimit))
+	ctx, wait := godb.WithWorkerGroup(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-alarm:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		wait()
+	}
+}
+
+// Abort the transaction of a query that failed with err, releasing its locks.
+// A query run in a transaction of its own is always aborted; an explicit
+// transaction is aborted only if the query was interrupted or ran out of time,
+// as it may then have stopped partway.  Returns whether the shell is back in
+// autocommit mode.
+func abortFailedQuery(bp *godb.BufferPool, tid godb.TransactionID, autocommit bool, err error) bool {
+	if autocommit {
+		bp.AbortTransaction(tid)
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		bp.AbortTransaction(tid)
+		fmt.Printf("\033[31;1mABORT\033[0m\n\n")
+		return true
+	}
+	return false
+}
+
 func main() {
 	alarm := make(chan int, 1)
 
 	go func() {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 
 		signal.Notify(c, os.Interrupt, syscall.SIGINT)
 		go func() {
 			for {
 				<-c
-				alarm <- 1
+				select {
+				case alarm <- 1:
+				default:
+				}
 				fmt.Println("Interrupted query.")
 			}
 		}()
 
 	}()
 
+	//each query is canceled and its workers waited for once it is done (see
+	//queryContext), so queries can be run in parallel
+	godb.ParallelWorkers = runtime.GOMAXPROCS(0)
+
 	bp := godb.NewBufferPool(10000)
 	/*
 		err := godb.ImportCatalogFromCSVs("tpch-catalog.sql", bp, "godb/tpch-dbgen", "tbl", "|")
@@ -218,14 +275,14 @@ func main() {
 		}
 		query = strings.TrimSpace(query + " " + text[0:len(text)-1])
 
-		explain := false
-		if strings.HasPrefix(strings.ToLower(query), "explain") {
-			queryParts := strings.Split(query, " ")
-			query = strings.Join(queryParts[1:], " ")
-			explain = true
+		explain, sql, isExplain, err := godb.ParseExplain(query)
+		if err != nil {
+			fmt.Printf("\033[31;1mInvalid query (%s)\033[0m\n", err.Error())
+			query = ""
+			continue
 		}
 
-		queryType, plan, err := godb.Parse(c, query)
+		queryType, plan, err := godb.Parse(c, sql)
 		//fmt.Println(query)
 		query = ""
 		nresults := 0
@@ -258,10 +315,31 @@ func main() {
 
 		switch queryType {
 		case godb.IteratorType:
-			if explain {
-				fmt.Printf("\033[32m")
-				godb.PrintPhysicalPlan(plan, "")
-				fmt.Printf("\033[0m\n")
+			if isExplain {
+				if explain.Analyze {
+					if autocommit {
+						tid = godb.NewTID()
+						bp.BeginTransaction(tid)
+					}
+					ctx, finish := queryContext(alarm)
+					plan, err = godb.ExplainAnalyze(ctx, plan, tid)
+					finish()
+					if err != nil {
+						fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+						autocommit = abortFailedQuery(bp, tid, autocommit, err)
+						continue
+					}
+					if autocommit {
+						bp.CommitTransaction(tid)
+					}
+				}
+				if explain.Format == godb.PlanText {
+					fmt.Printf("\033[32m")
+				}
+				godb.WritePlan(os.Stdout, godb.DescribePlan(c, plan), explain.Format)
+				if explain.Format == godb.PlanText {
+					fmt.Printf("\033[0m\n")
+				}
 				break
 			}
 			if autocommit {
@@ -270,16 +348,20 @@ func main() {
 			}
 			start := time.Now()
 
-			iter, err := plan.Iterator(tid)
+			ctx, finish := queryContext(alarm)
+			iter, err := plan.Iterator(ctx, tid)
 			if err != nil {
+				finish()
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				autocommit = abortFailedQuery(bp, tid, autocommit, err)
 				continue
 			}
 
 			fmt.Printf("\033[32;4m%s\033[0m\n", plan.Descriptor().HeaderString(aligned))
 
+			var tup *godb.Tuple
 			for {
-				tup, err := iter()
+				tup, err = iter()
 				if err != nil {
 					fmt.Printf("%s\n", err.Error())
 					break
@@ -290,18 +372,13 @@ func main() {
 					fmt.Printf("\033[32m%s\033[0m\n", tup.PrettyPrintString(aligned))
 				}
 				nresults++
-				select {
-				case <-alarm:
-					fmt.Println("Aborting")
-					goto outer
-				default:
-
-				}
 			}
-			if autocommit {
+			finish()
+			if err != nil {
+				autocommit = abortFailedQuery(bp, tid, autocommit, err)
+			} else if autocommit {
 				bp.CommitTransaction(tid)
 			}
-		outer:
 			fmt.Printf("\033[32;1m(%d results)\033[0m\n", nresults)
 			duration := time.Since(start)
 			fmt.Printf("\033[32;1m%v\033[0m\n\n", duration)